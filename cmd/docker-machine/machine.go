@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"path/filepath"
 
@@ -28,6 +29,7 @@ import (
 	"github.com/docker/machine/libmachine/drivers/plugin"
 	"github.com/docker/machine/libmachine/drivers/plugin/localbinary"
 	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/persist"
 	"github.com/docker/machine/version"
 )
 
@@ -115,7 +117,7 @@ func main() {
 			EnvVar: "MACHINE_STORAGE_PATH",
 			Name:   "storage-path, s",
 			Value:  mcndirs.GetBaseDir(),
-			Usage:  "Configures storage path",
+			Usage:  "Configures storage path, or URL of the store (file://, bolt:// or http(s)://)",
 		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_TLS_CA_CERT",
@@ -141,17 +143,33 @@ func main() {
 			Usage:  "Private key used in client TLS auth",
 			Value:  "",
 		},
-		cli.StringFlag{
+		commands.SecretStringFlag{StringFlag: cli.StringFlag{
 			EnvVar: "MACHINE_GITHUB_API_TOKEN",
 			Name:   "github-api-token",
 			Usage:  "Token to use for requests to the Github API",
 			Value:  "",
-		},
+		}},
 		cli.BoolFlag{
 			EnvVar: "MACHINE_NATIVE_SSH",
 			Name:   "native-ssh",
 			Usage:  "Use the native (Go-based) SSH implementation.",
 		},
+		cli.IntFlag{
+			EnvVar: "MACHINE_LOCK_TIMEOUT",
+			Name:   "lock-timeout",
+			Usage:  "Seconds to wait for a machine locked by another docker-machine process",
+			Value:  int(persist.DefaultLockTimeout / time.Second),
+		},
+		cli.IntFlag{
+			EnvVar: "MACHINE_PARALLEL",
+			Name:   "parallel",
+			Usage:  "Number of machines a command acts on at once, default depends on the driver",
+		},
+		cli.StringFlag{
+			EnvVar: "MACHINE_CREDENTIAL_HELPER",
+			Name:   "credential-helper",
+			Usage:  "Keep the driver credentials of new machines with this docker-credential helper, e.g. osxkeychain, instead of a file in the store",
+		},
 		cli.StringFlag{
 			EnvVar: "MACHINE_BUGSNAG_API_TOKEN",
 			Name:   "bugsnag-api-token",
@@ -3,13 +3,22 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/crashreport"
+	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnerror"
@@ -20,6 +29,7 @@ import (
 
 const (
 	defaultMachineName = "default"
+	defaultParallelism = 10
 )
 
 var (
@@ -30,8 +40,118 @@ var (
 	ErrTooManyArguments   = errors.New("Error: Too many arguments given")
 
 	osExit = func(code int) { os.Exit(code) }
+
+	signalHandlersMu sync.Mutex
+	signalHandlers   = map[chan<- os.Signal][]os.Signal{}
 )
 
+// notifySignals relays Ctrl-C or SIGTERM to c like signal.Notify, for
+// commands which handle them themselves, until the returned function is
+// called. Meanwhile, runCommand doesn't stop the process on them.
+func notifySignals(c chan<- os.Signal, sig ...os.Signal) func() {
+	signalHandlersMu.Lock()
+	signalHandlers[c] = sig
+	signalHandlersMu.Unlock()
+
+	return func() {
+		signalHandlersMu.Lock()
+		delete(signalHandlers, c)
+		signalHandlersMu.Unlock()
+	}
+}
+
+// relaySignal sends sig to the commands handling it, and returns whether
+// any does.
+func relaySignal(sig os.Signal) bool {
+	signalHandlersMu.Lock()
+	defer signalHandlersMu.Unlock()
+
+	handled := false
+	for c, handledSignals := range signalHandlers {
+		for _, s := range handledSignals {
+			if s != sig {
+				continue
+			}
+
+			handled = true
+			select {
+			case c <- sig:
+			default:
+			}
+		}
+	}
+
+	return handled
+}
+
+// exitOnSignals stops the process on Ctrl-C or SIGTERM, when the command
+// doesn't handle them, once closeAPI is called, until the returned function
+// is called.
+func exitOnSignals(closeAPI func()) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if relaySignal(sig) {
+					continue
+				}
+
+				closeAPI()
+				if sig == os.Interrupt {
+					osExit(130)
+				} else {
+					osExit(143)
+				}
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+		})
+	}
+}
+
+// SecretStringFlag is a string flag holding a credential, such as an API
+// token. Its value is redacted from the logs and the machine history.
+type SecretStringFlag struct {
+	cli.StringFlag
+}
+
+// registerSecretFlags makes the logs and the history redact the values of
+// the secret flags of a command line.
+func registerSecretFlags(context *cli.Context) {
+	if context.App != nil {
+		for _, f := range context.App.Flags {
+			if secretFlag, ok := f.(SecretStringFlag); ok {
+				log.RegisterSecret(context.GlobalString(secretFlag.Name))
+			}
+		}
+	}
+
+	for _, f := range context.Command.Flags {
+		if secretFlag, ok := f.(SecretStringFlag); ok {
+			log.RegisterSecret(context.String(secretFlag.Name))
+		}
+	}
+}
+
+// exitCoder is implemented by the errors of commands which exit with a code
+// of their own, such as wait when it times out.
+type exitCoder interface {
+	ExitCode() int
+}
+
 // CommandLine contains all the information passed to the commands on the command line.
 type CommandLine interface {
 	ShowHelp()
@@ -54,6 +174,10 @@ type CommandLine interface {
 
 	GlobalString(name string) string
 
+	GlobalInt(name string) int
+
+	GlobalBool(name string) bool
+
 	FlagNames() (names []string)
 
 	Generic(name string) interface{}
@@ -94,25 +218,56 @@ func targetHost(c CommandLine, api libmachine.API) (string, error) {
 	return c.Args()[0], nil
 }
 
+// targetHosts returns the machines named on the command line, or the
+// 'default' machine if it exists and none is.  This allows short form
+// commands such as 'docker-machine stop' for convenience.
+func targetHosts(c CommandLine, api libmachine.API) ([]string, error) {
+	if len(c.Args()) > 0 {
+		return c.Args(), nil
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{target}, nil
+}
+
 func runAction(actionName string, c CommandLine, api libmachine.API) error {
-	var (
-		hostsToLoad []string
-	)
+	// Commands which report their progress have an --output json flag.
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON); err != nil {
+		return err
+	}
 
-	// If user did not specify a machine name explicitly, use the 'default'
-	// machine if it exists.  This allows short form commands such as
-	// 'docker-machine stop' for convenience.
-	if len(c.Args()) == 0 {
-		target, err := targetHost(c, api)
-		if err != nil {
-			return err
-		}
+	if output == outputJSON {
+		defer useEventLogger(os.Stdout)()
+	}
+
+	results, err := runActionOnTargets(actionName, c, api)
+	if len(results) > 1 && output == "" {
+		printResults(os.Stderr, actionName, results)
+	}
+
+	return err
+}
 
-		hostsToLoad = []string{target}
-	} else {
-		hostsToLoad = c.Args()
+// runActionOnTargets runs a command on the machines given on the command
+// line, under their locks, and returns its results. Nothing is run if any
+// of the machines can't be loaded.
+func runActionOnTargets(actionName string, c CommandLine, api libmachine.API) ([]machineResult, error) {
+	hostsToLoad, err := targetHosts(c, api)
+	if err != nil {
+		return nil, err
 	}
 
+	unlock, err := lockMachines(api, hostsToLoad)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	hosts, hostsInError := persist.LoadHosts(api, hostsToLoad)
 
 	if len(hostsInError) > 0 {
@@ -120,48 +275,110 @@ func runAction(actionName string, c CommandLine, api libmachine.API) error {
 		for _, err := range hostsInError {
 			errs = append(errs, err)
 		}
-		return consolidateErrs(errs)
+		return nil, consolidateErrs(errs)
 	}
 
 	if len(hosts) == 0 {
-		return ErrHostLoad
+		return nil, ErrHostLoad
 	}
 
-	if errs := runActionForeachMachine(actionName, hosts); len(errs) > 0 {
-		return consolidateErrs(errs)
-	}
+	results := runActionForeachMachine(api, actionName, hosts, c.GlobalInt("parallel"))
+
+	// Machines the command failed on are left as they were.
+	_, readOnly := machineValues[actionName]
+	for i, h := range hosts {
+		if results[i].Err != nil {
+			continue
+		}
+
+		if readOnly {
+			touchHost(api, h)
+			continue
+		}
 
-	for _, h := range hosts {
+		h.Touch()
 		if err := api.Save(h); err != nil {
-			return fmt.Errorf("Error saving host to store: %s", err)
+			return results, fmt.Errorf("Error saving host to store: %s", err)
 		}
 	}
 
-	return nil
+	return results, resultsErr(actionName, results)
+}
+
+// touchHost records that a machine was used by a command which otherwise
+// doesn't change it, if the store supports it. Failing to is not worth
+// failing the command for.
+func touchHost(api libmachine.API, h *host.Host) {
+	h.Touch()
+
+	toucher, ok := storeOf(api).(persist.Toucher)
+	if !ok {
+		return
+	}
+
+	if err := toucher.Touch(h.Name); err != nil {
+		log.Debugf("Error saving the last use of %s: %s", h.Name, err)
+	}
 }
 
 func runCommand(command func(commandLine CommandLine, api libmachine.API) error) func(context *cli.Context) {
 	return func(context *cli.Context) {
-		api := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
-		defer api.Close()
+		registerSecretFlags(context)
 
-		if context.GlobalBool("native-ssh") {
-			api.SSHClientType = ssh.Native
+		store, err := persist.NewStore(context.GlobalString("storage-path"), persist.Options{
+			LockTimeout:      time.Duration(context.GlobalInt("lock-timeout")) * time.Second,
+			LockCommand:      context.Command.Name,
+			Passphrase:       storePassphrase,
+			CredentialHelper: context.GlobalString("credential-helper"),
+		})
+		if err != nil {
+			log.Error(err)
+			osExit(1)
+			return
 		}
-		api.GithubAPIToken = context.GlobalString("github-api-token")
-		api.Filestore.Path = context.GlobalString("storage-path")
 
 		// TODO (nathanleclaire): These should ultimately be accessed
 		// through the libmachine client by the rest of the code and
 		// not through their respective modules.  For now, however,
 		// they are also being set the way that they originally were
 		// set to preserve backwards compatibility.
-		mcndirs.BaseDir = api.Filestore.Path
+		//
+		// Remote stores mirror their machines in a local directory, which
+		// is where drivers and certificates have to live.
+		if localStore, ok := store.(persist.LocalStore); ok {
+			mcndirs.BaseDir = filepath.Dir(localStore.GetMachinesDir())
+		}
+
+		api := libmachine.NewClientWithStore(store, mcndirs.GetMachineCertDir())
+
+		// The store seals the keys decrypted for the command on close,
+		// which deferred calls don't get to do before osExit.
+		var closeOnce sync.Once
+		closeAPI := func() {
+			closeOnce.Do(func() { api.Close() })
+		}
+		defer closeAPI()
+
+		stopExitOnSignals := exitOnSignals(closeAPI)
+		defer stopExitOnSignals()
+
+		if context.GlobalBool("native-ssh") {
+			api.SSHClientType = ssh.Native
+		}
+		api.GithubAPIToken = context.GlobalString("github-api-token")
+
 		mcnutils.GithubAPIToken = api.GithubAPIToken
 		ssh.SetDefaultClient(api.SSHClientType)
 
-		if err := command(&contextCommandLine{context}, api); err != nil {
+		// The commands run on a machine share an SSH connection to it.
+		closeConnections := ssh.PoolConnections()
+		err = command(&contextCommandLine{context}, api)
+		closeConnections()
+
+		if err != nil {
 			log.Error(err)
+			stopExitOnSignals()
+			closeAPI()
 
 			if crashErr, ok := err.(crashreport.CrashError); ok {
 				crashReporter := crashreport.NewCrashReporter(mcndirs.GetBaseDir(), context.GlobalString("bugsnag-api-token"))
@@ -173,12 +390,73 @@ func runCommand(command func(commandLine CommandLine, api libmachine.API) error)
 				}
 			}
 
+			if coder, ok := err.(exitCoder); ok {
+				osExit(coder.ExitCode())
+				return
+			}
+
 			osExit(1)
 			return
 		}
 	}
 }
 
+// storeOf returns the store behind api, which optional store features such
+// as locking are detected on.
+func storeOf(api libmachine.API) persist.Store {
+	if client, ok := api.(*libmachine.Client); ok {
+		return client.Store
+	}
+	return api
+}
+
+// lockStore takes the store-wide lock if the store supports locking. It
+// must be taken before any machine lock.
+func lockStore(api libmachine.API) (func(), error) {
+	locker, ok := storeOf(api).(persist.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	lock, err := locker.LockStore()
+	if err != nil {
+		return nil, err
+	}
+
+	return func() { lock.Unlock() }, nil
+}
+
+// lockMachines takes the locks of the given machines if the store supports
+// locking. Locks are always taken in the same order so that two commands
+// working on overlapping sets of machines cannot deadlock.
+func lockMachines(api libmachine.API, names []string) (func(), error) {
+	locker, ok := storeOf(api).(persist.Locker)
+	if !ok {
+		return func() {}, nil
+	}
+
+	sortedNames := append([]string{}, names...)
+	sort.Strings(sortedNames)
+
+	locks := []*persist.Lock{}
+	unlock := func() {
+		for i := len(locks) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+		}
+	}
+
+	for _, name := range sortedNames {
+		lock, err := locker.LockMachine(name)
+		if err != nil {
+			unlock()
+			return nil, err
+		}
+		locks = append(locks, lock)
+	}
+
+	return unlock, nil
+}
+
 func confirmInput(msg string) (bool, error) {
 	fmt.Printf("%s (y/n): ", msg)
 
@@ -215,6 +493,34 @@ var Commands = []cli.Command{
 				Name:  "swarm",
 				Usage: "Display the Swarm config instead of the Docker daemon",
 			},
+			outputFlag,
+		},
+	},
+	{
+		Name:  "context",
+		Usage: "Manage the Docker contexts of machines",
+		Subcommands: []cli.Command{
+			{
+				Name:        "sync",
+				Usage:       "Create or update a Docker context named machine-<name> for each machine, and remove the contexts of removed machines",
+				Description: "Contexts are named after their machine. Contexts which weren't created by sync are left alone.",
+				Action:      runCommand(cmdContextSync),
+				Flags: []cli.Flag{
+					cli.StringSliceFlag{
+						Name:  "filter",
+						Usage: "Filter the machines to sync the contexts of, as with ls",
+						Value: &cli.StringSlice{},
+					},
+					cli.StringFlag{
+						Name:  "use",
+						Usage: "Make the context of this machine the current Docker context",
+					},
+					cli.BoolFlag{
+						Name:  "swarm",
+						Usage: "Point the contexts to the Swarm masters instead of the Docker daemons",
+					},
+				},
+			},
 		},
 	},
 	{
@@ -247,6 +553,95 @@ var Commands = []cli.Command{
 				Name:  "no-proxy",
 				Usage: "Add machine IP to NO_PROXY environment variable",
 			},
+			cli.BoolFlag{
+				Name:  "ssh",
+				Usage: "Connect to the Docker daemon over SSH instead of TLS, the SSH key of the machine is added to the SSH agent",
+			},
+		},
+	},
+	{
+		Name:   "events",
+		Usage:  "Watch machines and print their changes of state, URL, IP, Docker reachability and certificates",
+		Action: runCommand(cmdEvents),
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "filter",
+				Usage: "Filter the machines to watch, as with ls",
+				Value: &cli.StringSlice{},
+			},
+			cli.IntFlag{
+				Name:  "interval",
+				Usage: "Seconds between the polls of a machine",
+				Value: eventsDefaultInterval,
+			},
+			cli.IntFlag{
+				Name:  "max-interval",
+				Usage: "Seconds the interval backs off to while a machine can't be polled",
+				Value: eventsDefaultMaxInterval,
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Print the events as json lines",
+			},
+		},
+	},
+	{
+		Name:        "exec",
+		Usage:       "Run a command with SSH on several machines at once",
+		Description: "Arguments are the command to run, after --.",
+		Action:      runCommand(cmdExec),
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "filter",
+				Usage: "Filter the machines to run the command on, as with ls",
+				Value: &cli.StringSlice{},
+			},
+			cli.BoolFlag{
+				Name:  "fail-fast",
+				Usage: "Don't run the command on the remaining machines once it failed on one",
+			},
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "Print the summary as json or yaml, the output of the machines then goes to stderr",
+			},
+		},
+	},
+	{
+		Name:        "export",
+		Usage:       "Export a machine to a portable bundle",
+		Description: "Argument is a machine name.",
+		Action:      runCommand(cmdExport),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "output, o",
+				Usage: "File to write the bundle to, default is <machine>.tar.gz",
+			},
+			cli.BoolFlag{
+				Name:  "certs",
+				Usage: "Include the CA and client certificates in the bundle",
+			},
+		},
+	},
+	{
+		Name:        "history",
+		Usage:       "Show the operations run against a machine",
+		Description: "Argument is a machine name.",
+		Action:      runCommand(cmdHistory),
+	},
+	{
+		Name:        "import",
+		Usage:       "Import a machine from a bundle",
+		Description: "Argument is the path of a bundle created with export.",
+		Action:      runCommand(cmdImport),
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "force, f",
+				Usage: "Overwrite an existing machine with the same name",
+			},
+			cli.BoolFlag{
+				Name:  "regenerate-certs",
+				Usage: "Regenerate the machine's certificates with the local CA, required for bundles exported without --certs",
+			},
 		},
 	},
 	{
@@ -267,6 +662,9 @@ var Commands = []cli.Command{
 		Usage:       "Get the IP address of a machine",
 		Description: "Argument(s) are one or more machine names.",
 		Action:      runCommand(cmdIP),
+		Flags: []cli.Flag{
+			outputFlag,
+		},
 	},
 	{
 		Name:        "kill",
@@ -297,12 +695,26 @@ var Commands = []cli.Command{
 				Name:  "format, f",
 				Usage: "Pretty-print machines using a Go template",
 			},
+			cli.StringFlag{
+				Name:  "sort",
+				Usage: "Sort machines by name, driver, created, last-used or tag:<key>, prefix with - to reverse the order",
+			},
+			outputFlag,
 		},
 	},
+	{
+		Name:        "mv",
+		Usage:       "Rename a machine",
+		Description: "Arguments are the current and the new name of the machine.",
+		Action:      runCommand(cmdMv),
+	},
 	{
 		Name:   "provision",
 		Usage:  "Re-provision existing machines",
 		Action: runCommand(cmdProvision),
+		Flags: []cli.Flag{
+			progressFlag,
+		},
 	},
 	{
 		Name:        "regenerate-certs",
@@ -349,6 +761,18 @@ var Commands = []cli.Command{
 		Action:          runCommand(cmdSSH),
 		SkipFlagParsing: true,
 	},
+	{
+		Name:        "ssh-keyscan",
+		Usage:       "Check the SSH host key of a machine against the pinned one",
+		Description: "Argument is a machine name.",
+		Action:      runCommand(cmdSSHKeyscan),
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "update",
+				Usage: "Pin the key the machine presents, after it was rebuilt",
+			},
+		},
+	},
 	{
 		Name:        "scp",
 		Usage:       "Copy files between machines",
@@ -361,7 +785,7 @@ var Commands = []cli.Command{
 			},
 			cli.BoolFlag{
 				Name:  "delta, d",
-				Usage: "Reduce amount of data sent over network by sending only the differences (uses rsync)",
+				Usage: "Reduce amount of data sent over network by sending only the differences (uses rsync, or SFTP with the native SSH client)",
 			},
 			cli.BoolFlag{
 				Name:  "quiet, q",
@@ -369,16 +793,109 @@ var Commands = []cli.Command{
 			},
 		},
 	},
+	{
+		Name:        "sync",
+		Usage:       "Sync a local directory to a machine",
+		Description: "Arguments are [local directory] [[user@]machine:][path]. Paths matching the patterns of the .dockerignore file of the local directory aren't synced.",
+		Action:      runCommand(cmdSync),
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "watch, w",
+				Usage: "Keep pushing the local changes until interrupted, reconnecting when the connection to the machine is lost",
+			},
+			cli.IntFlag{
+				Name:  "interval",
+				Usage: "Seconds between pushes of the local changes while watching",
+				Value: syncDefaultInterval,
+			},
+			cli.BoolFlag{
+				Name:  "poll",
+				Usage: "Poll the local directory for changes while watching instead of relying on file change notifications, which are missed on network file systems",
+			},
+			cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "Exclude the paths matching a pattern, as in .dockerignore",
+				Value: &cli.StringSlice{},
+			},
+		},
+	},
 	{
 		Name:        "mount",
 		Usage:       "Mount or unmount a directory from a machine with SSHFS.",
-		Description: "Arguments are [machine:][path] [mountpoint]",
+		Description: "Arguments are [machine:][path] [mountpoint], or with --reverse, [local directory] [machine:][path]. Run 'mount --list' to list the local directories mounted into machines.",
 		Action:      runCommand(cmdMount),
 		Flags: []cli.Flag{
 			cli.BoolFlag{
 				Name:  "unmount, u",
 				Usage: "Unmount instead of mount",
 			},
+			cli.BoolFlag{
+				Name:  "reverse",
+				Usage: "Mount a local directory into the machine instead, served over SSH to SSHFS on the machine by a background process",
+			},
+			cli.BoolFlag{
+				Name:  "foreground",
+				Usage: "Serve a reverse mount in the foreground until interrupted, instead of in the background",
+			},
+			cli.BoolFlag{
+				Name:  "list",
+				Usage: "List the local directories mounted into machines",
+			},
+		},
+	},
+	{
+		Name:  "store",
+		Usage: "Manage the machine store",
+		Subcommands: []cli.Command{
+			{
+				Name:        "fsck",
+				Usage:       "Check the configuration of machines and repair broken ones",
+				Description: "Argument(s) are one or more machine names, all machines are checked if none are given.",
+				Action:      runCommand(cmdStoreFsck),
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "repair",
+						Usage: "Roll machines with an unreadable config back to their last valid revision",
+					},
+				},
+			},
+			{
+				Name:        "encrypt",
+				Usage:       "Encrypt the private keys and driver credentials of the store",
+				Description: "The store is then unlocked with the key file in MACHINE_STORE_KEY_FILE, the passphrase in MACHINE_STORE_PASSPHRASE, or a passphrase prompt. Run it again to encrypt keys left unencrypted by an interrupted command.",
+				Action:      runCommand(cmdStoreEncrypt),
+			},
+			{
+				Name:   "decrypt",
+				Usage:  "Store the private keys and driver credentials of an encrypted store in plaintext again",
+				Action: runCommand(cmdStoreDecrypt),
+			},
+			{
+				Name:        "serve",
+				Usage:       "Serve a store to other docker-machine clients over HTTP",
+				Description: "Argument is the path of the database file to serve. Clients use it with --storage-path https://<host>:<port>. Addresses other than loopback ones require --tls-cert, --tls-key and --auth.",
+				Action:      runCommand(cmdStoreServe),
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "listen",
+						Usage: "Address to listen on",
+						Value: "127.0.0.1:2380",
+					},
+					cli.StringFlag{
+						Name:  "tls-cert",
+						Usage: "Serve over TLS with this certificate",
+					},
+					cli.StringFlag{
+						Name:  "tls-key",
+						Usage: "Private key of the TLS certificate",
+					},
+					SecretStringFlag{StringFlag: cli.StringFlag{
+						Name:   "auth",
+						Usage:  "Require clients to authenticate with user:password",
+						EnvVar: "MACHINE_STORE_AUTH",
+					}},
+				},
+			},
 		},
 	},
 	{
@@ -386,18 +903,54 @@ var Commands = []cli.Command{
 		Usage:       "Start a machine",
 		Description: "Argument(s) are one or more machine names.",
 		Action:      runCommand(cmdStart),
+		Flags: []cli.Flag{
+			progressFlag,
+		},
 	},
 	{
 		Name:        "status",
 		Usage:       "Get the status of a machine",
 		Description: "Argument is a machine name.",
 		Action:      runCommand(cmdStatus),
+		Flags: []cli.Flag{
+			outputFlag,
+		},
 	},
 	{
 		Name:        "stop",
 		Usage:       "Stop a machine",
 		Description: "Argument(s) are one or more machine names.",
 		Action:      runCommand(cmdStop),
+		Flags: []cli.Flag{
+			progressFlag,
+		},
+	},
+	{
+		Name:        "tag",
+		Usage:       "Show, set or remove the tags of a machine",
+		Description: "Arguments are a machine name and tags in the form key=value to set them, or key- to remove them.",
+		Action:      runCommand(cmdTag),
+	},
+	{
+		Name:        "tunnel",
+		Usage:       "Forward a local socket or port to the Docker socket or a port of a machine over SSH",
+		Description: "Argument is a machine name. The tunnel reconnects when the SSH connection is lost, until it's interrupted.",
+		Action:      runCommand(cmdTunnel),
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "socket",
+				Usage: "Local unix socket to listen on, default is docker.sock in the machine directory",
+			},
+			cli.StringFlag{
+				Name:  "local",
+				Usage: "Local TCP address to listen on instead of a unix socket, such as localhost:2375",
+			},
+			cli.StringFlag{
+				Name:  "remote",
+				Usage: "Socket path, port or host:port to forward to, as seen from the machine",
+				Value: tunnelDefaultRemote,
+			},
+		},
 	},
 	{
 		Name:        "upgrade",
@@ -410,30 +963,58 @@ var Commands = []cli.Command{
 		Usage:       "Get the URL of a machine",
 		Description: "Argument is a machine name.",
 		Action:      runCommand(cmdURL),
+		Flags: []cli.Flag{
+			outputFlag,
+		},
 	},
 	{
 		Name:   "version",
 		Usage:  "Show the Docker Machine version or a machine docker version",
 		Action: runCommand(cmdVersion),
+		Flags: []cli.Flag{
+			outputFlag,
+		},
+	},
+	{
+		Name:        "wait",
+		Usage:       "Wait for machines to be ready",
+		Description: "Argument(s) are one or more machine names.",
+		Action:      runCommand(cmdWait),
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{
+				Name:  "for",
+				Usage: "Condition to wait for: state=<state>, ssh, docker or swarm, conditions are waited for in order",
+				Value: &cli.StringSlice{},
+			},
+			cli.StringFlag{
+				Name:  "timeout",
+				Usage: "How long to wait for, such as 30s or 5m",
+				Value: waitDefaultTimeout,
+			},
+		},
 	},
 }
 
-func printIP(h *host.Host) func() error {
-	return func() error {
-		ip, err := h.Driver.GetIP()
-		if err != nil {
-			return fmt.Errorf("Error getting IP address: %s", err)
-		}
+func getIP(h *host.Host) (string, error) {
+	ip, err := h.Driver.GetIP()
+	if err != nil {
+		return "", fmt.Errorf("Error getting IP address: %s", err)
+	}
 
-		fmt.Println(ip)
+	return ip, nil
+}
 
-		return nil
-	}
+// machineValues are the machine commands which get a value of the machine
+// rather than change it. The values are returned in the results, to be
+// printed in the order of the machines.
+var machineValues = map[string]func(h *host.Host) (string, error){
+	"ip": getIP,
 }
 
-// machineCommand maps the command name to the corresponding machine command.
-// We run commands concurrently and communicate back an error if there was one.
-func machineCommand(actionName string, host *host.Host, errorChan chan<- error) {
+// machineCommand maps the command name to the corresponding machine command
+// and runs it. Commands are recorded in the history of the machine. The
+// value the command gets, if any, is returned.
+func machineCommand(api libmachine.API, actionName string, host *host.Host) (string, error) {
 	// TODO: These actions should have their own type.
 	commands := map[string](func() error){
 		"configureAuth":    host.ConfigureAuth,
@@ -443,40 +1024,152 @@ func machineCommand(actionName string, host *host.Host, errorChan chan<- error)
 		"restart":          host.Restart,
 		"kill":             host.Kill,
 		"upgrade":          host.Upgrade,
-		"ip":               printIP(host),
 		"provision":        host.Provision,
 	}
 
+	var value string
+	if getValue, ok := machineValues[actionName]; ok {
+		commands[actionName] = func() (err error) {
+			value, err = getValue(host)
+			return err
+		}
+	}
+
 	log.Debugf("command=%s machine=%s", actionName, host.Name)
 
-	errorChan <- commands[actionName]()
+	start := time.Now()
+	err := commands[actionName]()
+	persist.RecordHistory(storeOf(api), host.Name, actionName, start, err)
+
+	return value, err
 }
 
-// runActionForeachMachine will run the command across multiple machines
-func runActionForeachMachine(actionName string, machines []*host.Host) []error {
+// machineResult is the outcome of a command on one machine.
+type machineResult struct {
+	Name     string
+	Value    string
+	Err      error
+	Duration time.Duration
+}
+
+// driverParallelism returns how many machines of the driver of machine are
+// acted on at once when --parallel isn't given.
+func driverParallelism(machine *host.Host) int {
+	if limiter, ok := machine.Driver.(drivers.ParallelismLimiter); ok {
+		if parallelism := limiter.MaxParallelism(); parallelism > 0 {
+			return parallelism
+		}
+	}
+	return defaultParallelism
+}
+
+// machineSemaphores returns the semaphore bounding how many machines are
+// acted on at once, for each machine: one for all of them if parallel is
+// given, one per driver with the limit of the driver otherwise.
+func machineSemaphores(machines []*host.Host, parallel int) []chan struct{} {
 	var (
-		numConcurrentActions = 0
-		errorChan            = make(chan error)
-		errs                 = []error{}
+		semaphores = make([]chan struct{}, len(machines))
+		byDriver   = map[string]chan struct{}{}
 	)
 
-	for _, machine := range machines {
-		numConcurrentActions++
-		go machineCommand(actionName, machine, errorChan)
+	for i, machine := range machines {
+		key := machine.DriverName
+		if parallel > 0 {
+			key = ""
+		}
+
+		semaphore, ok := byDriver[key]
+		if !ok {
+			limit := parallel
+			if limit <= 0 {
+				limit = driverParallelism(machine)
+			}
+			semaphore = make(chan struct{}, limit)
+			byDriver[key] = semaphore
+		}
+
+		semaphores[i] = semaphore
 	}
 
-	// TODO: We should probably only do 5-10 of these
-	// at a time, since otherwise cloud providers might
-	// rate limit us.
-	for i := 0; i < numConcurrentActions; i++ {
-		if err := <-errorChan; err != nil {
-			errs = append(errs, err)
+	return semaphores
+}
+
+// runActionForeachMachine will run the command across multiple machines,
+// at most parallel at a time, or as many as their drivers allow if parallel
+// is 0. Results are in the order of machines.
+func runActionForeachMachine(api libmachine.API, actionName string, machines []*host.Host, parallel int) []machineResult {
+	var (
+		results    = make([]machineResult, len(machines))
+		semaphores = machineSemaphores(machines, parallel)
+		wg         sync.WaitGroup
+	)
+
+	for i, machine := range machines {
+		wg.Add(1)
+		go func(i int, machine *host.Host, semaphore chan struct{}) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			value, err := machineCommand(api, actionName, machine)
+			log.Done(machine.Name, err)
+
+			results[i] = machineResult{
+				Name:     machine.Name,
+				Value:    value,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, machine, semaphores[i])
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// printResults prints the outcome of a command on each machine, followed by
+// a count of successes and failures. It goes to stderr, along with the
+// errors, so that the output of commands such as ip can still be piped.
+func printResults(w io.Writer, actionName string, results []machineResult) {
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+
+	failed := 0
+	fmt.Fprintln(tw, "MACHINE\tRESULT\tDURATION\tERROR")
+	for _, result := range results {
+		status, message := "ok", ""
+		if result.Err != nil {
+			failed++
+			status, message = "failed", strings.Replace(result.Err.Error(), "\n", " ", -1)
 		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.Name, status, result.Duration.Round(time.Millisecond), message)
 	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "%s: %d succeeded, %d failed\n", actionName, len(results)-failed, failed)
+}
 
-	close(errorChan)
+// resultsErr returns the error of a command run on machines. The error of a
+// single machine is returned as is, the ones of several machines are in
+// their results.
+func resultsErr(actionName string, results []machineResult) error {
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+		}
+	}
 
-	return errs
+	switch {
+	case failed == 0:
+		return nil
+	case len(results) == 1:
+		return results[0].Err
+	default:
+		return fmt.Errorf("Error: %s failed on %d of %d machines", actionName, failed, len(results))
+	}
 }
 
 func consolidateErrs(errs []error) error {
@@ -1,17 +1,25 @@
 package commands
 
 import (
+	"bytes"
 	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/codegangsta/cli"
-	"github.com/docker/machine/commands/commandstest"
 	"github.com/docker/machine/drivers/fakedriver"
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/crashreport"
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnerror"
 	"github.com/docker/machine/libmachine/provision"
 	"github.com/docker/machine/libmachine/state"
@@ -75,7 +83,7 @@ func TestRunActionForeachMachine(t *testing.T) {
 		},
 	}
 
-	runActionForeachMachine("start", machines)
+	runActionForeachMachine(&libmachinetest.FakeAPI{}, "start", machines, 0)
 
 	for _, machine := range machines {
 		machineState, _ := machine.Driver.GetState()
@@ -83,7 +91,7 @@ func TestRunActionForeachMachine(t *testing.T) {
 		assert.Equal(t, state.Running, machineState)
 	}
 
-	runActionForeachMachine("stop", machines)
+	runActionForeachMachine(&libmachinetest.FakeAPI{}, "stop", machines, 0)
 
 	for _, machine := range machines {
 		machineState, _ := machine.Driver.GetState()
@@ -92,30 +100,163 @@ func TestRunActionForeachMachine(t *testing.T) {
 	}
 }
 
-func TestPrintIPEmptyGivenLocalEngine(t *testing.T) {
-	stdoutGetter := commandstest.NewStdoutGetter()
-	defer stdoutGetter.Stop()
+// slowDriver takes a while to be killed and keeps track of how many of its
+// machines are being killed at once.
+// killBarrier holds the kills of machines until as many as expected run at
+// once, or all the others are done, so that tests see the parallelism of
+// commands without relying on timing.
+type killBarrier struct {
+	cond              *sync.Cond
+	expected, pending int
+	active, maxActive int
+}
+
+func newKillBarrier(expected, count int) *killBarrier {
+	return &killBarrier{
+		cond:     sync.NewCond(&sync.Mutex{}),
+		expected: expected,
+		pending:  count,
+	}
+}
+
+func (b *killBarrier) enter() {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	b.pending--
+	b.active++
+	if b.active > b.maxActive {
+		b.maxActive = b.active
+	}
+	b.cond.Broadcast()
+
+	for b.active < b.expected && b.pending > 0 {
+		b.cond.Wait()
+	}
+}
+
+func (b *killBarrier) leave() {
+	b.cond.L.Lock()
+	defer b.cond.L.Unlock()
+
+	b.active--
+}
+
+type barrierDriver struct {
+	*fakedriver.Driver
+	barrier     *killBarrier
+	parallelism int
+}
+
+func (d *barrierDriver) Kill() error {
+	d.barrier.enter()
+	defer d.barrier.leave()
+
+	return d.Driver.Kill()
+}
+
+func (d *barrierDriver) MaxParallelism() int {
+	return d.parallelism
+}
+
+func barrierMachines(driverName string, count, parallelism int, barrier *killBarrier) []*host.Host {
+	machines := []*host.Host{}
+	for i := 0; i < count; i++ {
+		machines = append(machines, &host.Host{
+			Name:       fmt.Sprintf("%s-%d", driverName, i),
+			DriverName: driverName,
+			Driver: &barrierDriver{
+				Driver:      &fakedriver.Driver{MockState: state.Running},
+				barrier:     barrier,
+				parallelism: parallelism,
+			},
+		})
+	}
+	return machines
+}
+
+func TestRunActionForeachMachineParallel(t *testing.T) {
+	// The stopped machine is not killed.
+	barrier := newKillBarrier(2, 5)
+	machines := barrierMachines("none", 6, 0, barrier)
+	machines[3].Driver.(*barrierDriver).MockState = state.Stopped
+
+	results := runActionForeachMachine(&libmachinetest.FakeAPI{}, "kill", machines, 2)
+
+	assert.Equal(t, 2, barrier.maxActive)
+	assert.Len(t, results, 6)
+	for i, result := range results {
+		assert.Equal(t, machines[i].Name, result.Name)
+		if i == 3 {
+			assert.Error(t, result.Err)
+		} else {
+			assert.NoError(t, result.Err)
+		}
+	}
+
+	assert.EqualError(t, resultsErr("kill", results), "Error: kill failed on 1 of 6 machines")
+	assert.Equal(t, results[3].Err, resultsErr("kill", results[3:4]))
+	assert.NoError(t, resultsErr("kill", results[:3]))
+}
+
+func TestRunActionForeachMachineDriverParallelism(t *testing.T) {
+	barrier := newKillBarrier(2, 5)
+	machines := barrierMachines("virtualbox", 5, 2, barrier)
+
+	runActionForeachMachine(&libmachinetest.FakeAPI{}, "kill", machines, 0)
+
+	assert.Equal(t, 2, barrier.maxActive)
+}
+
+func TestMachineSemaphores(t *testing.T) {
+	machines := append(barrierMachines("virtualbox", 2, 2, nil), barrierMachines("none", 2, 0, nil)...)
+
+	semaphores := machineSemaphores(machines, 0)
+	assert.True(t, semaphores[0] == semaphores[1])
+	assert.True(t, semaphores[1] != semaphores[2])
+	assert.Equal(t, 2, cap(semaphores[0]))
+	assert.Equal(t, defaultParallelism, cap(semaphores[2]))
 
+	semaphores = machineSemaphores(machines, 3)
+	assert.True(t, semaphores[0] == semaphores[3])
+	assert.Equal(t, 3, cap(semaphores[0]))
+}
+
+func TestPrintResults(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	printResults(buf, "stop", []machineResult{
+		{Name: "foo", Duration: 1500 * time.Millisecond},
+		{Name: "bar", Err: errors.New("unable to stop\ntimeout")},
+	})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "MACHINE")
+	assert.Contains(t, lines[1], "foo")
+	assert.Contains(t, lines[1], "1.5s")
+	assert.Contains(t, lines[2], "unable to stop timeout")
+	assert.Equal(t, "stop: 1 succeeded, 1 failed", lines[3])
+}
+
+func TestGetIPEmptyGivenLocalEngine(t *testing.T) {
 	host, _ := hosttest.GetDefaultTestHost()
-	err := printIP(host)()
+	ip, err := getIP(host)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "\n", stdoutGetter.Output())
+	assert.Equal(t, "", ip)
 }
 
-func TestPrintIPPrintsGivenRemoteEngine(t *testing.T) {
-	stdoutGetter := commandstest.NewStdoutGetter()
-	defer stdoutGetter.Stop()
-
+func TestGetIPGivenRemoteEngine(t *testing.T) {
 	host, _ := hosttest.GetDefaultTestHost()
 	host.Driver = &fakedriver.Driver{
 		MockState: state.Running,
 		MockIP:    "1.2.3.4",
 	}
-	err := printIP(host)()
+	ip, err := getIP(host)
 
 	assert.NoError(t, err)
-	assert.Equal(t, "1.2.3.4\n", stdoutGetter.Output())
+	assert.Equal(t, "1.2.3.4", ip)
 }
 
 func TestConsolidateError(t *testing.T) {
@@ -241,3 +382,86 @@ func checkErrorCodeForCommand(command func(commandLine CommandLine, api libmachi
 
 	return setExitCode
 }
+
+func TestNotifySignals(t *testing.T) {
+	interrupt := make(chan os.Signal, 1)
+	stop := notifySignals(interrupt, os.Interrupt)
+
+	assert.False(t, relaySignal(syscall.SIGTERM))
+	assert.True(t, relaySignal(os.Interrupt))
+	assert.Equal(t, os.Interrupt, <-interrupt)
+
+	// Signals are dropped rather than blocking on busy commands.
+	assert.True(t, relaySignal(os.Interrupt))
+	assert.True(t, relaySignal(os.Interrupt))
+
+	stop()
+	assert.False(t, relaySignal(os.Interrupt))
+}
+
+func TestExitOnSignals(t *testing.T) {
+	defer func(fnOsExit func(code int)) { osExit = fnOsExit }(osExit)
+
+	exited := make(chan int, 1)
+	osExit = func(code int) { exited <- code }
+
+	var closed bool
+	stop := exitOnSignals(func() { closed = true })
+	defer stop()
+
+	process, _ := os.FindProcess(os.Getpid())
+
+	// Signals handled by the command are left to it.
+	interrupt := make(chan os.Signal, 1)
+	stopNotify := notifySignals(interrupt, os.Interrupt)
+	if err := process.Signal(os.Interrupt); err != nil {
+		stopNotify()
+		t.Skip("Interrupts can't be sent on this platform")
+	}
+	<-interrupt
+	stopNotify()
+
+	select {
+	case <-exited:
+		t.Fatal("Exited on a handled interrupt")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, process.Signal(os.Interrupt))
+
+	select {
+	case code := <-exited:
+		assert.Equal(t, 130, code)
+		assert.True(t, closed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Didn't exit on interrupt")
+	}
+}
+
+func TestRegisterSecretFlags(t *testing.T) {
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		SecretStringFlag{StringFlag: cli.StringFlag{Name: "api-token"}},
+	}
+	globalSet := flag.NewFlagSet("docker-machine", flag.ContinueOnError)
+	globalSet.String("api-token", "gl0bal-t0k3n", "")
+
+	command := cli.Command{
+		Flags: []cli.Flag{
+			SecretStringFlag{StringFlag: cli.StringFlag{Name: "auth"}},
+			cli.StringFlag{Name: "listen"},
+		},
+	}
+	commandSet := flag.NewFlagSet("serve", flag.ContinueOnError)
+	commandSet.String("auth", "user:passw0rd", "")
+	commandSet.String("listen", "127.0.0.1:2380", "")
+
+	context := cli.NewContext(app, commandSet, cli.NewContext(app, globalSet, nil))
+	context.Command = command
+
+	registerSecretFlags(context)
+
+	assert.Equal(t,
+		[]string{"--api-token=<REDACTED>", "serve", "--auth", "<REDACTED>", "--listen", "127.0.0.1:2380"},
+		log.StripSecrets([]string{"--api-token=gl0bal-t0k3n", "serve", "--auth", "user:passw0rd", "--listen", "127.0.0.1:2380"}))
+}
@@ -48,6 +48,9 @@ func (fcli *FakeCommandLine) IsSet(key string) bool {
 }
 
 func (fcli *FakeCommandLine) String(key string) string {
+	if fcli.LocalFlags == nil {
+		return ""
+	}
 	return fcli.LocalFlags.String(key)
 }
 
@@ -70,6 +73,20 @@ func (fcli *FakeCommandLine) GlobalString(key string) string {
 	return fcli.GlobalFlags.String(key)
 }
 
+func (fcli *FakeCommandLine) GlobalInt(key string) int {
+	if fcli.GlobalFlags == nil {
+		return 0
+	}
+	return fcli.GlobalFlags.Int(key)
+}
+
+func (fcli *FakeCommandLine) GlobalBool(key string) bool {
+	if fcli.GlobalFlags == nil {
+		return false
+	}
+	return fcli.GlobalFlags.Bool(key)
+}
+
 func (fcli *FakeCommandLine) Generic(name string) interface{} {
 	return fcli.LocalFlags.Data[name]
 }
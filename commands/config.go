@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine"
@@ -11,11 +12,24 @@ import (
 	"github.com/docker/machine/libmachine/log"
 )
 
+type configOutput struct {
+	Name       string
+	DockerHost string
+	TLSCACert  string `json:",omitempty"`
+	TLSCert    string `json:",omitempty"`
+	TLSKey     string `json:",omitempty"`
+}
+
 func cmdConfig(c CommandLine, api libmachine.API) error {
 	// Ensure that log messages always go to stderr when this command is
 	// being run (it is intended to be run in a subshell)
 	log.SetOutWriter(os.Stderr)
 
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
 	target, err := targetHost(c, api)
 	if err != nil {
 		return err
@@ -33,10 +47,33 @@ func cmdConfig(c CommandLine, api libmachine.API) error {
 
 	log.Debug(dockerHost)
 
+	// Daemons reached over SSH don't use TLS.
+	if strings.HasPrefix(dockerHost, "ssh://") {
+		if output != "" {
+			return printOutput(os.Stdout, output, configOutput{
+				Name:       host.Name,
+				DockerHost: dockerHost,
+			})
+		}
+
+		fmt.Printf("-H=%s\n", dockerHost)
+		return nil
+	}
+
 	tlsCACert := filepath.Join(mcndirs.GetMachineDir(), host.Name, "ca.pem")
 	tlsCert := filepath.Join(mcndirs.GetMachineDir(), host.Name, "cert.pem")
 	tlsKey := filepath.Join(mcndirs.GetMachineDir(), host.Name, "key.pem")
 
+	if output != "" {
+		return printOutput(os.Stdout, output, configOutput{
+			Name:       host.Name,
+			DockerHost: dockerHost,
+			TLSCACert:  tlsCACert,
+			TLSCert:    tlsCert,
+			TLSKey:     tlsKey,
+		})
+	}
+
 	// TODO(nathanleclaire): These magic strings for the certificate file
 	// names should be cross-package constants.
 	fmt.Printf("--tlsverify\n--tlscacert=%q\n--tlscert=%q\n--tlskey=%q\n-H=%s\n",
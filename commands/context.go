@@ -0,0 +1,394 @@
+package commands
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/check"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/persist"
+)
+
+const (
+	// contextPrefix namespaces the Docker contexts of machines, the Docker
+	// CLI reserves some names such as default.
+	contextPrefix = "machine-"
+
+	dockerConfigFile = "config.json"
+)
+
+var (
+	contextTLSFiles = []string{"ca.pem", "cert.pem", "key.pem"}
+
+	// dockerCLI is the Docker CLI contexts are managed with, the context
+	// store is written directly if it isn't installed.
+	dockerCLI = "docker"
+)
+
+// dockerContext is the meta.json of a context in the Docker CLI context
+// store.
+type dockerContext struct {
+	Name      string
+	Metadata  map[string]interface{}
+	Endpoints map[string]dockerEndpoint
+}
+
+type dockerEndpoint struct {
+	Host          string
+	SkipTLSVerify bool
+}
+
+// machineContextName returns the name of the Docker context of a machine.
+func machineContextName(machineName string) string {
+	return contextPrefix + machineName
+}
+
+// contextDescription marks the Docker contexts created by sync with the
+// machine store they're for, the other contexts are left alone. It's the
+// only metadata the Docker CLI lets us set.
+func contextDescription(machineName, storePath string) string {
+	return fmt.Sprintf("Docker Machine %s (store %s)", machineName, storePath)
+}
+
+// dockerConfigDir returns the directory of the Docker CLI config, the same
+// way the Docker CLI does.
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker")
+}
+
+// contextID is the name of the directories of a context, the Docker CLI
+// hashes context names for them to be valid file names.
+func contextID(name string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+}
+
+func contextMetaDir(name string) string {
+	return filepath.Join(dockerConfigDir(), "contexts", "meta", contextID(name))
+}
+
+func contextTLSDir(name string) string {
+	return filepath.Join(dockerConfigDir(), "contexts", "tls", contextID(name))
+}
+
+func readDockerContext(metaDir string) (*dockerContext, error) {
+	data, err := ioutil.ReadFile(filepath.Join(metaDir, "meta.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	context := &dockerContext{}
+	if err := json.Unmarshal(data, context); err != nil {
+		return nil, fmt.Errorf("Invalid Docker context in %s: %s", metaDir, err)
+	}
+
+	return context, nil
+}
+
+// isMachineContext tells whether a context was created for a machine of
+// the store in storePath.
+func isMachineContext(context *dockerContext, storePath string) bool {
+	if !strings.HasPrefix(context.Name, contextPrefix) {
+		return false
+	}
+
+	description, ok := context.Metadata["Description"].(string)
+	return ok && description == contextDescription(strings.TrimPrefix(context.Name, contextPrefix), storePath)
+}
+
+// contextWriter creates, removes and switches between Docker contexts.
+type contextWriter interface {
+	// write creates or updates a context, with the TLS material in
+	// certDir unless the daemon is reached over SSH.
+	write(name, description, dockerHost, certDir string, exists bool) error
+
+	// remove removes a context.
+	remove(name string) error
+}
+
+// newContextWriter uses the Docker CLI if it's installed, since the layout
+// of its context store isn't an API.
+func newContextWriter() contextWriter {
+	if path, err := exec.LookPath(dockerCLI); err == nil {
+		return cliContextWriter{path}
+	}
+	return fileContextWriter{}
+}
+
+// cliContextWriter runs docker context commands.
+type cliContextWriter struct {
+	docker string
+}
+
+func (w cliContextWriter) run(args ...string) error {
+	cmd := exec.Command(w.docker, append([]string{"context"}, args...)...)
+
+	var stderr bytes.Buffer
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error running docker context %s: %s %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+func (w cliContextWriter) write(name, description, dockerHost, certDir string, exists bool) error {
+	endpoint := []string{"host=" + dockerHost}
+	if !strings.HasPrefix(dockerHost, "ssh://") {
+		endpoint = append(endpoint,
+			"ca="+filepath.Join(certDir, "ca.pem"),
+			"cert="+filepath.Join(certDir, "cert.pem"),
+			"key="+filepath.Join(certDir, "key.pem"))
+	}
+
+	docker, err := csvRecord(endpoint)
+	if err != nil {
+		return err
+	}
+
+	action := "create"
+	if exists {
+		action = "update"
+	}
+
+	return w.run(action, name, "--description", description, "--docker", docker)
+}
+
+func (w cliContextWriter) remove(name string) error {
+	return w.run("rm", "--force", name)
+}
+
+// csvRecord joins the fields of a flag the Docker CLI parses as CSV, such as
+// --docker, quoting the ones which need it.
+func csvRecord(fields []string) (string, error) {
+	var buf bytes.Buffer
+
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(fields); err != nil {
+		return "", err
+	}
+	writer.Flush()
+
+	return strings.TrimSuffix(buf.String(), "\n"), writer.Error()
+}
+
+// fileContextWriter writes the context store of the Docker CLI directly.
+type fileContextWriter struct{}
+
+func (fileContextWriter) write(name, description, dockerHost, certDir string, exists bool) error {
+	if err := writeContextTLS(name, dockerHost, certDir); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(dockerContext{
+		Name: name,
+		Metadata: map[string]interface{}{
+			"Description": description,
+		},
+		Endpoints: map[string]dockerEndpoint{
+			"docker": {
+				Host: dockerHost,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	metaDir := contextMetaDir(name)
+	if err := os.MkdirAll(metaDir, 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(metaDir, "meta.json"), data, 0644)
+}
+
+func (fileContextWriter) remove(name string) error {
+	if err := os.RemoveAll(contextMetaDir(name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(contextTLSDir(name))
+}
+
+// writeDockerContext creates or updates the context of a machine, with the
+// TLS material in certDir. Contexts created otherwise aren't overwritten.
+func writeDockerContext(writer contextWriter, machineName, dockerHost, certDir, storePath string) error {
+	name := machineContextName(machineName)
+
+	existing, err := readDockerContext(contextMetaDir(name))
+	if err == nil && !isMachineContext(existing, storePath) {
+		return fmt.Errorf("A Docker context named %q which wasn't created for this machine already exists", name)
+	}
+
+	return writer.write(name, contextDescription(machineName, storePath), dockerHost, certDir, err == nil)
+}
+
+// writeContextTLS copies the TLS material of a machine to its context.
+// Daemons reached over SSH have none.
+func writeContextTLS(name, dockerHost, certDir string) error {
+	if strings.HasPrefix(dockerHost, "ssh://") {
+		return os.RemoveAll(contextTLSDir(name))
+	}
+
+	tlsDir := filepath.Join(contextTLSDir(name), "docker")
+	if err := os.MkdirAll(tlsDir, 0700); err != nil {
+		return err
+	}
+
+	for _, file := range contextTLSFiles {
+		data, err := ioutil.ReadFile(filepath.Join(certDir, file))
+		if err != nil {
+			return err
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(tlsDir, file), data, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeDockerContexts removes the contexts created for the machines of the
+// store in storePath which don't exist anymore, and returns their names.
+func removeDockerContexts(writer contextWriter, storePath string, exists map[string]bool) ([]string, error) {
+	metaDirs, err := filepath.Glob(filepath.Join(dockerConfigDir(), "contexts", "meta", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	removed := []string{}
+	for _, metaDir := range metaDirs {
+		context, err := readDockerContext(metaDir)
+		if err != nil || !isMachineContext(context, storePath) || exists[strings.TrimPrefix(context.Name, contextPrefix)] {
+			continue
+		}
+
+		if err := writer.remove(context.Name); err != nil {
+			return removed, err
+		}
+
+		removed = append(removed, context.Name)
+	}
+
+	return removed, nil
+}
+
+// updateDockerConfig applies update to the Docker CLI config, keeping the
+// settings it doesn't know of.
+func updateDockerConfig(update func(config map[string]interface{})) error {
+	path := filepath.Join(dockerConfigDir(), dockerConfigFile)
+
+	config := map[string]interface{}{}
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("Invalid Docker config %s: %s", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	update(config)
+
+	data, err = json.MarshalIndent(config, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func cmdContextSync(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 0 {
+		return ErrTooManyArguments
+	}
+
+	filters, err := parseFilters(c.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
+	hostList, _, err := persist.LoadAllHosts(api)
+	if err != nil {
+		return err
+	}
+
+	names, err := api.List()
+	if err != nil {
+		return err
+	}
+
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+	}
+
+	storePath := mcndirs.GetBaseDir()
+	writer := newContextWriter()
+	use := c.String("use")
+	synced := map[string]bool{}
+
+	// Machines which can't be reached keep their context as it was.
+	for _, h := range filterHosts(hostList, filters) {
+		dockerHost, _, err := check.DefaultConnChecker.Check(h, c.Bool("swarm"))
+		if err != nil {
+			log.Warnf("Skipping %s: %s", h.Name, err)
+			continue
+		}
+
+		certDir := filepath.Join(mcndirs.GetMachineDir(), h.Name)
+		if err := writeDockerContext(writer, h.Name, dockerHost, certDir, storePath); err != nil {
+			log.Warnf("Skipping %s: %s", h.Name, err)
+			continue
+		}
+
+		synced[h.Name] = true
+		log.Infof("Docker context %q is up to date", machineContextName(h.Name))
+	}
+
+	removed, err := removeDockerContexts(writer, storePath, exists)
+	for _, name := range removed {
+		log.Infof("Docker context %q was removed", name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if use != "" && !synced[use] {
+		return fmt.Errorf("Error: no Docker context was synced for %q", use)
+	}
+
+	return updateDockerConfig(func(config map[string]interface{}) {
+		current, _ := config["currentContext"].(string)
+
+		for _, name := range removed {
+			if name == current {
+				delete(config, "currentContext")
+			}
+		}
+
+		if use != "" {
+			config["currentContext"] = machineContextName(use)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/check"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func readDockerConfig(t *testing.T) map[string]interface{} {
+	data, err := ioutil.ReadFile(filepath.Join(dockerConfigDir(), dockerConfigFile))
+	assert.NoError(t, err)
+
+	config := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &config))
+	return config
+}
+
+func TestCmdContextSync(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	defer func(dir string) { os.Setenv("DOCKER_CONFIG", dir) }(os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", filepath.Join(tmpDir, "docker"))
+
+	defer func(dir string) { mcndirs.BaseDir = dir }(mcndirs.BaseDir)
+	mcndirs.BaseDir = filepath.Join(tmpDir, "machine")
+
+	defer func(checker check.ConnChecker) { check.DefaultConnChecker = checker }(check.DefaultConnChecker)
+	check.DefaultConnChecker = &FakeConnChecker{DockerHost: "tcp://1.2.3.4:2376"}
+
+	defer func(cli string) { dockerCLI = cli }(dockerCLI)
+	dockerCLI = filepath.Join(tmpDir, "no-docker")
+
+	for _, name := range []string{"foo", "bar"} {
+		machineDir := filepath.Join(mcndirs.GetMachineDir(), name)
+		assert.NoError(t, os.MkdirAll(machineDir, 0700))
+		for _, file := range contextTLSFiles {
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(machineDir, file), []byte(name+" "+file), 0600))
+		}
+	}
+
+	// A context which wasn't created by sync is left alone.
+	assert.NoError(t, os.MkdirAll(contextMetaDir("machine-bar"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(contextMetaDir("machine-bar"), "meta.json"), []byte(`{"Name":"machine-bar"}`), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dockerConfigDir(), dockerConfigFile), []byte(`{"auths":{}}`), 0600))
+
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{Name: "foo", Driver: &fakedriver.Driver{MockState: state.Running}},
+			{Name: "bar", Driver: &fakedriver.Driver{MockState: state.Running}},
+		},
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"use": "foo",
+			},
+		},
+	}
+
+	assert.NoError(t, cmdContextSync(commandLine, api))
+
+	context, err := readDockerContext(contextMetaDir("machine-foo"))
+	assert.NoError(t, err)
+	assert.Equal(t, "machine-foo", context.Name)
+	assert.Equal(t, "tcp://1.2.3.4:2376", context.Endpoints["docker"].Host)
+	assert.True(t, isMachineContext(context, mcndirs.GetBaseDir()))
+
+	key, err := ioutil.ReadFile(filepath.Join(contextTLSDir("machine-foo"), "docker", "key.pem"))
+	assert.NoError(t, err)
+	assert.Equal(t, "foo key.pem", string(key))
+
+	context, err = readDockerContext(contextMetaDir("machine-bar"))
+	assert.NoError(t, err)
+	assert.False(t, isMachineContext(context, mcndirs.GetBaseDir()))
+
+	config := readDockerConfig(t)
+	assert.Equal(t, "machine-foo", config["currentContext"])
+	assert.Contains(t, config, "auths")
+
+	// The context of a removed machine is removed, and isn't current anymore.
+	api.Hosts = api.Hosts[1:]
+	commandLine.LocalFlags = &commandstest.FakeFlagger{Data: map[string]interface{}{}}
+
+	assert.NoError(t, cmdContextSync(commandLine, api))
+
+	_, err = os.Stat(contextMetaDir("machine-foo"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(contextTLSDir("machine-foo"))
+	assert.True(t, os.IsNotExist(err))
+	assert.NotContains(t, readDockerConfig(t), "currentContext")
+
+	_, err = os.Stat(contextMetaDir("machine-bar"))
+	assert.NoError(t, err)
+}
+
+func TestCmdContextSyncUseUnknownMachine(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	defer func(dir string) { os.Setenv("DOCKER_CONFIG", dir) }(os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", tmpDir)
+
+	defer func(cli string) { dockerCLI = cli }(dockerCLI)
+	dockerCLI = filepath.Join(tmpDir, "no-docker")
+
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"use": "foo",
+			},
+		},
+	}
+
+	err = cmdContextSync(commandLine, &libmachinetest.FakeAPI{})
+
+	assert.EqualError(t, err, `Error: no Docker context was synced for "foo"`)
+	_, err = os.Stat(filepath.Join(tmpDir, dockerConfigFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCmdContextSyncWithDockerCLI(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake Docker CLI is a shell script")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	defer func(dir string) { os.Setenv("DOCKER_CONFIG", dir) }(os.Getenv("DOCKER_CONFIG"))
+	os.Setenv("DOCKER_CONFIG", filepath.Join(tmpDir, "docker"))
+
+	defer func(dir string) { mcndirs.BaseDir = dir }(mcndirs.BaseDir)
+	mcndirs.BaseDir = filepath.Join(tmpDir, "machine,1")
+
+	defer func(checker check.ConnChecker) { check.DefaultConnChecker = checker }(check.DefaultConnChecker)
+	check.DefaultConnChecker = &FakeConnChecker{DockerHost: "tcp://1.2.3.4:2376"}
+
+	// The fake CLI records its arguments, one per line.
+	argsFile := filepath.Join(tmpDir, "args")
+	defer func(cli string) { dockerCLI = cli }(dockerCLI)
+	dockerCLI = filepath.Join(tmpDir, "docker-cli")
+	assert.NoError(t, ioutil.WriteFile(dockerCLI, []byte("#!/bin/sh\nprintf '%s\\n' \"$@\" >> "+argsFile+"\n"), 0755))
+
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{Name: "default", Driver: &fakedriver.Driver{MockState: state.Running}},
+		},
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+
+	assert.NoError(t, cmdContextSync(commandLine, api))
+
+	args, err := ioutil.ReadFile(argsFile)
+	assert.NoError(t, err)
+
+	certDir := filepath.Join(mcndirs.GetMachineDir(), "default")
+	assert.Equal(t, []string{
+		"context", "create", "machine-default",
+		"--description", contextDescription("default", mcndirs.GetBaseDir()),
+		"--docker", `host=tcp://1.2.3.4:2376,"ca=` + filepath.Join(certDir, "ca.pem") + `","cert=` + filepath.Join(certDir, "cert.pem") + `","key=` + filepath.Join(certDir, "key.pem") + `"`,
+	}, strings.Split(strings.TrimSpace(string(args)), "\n"))
+}
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -26,11 +27,14 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnerror"
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/swarm"
 )
 
 var (
 	errNoMachineName = errors.New("Error: No machine name specified")
+	errSwarmNoTLS    = errors.New("Error: Swarm needs the engine to listen with TLS, it can't be used with --engine-no-tls")
+	errJumpKeys      = errors.New("Error: there are more --ssh-jump-key than --ssh-jump-host")
 )
 
 var (
@@ -77,6 +81,20 @@ var (
 			Usage: "Specify environment variables to set in the engine",
 			Value: &cli.StringSlice{},
 		},
+		cli.BoolFlag{
+			Name:  "engine-no-tls",
+			Usage: "Only listen on the unix socket of the engine, the Docker client connects to it over SSH",
+		},
+		cli.StringSliceFlag{
+			Name:  "ssh-jump-host",
+			Usage: "Reach the machine over SSH through a jump host in the form user@host[:port], repeat it for a chain of jump hosts",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "ssh-jump-key",
+			Usage: "Private key to log in to the jump host at the same position with, an empty one for none",
+			Value: &cli.StringSlice{},
+		},
 		cli.BoolFlag{
 			Name:  "swarm",
 			Usage: "Configure Machine to join a Swarm cluster",
@@ -125,6 +143,16 @@ var (
 			Name:  "swarm-experimental",
 			Usage: "Enable Swarm experimental features",
 		},
+		cli.StringFlag{
+			Name:  "from",
+			Usage: "Create the machine with the options and driver flags of an existing machine, flags given on the command line take precedence",
+		},
+		progressFlag,
+		cli.StringSliceFlag{
+			Name:  "tag",
+			Usage: "Tag the machine with key=value, such as owner=alice",
+			Value: &cli.StringSlice{},
+		},
 		cli.StringSliceFlag{
 			Name:  "tls-san",
 			Usage: "Support extra SANs for TLS certs",
@@ -149,14 +177,40 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 		return fmt.Errorf("Error creating machine: %s", mcnerror.ErrInvalidHostname)
 	}
 
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON); err != nil {
+		return err
+	}
+
+	if output == outputJSON {
+		defer useEventLogger(os.Stdout)()
+	}
+
+	if from := c.String("from"); from != "" {
+		source, err := api.Load(from)
+		if err != nil {
+			return fmt.Errorf("Error loading machine %q to create from: %s", from, err)
+		}
+		c = newFromCommandLine(c, source)
+	}
+
 	if err := validateSwarmDiscovery(c.String("swarm-discovery")); err != nil {
 		return fmt.Errorf("Error parsing swarm discovery: %s", err)
 	}
 
+	if c.Bool("engine-no-tls") && (c.Bool("swarm") || c.Bool("swarm-master")) {
+		return errSwarmNoTLS
+	}
+
+	jumpHosts, err := parseJumpHosts(c.StringSlice("ssh-jump-host"), c.StringSlice("ssh-jump-key"))
+	if err != nil {
+		return err
+	}
+
 	// TODO: Fix hacky JSON solution
 	rawDriver, err := json.Marshal(&drivers.BaseDriver{
 		MachineName: name,
-		StorePath:   c.GlobalString("storage-path"),
+		StorePath:   mcndirs.GetBaseDir(),
 	})
 	if err != nil {
 		return fmt.Errorf("Error attempting to marshal bare driver data: %s", err)
@@ -189,6 +243,7 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 			StorageDriver:    c.String("engine-storage-driver"),
 			TLSVerify:        true,
 			InstallURL:       c.String("engine-install-url"),
+			NoTLS:            c.Bool("engine-no-tls"),
 		},
 		SwarmOptions: &swarm.Options{
 			IsSwarm:            c.Bool("swarm") || c.Bool("swarm-master"),
@@ -203,7 +258,24 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 			ArbitraryJoinFlags: c.StringSlice("swarm-join-opt"),
 			IsExperimental:     c.Bool("swarm-experimental"),
 		},
+		SSHJumpHosts: jumpHosts,
+	}
+
+	for _, tag := range c.StringSlice("tag") {
+		key, value, err := parseTag(tag)
+		if err != nil {
+			return err
+		}
+		h.SetTag(key, value)
+	}
+
+	// Hold the machine lock from the existence check until the machine is
+	// fully saved, so that two concurrent creates can't claim the same name.
+	unlock, err := lockMachines(api, []string{h.Name})
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
 	exists, err := api.Exists(h.Name)
 	if err != nil {
@@ -225,10 +297,18 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 		return fmt.Errorf("Error setting machine configuration from flags provided: %s", err)
 	}
 
-	if err := api.Create(h); err != nil {
+	h.DriverFlags = recordedDriverFlags(driverOpts, mcnFlags)
+
+	ctx, stopInterrupting := interruptContext()
+	err = api.CreateContext(ctx, h)
+	stopInterrupting()
+
+	if err != nil {
 		// Wait for all the logs to reach the client
 		time.Sleep(2 * time.Second)
 
+		log.Done(h.Name, err)
+
 		vBoxLog := ""
 		if h.DriverName == "virtualbox" {
 			vBoxLog = filepath.Join(api.GetMachinesDir(), h.Name, h.Name, "Logs", "VBox.log")
@@ -244,10 +324,13 @@ func cmdCreateInner(c CommandLine, api libmachine.API) error {
 	}
 
 	if err := api.Save(h); err != nil {
-		return fmt.Errorf("Error attempting to save store: %s", err)
+		err = fmt.Errorf("Error attempting to save store: %s", err)
+		log.Done(h.Name, err)
+		return err
 	}
 
 	log.Infof("To see how to connect your Docker Client to the Docker Engine running on this virtual machine, run: %s env %s", os.Args[0], name)
+	log.Done(h.Name, nil)
 
 	return nil
 }
@@ -295,6 +378,9 @@ func cmdCreateOuter(c CommandLine, api libmachine.API) error {
 
 	// We didn't recognize the driver name.
 	driverName := flagHackLookup("--driver")
+	if driverName == "" {
+		driverName = sourceDriverName(api, flagHackLookup("--from"))
+	}
 	if driverName == "" {
 		//TODO: Check Environment have to include flagHackLookup function.
 		driverName = os.Getenv("MACHINE_DRIVER")
@@ -358,6 +444,11 @@ func getDriverOpts(c CommandLine, mcnflags []mcnflag.Flag) drivers.DriverOptions
 		if f.Default() == nil {
 			driverOpts.Values[f.String()] = false
 		}
+
+		switch f.(type) {
+		case mcnflag.SecretFlag, *mcnflag.SecretFlag:
+			driverOpts.Secrets = append(driverOpts.Secrets, f.String())
+		}
 	}
 
 	for _, name := range c.FlagNames() {
@@ -374,6 +465,10 @@ func getDriverOpts(c CommandLine, mcnflags []mcnflag.Flag) drivers.DriverOptions
 		}
 	}
 
+	for _, secret := range driverOpts.SecretValues() {
+		log.RegisterSecret(secret)
+	}
+
 	return driverOpts
 }
 
@@ -407,6 +502,14 @@ func convertMcnFlagsToCliFlags(mcnFlags []mcnflag.Flag) ([]cli.Flag, error) {
 				Usage:  f.Usage,
 				Value:  f.Value,
 			})
+		case *mcnflag.SecretFlag:
+			f := f.(*mcnflag.SecretFlag)
+			cliFlags = append(cliFlags, cli.StringFlag{
+				Name:   f.Name,
+				EnvVar: f.EnvVar,
+				Usage:  f.Usage,
+				Value:  f.Value,
+			})
 		case *mcnflag.StringSliceFlag:
 			f := f.(*mcnflag.StringSliceFlag)
 			cliFlags = append(cliFlags, cli.StringSliceFlag{
@@ -452,6 +555,34 @@ func validateSwarmDiscovery(discovery string) error {
 	return fmt.Errorf("Swarm Discovery URL was in the wrong format: %s", discovery)
 }
 
+// parseJumpHosts returns the chain of jump hosts, each logged in to with the
+// key at the same position if there's one.
+func parseJumpHosts(hosts, keys []string) ([]ssh.JumpHost, error) {
+	if len(keys) > len(hosts) {
+		return nil, errJumpKeys
+	}
+
+	jumpHosts := []ssh.JumpHost{}
+	for i, value := range hosts {
+		jumpHost, err := ssh.ParseJumpHost(value)
+		if err != nil {
+			return nil, fmt.Errorf("Error: %s", err)
+		}
+
+		if i < len(keys) && keys[i] != "" {
+			keyPath, err := filepath.Abs(keys[i])
+			if err != nil {
+				return nil, err
+			}
+			jumpHost.KeyPath = keyPath
+		}
+
+		jumpHosts = append(jumpHosts, jumpHost)
+	}
+
+	return jumpHosts, nil
+}
+
 func tlsPath(c CommandLine, flag string, defaultName string) string {
 	path := c.GlobalString(flag)
 	if path != "" {
@@ -460,3 +591,24 @@ func tlsPath(c CommandLine, flag string, defaultName string) string {
 
 	return filepath.Join(mcndirs.GetMachineCertDir(), defaultName)
 }
+
+// interruptContext returns a context canceled on Ctrl-C, until the returned
+// function is called. Another Ctrl-C stops the process right away.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interrupt := make(chan os.Signal, 1)
+	stopNotify := notifySignals(interrupt, os.Interrupt)
+
+	go func() {
+		select {
+		case <-interrupt:
+			log.Info("Interrupting, press Ctrl-C again to stop right away...")
+		case <-ctx.Done():
+		}
+		stopNotify()
+		cancel()
+	}()
+
+	return ctx, cancel
+}
@@ -0,0 +1,232 @@
+package commands
+
+import (
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/drivers/rpc"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnflag"
+)
+
+// fromCommandLine is the command line of create --from. Flags which are not
+// given on the command line take the value they have on the source machine.
+//
+// Only options and flags are copied, the identity of the new machine such
+// as its keys, IP and instance come from creating it.
+type fromCommandLine struct {
+	CommandLine
+	flags map[string]interface{}
+}
+
+func newFromCommandLine(c CommandLine, source *host.Host) CommandLine {
+	flags := map[string]interface{}{
+		"driver": source.DriverName,
+		"tag":    sortedTags(source.Tags()),
+	}
+
+	// Driver flags are only meaningful to the driver they come from.
+	if !c.IsSet("driver") || c.String("driver") == source.DriverName {
+		if len(source.DriverFlags) == 0 {
+			log.Warnf("The driver flags of %q were not recorded when it was created, the new machine gets the default ones", source.Name)
+		}
+
+		for name, value := range source.DriverFlags {
+			flags[name] = flagValue(value)
+		}
+	}
+
+	if source.HostOptions != nil {
+		if engineOptions := source.HostOptions.EngineOptions; engineOptions != nil {
+			flags["engine-install-url"] = engineOptions.InstallURL
+			flags["engine-opt"] = engineOptions.ArbitraryFlags
+			flags["engine-insecure-registry"] = engineOptions.InsecureRegistry
+			flags["engine-registry-mirror"] = engineOptions.RegistryMirror
+			flags["engine-label"] = engineOptions.Labels
+			flags["engine-storage-driver"] = engineOptions.StorageDriver
+			flags["engine-env"] = engineOptions.Env
+			flags["engine-no-tls"] = engineOptions.NoTLS
+		}
+
+		// The Swarm address is the one of the source machine.
+		if swarmOptions := source.HostOptions.SwarmOptions; swarmOptions != nil {
+			flags["swarm"] = swarmOptions.Agent
+			flags["swarm-image"] = swarmOptions.Image
+			flags["swarm-master"] = swarmOptions.Master
+			flags["swarm-discovery"] = swarmOptions.Discovery
+			flags["swarm-strategy"] = swarmOptions.Strategy
+			flags["swarm-opt"] = swarmOptions.ArbitraryFlags
+			flags["swarm-join-opt"] = swarmOptions.ArbitraryJoinFlags
+			flags["swarm-host"] = swarmOptions.Host
+			flags["swarm-experimental"] = swarmOptions.IsExperimental
+		}
+
+		if authOptions := source.HostOptions.AuthOptions; authOptions != nil {
+			flags["tls-san"] = authOptions.ServerCertSANs
+		}
+
+		if jumpHosts := source.HostOptions.SSHJumpHosts; len(jumpHosts) > 0 {
+			hosts := []string{}
+			keys := []string{}
+			for _, jumpHost := range jumpHosts {
+				hosts = append(hosts, jumpHost.String())
+				keys = append(keys, jumpHost.KeyPath)
+			}
+			flags["ssh-jump-host"] = hosts
+			flags["ssh-jump-key"] = keys
+		}
+	}
+
+	return &fromCommandLine{
+		CommandLine: c,
+		flags:       flags,
+	}
+}
+
+// flagValue converts a flag value read back from a config to the type of
+// the flag.
+func flagValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float64:
+		return int(v)
+	case []interface{}:
+		values := []string{}
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return value
+}
+
+func (c *fromCommandLine) sourceValue(name string) (interface{}, bool) {
+	if c.CommandLine.IsSet(name) {
+		return nil, false
+	}
+
+	value, ok := c.flags[name]
+	return value, ok
+}
+
+func (c *fromCommandLine) IsSet(name string) bool {
+	_, ok := c.sourceValue(name)
+	return ok || c.CommandLine.IsSet(name)
+}
+
+func (c *fromCommandLine) String(name string) string {
+	if value, ok := c.sourceValue(name); ok {
+		if s, ok := value.(string); ok {
+			return s
+		}
+	}
+	return c.CommandLine.String(name)
+}
+
+func (c *fromCommandLine) StringSlice(name string) []string {
+	if value, ok := c.sourceValue(name); ok {
+		if s, ok := value.([]string); ok {
+			return s
+		}
+	}
+	return c.CommandLine.StringSlice(name)
+}
+
+func (c *fromCommandLine) Bool(name string) bool {
+	if value, ok := c.sourceValue(name); ok {
+		if b, ok := value.(bool); ok {
+			return b
+		}
+	}
+	return c.CommandLine.Bool(name)
+}
+
+func (c *fromCommandLine) Int(name string) int {
+	if value, ok := c.sourceValue(name); ok {
+		if i, ok := value.(int); ok {
+			return i
+		}
+	}
+	return c.CommandLine.Int(name)
+}
+
+func (c *fromCommandLine) Generic(name string) interface{} {
+	if value, ok := c.sourceValue(name); ok {
+		return sourceFlag{value}
+	}
+	return c.CommandLine.Generic(name)
+}
+
+func (c *fromCommandLine) FlagNames() []string {
+	names := c.CommandLine.FlagNames()
+
+	known := map[string]bool{}
+	for _, name := range names {
+		known[name] = true
+	}
+
+	for name := range c.flags {
+		if !known[name] {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// sourceFlag is the flag.Getter of a flag taken from the source machine.
+type sourceFlag struct {
+	value interface{}
+}
+
+func (f sourceFlag) Get() interface{} {
+	return f.value
+}
+
+func (f sourceFlag) Set(string) error {
+	return nil
+}
+
+func (f sourceFlag) String() string {
+	return ""
+}
+
+// sourceDriverName returns the driver of the machine to create another one
+// from, if there is one.
+func sourceDriverName(api libmachine.API, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	source, err := api.Load(name)
+	if err != nil {
+		return ""
+	}
+
+	return source.DriverName
+}
+
+// recordedDriverFlags returns the values of the driver flags to keep with
+// a machine. Credentials and the flags which only apply to this machine are
+// left out.
+func recordedDriverFlags(driverOpts drivers.DriverOptions, mcnFlags []mcnflag.Flag) map[string]interface{} {
+	rpcFlags, ok := driverOpts.(rpcdriver.RPCFlags)
+	if !ok {
+		return nil
+	}
+
+	excluded := mcnflag.PerMachineFlags(mcnFlags)
+	for _, name := range rpcFlags.Secrets {
+		excluded[name] = true
+	}
+
+	flags := map[string]interface{}{}
+	for _, f := range mcnFlags {
+		if value, ok := rpcFlags.Values[f.String()]; ok && !excluded[f.String()] {
+			flags[f.String()] = value
+		}
+	}
+
+	return flags
+}
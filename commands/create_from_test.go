@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/drivers/rpc"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestSourceHost() *host.Host {
+	return &host.Host{
+		Name:       "source",
+		DriverName: "amazonec2",
+		DriverFlags: map[string]interface{}{
+			"amazonec2-region":         "eu-west-1",
+			"amazonec2-root-size":      float64(64),
+			"amazonec2-security-group": []interface{}{"web", "ssh"},
+		},
+		HostOptions: &host.Options{
+			EngineOptions: &engine.Options{
+				Labels:        []string{"env=prod"},
+				StorageDriver: "overlay2",
+			},
+			SwarmOptions: &swarm.Options{},
+			AuthOptions: &auth.Options{
+				ServerCertSANs: []string{"source.example.com"},
+			},
+		},
+		Metadata: &host.MachineMetadata{
+			Tags: map[string]string{"owner": "alice"},
+		},
+	}
+}
+
+func TestFromCommandLine(t *testing.T) {
+	commandLine := newFromCommandLine(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"engine-storage-driver": "devicemapper",
+			},
+		},
+	}, getTestSourceHost())
+
+	assert.Equal(t, "amazonec2", commandLine.String("driver"))
+	assert.Equal(t, "devicemapper", commandLine.String("engine-storage-driver"))
+	assert.Equal(t, []string{"env=prod"}, commandLine.StringSlice("engine-label"))
+	assert.Equal(t, []string{"source.example.com"}, commandLine.StringSlice("tls-san"))
+	assert.Equal(t, []string{"owner=alice"}, commandLine.StringSlice("tag"))
+	assert.False(t, commandLine.Bool("swarm-master"))
+}
+
+func TestFromCommandLineDriverOpts(t *testing.T) {
+	commandLine := newFromCommandLine(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"amazonec2-region": fakeFlagGetter{value: "us-east-1"},
+			},
+		},
+	}, getTestSourceHost())
+
+	driverOpts := getDriverOpts(commandLine, []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "amazonec2-region"},
+		mcnflag.IntFlag{Name: "amazonec2-root-size"},
+		mcnflag.StringSliceFlag{Name: "amazonec2-security-group"},
+	})
+
+	assert.Equal(t, "us-east-1", driverOpts.String("amazonec2-region"))
+	assert.Equal(t, 64, driverOpts.Int("amazonec2-root-size"))
+	assert.Equal(t, []string{"web", "ssh"}, driverOpts.StringSlice("amazonec2-security-group"))
+}
+
+func TestFromCommandLineWithOtherDriver(t *testing.T) {
+	commandLine := newFromCommandLine(&commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"driver": "digitalocean",
+			},
+		},
+	}, getTestSourceHost())
+
+	assert.Equal(t, "digitalocean", commandLine.String("driver"))
+	assert.False(t, commandLine.IsSet("amazonec2-region"))
+	assert.Equal(t, []string{"env=prod"}, commandLine.StringSlice("engine-label"))
+}
+
+func TestRecordedDriverFlags(t *testing.T) {
+	driverOpts := rpcdriver.RPCFlags{
+		Values: map[string]interface{}{
+			"driver":       "digitalocean",
+			"region":       "nyc3",
+			"access-token": "t0k3n",
+			"ssh-key-path": "/keys/id_rsa",
+		},
+		Secrets: []string{"access-token"},
+	}
+
+	flags := recordedDriverFlags(driverOpts, []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "region"},
+		mcnflag.SecretFlag{Name: "access-token"},
+		mcnflag.StringFlag{Name: "ssh-key-path", PerMachine: true},
+	})
+
+	assert.Equal(t, map[string]interface{}{"region": "nyc3"}, flags)
+}
@@ -5,7 +5,9 @@ import (
 
 	"flag"
 	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/libmachine/drivers/rpc"
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,6 +26,28 @@ func TestValidateSwarmDiscoveryAcceptsValidFormat(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestParseJumpHosts(t *testing.T) {
+	jumpHosts, err := parseJumpHosts([]string{"admin@bastion", "docker@10.0.0.1:2222"}, []string{"/keys/bastion"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []ssh.JumpHost{
+		{Hostname: "bastion", User: "admin", KeyPath: "/keys/bastion"},
+		{Hostname: "10.0.0.1", Port: 2222, User: "docker"},
+	}, jumpHosts)
+}
+
+func TestParseJumpHostsMoreKeysThanHosts(t *testing.T) {
+	_, err := parseJumpHosts([]string{"admin@bastion"}, []string{"/keys/bastion", "/keys/other"})
+
+	assert.Equal(t, errJumpKeys, err)
+}
+
+func TestParseJumpHostsInvalid(t *testing.T) {
+	_, err := parseJumpHosts([]string{"bastion"}, nil)
+
+	assert.EqualError(t, err, `Error: Invalid jump host "bastion", expected user@host[:port]`)
+}
+
 type fakeFlagGetter struct {
 	flag.Value
 	value interface{}
@@ -117,3 +141,22 @@ func TestGetDriverOpts(t *testing.T) {
 		assert.Equal(t, tt.expected["stringslice_defaulted"], driverOpts.StringSlice("stringslice_defaulted"))
 	}
 }
+
+func TestGetDriverOptsWithSecret(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"token": fakeFlagGetter{value: "t0k3n"},
+			},
+		},
+	}
+
+	driverOpts := getDriverOpts(commandLine, []mcnflag.Flag{
+		mcnflag.StringFlag{Name: "region"},
+		mcnflag.SecretFlag{Name: "token", Field: "Token"},
+	})
+
+	assert.Equal(t, "t0k3n", driverOpts.String("token"))
+	assert.Equal(t, []string{"token"}, driverOpts.(rpcdriver.RPCFlags).Secrets)
+	assert.Equal(t, []string{"t0k3n"}, driverOpts.(rpcdriver.RPCFlags).SecretValues())
+}
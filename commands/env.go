@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -12,6 +13,7 @@ import (
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/check"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/shell"
 )
@@ -22,8 +24,11 @@ const (
 
 var (
 	errImproperUnsetEnvArgs = errors.New("Error: Expected no machine name when the -u flag is present")
+	errNoSSHAgent           = errors.New("Error: no SSH agent to add the key of the machine to, start one with 'eval $(ssh-agent)'")
 	defaultUsageHinter      UsageHintGenerator
 	runtimeOS               = func() string { return runtime.GOOS }
+	sshAgentAdd             = addSSHKey
+	sshDockerGroup          = checkDockerGroup
 )
 
 func init() {
@@ -84,7 +89,18 @@ func shellCfgSet(c CommandLine, api libmachine.API) (*ShellConfig, error) {
 		return nil, err
 	}
 
-	dockerHost, _, err := check.DefaultConnChecker.Check(host, c.Bool("swarm"))
+	var dockerHost string
+	if c.Bool("ssh") && !host.NoTLS() {
+		if c.Bool("swarm") {
+			return nil, check.ErrSwarmNoTLS
+		}
+		if err := sshDockerGroup(host); err != nil {
+			return nil, err
+		}
+		dockerHost, err = host.SSHURL()
+	} else {
+		dockerHost, _, err = check.DefaultConnChecker.Check(host, c.Bool("swarm"))
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Error checking TLS connection: %s", err)
 	}
@@ -102,6 +118,19 @@ func shellCfgSet(c CommandLine, api libmachine.API) (*ShellConfig, error) {
 		MachineName:     host.Name,
 	}
 
+	// The Docker client connects over SSH with the keys of the SSH agent,
+	// and doesn't use TLS.
+	if strings.HasPrefix(dockerHost, "ssh://") {
+		if keyPath := host.Driver.GetSSHKeyPath(); keyPath != "" {
+			if err := sshAgentAdd(keyPath); err != nil {
+				return nil, err
+			}
+		}
+
+		shellCfg.DockerCertPath = ""
+		shellCfg.DockerTLSVerify = ""
+	}
+
 	if c.Bool("no-proxy") {
 		ip, err := host.Driver.GetIP()
 		if err != nil {
@@ -273,3 +302,58 @@ func (g *EnvUsageHintGenerator) GenerateUsageHint(userShell string, args []strin
 
 	return fmt.Sprintf("%s Run this command to configure your shell: \n%s %s\n", comment, comment, cmd)
 }
+
+// checkDockerGroup checks that the SSH user of a machine may use the unix
+// socket of the daemon. Provisioning adds it to the docker group, machines
+// provisioned before that have to be provisioned again.
+func checkDockerGroup(h *host.Host) error {
+	output, err := h.RunSSHCommand("id -u && id -nG")
+	if err != nil {
+		return fmt.Errorf("Error checking the groups of the SSH user of %s: %s", h.Name, err)
+	}
+
+	if !inDockerGroup(output) {
+		return fmt.Errorf("The SSH user of %s isn't in the docker group, run '%s provision %s' to add it", h.Name, os.Args[0], h.Name)
+	}
+
+	return nil
+}
+
+// inDockerGroup tells from the output of "id -u && id -nG" whether a user
+// may use the unix socket of the daemon: root can, other users need to be
+// in the docker group.
+func inDockerGroup(idOutput string) bool {
+	lines := strings.SplitN(strings.TrimSpace(idOutput), "\n", 2)
+	if lines[0] == "0" {
+		return true
+	}
+
+	if len(lines) < 2 {
+		return false
+	}
+
+	for _, group := range strings.Fields(lines[1]) {
+		if group == "docker" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addSSHKey adds a key to the SSH agent, for the Docker client to connect
+// with it.
+func addSSHKey(keyPath string) error {
+	if os.Getenv("SSH_AUTH_SOCK") == "" {
+		return errNoSSHAgent
+	}
+
+	cmd := exec.Command("ssh-add", keyPath)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("Error adding %s to the SSH agent: %s", keyPath, err)
+	}
+
+	return nil
+}
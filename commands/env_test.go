@@ -1,8 +1,10 @@
 package commands
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/docker/machine/commands/commandstest"
@@ -686,3 +688,105 @@ func TestShellCfgUnset(t *testing.T) {
 		os.Setenv(test.noProxyVar, "")
 	}
 }
+
+type sshKeyDriver struct {
+	fakedriver.Driver
+}
+
+func (d *sshKeyDriver) GetSSHKeyPath() string {
+	return "/path/to/id_rsa"
+}
+
+func TestShellCfgSetSSH(t *testing.T) {
+	defer revertUsageHinter(defaultUsageHinter)
+	defaultUsageHinter = &SimpleUsageHintGenerator{"This is a usage hint"}
+
+	defer func(checker check.ConnChecker) { check.DefaultConnChecker = checker }(check.DefaultConnChecker)
+	check.DefaultConnChecker = &FakeConnChecker{DockerHost: "ssh://docker@1.2.3.4"}
+
+	defer func(add func(string) error) { sshAgentAdd = add }(sshAgentAdd)
+	added := []string{}
+	sshAgentAdd = func(keyPath string) error {
+		added = append(added, keyPath)
+		return nil
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"quux"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"shell": "bash",
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name:   "quux",
+				Driver: &sshKeyDriver{},
+			},
+		},
+	}
+
+	shellCfg, err := shellCfgSet(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ssh://docker@1.2.3.4", shellCfg.DockerHost)
+	assert.Empty(t, shellCfg.DockerTLSVerify)
+	assert.Empty(t, shellCfg.DockerCertPath)
+	assert.Equal(t, []string{"/path/to/id_rsa"}, added)
+}
+
+func TestShellCfgSetSSHFlagChecksDockerGroup(t *testing.T) {
+	defer revertUsageHinter(defaultUsageHinter)
+	defaultUsageHinter = &SimpleUsageHintGenerator{"This is a usage hint"}
+
+	defer func(add func(string) error) { sshAgentAdd = add }(sshAgentAdd)
+	sshAgentAdd = func(string) error { return nil }
+
+	defer func(check func(*host.Host) error) { sshDockerGroup = check }(sshDockerGroup)
+	checked := []string{}
+	sshDockerGroup = func(h *host.Host) error {
+		checked = append(checked, h.Name)
+		return nil
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"quux"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"shell": "bash",
+				"ssh":   true,
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name:   "quux",
+				Driver: &sshKeyDriver{},
+			},
+		},
+	}
+
+	shellCfg, err := shellCfgSet(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(shellCfg.DockerHost, "ssh://"))
+	assert.Equal(t, []string{"quux"}, checked)
+
+	sshDockerGroup = func(h *host.Host) error {
+		return errors.New("The SSH user of quux isn't in the docker group")
+	}
+
+	_, err = shellCfgSet(commandLine, api)
+
+	assert.EqualError(t, err, "The SSH user of quux isn't in the docker group")
+}
+
+func TestInDockerGroup(t *testing.T) {
+	assert.True(t, inDockerGroup("1000\nubuntu adm docker\n"))
+	assert.True(t, inDockerGroup("0\nroot\n"))
+	assert.False(t, inDockerGroup("1000\nubuntu adm dockerroot\n"))
+	assert.False(t, inDockerGroup(""))
+}
@@ -0,0 +1,433 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcndockerclient"
+	"github.com/docker/machine/libmachine/persist"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	eventsDefaultInterval    = 5
+	eventsDefaultMaxInterval = 60
+)
+
+// machineEvent is a change of a machine, or the first values seen of a
+// machine, in which case From is empty.
+type machineEvent struct {
+	Time    time.Time
+	Machine string
+	Type    string
+	From    string `json:",omitempty"`
+	To      string `json:",omitempty"`
+}
+
+func (e machineEvent) String() string {
+	from := e.From
+	if from == "" {
+		from = "-"
+	}
+	return fmt.Sprintf("%s %s %s: %s -> %s", e.Time.Format(time.RFC3339), e.Machine, e.Type, from, e.To)
+}
+
+// machineStatus is what events are watched for on a machine.
+type machineStatus struct {
+	State      state.State
+	URL        string
+	IP         string
+	Docker     bool
+	CertsValid bool
+	Error      string
+}
+
+func (s machineStatus) fields() [][2]string {
+	return [][2]string{
+		{"state", s.State.String()},
+		{"url", s.URL},
+		{"ip", s.IP},
+		{"docker", reachability(s.Docker)},
+		{"certs", validity(s.CertsValid)},
+		{"error", s.Error},
+	}
+}
+
+func reachability(reachable bool) string {
+	if reachable {
+		return "reachable"
+	}
+	return "unreachable"
+}
+
+func validity(valid bool) string {
+	if valid {
+		return "valid"
+	}
+	return "invalid"
+}
+
+// pollMachine gets the status of a machine. The error is the one getting
+// its state, the rest is only looked at once it's running.
+func pollMachine(h *host.Host) (machineStatus, error) {
+	status := machineStatus{
+		CertsValid: certsValid(h),
+	}
+
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return status, err
+	}
+	status.State = currentState
+
+	if currentState != state.Running {
+		return status, nil
+	}
+
+	if status.URL, err = h.URL(); err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+
+	if status.IP, err = h.Driver.GetIP(); err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+
+	if h.NoTLS() {
+		_, err = h.DockerVersion()
+	} else {
+		_, err = mcndockerclient.DockerVersion(&mcndockerclient.RemoteDocker{
+			HostURL:    status.URL,
+			AuthOption: h.AuthOptions(),
+			JumpHosts:  h.SSHJumpHosts(),
+		})
+	}
+	status.Docker = err == nil
+
+	return status, nil
+}
+
+// certsValid tells whether none of the certificates of a machine expired.
+// Machines reached over SSH have none.
+func certsValid(h *host.Host) bool {
+	if h.NoTLS() {
+		return true
+	}
+
+	authOptions := h.AuthOptions()
+	if authOptions == nil {
+		return false
+	}
+
+	for _, path := range []string{authOptions.CaCertPath, authOptions.ClientCertPath, authOptions.ServerCertPath} {
+		if valid, err := cert.CheckCertificateDate(path); err != nil || !valid {
+			return false
+		}
+	}
+
+	return true
+}
+
+// diffStatus returns the events between two statuses of a machine, all of
+// its values if there's no previous status.
+func diffStatus(name string, previous *machineStatus, current machineStatus) []machineEvent {
+	now := time.Now()
+	events := []machineEvent{}
+
+	currentFields := current.fields()
+	for i, field := range currentFields {
+		from := ""
+		if previous != nil {
+			from = previous.fields()[i][1]
+			if from == field[1] {
+				continue
+			}
+		} else if field[0] == "error" && field[1] == "" {
+			continue
+		}
+
+		events = append(events, machineEvent{
+			Time:    now,
+			Machine: name,
+			Type:    field[0],
+			From:    from,
+			To:      field[1],
+		})
+	}
+
+	return events
+}
+
+// backoff is the interval between the polls of a machine, which doubles
+// up to max while polling it fails.
+type backoff struct {
+	base, max, current time.Duration
+}
+
+func (b *backoff) next(failed bool) time.Duration {
+	switch {
+	case !failed || b.current == 0:
+		b.current = b.base
+	case b.current*2 > b.max:
+		b.current = b.max
+	default:
+		b.current *= 2
+	}
+	return b.current
+}
+
+type watchedMachine struct {
+	host     *host.Host
+	stamp    string
+	status   *machineStatus
+	backoff  *backoff
+	nextPoll time.Time
+	polling  bool
+}
+
+type pollResult struct {
+	name   string
+	status machineStatus
+	err    error
+}
+
+// eventWatcher polls machines for changes.
+type eventWatcher struct {
+	api         libmachine.API
+	filters     FilterOptions
+	interval    time.Duration
+	maxInterval time.Duration
+	emit        func(machineEvent)
+
+	machines map[string]*watchedMachine
+	results  chan pollResult
+	stop     <-chan struct{}
+}
+
+// refresh loads the machines which showed up in the store and forgets the
+// ones which were removed. Machines are loaded again when their config
+// changed, if the store can tell, and otherwise once. Loading them starts
+// their driver plugin, the one of the previous load is stopped.
+func (w *eventWatcher) refresh() {
+	names, err := w.api.List()
+	if err != nil {
+		log.Debugf("Error listing machines: %s", err)
+		return
+	}
+
+	stamper, _ := storeOf(w.api).(persist.Stamper)
+
+	exists := map[string]bool{}
+	for _, name := range names {
+		exists[name] = true
+
+		stamp := ""
+		if stamper != nil {
+			if stamp, err = stamper.ConfigStamp(name); err != nil {
+				log.Debugf("Error checking the config of %s: %s", name, err)
+				continue
+			}
+		}
+
+		// Machines being polled are loaded again on the next refresh.
+		machine, ok := w.machines[name]
+		if ok && (machine.stamp == stamp || machine.polling) {
+			continue
+		}
+
+		h, err := w.api.Load(name)
+		if err != nil {
+			log.Debugf("Error loading %s: %s", name, err)
+			continue
+		}
+
+		if ok {
+			closeDriver(machine.host)
+			machine.host = h
+			machine.stamp = stamp
+			continue
+		}
+
+		w.machines[name] = &watchedMachine{
+			host:    h,
+			stamp:   stamp,
+			backoff: &backoff{base: w.interval, max: w.maxInterval},
+		}
+	}
+
+	for name, machine := range w.machines {
+		if exists[name] {
+			continue
+		}
+
+		if machine.status != nil {
+			w.emit(machineEvent{
+				Time:    time.Now(),
+				Machine: name,
+				Type:    "removed",
+			})
+		}
+		if !machine.polling {
+			closeDriver(machine.host)
+		}
+		delete(w.machines, name)
+	}
+}
+
+// closeDriver stops the driver plugin of a machine which is no longer
+// watched.
+func closeDriver(h *host.Host) {
+	closer, ok := h.Driver.(io.Closer)
+	if !ok {
+		return
+	}
+
+	if err := closer.Close(); err != nil {
+		log.Debugf("Error closing the driver of %s: %s", h.Name, err)
+	}
+}
+
+// poll starts polling the machines matching the filters which are due.
+func (w *eventWatcher) poll() {
+	hosts := []*host.Host{}
+	for _, machine := range w.machines {
+		hosts = append(hosts, machine.host)
+	}
+
+	now := time.Now()
+	for _, h := range filterHosts(hosts, w.filters) {
+		machine := w.machines[h.Name]
+		if machine.polling || now.Before(machine.nextPoll) {
+			continue
+		}
+
+		machine.polling = true
+		go func(h *host.Host) {
+			status, err := pollMachine(h)
+			select {
+			case w.results <- pollResult{h.Name, status, err}:
+			case <-w.stop:
+			}
+		}(h)
+	}
+}
+
+func (w *eventWatcher) handle(result pollResult) {
+	machine, ok := w.machines[result.name]
+	if !ok {
+		return
+	}
+
+	machine.polling = false
+	machine.nextPoll = time.Now().Add(machine.backoff.next(result.err != nil))
+
+	// Machines which can't be polled keep their last known values.
+	status := result.status
+	if result.err != nil {
+		if machine.status == nil {
+			status = machineStatus{State: state.Error}
+		} else {
+			status = *machine.status
+		}
+		status.Error = result.err.Error()
+	}
+
+	for _, event := range diffStatus(result.name, machine.status, status) {
+		w.emit(event)
+	}
+	machine.status = &status
+}
+
+func (w *eventWatcher) watch(stop <-chan struct{}) {
+	w.machines = map[string]*watchedMachine{}
+	w.results = make(chan pollResult)
+	w.stop = stop
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	w.refresh()
+	w.poll()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case result := <-w.results:
+			w.handle(result)
+		case <-ticker.C:
+			w.refresh()
+			w.poll()
+		}
+	}
+}
+
+func printEvent(out io.Writer, output string) func(machineEvent) {
+	return func(event machineEvent) {
+		if output == outputJSON {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintln(out, string(data))
+			return
+		}
+
+		fmt.Fprintln(out, event)
+	}
+}
+
+func cmdEvents(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 0 {
+		return ErrTooManyArguments
+	}
+
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON); err != nil {
+		return err
+	}
+
+	filters, err := parseFilters(c.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
+	interval := time.Duration(c.Int("interval")) * time.Second
+	maxInterval := time.Duration(c.Int("max-interval")) * time.Second
+	if interval <= 0 {
+		return fmt.Errorf("Error: the interval must be positive")
+	}
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+
+	watcher := &eventWatcher{
+		api:         api,
+		filters:     filters,
+		interval:    interval,
+		maxInterval: maxInterval,
+		emit:        printEvent(os.Stdout, output),
+	}
+
+	// Stop watching on interrupt, for the driver plugins to be closed.
+	interrupt := make(chan os.Signal, 1)
+	defer notifySignals(interrupt, os.Interrupt)()
+
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	watcher.watch(stop)
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/mcndockerclient"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func eventTypes(events []machineEvent) []string {
+	types := []string{}
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+	return types
+}
+
+func TestDiffStatus(t *testing.T) {
+	initial := diffStatus("foo", nil, machineStatus{State: state.Stopped})
+	assert.Equal(t, []string{"state", "url", "ip", "docker", "certs"}, eventTypes(initial))
+	assert.Equal(t, "Stopped", initial[0].To)
+	assert.Empty(t, initial[0].From)
+
+	previous := machineStatus{State: state.Stopped}
+	current := machineStatus{State: state.Running, URL: "tcp://1.2.3.4:2376", IP: "1.2.3.4", Docker: true}
+
+	events := diffStatus("foo", &previous, current)
+	assert.Equal(t, []string{"state", "url", "ip", "docker"}, eventTypes(events))
+	assert.Equal(t, machineEvent{Time: events[0].Time, Machine: "foo", Type: "state", From: "Stopped", To: "Running"}, events[0])
+	assert.Equal(t, machineEvent{Time: events[3].Time, Machine: "foo", Type: "docker", From: "unreachable", To: "reachable"}, events[3])
+
+	assert.Empty(t, diffStatus("foo", &current, current))
+}
+
+func TestBackoff(t *testing.T) {
+	b := &backoff{base: time.Second, max: 5 * time.Second}
+
+	assert.Equal(t, time.Second, b.next(false))
+	assert.Equal(t, 2*time.Second, b.next(true))
+	assert.Equal(t, 4*time.Second, b.next(true))
+	assert.Equal(t, 5*time.Second, b.next(true))
+	assert.Equal(t, 5*time.Second, b.next(true))
+	assert.Equal(t, time.Second, b.next(false))
+}
+
+func TestEventWatcherHandle(t *testing.T) {
+	events := []machineEvent{}
+	watcher := &eventWatcher{
+		interval:    time.Second,
+		maxInterval: time.Minute,
+		emit:        func(event machineEvent) { events = append(events, event) },
+		machines: map[string]*watchedMachine{
+			"foo": {backoff: &backoff{base: time.Second, max: time.Minute}},
+		},
+	}
+
+	watcher.handle(pollResult{name: "foo", status: machineStatus{State: state.Running}})
+	assert.Len(t, events, 5)
+
+	// A failed poll keeps the last values, with the error.
+	events = nil
+	watcher.handle(pollResult{name: "foo", err: errors.New("API rate limit exceeded")})
+	assert.Equal(t, []string{"error"}, eventTypes(events))
+	assert.Equal(t, "API rate limit exceeded", events[0].To)
+	assert.Equal(t, 2*time.Second, watcher.machines["foo"].backoff.current)
+
+	events = nil
+	watcher.handle(pollResult{name: "foo", status: machineStatus{State: state.Stopped}})
+	assert.Equal(t, []string{"state", "error"}, eventTypes(events))
+	assert.Equal(t, time.Second, watcher.machines["foo"].backoff.current)
+}
+
+func TestEventWatcherWatch(t *testing.T) {
+	defer func(versioner mcndockerclient.DockerVersioner) { mcndockerclient.CurrentDockerVersioner = versioner }(mcndockerclient.CurrentDockerVersioner)
+	mcndockerclient.CurrentDockerVersioner = &mcndockerclient.FakeDockerVersioner{Version: "17.06.0"}
+
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name:       "foo",
+				DriverName: "amazonec2",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+					MockIP:    "1.2.3.4",
+				},
+			},
+			{
+				Name:       "bar",
+				DriverName: "virtualbox",
+				Driver: &fakedriver.Driver{
+					MockState: state.Stopped,
+				},
+			},
+		},
+	}
+
+	filters, _ := parseFilters([]string{"driver=amazonec2"})
+	received := make(chan machineEvent, 10)
+	watcher := &eventWatcher{
+		api:         api,
+		filters:     filters,
+		interval:    time.Hour,
+		maxInterval: time.Hour,
+		emit:        func(event machineEvent) { received <- event },
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		watcher.watch(stop)
+		close(done)
+	}()
+
+	events := []machineEvent{}
+	for len(events) < 5 {
+		events = append(events, <-received)
+	}
+	close(stop)
+	<-done
+
+	assert.Equal(t, []string{"state", "url", "ip", "docker", "certs"}, eventTypes(events))
+	for _, event := range events {
+		assert.Equal(t, "foo", event.Machine)
+	}
+	assert.Equal(t, "tcp://1.2.3.4:2376", events[1].To)
+	assert.Equal(t, "reachable", events[3].To)
+	assert.Equal(t, "invalid", events[4].To)
+	assert.Empty(t, received)
+}
+
+// stampingAPI is a store which tells when the configs of its machines
+// change.
+type stampingAPI struct {
+	*libmachinetest.FakeAPI
+	stamps map[string]string
+	loads  int
+}
+
+func (api *stampingAPI) Load(name string) (*host.Host, error) {
+	api.loads++
+	return api.FakeAPI.Load(name)
+}
+
+func (api *stampingAPI) ConfigStamp(name string) (string, error) {
+	return api.stamps[name], nil
+}
+
+func TestEventWatcherRefreshReloadsChangedConfigs(t *testing.T) {
+	api := &stampingAPI{
+		FakeAPI: &libmachinetest.FakeAPI{
+			Hosts: []*host.Host{
+				{
+					Name:   "foo",
+					Driver: &fakedriver.Driver{},
+				},
+			},
+		},
+		stamps: map[string]string{"foo": "1"},
+	}
+
+	watcher := &eventWatcher{
+		api:      api,
+		machines: map[string]*watchedMachine{},
+	}
+
+	watcher.refresh()
+	watcher.refresh()
+	assert.Equal(t, 1, api.loads)
+
+	// Machines being polled are loaded once the poll is done.
+	api.stamps["foo"] = "2"
+	watcher.machines["foo"].polling = true
+	watcher.refresh()
+	assert.Equal(t, 1, api.loads)
+
+	watcher.machines["foo"].polling = false
+	watcher.refresh()
+	assert.Equal(t, 2, api.loads)
+	assert.Equal(t, "2", watcher.machines["foo"].stamp)
+
+	watcher.refresh()
+	assert.Equal(t, 2, api.loads)
+}
@@ -0,0 +1,240 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/persist"
+	"github.com/docker/machine/libmachine/state"
+)
+
+var (
+	errNoExecCommand     = errors.New("Error: expected a command to run, after --")
+	errNoMachinesMatched = errors.New("Error: no machine matches the filters")
+	errExecSkipped       = errors.New("skipped after an earlier failure")
+)
+
+// execResult is the outcome of a command run on one machine. ExitCode is -1
+// if the command couldn't be run at all.
+type execResult struct {
+	Name     string
+	ExitCode int
+	Duration string
+	Error    string `json:",omitempty"`
+}
+
+// prefixedOutput writes the output of commands running on several machines
+// line by line, each line prefixed with the name of its machine.
+type prefixedOutput struct {
+	sync.Mutex
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func (o *prefixedOutput) copy(w io.Writer, name string, r io.Reader) {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			o.Lock()
+			fmt.Fprintf(w, "%s: %s\n", name, strings.TrimSuffix(line, "\n"))
+			o.Unlock()
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Debugf("Error reading the output of %s: %s", name, err)
+			}
+			return
+		}
+	}
+}
+
+// exitStatus returns the exit status of a command which failed, for both
+// the native and the external SSH clients.
+func exitStatus(err error) (int, bool) {
+	switch e := err.(type) {
+	case interface {
+		ExitStatus() int
+	}:
+		return e.ExitStatus(), true
+	case interface {
+		ExitCode() int
+	}:
+		return e.ExitCode(), true
+	}
+	return -1, false
+}
+
+// execOnMachine runs a command on a machine over SSH and streams its output.
+func execOnMachine(h *host.Host, command string, output *prefixedOutput) (int, error) {
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return -1, err
+	}
+
+	if currentState != state.Running {
+		return -1, errStateInvalidForSSH{h.Name}
+	}
+
+	client, err := h.CreateSSHClient()
+	if err != nil {
+		return -1, err
+	}
+
+	stdout, stderr, err := client.Start(command)
+	if err != nil {
+		return -1, err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		output.copy(output.stdout, h.Name, stdout)
+	}()
+	go func() {
+		defer wg.Done()
+		output.copy(output.stderr, h.Name, stderr)
+	}()
+	wg.Wait()
+
+	if err := client.Wait(); err != nil {
+		code, _ := exitStatus(err)
+		return code, err
+	}
+
+	return 0, nil
+}
+
+// execOnMachines runs a command on machines, at most parallel at a time, or
+// as many as their drivers allow if parallel is 0. With failFast, the machines which haven't started yet once the command
+// failed on one are skipped, the ones already running it are waited for.
+func execOnMachines(api libmachine.API, hosts []*host.Host, command string, parallel int, failFast bool, output *prefixedOutput) ([]execResult, int) {
+	var (
+		results    = make([]execResult, len(hosts))
+		semaphores = machineSemaphores(hosts, parallel)
+		failed     = make(chan struct{})
+		failOnce   sync.Once
+		failures   int
+		mutex      sync.Mutex
+		wg         sync.WaitGroup
+	)
+
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h *host.Host, semaphore chan struct{}) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			code, err := -1, errExecSkipped
+
+			select {
+			case <-failed:
+			default:
+				code, err = execOnMachine(h, command, output)
+				if code >= 0 {
+					touchHost(api, h)
+				}
+			}
+
+			results[i] = execResult{
+				Name:     h.Name,
+				ExitCode: code,
+				Duration: time.Since(start).Round(time.Millisecond).String(),
+			}
+
+			if err != nil {
+				results[i].Error = err.Error()
+
+				mutex.Lock()
+				failures++
+				mutex.Unlock()
+
+				if failFast {
+					failOnce.Do(func() { close(failed) })
+				}
+			}
+		}(i, h, semaphores[i])
+	}
+
+	wg.Wait()
+
+	return results, failures
+}
+
+func printExecResults(w io.Writer, results []execResult) {
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "MACHINE\tEXIT\tDURATION\tERROR")
+	for _, result := range results {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", result.Name, result.ExitCode, result.Duration, result.Error)
+	}
+}
+
+func cmdExec(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) == 0 {
+		c.ShowHelp()
+		return errNoExecCommand
+	}
+
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
+	filters, err := parseFilters(c.StringSlice("filter"))
+	if err != nil {
+		return err
+	}
+
+	hostList, _, err := persist.LoadAllHosts(api)
+	if err != nil {
+		return err
+	}
+
+	hostList = filterHosts(hostList, filters)
+	if len(hostList) == 0 {
+		return errNoMachinesMatched
+	}
+
+	// The output of the machines goes to stderr when the summary is
+	// printed as json or yaml, for it to be the only thing on stdout.
+	prefixed := &prefixedOutput{
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+	}
+	if output != "" {
+		prefixed.stdout = os.Stderr
+	}
+
+	command := strings.Join(c.Args(), " ")
+	results, failures := execOnMachines(api, hostList, command, c.GlobalInt("parallel"), c.Bool("fail-fast"), prefixed)
+
+	if output != "" {
+		if err := printOutput(os.Stdout, output, results); err != nil {
+			return err
+		}
+	} else {
+		printExecResults(os.Stderr, results)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("Error: command failed on %d of %d machines", failures, len(results))
+	}
+
+	return nil
+}
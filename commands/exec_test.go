@@ -0,0 +1,199 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeExitError struct {
+	status int
+}
+
+func (e fakeExitError) Error() string {
+	return fmt.Sprintf("Process exited with status %d", e.status)
+}
+
+func (e fakeExitError) ExitStatus() int {
+	return e.status
+}
+
+// execClient is an SSH client whose command prints stdout and exits with
+// status.
+type execClient struct {
+	ssh.Client
+	stdout string
+	status int
+}
+
+func (c *execClient) Start(command string) (io.ReadCloser, io.ReadCloser, error) {
+	return ioutil.NopCloser(strings.NewReader(c.stdout)), ioutil.NopCloser(strings.NewReader("")), nil
+}
+
+func (c *execClient) Wait() error {
+	if c.status != 0 {
+		return fakeExitError{c.status}
+	}
+	return nil
+}
+
+// execClientCreator hands out the client of each machine by name.
+type execClientCreator map[string]*execClient
+
+func (creator execClientCreator) CreateSSHClient(d drivers.Driver) (ssh.Client, error) {
+	return creator[d.GetMachineName()], nil
+}
+
+func execTestHost(name, driverName string, currentState state.State) *host.Host {
+	return &host.Host{
+		Name:       name,
+		DriverName: driverName,
+		Driver: &fakedriver.Driver{
+			MockName:  name,
+			MockState: currentState,
+		},
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	code, ok := exitStatus(fakeExitError{2})
+	assert.True(t, ok)
+	assert.Equal(t, 2, code)
+
+	code, ok = exitStatus(errors.New("connection refused"))
+	assert.False(t, ok)
+	assert.Equal(t, -1, code)
+}
+
+func TestPrefixedOutput(t *testing.T) {
+	buf := &bytes.Buffer{}
+	output := &prefixedOutput{stdout: buf}
+
+	output.copy(buf, "foo", strings.NewReader("one\ntwo\nno newline"))
+
+	assert.Equal(t, "foo: one\nfoo: two\nfoo: no newline\n", buf.String())
+}
+
+func TestExecOnMachines(t *testing.T) {
+	defer host.SetSSHClientCreator(&host.StandardSSHClientCreator{})
+	host.SetSSHClientCreator(execClientCreator{
+		"foo": {stdout: "hello from foo\n"},
+		"bar": {stdout: "hello from bar\n", status: 3},
+	})
+
+	hosts := []*host.Host{
+		execTestHost("foo", "none", state.Running),
+		execTestHost("bar", "none", state.Running),
+		execTestHost("baz", "none", state.Stopped),
+	}
+
+	buf := &bytes.Buffer{}
+	output := &prefixedOutput{stdout: buf, stderr: ioutil.Discard}
+
+	results, failures := execOnMachines(&libmachinetest.FakeAPI{}, hosts, "echo hello", 2, false, output)
+
+	assert.Equal(t, 2, failures)
+	assert.Equal(t, "foo", results[0].Name)
+	assert.Equal(t, 0, results[0].ExitCode)
+	assert.Empty(t, results[0].Error)
+	assert.Equal(t, "bar", results[1].Name)
+	assert.Equal(t, 3, results[1].ExitCode)
+	assert.Equal(t, "baz", results[2].Name)
+	assert.Equal(t, -1, results[2].ExitCode)
+	assert.Equal(t, errStateInvalidForSSH{"baz"}.Error(), results[2].Error)
+
+	assert.Contains(t, buf.String(), "foo: hello from foo\n")
+	assert.Contains(t, buf.String(), "bar: hello from bar\n")
+}
+
+func TestExecOnMachinesFailFast(t *testing.T) {
+	defer host.SetSSHClientCreator(&host.StandardSSHClientCreator{})
+	host.SetSSHClientCreator(execClientCreator{
+		"foo": {status: 1},
+		"bar": {},
+	})
+
+	hosts := []*host.Host{
+		execTestHost("foo", "none", state.Running),
+		execTestHost("bar", "none", state.Running),
+	}
+
+	output := &prefixedOutput{stdout: ioutil.Discard, stderr: ioutil.Discard}
+
+	results, failures := execOnMachines(&libmachinetest.FakeAPI{}, hosts, "false", 1, true, output)
+
+	// With one machine at a time, bar is skipped once foo failed, unless
+	// it was first to take the slot.
+	assert.Equal(t, 1, results[0].ExitCode)
+	if results[1].ExitCode == 0 {
+		assert.Equal(t, 1, failures)
+	} else {
+		assert.Equal(t, 2, failures)
+		assert.Equal(t, errExecSkipped.Error(), results[1].Error)
+	}
+}
+
+func TestCmdExecFilters(t *testing.T) {
+	defer host.SetSSHClientCreator(&host.StandardSSHClientCreator{})
+	host.SetSSHClientCreator(execClientCreator{
+		"foo": {stdout: "foo\n"},
+		"bar": {stdout: "bar\n"},
+	})
+
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"hostname"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"filter": []string{"driver=amazonec2"},
+				"output": "json",
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			execTestHost("foo", "amazonec2", state.Running),
+			execTestHost("bar", "virtualbox", state.Running),
+		},
+	}
+
+	assert.NoError(t, cmdExec(commandLine, api))
+
+	results := []execResult{}
+	assert.NoError(t, json.Unmarshal([]byte(stdoutGetter.Output()), &results))
+	assert.Len(t, results, 1)
+	assert.Equal(t, "foo", results[0].Name)
+	assert.Equal(t, 0, results[0].ExitCode)
+}
+
+func TestCmdExecErrors(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{}
+	assert.Equal(t, errNoExecCommand, cmdExec(commandLine, &libmachinetest.FakeAPI{}))
+	assert.True(t, commandLine.HelpShown)
+
+	commandLine = &commandstest.FakeCommandLine{
+		CliArgs: []string{"hostname"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"filter": []string{"name=nope"},
+			},
+		},
+	}
+	assert.Equal(t, errNoMachinesMatched, cmdExec(commandLine, &libmachinetest.FakeAPI{}))
+}
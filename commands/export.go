@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/persist"
+)
+
+var (
+	errStoreNotBundler = errors.New("Error: The machine store doesn't support exporting and importing machines")
+	errNoBundleFile    = errors.New("Error: Expected the path of a machine bundle as an argument")
+)
+
+func cmdExport(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 1 {
+		return ErrExpectedOneMachine
+	}
+
+	bundler, ok := storeOf(api).(persist.Bundler)
+	if !ok {
+		return errStoreNotBundler
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return err
+	}
+
+	output := c.String("output")
+	if output == "" {
+		output = target + ".tar.gz"
+	}
+
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := bundler.Export(target, f, c.Bool("certs")); err != nil {
+		f.Close()
+		os.Remove(output)
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	log.Infof("Exported %q to %s", target, output)
+
+	return nil
+}
+
+func cmdImport(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 1 {
+		c.ShowHelp()
+		return errNoBundleFile
+	}
+
+	bundler, ok := storeOf(api).(persist.Bundler)
+	if !ok {
+		return errStoreNotBundler
+	}
+
+	f, err := os.Open(c.Args().First())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	regenerateCerts := c.Bool("regenerate-certs")
+
+	name, err := bundler.Import(f, c.Bool("force"), regenerateCerts)
+	if err != nil {
+		return fmt.Errorf("Error importing machine: %s", err)
+	}
+
+	log.Infof("Imported %q", name)
+
+	if regenerateCerts {
+		return regenerateImportedCerts(api, name)
+	}
+
+	return nil
+}
+
+// regenerateImportedCerts signs the certificates of an imported machine
+// with the CA of the store.
+func regenerateImportedCerts(api libmachine.API, name string) error {
+	unlock, err := lockMachines(api, []string{name})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	h, err := api.Load(name)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Regenerating TLS certificates")
+
+	if err := h.ConfigureAuth(); err != nil {
+		return fmt.Errorf("Error regenerating the certificates of %q, run `docker-machine regenerate-certs %s` once it's reachable: %s", name, name, err)
+	}
+
+	return api.Save(h)
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/persist"
+)
+
+var errStoreNoHistory = errors.New("Error: The machine store doesn't keep the history of machines")
+
+func cmdHistory(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 1 {
+		return ErrExpectedOneMachine
+	}
+
+	historyStore, ok := storeOf(api).(persist.HistoryStore)
+	if !ok {
+		return errStoreNoHistory
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return err
+	}
+
+	if _, err := api.Load(target); err != nil {
+		return err
+	}
+
+	records, err := historyStore.History(target)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "TIME\tUSER\tCOMMAND\tARGS\tDURATION\tRESULT")
+	for _, record := range records {
+		result := record.Result
+		if record.Error != "" {
+			result = fmt.Sprintf("%s: %s", result, strings.Replace(record.Error, "\n", " ", -1))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			record.Time.Local().Format(time.RFC3339),
+			record.User,
+			record.Command,
+			strings.Join(record.Args, " "),
+			record.Duration.Round(time.Millisecond),
+			result)
+	}
+
+	return nil
+}
@@ -4,11 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"text/template"
 
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/ssh"
 )
 
+const redactedSecret = "<REDACTED>"
+
 var funcMap = template.FuncMap{
 	"json": func(v interface{}) string {
 		a, _ := json.Marshal(v)
@@ -36,6 +41,11 @@ func cmdInspect(c CommandLine, api libmachine.API) error {
 		return err
 	}
 
+	obj, err := inspectObject(host)
+	if err != nil {
+		return err
+	}
+
 	tmplString := c.String("format")
 	if tmplString != "" {
 		var tmpl *template.Template
@@ -44,23 +54,13 @@ func cmdInspect(c CommandLine, api libmachine.API) error {
 			return fmt.Errorf("template parsing error: %v", err)
 		}
 
-		jsonHost, err := json.Marshal(host)
-		if err != nil {
-			return err
-		}
-
-		obj := make(map[string]interface{})
-		if err := json.Unmarshal(jsonHost, &obj); err != nil {
-			return err
-		}
-
 		if err := tmpl.Execute(os.Stdout, obj); err != nil {
 			return err
 		}
 
 		os.Stdout.Write([]byte{'\n'})
 	} else {
-		prettyJSON, err := json.MarshalIndent(host, "", "    ")
+		prettyJSON, err := json.MarshalIndent(obj, "", "    ")
 		if err != nil {
 			return err
 		}
@@ -70,3 +70,43 @@ func cmdInspect(c CommandLine, api libmachine.API) error {
 
 	return nil
 }
+
+// inspectObject returns the config of a machine as inspect shows it, with
+// the credentials of its driver redacted.
+func inspectObject(h *host.Host) (map[string]interface{}, error) {
+	jsonHost, err := json.Marshal(h)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := make(map[string]interface{})
+	if err := json.Unmarshal(jsonHost, &obj); err != nil {
+		return nil, err
+	}
+
+	for _, field := range h.SecretFields {
+		object, ok := obj["Driver"].(map[string]interface{})
+		path := strings.Split(field, ".")
+
+		for _, name := range path[:len(path)-1] {
+			if !ok {
+				break
+			}
+			object, ok = object[name].(map[string]interface{})
+		}
+
+		if value, present := object[path[len(path)-1]]; ok && present && value != "" {
+			object[path[len(path)-1]] = redactedSecret
+		}
+	}
+
+	if h.SSHHostKey != "" {
+		fingerprint, err := ssh.Fingerprint(h.SSHHostKey)
+		if err != nil {
+			return nil, err
+		}
+		obj["SSHHostKeyFingerprint"] = fingerprint
+	}
+
+	return obj, nil
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/docker/machine/commands/commandstest"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/libmachinetest"
 	"github.com/stretchr/testify/assert"
 )
@@ -29,3 +30,34 @@ func TestCmdInspect(t *testing.T) {
 		assert.Equal(t, tc.expectedErr, err)
 	}
 }
+
+func TestInspectObjectRedactsSecrets(t *testing.T) {
+	h := &host.Host{
+		Name: "foo",
+		Driver: &host.RawDataDriver{
+			Data: []byte(`{"AccessToken": "t0k3n", "Client": {"User": "me", "ApiKey": "k3y"}, "Region": "eu"}`),
+		},
+		SecretFields: []string{"AccessToken", "Client.ApiKey", "Missing.Field"},
+	}
+
+	obj, err := inspectObject(h)
+	assert.NoError(t, err)
+
+	driver := obj["Driver"].(map[string]interface{})
+	assert.Equal(t, "<REDACTED>", driver["AccessToken"])
+	assert.Equal(t, "eu", driver["Region"])
+	assert.Equal(t, map[string]interface{}{"User": "me", "ApiKey": "<REDACTED>"}, driver["Client"])
+}
+
+func TestInspectObjectShowsSSHHostKeyFingerprint(t *testing.T) {
+	h := &host.Host{
+		Name:       "foo",
+		Driver:     &host.RawDataDriver{Data: []byte(`{}`)},
+		SSHHostKey: testHostKey,
+	}
+
+	obj, err := inspectObject(h)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "SHA256:WanU0av6hrg2s3u4NvTgZIzMVAy1AT6TSRxQUjIa68Y", obj["SSHHostKeyFingerprint"])
+}
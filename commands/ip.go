@@ -1,7 +1,54 @@
 package commands
 
-import "github.com/docker/machine/libmachine"
+import (
+	"fmt"
+	"os"
+
+	"github.com/docker/machine/libmachine"
+)
+
+type ipOutput struct {
+	Name  string
+	IP    string
+	Error string `json:",omitempty"`
+}
 
 func cmdIP(c CommandLine, api libmachine.API) error {
-	return runAction("ip", c, api)
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
+	results, err := runActionOnTargets("ip", c, api)
+
+	if output == "" {
+		for _, result := range results {
+			if result.Err == nil {
+				fmt.Println(result.Value)
+			}
+		}
+		if len(results) > 1 {
+			printResults(os.Stderr, "ip", results)
+		}
+		return err
+	}
+
+	if results == nil {
+		return err
+	}
+
+	ips := []ipOutput{}
+	for _, result := range results {
+		ip := ipOutput{Name: result.Name, IP: result.Value}
+		if result.Err != nil {
+			ip.Error = result.Err.Error()
+		}
+		ips = append(ips, ip)
+	}
+
+	if printErr := printOutput(os.Stdout, output, ips); printErr != nil {
+		return printErr
+	}
+
+	return err
 }
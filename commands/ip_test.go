@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/docker/machine/commands/commandstest"
@@ -77,3 +78,74 @@ func TestCmdIP(t *testing.T) {
 		stdoutGetter.Stop()
 	}
 }
+
+func TestCmdIPOutputJSON(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"foo", "bar"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"output": "json",
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "foo",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+					MockIP:    "1.2.3.4",
+				},
+			},
+			{
+				Name: "bar",
+				Driver: &fakedriver.Driver{
+					MockState: state.Stopped,
+				},
+			},
+		},
+	}
+
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	err := cmdIP(commandLine, api)
+
+	assert.EqualError(t, err, "Error: ip failed on 1 of 2 machines")
+
+	ips := []ipOutput{}
+	assert.NoError(t, json.Unmarshal([]byte(stdoutGetter.Output()), &ips))
+	assert.Equal(t, ipOutput{Name: "foo", IP: "1.2.3.4"}, ips[0])
+	assert.Equal(t, "bar", ips[1].Name)
+	assert.NotEmpty(t, ips[1].Error)
+}
+
+func TestCmdIPOutputMissingMachine(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"foo", "bar"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"output": "yaml",
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "foo",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+					MockIP:    "1.2.3.4",
+				},
+			},
+		},
+	}
+
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	err := cmdIP(commandLine, api)
+
+	assert.Error(t, err)
+	assert.Empty(t, stdoutGetter.Output())
+}
@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -46,7 +48,11 @@ var (
 		"Error":         "ERRORS",
 		"DockerVersion": "DOCKER",
 		"ResponseTime":  "RESPONSE",
+		"Created":       "CREATED",
+		"LastUsed":      "LAST_USED",
 	}
+
+	errInvalidSortKey = errors.New("Unsupported sort key, expected name, driver, created, last-used or tag:<key>")
 )
 
 type HostListItem struct {
@@ -63,6 +69,9 @@ type HostListItem struct {
 	Error         string
 	DockerVersion string
 	ResponseTime  time.Duration
+	Created       time.Time
+	LastUsed      time.Time
+	Tags          map[string]string
 }
 
 // FilterOptions -
@@ -72,6 +81,7 @@ type FilterOptions struct {
 	State      []string
 	Name       []string
 	Labels     []string
+	Tags       []string
 }
 
 func cmdLs(c CommandLine, api libmachine.API) error {
@@ -85,37 +95,41 @@ func cmdLs(c CommandLine, api libmachine.API) error {
 		return err
 	}
 
+	less, err := parseSortKey(c.String("sort"))
+	if err != nil {
+		return err
+	}
+
 	hostList = filterHosts(hostList, filters)
 
 	// Just print out the names if we're being quiet
 	if c.Bool("quiet") {
+		items := []HostListItem{}
 		for _, host := range hostList {
-			fmt.Println(host.Name)
+			items = append(items, withMetadata(HostListItem{Name: host.Name, DriverName: host.DriverName}, host))
+		}
+		sortHostListItemsByName(items)
+		sortHostListItems(items, less)
+
+		for _, item := range items {
+			fmt.Println(item.Name)
 		}
 		return nil
 	}
 
-	template, table, err := parseFormat(c.String("format"))
-	if err != nil {
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
 		return err
 	}
 
-	var w io.Writer
-	if table {
-		tabWriter := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-		defer tabWriter.Flush()
-
-		w = tabWriter
-
-		if err := template.Execute(w, headers); err != nil {
-			return err
-		}
-	} else {
-		w = os.Stdout
+	template, table, err := parseFormat(c.String("format"))
+	if err != nil {
+		return err
 	}
 
 	timeout := time.Duration(c.Int("timeout")) * time.Second
 	items := getHostListItems(hostList, hostInError, timeout)
+	sortHostListItems(items, less)
 
 	swarmMasters := make(map[string]string)
 	swarmInfo := make(map[string]string)
@@ -133,7 +147,7 @@ func cmdLs(c CommandLine, api libmachine.API) error {
 		}
 	}
 
-	for _, item := range items {
+	for i, item := range items {
 		swarmColumn := ""
 		if item.SwarmOptions != nil && item.SwarmOptions.Discovery != "" {
 			swarmColumn = swarmMasters[item.SwarmOptions.Discovery]
@@ -141,8 +155,28 @@ func cmdLs(c CommandLine, api libmachine.API) error {
 				swarmColumn = fmt.Sprintf("%s (master)", swarmColumn)
 			}
 		}
-		item.Swarm = swarmColumn
+		items[i].Swarm = swarmColumn
+	}
+
+	if output != "" {
+		return printOutput(os.Stdout, output, items)
+	}
+
+	var w io.Writer
+	if table {
+		tabWriter := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+		defer tabWriter.Flush()
+
+		w = tabWriter
+
+		if err := template.Execute(w, tableHeaders(items)); err != nil {
+			return err
+		}
+	} else {
+		w = os.Stdout
+	}
 
+	for _, item := range items {
 		if err := template.Execute(w, item); err != nil {
 			return err
 		}
@@ -151,6 +185,22 @@ func cmdLs(c CommandLine, api libmachine.API) error {
 	return nil
 }
 
+// MarshalJSON writes the state and response time of the machine as text,
+// for the output of ls.
+func (item HostListItem) MarshalJSON() ([]byte, error) {
+	type hostListItem HostListItem
+
+	return json.Marshal(struct {
+		hostListItem
+		State        string
+		ResponseTime string
+	}{
+		hostListItem: hostListItem(item),
+		State:        item.State.String(),
+		ResponseTime: item.ResponseTime.String(),
+	})
+}
+
 func parseFormat(format string) (*template.Template, bool, error) {
 	table := false
 	finalFormat := format
@@ -176,6 +226,59 @@ func parseFormat(format string) (*template.Template, bool, error) {
 	return template, table, nil
 }
 
+// tableHeaders returns the headers of the table columns, including the ones
+// of the tags used in templates such as {{ .Tags.owner }}.
+func tableHeaders(items []HostListItem) map[string]interface{} {
+	tableHeaders := map[string]interface{}{}
+	for field, header := range headers {
+		tableHeaders[field] = header
+	}
+
+	tagHeaders := map[string]string{}
+	for _, item := range items {
+		for key := range item.Tags {
+			tagHeaders[key] = strings.ToUpper(key)
+		}
+	}
+	tableHeaders["Tags"] = tagHeaders
+
+	return tableHeaders
+}
+
+// parseSortKey returns how to order machines for a sort key. Keys prefixed
+// with - sort in descending order, machines are sorted by name by default.
+func parseSortKey(key string) (func(a, b HostListItem) bool, error) {
+	descending := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+
+	var less func(a, b HostListItem) bool
+
+	switch {
+	case key == "" || key == "name":
+		less = func(a, b HostListItem) bool {
+			return naturalsort.NaturalSort{strings.ToLower(a.Name), strings.ToLower(b.Name)}.Less(0, 1)
+		}
+	case key == "driver":
+		less = func(a, b HostListItem) bool { return a.DriverName < b.DriverName }
+	case key == "created":
+		less = func(a, b HostListItem) bool { return a.Created.Before(b.Created) }
+	case key == "last-used":
+		less = func(a, b HostListItem) bool { return a.LastUsed.Before(b.LastUsed) }
+	case strings.HasPrefix(key, "tag:") && len(key) > len("tag:"):
+		tag := strings.TrimPrefix(key, "tag:")
+		less = func(a, b HostListItem) bool { return a.Tags[tag] < b.Tags[tag] }
+	default:
+		return nil, errInvalidSortKey
+	}
+
+	if descending {
+		ascending := less
+		return func(a, b HostListItem) bool { return ascending(b, a) }, nil
+	}
+
+	return less, nil
+}
+
 func parseFilters(filters []string) (FilterOptions, error) {
 	options := FilterOptions{}
 	for _, f := range filters {
@@ -196,6 +299,8 @@ func parseFilters(filters []string) (FilterOptions, error) {
 			options.Name = append(options.Name, value)
 		case "label":
 			options.Labels = append(options.Labels, value)
+		case "tag":
+			options.Tags = append(options.Tags, value)
 		default:
 			return options, fmt.Errorf("Unsupported filter key '%s'", key)
 		}
@@ -208,7 +313,8 @@ func filterHosts(hosts []*host.Host, filters FilterOptions) []*host.Host {
 		len(filters.DriverName) == 0 &&
 		len(filters.State) == 0 &&
 		len(filters.Name) == 0 &&
-		len(filters.Labels) == 0 {
+		len(filters.Labels) == 0 &&
+		len(filters.Tags) == 0 {
 		return hosts
 	}
 
@@ -242,8 +348,9 @@ func filterHost(host *host.Host, filters FilterOptions, swarmMasters map[string]
 	stateMatches := matchesState(host, filters.State)
 	nameMatches := matchesName(host, filters.Name)
 	labelMatches := matchesLabel(host, filters.Labels)
+	tagMatches := matchesTag(host, filters.Tags)
 
-	return swarmMatches && driverMatches && stateMatches && nameMatches && labelMatches
+	return swarmMatches && driverMatches && stateMatches && nameMatches && labelMatches && tagMatches
 }
 
 func matchesSwarmName(host *host.Host, swarmNames []string, swarmMasters map[string]string) bool {
@@ -328,10 +435,29 @@ func matchesLabel(host *host.Host, labels []string) bool {
 	return false
 }
 
+// matchesTag matches tags given as key=value, or as key for machines having
+// the tag whatever its value.
+func matchesTag(host *host.Host, tags []string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+
+	hostTags := host.Tags()
+
+	for _, t := range tags {
+		kv := strings.SplitN(t, "=", 2)
+		val, exists := hostTags[kv[0]]
+		if exists && (len(kv) == 1 || strings.EqualFold(val, kv[1])) {
+			return true
+		}
+	}
+	return false
+}
+
 // PERFORMANCE: The code of this function is complicated because we try
 // to call the underlying drivers as less as possible to get the information
 // we need.
-func attemptGetHostState(h *host.Host, stateQueryChan chan<- HostListItem) {
+func attemptGetHostState(ctx context.Context, h *host.Host, stateQueryChan chan<- HostListItem) {
 	requestBeginning := time.Now()
 	url := ""
 	currentState := state.None
@@ -346,20 +472,25 @@ func attemptGetHostState(h *host.Host, stateQueryChan chan<- HostListItem) {
 		if url != "" {
 			currentState = state.Running
 		} else {
-			currentState, err = h.Driver.GetState()
+			currentState, err = drivers.GetState(ctx, h.Driver)
 		}
 	} else {
-		currentState, _ = h.Driver.GetState()
+		currentState, _ = drivers.GetState(ctx, h.Driver)
 	}
 
 	if err == nil && url != "" {
-		// PERFORMANCE: Reuse the url instead of asking the host again.
-		// This reduces the number of calls to the drivers
-		dockerHost := &mcndockerclient.RemoteDocker{
-			HostURL:    url,
-			AuthOption: h.AuthOptions(),
+		if h.NoTLS() {
+			dockerVersion, err = h.DockerVersion()
+		} else {
+			// PERFORMANCE: Reuse the url instead of asking the host again.
+			// This reduces the number of calls to the drivers
+			dockerHost := &mcndockerclient.RemoteDocker{
+				HostURL:    url,
+				AuthOption: h.AuthOptions(),
+				JumpHosts:  h.SSHJumpHosts(),
+			}
+			dockerVersion, err = mcndockerclient.DockerVersion(dockerHost)
 		}
-		dockerVersion, err = mcndockerclient.DockerVersion(dockerHost)
 
 		if err != nil {
 			dockerVersion = "Unknown"
@@ -399,7 +530,7 @@ func attemptGetHostState(h *host.Host, stateQueryChan chan<- HostListItem) {
 		active = "* (swarm)"
 	}
 
-	stateQueryChan <- HostListItem{
+	stateQueryChan <- withMetadata(HostListItem{
 		Name:          h.Name,
 		Active:        active,
 		ActiveHost:    activeHost,
@@ -412,7 +543,7 @@ func attemptGetHostState(h *host.Host, stateQueryChan chan<- HostListItem) {
 		DockerVersion: dockerVersion,
 		Error:         hostError,
 		ResponseTime:  time.Now().Round(time.Millisecond).Sub(requestBeginning.Round(time.Millisecond)),
-	}
+	}, h)
 }
 
 func getHostState(h *host.Host, hostListItemsChan chan<- HostListItem, timeout time.Duration) {
@@ -420,7 +551,11 @@ func getHostState(h *host.Host, hostListItemsChan chan<- HostListItem, timeout t
 	// about the host in the case of a successful read.
 	stateQueryChan := make(chan HostListItem)
 
-	go attemptGetHostState(h, stateQueryChan)
+	// Drivers supporting it are interrupted when the timeout passes.
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	go attemptGetHostState(ctx, h, stateQueryChan)
 
 	select {
 	// If we get back useful information, great.  Forward it straight to
@@ -429,13 +564,13 @@ func getHostState(h *host.Host, hostListItemsChan chan<- HostListItem, timeout t
 		hostListItemsChan <- hli
 
 	// Otherwise, give up after a predetermined duration.
-	case <-time.After(timeout):
-		hostListItemsChan <- HostListItem{
+	case <-ctx.Done():
+		hostListItemsChan <- withMetadata(HostListItem{
 			Name:         h.Name,
 			DriverName:   h.Driver.DriverName(),
 			State:        state.Timeout,
 			ResponseTime: timeout,
-		}
+		}, h)
 	}
 }
 
@@ -463,6 +598,16 @@ func getHostListItems(hostList []*host.Host, hostsInError map[string]error, time
 	return hostListItems
 }
 
+// withMetadata fills the metadata of a machine in its list item.
+func withMetadata(item HostListItem, h *host.Host) HostListItem {
+	item.Tags = h.Tags()
+	if h.Metadata != nil {
+		item.Created = h.Metadata.Created
+		item.LastUsed = h.Metadata.LastUsed
+	}
+	return item
+}
+
 func newHostListItemInError(name string, err error) HostListItem {
 	return HostListItem{
 		Name:       name,
@@ -486,6 +631,12 @@ func sortHostListItemsByName(items []HostListItem) {
 	}
 }
 
+// sortHostListItems sorts items already sorted by name, machines which
+// compare equal stay sorted by name.
+func sortHostListItems(items []HostListItem, less func(a, b HostListItem) bool) {
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+}
+
 func isActive(currentState state.State, hostURL string) bool {
 	return currentState == state.Running && hostURL == os.Getenv("DOCKER_HOST")
 }
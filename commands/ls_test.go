@@ -1,6 +1,8 @@
 package commands
 
 import (
+	"bytes"
+	"encoding/json"
 	"os"
 	"testing"
 
@@ -533,3 +535,84 @@ func TestOnErrorWithMultilineComment(t *testing.T) {
 
 	assert.Equal(t, itemInError.Error, "missing parameter: the request must contain the parameter InstanceId	status code: 400")
 }
+
+func TestParseFiltersTag(t *testing.T) {
+	actual, err := parseFilters([]string{"tag=owner=alice", "tag=project"})
+	assert.NoError(t, err)
+	assert.Equal(t, FilterOptions{Tags: []string{"owner=alice", "project"}}, actual)
+}
+
+func TestFilterHostsByTag(t *testing.T) {
+	node1 := &host.Host{Name: "node1", Metadata: &host.MachineMetadata{Tags: map[string]string{"owner": "alice", "project": "web"}}}
+	node2 := &host.Host{Name: "node2", Metadata: &host.MachineMetadata{Tags: map[string]string{"owner": "bob"}}}
+	node3 := &host.Host{Name: "node3"}
+	hosts := []*host.Host{node1, node2, node3}
+
+	assert.Equal(t, []*host.Host{node1}, filterHosts(hosts, FilterOptions{Tags: []string{"owner=ALICE"}}))
+	assert.Equal(t, []*host.Host{node1}, filterHosts(hosts, FilterOptions{Tags: []string{"project"}}))
+	assert.Equal(t, []*host.Host{node1, node2}, filterHosts(hosts, FilterOptions{Tags: []string{"owner"}}))
+}
+
+func TestSortHostListItems(t *testing.T) {
+	now := time.Now()
+	items := []HostListItem{
+		{Name: "node1", Created: now, Tags: map[string]string{"owner": "bob"}},
+		{Name: "node2", Created: now.Add(-time.Hour), Tags: map[string]string{"owner": "alice"}},
+		{Name: "node10", Created: now.Add(time.Hour)},
+	}
+
+	names := func() []string {
+		names := []string{}
+		for _, item := range items {
+			names = append(names, item.Name)
+		}
+		return names
+	}
+
+	less, err := parseSortKey("created")
+	assert.NoError(t, err)
+	sortHostListItems(items, less)
+	assert.Equal(t, []string{"node2", "node1", "node10"}, names())
+
+	less, err = parseSortKey("tag:owner")
+	assert.NoError(t, err)
+	sortHostListItems(items, less)
+	assert.Equal(t, []string{"node10", "node2", "node1"}, names())
+
+	less, err = parseSortKey("-name")
+	assert.NoError(t, err)
+	sortHostListItems(items, less)
+	assert.Equal(t, []string{"node10", "node2", "node1"}, names())
+
+	_, err = parseSortKey("tag:")
+	assert.Equal(t, errInvalidSortKey, err)
+}
+
+func TestTableHeadersIncludeTags(t *testing.T) {
+	template, _, err := parseFormat("table {{ .Name }}\t{{ .Tags.owner }}")
+	assert.NoError(t, err)
+
+	items := []HostListItem{{Name: "node1", Tags: map[string]string{"owner": "alice"}}}
+
+	output := &bytes.Buffer{}
+	assert.NoError(t, template.Execute(output, tableHeaders(items)))
+	assert.NoError(t, template.Execute(output, items[0]))
+	assert.Equal(t, "NAME\tOWNER\nnode1\talice\n", output.String())
+}
+
+func TestHostListItemJSON(t *testing.T) {
+	data, err := json.Marshal(HostListItem{
+		Name:         "foo",
+		State:        state.Running,
+		ResponseTime: 1500 * time.Millisecond,
+		Tags:         map[string]string{"owner": "alice"},
+	})
+	assert.NoError(t, err)
+
+	item := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(data, &item))
+	assert.Equal(t, "foo", item["Name"])
+	assert.Equal(t, "Running", item["State"])
+	assert.Equal(t, "1.5s", item["ResponseTime"])
+	assert.Equal(t, map[string]interface{}{"owner": "alice"}, item["Tags"])
+}
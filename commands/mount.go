@@ -22,11 +22,35 @@ var (
 
 func cmdMount(c CommandLine, api libmachine.API) error {
 	args := c.Args()
+	if c.Bool("list") {
+		if len(args) != 0 {
+			c.ShowHelp()
+			return errWrongNumberArguments
+		}
+		return cmdMountList(c, api)
+	}
+
 	if len(args) < 1 || len(args) > 2 {
 		c.ShowHelp()
 		return errWrongNumberArguments
 	}
 
+	if c.Bool("unmount") {
+		// Reverse mounts are unmounted by their directory on the machine,
+		// the last argument.
+		target := args[len(args)-1]
+		if c.Bool("reverse") {
+			return cmdUnmountReverse(api, target)
+		}
+		if machine, remote, err := parseReverseMountTarget(target); err == nil {
+			if m, err := loadReverseMount(machine, remote); err == nil && m != nil {
+				return cmdUnmountReverse(api, target)
+			}
+		}
+	} else if c.Bool("reverse") {
+		return cmdReverseMount(c, api)
+	}
+
 	src := args[0]
 	dest := ""
 	if len(args) > 1 {
@@ -78,6 +102,12 @@ func getMountCmd(src, dest string, unmount bool, hostInfoLoader HostInfoLoader)
 
 	// Append needed -i / private key flags to command.
 	sshArgs = append(sshArgs, srcOpts...)
+	sshArgs = append(sshArgs, sshJumpArgs(srcHost)...)
+
+	sshArgs, err = checkHostKeys(sshArgs, srcHost)
+	if err != nil {
+		return nil, err
+	}
 
 	// Append actual arguments for the sshfs command (i.e. docker@<ip>:/path)
 	locationArg, err := generateLocationArg(srcHost, srcUser, srcPath)
@@ -0,0 +1,510 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	// reverseMountTimeout is how long a reverse mount has to start or stop.
+	reverseMountTimeout = 30 * time.Second
+
+	reverseMountPollInterval = 500 * time.Millisecond
+)
+
+var (
+	errReverseMountArgs = errors.New("Error: expected a local directory and a directory on the machine, as in ./src machine:/src")
+
+	serveSFTP = ssh.ServeSFTP
+
+	// startReverseMountProcess starts docker-machine in the background with
+	// its output going to logFile. The returned channel gets its exit.
+	startReverseMountProcess = func(args []string, logFile string) (int, <-chan error, error) {
+		out, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return 0, nil, err
+		}
+		defer out.Close()
+
+		cmd := exec.Command(os.Args[0], args...)
+		cmd.Stdout = out
+		cmd.Stderr = out
+		detach(cmd)
+
+		if err := cmd.Start(); err != nil {
+			return 0, nil, err
+		}
+
+		exited := make(chan error, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		return cmd.Process.Pid, exited, nil
+	}
+)
+
+// reverseMount is a local directory mounted into a machine, by a
+// docker-machine process serving it over SFTP to sshfs on the machine.
+type reverseMount struct {
+	Machine string
+	Local   string
+	Remote  string
+	PID     int
+
+	// Started is when the process started, for another process which got
+	// its pid since not to be taken for it.
+	Started string
+}
+
+func reverseMountsDir(machine string) string {
+	return filepath.Join(mcndirs.GetMachineDir(), machine, "mounts")
+}
+
+// reverseMountPath returns where a reverse mount is recorded, without the
+// extension. Its process logs to the same path with a .log extension.
+func reverseMountPath(machine, remote string) string {
+	hash := sha256.Sum256([]byte(remote))
+	return filepath.Join(reverseMountsDir(machine), fmt.Sprintf("%x", hash[:8]))
+}
+
+func (m *reverseMount) String() string {
+	return fmt.Sprintf("%s:%s", m.Machine, m.Remote)
+}
+
+// running tells whether the process which recorded the reverse mount still
+// runs.
+func (m *reverseMount) running() bool {
+	if m.PID == 0 || m.Started == "" {
+		return false
+	}
+
+	started, err := processStartTime(m.PID)
+	return err == nil && started == m.Started
+}
+
+func (m *reverseMount) save() error {
+	if err := os.MkdirAll(reverseMountsDir(m.Machine), 0700); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(reverseMountPath(m.Machine, m.Remote)+".json", data, 0600)
+}
+
+func (m *reverseMount) remove() error {
+	err := os.Remove(reverseMountPath(m.Machine, m.Remote) + ".json")
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// loadReverseMount returns the reverse mount of a directory of a machine,
+// nil if there's none.
+func loadReverseMount(machine, remote string) (*reverseMount, error) {
+	return readReverseMount(reverseMountPath(machine, remote) + ".json")
+}
+
+func readReverseMount(file string) (*reverseMount, error) {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &reverseMount{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("Error reading the reverse mount %s: %s", file, err)
+	}
+	return m, nil
+}
+
+// listReverseMounts returns the reverse mounts of all machines. Those whose
+// process is gone are forgotten.
+func listReverseMounts() ([]*reverseMount, error) {
+	files, err := filepath.Glob(filepath.Join(mcndirs.GetMachineDir(), "*", "mounts", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := []*reverseMount{}
+	for _, file := range files {
+		m, err := readReverseMount(file)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			continue
+		}
+
+		if !m.running() {
+			log.Debugf("Forgetting the reverse mount %s, its process is gone", m)
+			os.Remove(file)
+			continue
+		}
+		mounts = append(mounts, m)
+	}
+
+	return mounts, nil
+}
+
+// parseReverseMountTarget returns the machine and the absolute path of a
+// directory on it, given as [machine:]path.
+func parseReverseMountTarget(target string) (string, string, error) {
+	machine, remote := defaultMachineName, target
+	if parts := strings.SplitN(target, ":", 2); len(parts) == 2 {
+		machine, remote = parts[0], parts[1]
+	}
+
+	if !path.IsAbs(remote) {
+		return "", "", fmt.Errorf("Error: the directory on the machine must be an absolute path, got %q", remote)
+	}
+
+	return machine, path.Clean(remote), nil
+}
+
+// reverseMountCommand returns the command which mounts a directory served
+// over SFTP on its standard input and output. sshfs calls that the slave
+// mode, renamed to the passive mode in recent versions. The mount is shared
+// with the other users for Docker to bind mount it, its files are owned by
+// the SSH user and the kernel checks their permissions.
+func reverseMountCommand(remote string) string {
+	dir := ssh.ShellQuote(remote)
+	return fmt.Sprintf("sudo mkdir -p %s && mode=slave && if sshfs -h 2>&1 | grep -q passive; then mode=passive; fi && exec sudo sshfs -f -o $mode,allow_other,default_permissions,uid=$(id -u),gid=$(id -g) :/ %s", dir, dir)
+}
+
+func reverseMountedCommand(remote string) string {
+	return fmt.Sprintf("mountpoint -q %s", ssh.ShellQuote(remote))
+}
+
+func reverseUnmountCommand(remote string) string {
+	dir := ssh.ShellQuote(remote)
+	return fmt.Sprintf("if mountpoint -q %s; then sudo fusermount -u %s || sudo umount -l %s; fi", dir, dir, dir)
+}
+
+func cmdReverseMount(c CommandLine, api libmachine.API) error {
+	args := c.Args()
+	if len(args) != 2 {
+		c.ShowHelp()
+		return errReverseMountArgs
+	}
+
+	local, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(local); err != nil {
+		return err
+	} else if !fi.IsDir() {
+		return fmt.Errorf("Error: %s is not a directory", local)
+	}
+
+	machine, remote, err := parseReverseMountTarget(args[1])
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("foreground") {
+		started, err := processStartTime(os.Getpid())
+		if err != nil {
+			return err
+		}
+
+		return serveReverseMount(api, &reverseMount{
+			Machine: machine,
+			Local:   local,
+			Remote:  remote,
+			PID:     os.Getpid(),
+			Started: started,
+		})
+	}
+
+	return startReverseMount(c, machine, local, remote)
+}
+
+// startReverseMount mounts a local directory into a machine, with a
+// docker-machine process serving it in the background.
+func startReverseMount(c CommandLine, machine, local, remote string) error {
+	existing, err := loadReverseMount(machine, remote)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if existing.running() {
+			return fmt.Errorf("Error: %s is already mounted from %s", existing, existing.Local)
+		}
+
+		log.Debugf("Forgetting the reverse mount %s, its process is gone", existing)
+		if err := existing.remove(); err != nil {
+			return err
+		}
+	}
+
+	if err := os.MkdirAll(reverseMountsDir(machine), 0700); err != nil {
+		return err
+	}
+
+	args := append(reverseMountGlobalArgs(c), "mount", "--reverse", "--foreground", local, machine+":"+remote)
+
+	logFile := reverseMountPath(machine, remote) + ".log"
+	pid, exited, err := startReverseMountProcess(args, logFile)
+	if err != nil {
+		return fmt.Errorf("Error starting the reverse mount: %s", err)
+	}
+
+	timeout := time.After(reverseMountTimeout)
+	for {
+		m, err := loadReverseMount(machine, remote)
+		if err != nil {
+			return err
+		}
+		if m != nil && m.PID == pid {
+			log.Infof("Mounted %s on %s, run '%s mount -u %s' to unmount it", local, m, os.Args[0], m)
+			return nil
+		}
+
+		select {
+		case <-exited:
+			return fmt.Errorf("Error mounting %s on %s:%s: %s", local, machine, remote, lastLines(logFile, 5))
+		case <-timeout:
+			stopProcess(pid)
+			return fmt.Errorf("Error mounting %s on %s:%s: timed out, see %s", local, machine, remote, logFile)
+		case <-time.After(reverseMountPollInterval):
+		}
+	}
+}
+
+// reverseMountGlobalArgs returns the global flags of the command for the
+// process serving a reverse mount to run as it does. The ones set in the
+// environment are passed along with it.
+func reverseMountGlobalArgs(c CommandLine) []string {
+	args := []string{}
+	if c.GlobalBool("debug") {
+		args = append(args, "--debug")
+	}
+	if storagePath := c.GlobalString("storage-path"); storagePath != "" {
+		args = append(args, "--storage-path", storagePath)
+	}
+	if c.GlobalBool("native-ssh") {
+		args = append(args, "--native-ssh")
+	}
+	if lockTimeout := c.GlobalInt("lock-timeout"); lockTimeout != 0 {
+		args = append(args, "--lock-timeout", strconv.Itoa(lockTimeout))
+	}
+	if credentialHelper := c.GlobalString("credential-helper"); credentialHelper != "" {
+		args = append(args, "--credential-helper", credentialHelper)
+	}
+	return args
+}
+
+// lastLines returns the last lines of a file, on a single line.
+func lastLines(file string, count int) string {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err.Error()
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > count {
+		lines = lines[len(lines)-count:]
+	}
+	return strings.Join(lines, " ")
+}
+
+// serveReverseMount serves a local directory to sshfs on the machine until
+// it's interrupted or sshfs exits. The mount is recorded while it's up.
+func serveReverseMount(api libmachine.API, m *reverseMount) error {
+	h, err := api.Load(m.Machine)
+	if err != nil {
+		return err
+	}
+
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+	if currentState != state.Running {
+		return errStateInvalidForSSH{h.Name}
+	}
+
+	if _, err := h.RunSSHCommand("command -v sshfs"); err != nil {
+		return fmt.Errorf("Error: sshfs must be installed on %s to mount a directory into it", h.Name)
+	}
+
+	hostname, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return err
+	}
+
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return err
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	defer notifySignals(interrupt, os.Interrupt, syscall.SIGTERM)()
+
+	stop := make(chan struct{})
+	served := make(chan error, 1)
+	go func() {
+		served <- serveSFTP(h.Driver.GetSSHUsername(), hostname, port, drivers.SSHAuth(h.Driver), reverseMountCommand(m.Remote), m.Local, stop)
+	}()
+
+	defer unmountReverseMount(h, m)
+
+	if err := waitForReverseMount(h, m, served); err != nil {
+		close(stop)
+		return err
+	}
+
+	if err := m.save(); err != nil {
+		close(stop)
+		return err
+	}
+	log.Infof("Mounted %s on %s, press Ctrl-C to unmount it", m.Local, m)
+
+	select {
+	case err = <-served:
+	case <-interrupt:
+		close(stop)
+		err = <-served
+	}
+
+	return err
+}
+
+// waitForReverseMount waits for sshfs to have mounted the directory.
+func waitForReverseMount(h *host.Host, m *reverseMount, served <-chan error) error {
+	timeout := time.After(reverseMountTimeout)
+	for {
+		if _, err := h.RunSSHCommand(reverseMountedCommand(m.Remote)); err == nil {
+			return nil
+		}
+
+		select {
+		case err := <-served:
+			if err == nil {
+				err = errors.New("sshfs exited")
+			}
+			return fmt.Errorf("Error mounting %s on %s: %s", m.Local, m, err)
+		case <-timeout:
+			return fmt.Errorf("Error mounting %s on %s: timed out", m.Local, m)
+		case <-time.After(reverseMountPollInterval):
+		}
+	}
+}
+
+// unmountReverseMount forgets a reverse mount and makes sure the directory
+// isn't left mounted on the machine.
+func unmountReverseMount(h *host.Host, m *reverseMount) {
+	if err := m.remove(); err != nil {
+		log.Warnf("Error forgetting the reverse mount %s: %s", m, err)
+	}
+
+	if output, err := h.RunSSHCommand(reverseUnmountCommand(m.Remote)); err != nil {
+		log.Warnf("Error unmounting %s: %s: %s", m, err, output)
+	}
+}
+
+// stopReverseMount stops the process serving a reverse mount, which
+// unmounts it. The machine is unmounted here if the process couldn't.
+func stopReverseMount(api libmachine.API, m *reverseMount) error {
+	if m.running() {
+		if err := stopProcess(m.PID); err != nil {
+			return fmt.Errorf("Error stopping the reverse mount %s: %s", m, err)
+		}
+
+		timeout := time.After(reverseMountTimeout)
+		for m.running() {
+			select {
+			case <-timeout:
+				return fmt.Errorf("Error stopping the reverse mount %s: process %d is still running", m, m.PID)
+			case <-time.After(reverseMountPollInterval):
+			}
+		}
+	}
+
+	if current, err := loadReverseMount(m.Machine, m.Remote); err != nil || current == nil {
+		return err
+	}
+
+	h, err := api.Load(m.Machine)
+	if err != nil {
+		m.remove()
+		return err
+	}
+	unmountReverseMount(h, m)
+	return nil
+}
+
+// cmdUnmountReverse unmounts the reverse mount of a directory of a machine.
+func cmdUnmountReverse(api libmachine.API, target string) error {
+	machine, remote, err := parseReverseMountTarget(target)
+	if err != nil {
+		return err
+	}
+
+	m, err := loadReverseMount(machine, remote)
+	if err != nil {
+		return err
+	}
+	if m == nil {
+		return fmt.Errorf("Error: no local directory is mounted on %s:%s", machine, remote)
+	}
+
+	if err := stopReverseMount(api, m); err != nil {
+		return err
+	}
+
+	log.Infof("Unmounted %s from %s", m.Local, m)
+	return nil
+}
+
+func cmdMountList(c CommandLine, api libmachine.API) error {
+	mounts, err := listReverseMounts()
+	if err != nil {
+		return err
+	}
+
+	printReverseMounts(os.Stdout, mounts)
+	return nil
+}
+
+func printReverseMounts(w io.Writer, mounts []*reverseMount) {
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	defer tw.Flush()
+
+	fmt.Fprintln(tw, "MACHINE\tLOCAL\tREMOTE\tPID")
+	for _, m := range mounts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", m.Machine, m.Local, m.Remote, m.PID)
+	}
+}
@@ -0,0 +1,236 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/stretchr/testify/assert"
+)
+
+func withTempStore(t *testing.T) func() {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+
+	baseDir := mcndirs.BaseDir
+	mcndirs.BaseDir = dir
+
+	return func() {
+		mcndirs.BaseDir = baseDir
+		os.RemoveAll(dir)
+	}
+}
+
+// currentStartTime returns when the test process started.
+func currentStartTime(t *testing.T) string {
+	started, err := processStartTime(os.Getpid())
+	assert.NoError(t, err)
+	return started
+}
+
+// deadPID returns the pid of a process which exited.
+func deadPID(t *testing.T) int {
+	cmd := exec.Command(os.Args[0], "-test.run", "^$")
+	assert.NoError(t, cmd.Run())
+	return cmd.Process.Pid
+}
+
+func TestParseReverseMountTarget(t *testing.T) {
+	machine, remote, err := parseReverseMountTarget("dev:/src/")
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", machine)
+	assert.Equal(t, "/src", remote)
+
+	machine, remote, err = parseReverseMountTarget("/src")
+	assert.NoError(t, err)
+	assert.Equal(t, defaultMachineName, machine)
+	assert.Equal(t, "/src", remote)
+
+	_, _, err = parseReverseMountTarget("dev:src")
+	assert.EqualError(t, err, `Error: the directory on the machine must be an absolute path, got "src"`)
+}
+
+func TestReverseMountCommand(t *testing.T) {
+	assert.Equal(t,
+		`sudo mkdir -p '/it'\''s' && mode=slave && if sshfs -h 2>&1 | grep -q passive; then mode=passive; fi && exec sudo sshfs -f -o $mode,allow_other,default_permissions,uid=$(id -u),gid=$(id -g) :/ '/it'\''s'`,
+		reverseMountCommand("/it's"))
+	assert.Equal(t,
+		`if mountpoint -q '/src'; then sudo fusermount -u '/src' || sudo umount -l '/src'; fi`,
+		reverseUnmountCommand("/src"))
+}
+
+func TestReverseMountRecords(t *testing.T) {
+	defer withTempStore(t)()
+
+	running := &reverseMount{Machine: "dev", Local: "/home/user/src", Remote: "/src", PID: os.Getpid(), Started: currentStartTime(t)}
+	assert.NoError(t, running.save())
+
+	gone := &reverseMount{Machine: "other", Local: "/home/user/app", Remote: "/app", PID: deadPID(t), Started: currentStartTime(t)}
+	assert.NoError(t, gone.save())
+
+	// Another process got the pid of the one which recorded the mount.
+	reused := &reverseMount{Machine: "other", Local: "/home/user/db", Remote: "/db", PID: os.Getpid(), Started: "0"}
+	assert.NoError(t, reused.save())
+
+	m, err := loadReverseMount("dev", "/src")
+	assert.NoError(t, err)
+	assert.Equal(t, running, m)
+
+	mounts, err := listReverseMounts()
+	assert.NoError(t, err)
+	assert.Equal(t, []*reverseMount{running}, mounts)
+
+	m, err = loadReverseMount("other", "/app")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	m, err = loadReverseMount("other", "/db")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	assert.NoError(t, running.remove())
+	m, err = loadReverseMount("dev", "/src")
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+}
+
+func TestPrintReverseMounts(t *testing.T) {
+	out := &bytes.Buffer{}
+	printReverseMounts(out, []*reverseMount{
+		{Machine: "dev", Local: "/home/user/src", Remote: "/src", PID: 42},
+	})
+
+	assert.Equal(t, "MACHINE   LOCAL            REMOTE   PID\ndev       /home/user/src   /src     42\n", out.String())
+}
+
+func TestStartReverseMount(t *testing.T) {
+	defer withTempStore(t)()
+
+	defer func(start func([]string, string) (int, <-chan error, error)) {
+		startReverseMountProcess = start
+	}(startReverseMountProcess)
+
+	var startedWith []string
+	startReverseMountProcess = func(args []string, logFile string) (int, <-chan error, error) {
+		startedWith = args
+		m := &reverseMount{Machine: "dev", Local: "/home/user/src", Remote: "/src", PID: os.Getpid(), Started: currentStartTime(t)}
+		return os.Getpid(), make(chan error), m.save()
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		GlobalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"debug":             true,
+				"storage-path":      "/store",
+				"native-ssh":        true,
+				"lock-timeout":      30,
+				"credential-helper": "pass",
+			},
+		},
+	}
+
+	err := startReverseMount(commandLine, "dev", "/home/user/src", "/src")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"--debug",
+		"--storage-path", "/store",
+		"--native-ssh",
+		"--lock-timeout", "30",
+		"--credential-helper", "pass",
+		"mount", "--reverse", "--foreground", "/home/user/src", "dev:/src",
+	}, startedWith)
+
+	err = startReverseMount(commandLine, "dev", "/home/user/other", "/src")
+	assert.EqualError(t, err, "Error: dev:/src is already mounted from /home/user/src")
+}
+
+func TestStartReverseMountFails(t *testing.T) {
+	defer withTempStore(t)()
+
+	defer func(start func([]string, string) (int, <-chan error, error)) {
+		startReverseMountProcess = start
+	}(startReverseMountProcess)
+
+	startReverseMountProcess = func(args []string, logFile string) (int, <-chan error, error) {
+		exited := make(chan error, 1)
+		exited <- errors.New("exit status 1")
+		return 0, exited, ioutil.WriteFile(logFile, []byte("Error: sshfs must be installed on dev to mount a directory into it\n"), 0600)
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+
+	err := startReverseMount(commandLine, "dev", "/home/user/src", "/src")
+
+	assert.EqualError(t, err, "Error mounting /home/user/src on dev:/src: Error: sshfs must be installed on dev to mount a directory into it")
+}
+
+func TestStopReverseMount(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no shell on windows")
+	}
+
+	defer withTempStore(t)()
+
+	m := &reverseMount{Machine: "dev", Local: "/home/user/src", Remote: "/src"}
+	record := reverseMountPath("dev", "/src") + ".json"
+
+	// The process forgets the mount before it exits.
+	cmd := exec.Command("sh", "-c", `trap 'rm -f "$0"; exit 0' TERM; echo ready; while :; do sleep 0.1; done`, record)
+	stdout, err := cmd.StdoutPipe()
+	assert.NoError(t, err)
+	assert.NoError(t, cmd.Start())
+	_, err = bufio.NewReader(stdout).ReadString('\n')
+	assert.NoError(t, err)
+	go cmd.Wait()
+
+	m.PID = cmd.Process.Pid
+	m.Started, err = processStartTime(m.PID)
+	assert.NoError(t, err)
+	assert.NoError(t, m.save())
+
+	assert.NoError(t, stopReverseMount(nil, m))
+	assert.False(t, m.running())
+
+	_, err = os.Stat(record)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStartReverseMountForgetsStaleRecord(t *testing.T) {
+	defer withTempStore(t)()
+
+	defer func(start func([]string, string) (int, <-chan error, error)) {
+		startReverseMountProcess = start
+	}(startReverseMountProcess)
+
+	stale := &reverseMount{Machine: "dev", Local: "/home/user/old", Remote: "/src", PID: os.Getpid(), Started: "0"}
+	assert.NoError(t, stale.save())
+
+	startReverseMountProcess = func(args []string, logFile string) (int, <-chan error, error) {
+		m := &reverseMount{Machine: "dev", Local: "/home/user/src", Remote: "/src", PID: os.Getpid(), Started: currentStartTime(t)}
+		return os.Getpid(), make(chan error), m.save()
+	}
+
+	commandLine := &commandstest.FakeCommandLine{
+		GlobalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+
+	assert.NoError(t, startReverseMount(commandLine, "dev", "/home/user/src", "/src"))
+}
+
+func TestUnmountReverseNotMounted(t *testing.T) {
+	defer withTempStore(t)()
+
+	err := cmdUnmountReverse(nil, "dev:/src")
+
+	assert.EqualError(t, err, "Error: no local directory is mounted on dev:/src")
+}
@@ -4,11 +4,12 @@ import (
 	"os/exec"
 	"testing"
 
+	"github.com/docker/machine/commands/commandstest"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetMountCmd(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "12.34.56.78",
 		sshPort:     234,
 		sshUsername: "root",
@@ -39,7 +40,7 @@ func TestGetMountCmd(t *testing.T) {
 }
 
 func TestGetMountCmdWithoutSshKey(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "1.2.3.4",
 		sshUsername: "user",
 	}}
@@ -62,7 +63,7 @@ func TestGetMountCmdWithoutSshKey(t *testing.T) {
 }
 
 func TestGetMountCmdUnmount(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "1.2.3.4",
 		sshUsername: "user",
 	}}
@@ -82,3 +83,15 @@ func TestGetMountCmdUnmount(t *testing.T) {
 	assert.Equal(t, expectedCmd, cmd)
 	assert.NoError(t, err)
 }
+
+func TestMountListTakesNoArguments(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"list": true}},
+		CliArgs:    []string{"ls"},
+	}
+
+	err := cmdMount(commandLine, nil)
+
+	assert.Equal(t, errWrongNumberArguments, err)
+	assert.True(t, commandLine.HelpShown)
+}
@@ -0,0 +1,58 @@
+// +build !windows
+
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// detach runs a command in its own session, for it to outlive the terminal.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processStartTime returns when a running process started, from /proc where
+// there's one, or as ps shows it.
+func processStartTime(pid int) (string, error) {
+	if _, err := os.Stat("/proc/self/stat"); err != nil {
+		output, err := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+		if err != nil {
+			return "", fmt.Errorf("no process %d", pid)
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	data, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return "", err
+	}
+
+	// The fields after the command, which may have spaces, start with the
+	// state of the process, its start time is the 20th.
+	stat := string(data)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return "", fmt.Errorf("unexpected content of /proc/%d/stat", pid)
+	}
+	if fields[0] == "Z" {
+		return "", errors.New("the process exited")
+	}
+
+	return fields[19], nil
+}
+
+// stopProcess asks a process to stop, for it to clean up.
+func stopProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Signal(syscall.SIGTERM)
+}
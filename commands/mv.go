@@ -0,0 +1,159 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/docker/machine/libmachine/persist"
+	"github.com/docker/machine/libmachine/state"
+)
+
+var (
+	errStoreNotRenamer = errors.New("Error: The machine store doesn't support renaming machines")
+	errExpectedNames   = errors.New("Error: Expected the current and the new name of a machine as arguments")
+)
+
+func cmdMv(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 2 {
+		c.ShowHelp()
+		return errExpectedNames
+	}
+
+	oldName, newName := c.Args()[0], c.Args()[1]
+
+	if !host.ValidateHostName(newName) {
+		return fmt.Errorf("Error renaming machine: %s", mcnerror.ErrInvalidHostname)
+	}
+
+	renamer, ok := storeOf(api).(persist.Renamer)
+	if !ok {
+		return errStoreNotRenamer
+	}
+
+	unlock, err := lockMachines(api, []string{oldName, newName})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	exists, err := api.Exists(newName)
+	if err != nil {
+		return fmt.Errorf("Error checking if host exists: %s", err)
+	}
+	if exists {
+		return mcnerror.ErrHostAlreadyExists{
+			Name: newName,
+		}
+	}
+
+	h, err := api.Load(oldName)
+	if err != nil {
+		return err
+	}
+
+	if err := renameDriverMachine(h, newName); err != nil {
+		return fmt.Errorf("Error renaming machine: %s", err)
+	}
+
+	// Drivers may have changed their config while renaming.
+	err = api.Save(h)
+	if err == nil {
+		err = renamer.Rename(oldName, newName)
+	}
+	if err != nil {
+		if rollbackErr := renameDriverMachine(h, oldName); rollbackErr != nil {
+			log.Warnf("Error giving %q its old name back on the %s side: %s", oldName, h.DriverName, rollbackErr)
+		}
+		return fmt.Errorf("Error renaming machine: %s", err)
+	}
+
+	h, err = api.Load(newName)
+	if err != nil {
+		return err
+	}
+
+	if needsNewServerCert(h, oldName, newName) {
+		regenerateServerCert(h)
+	}
+
+	h.Touch()
+	if err := api.Save(h); err != nil {
+		return fmt.Errorf("Error saving host to store: %s", err)
+	}
+
+	log.Infof("Renamed %q to %q", oldName, newName)
+
+	return nil
+}
+
+// renameDriverMachine renames the VM or instance of a machine, where the
+// driver supports it. Other machines are only renamed in the store, unless
+// their driver finds their VM by machine name.
+func renameDriverMachine(h *host.Host, name string) error {
+	err := drivers.ErrRenameNotSupported
+	if renamer, ok := h.Driver.(drivers.Renamer); ok {
+		err = renamer.Rename(name)
+	}
+
+	if err != drivers.ErrRenameNotSupported {
+		return err
+	}
+
+	if bound, ok := h.Driver.(drivers.NameBound); ok && bound.BoundToMachineName() {
+		return fmt.Errorf("The %s driver finds its machines by name and can't rename them", h.DriverName)
+	}
+
+	log.Debugf("The %s driver doesn't rename machines, %q keeps its VM name", h.DriverName, h.Name)
+
+	return nil
+}
+
+// needsNewServerCert replaces the old name of a machine in the extra SANs
+// of its server certificate, and tells whether the certificate has to be
+// generated again because it was issued for the old name.
+func needsNewServerCert(h *host.Host, oldName, newName string) bool {
+	authOptions := h.AuthOptions()
+	if authOptions == nil {
+		return false
+	}
+
+	renamed := false
+	for i, san := range authOptions.ServerCertSANs {
+		if san == oldName || strings.HasPrefix(san, oldName+".") {
+			authOptions.ServerCertSANs[i] = newName + strings.TrimPrefix(san, oldName)
+			renamed = true
+		}
+	}
+
+	if renamed {
+		return true
+	}
+
+	hasName, err := cert.CertificateHasName(authOptions.ServerCertPath, oldName)
+	if err != nil {
+		log.Debugf("Unable to read the server certificate of %s: %s", h.Name, err)
+	}
+
+	return hasName
+}
+
+func regenerateServerCert(h *host.Host) {
+	currentState, err := h.Driver.GetState()
+	if err != nil || currentState != state.Running {
+		log.Warnf("The TLS certificate of %s is issued for its old name, run '%s regenerate-certs %s' once it is running.", h.Name, os.Args[0], h.Name)
+		return
+	}
+
+	log.Info("Regenerating TLS certificates")
+	if err := h.ConfigureAuth(); err != nil {
+		log.Warnf("Error regenerating the TLS certificate of %s, run '%s regenerate-certs %s' to try again: %s", h.Name, os.Args[0], h.Name, err)
+	}
+}
@@ -0,0 +1,98 @@
+package commands
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNeedsNewServerCert(t *testing.T) {
+	h := &host.Host{
+		Name: "web",
+		HostOptions: &host.Options{
+			AuthOptions: &auth.Options{
+				ServerCertPath: "/does/not/exist/server.pem",
+				ServerCertSANs: []string{"dev", "dev.example.com", "developer"},
+			},
+		},
+	}
+
+	assert.True(t, needsNewServerCert(h, "dev", "web"))
+	assert.Equal(t, []string{"web", "web.example.com", "developer"}, h.HostOptions.AuthOptions.ServerCertSANs)
+
+	assert.False(t, needsNewServerCert(h, "dev", "web"))
+}
+
+type renamingDriver struct {
+	*fakedriver.Driver
+	names []string
+}
+
+func (d *renamingDriver) Rename(name string) error {
+	d.names = append(d.names, name)
+	return nil
+}
+
+type failingRenameAPI struct {
+	*libmachinetest.FakeAPI
+}
+
+func (api *failingRenameAPI) Rename(oldName, newName string) error {
+	return errors.New("disk full")
+}
+
+type nameBoundDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *nameBoundDriver) BoundToMachineName() bool {
+	return true
+}
+
+func TestMvRefusesDriversBoundToMachineNames(t *testing.T) {
+	h := &host.Host{
+		Name:       "dev",
+		DriverName: "fakedriver",
+		Driver:     &nameBoundDriver{&fakedriver.Driver{}},
+	}
+	api := &failingRenameAPI{&libmachinetest.FakeAPI{Hosts: []*host.Host{h}}}
+
+	err := cmdMv(&commandstest.FakeCommandLine{CliArgs: []string{"dev", "web"}}, api)
+
+	assert.EqualError(t, err, "Error renaming machine: The fakedriver driver finds its machines by name and can't rename them")
+}
+
+func TestMvRenamesStoreOnlyForDriversWhichCantRename(t *testing.T) {
+	h := &host.Host{
+		Name:       "dev",
+		DriverName: "fakedriver",
+		Driver:     &fakedriver.Driver{},
+	}
+	api := &failingRenameAPI{&libmachinetest.FakeAPI{Hosts: []*host.Host{h}}}
+
+	err := cmdMv(&commandstest.FakeCommandLine{CliArgs: []string{"dev", "web"}}, api)
+
+	// The store was asked to rename the machine.
+	assert.EqualError(t, err, "Error renaming machine: disk full")
+}
+
+func TestMvRollsBackDriverRename(t *testing.T) {
+	driver := &renamingDriver{Driver: &fakedriver.Driver{}}
+	h := &host.Host{
+		Name:       "dev",
+		DriverName: "fakedriver",
+		Driver:     driver,
+	}
+	api := &failingRenameAPI{&libmachinetest.FakeAPI{Hosts: []*host.Host{h}}}
+
+	err := cmdMv(&commandstest.FakeCommandLine{CliArgs: []string{"dev", "web"}}, api)
+
+	assert.EqualError(t, err, "Error renaming machine: disk full")
+	assert.Equal(t, []string{"web", "dev"}, driver.names)
+}
@@ -0,0 +1,197 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	outputJSON = "json"
+	outputYAML = "yaml"
+)
+
+var (
+	outputFlag = cli.StringFlag{
+		Name:  "output, o",
+		Usage: "Print the output as json or yaml",
+	}
+
+	progressFlag = cli.StringFlag{
+		Name:  "output, o",
+		Usage: "Print the progress as json lines of events",
+	}
+
+	plainYAMLPattern    = regexp.MustCompile(`^[a-zA-Z_/][a-zA-Z0-9_./@:-]*$`)
+	reservedYAMLPattern = regexp.MustCompile(`^(?i:y|n|yes|no|on|off|true|false|null)$`)
+
+	// JSON strings are valid double quoted YAML scalars, once the
+	// characters YAML doesn't allow unescaped are escaped: DEL, C1
+	// control characters such as NEL, which YAML takes as a line break,
+	// the byte order mark and non characters.
+	unprintableYAMLPattern = regexp.MustCompile(`[\x{7F}-\x{9F}\x{FEFF}\x{FFFE}\x{FFFF}]`)
+)
+
+type errUnsupportedOutput struct {
+	Output string
+}
+
+func (e errUnsupportedOutput) Error() string {
+	return fmt.Sprintf("Error: unsupported output %q, expected json or yaml", e.Output)
+}
+
+// checkOutput checks an --output value is one of outputs.
+func checkOutput(output string, outputs ...string) error {
+	if output == "" {
+		return nil
+	}
+
+	for _, o := range outputs {
+		if output == o {
+			return nil
+		}
+	}
+
+	return errUnsupportedOutput{output}
+}
+
+// printOutput prints v as json or yaml.
+func printOutput(w io.Writer, output string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	switch output {
+	case outputJSON:
+		_, err := fmt.Fprintln(w, string(data))
+		return err
+	case outputYAML:
+		data, err := jsonToYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	return errUnsupportedOutput{output}
+}
+
+// jsonToYAML converts a JSON document to YAML, for the output of commands
+// to be the same in both. Keys come out sorted.
+func jsonToYAML(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if isYAMLCollection(v) {
+		writeYAML(buf, v, "")
+	} else {
+		fmt.Fprintln(buf, yamlScalar(v))
+	}
+
+	return buf.Bytes(), nil
+}
+
+func writeYAML(buf *bytes.Buffer, v interface{}, indent string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%s%s:", indent, yamlScalar(key))
+			writeYAMLValue(buf, v[key], indent+"  ")
+		}
+	case []interface{}:
+		for _, item := range v {
+			if !isYAMLCollection(item) {
+				fmt.Fprintf(buf, "%s-", indent)
+				writeYAMLValue(buf, item, indent+"  ")
+				continue
+			}
+
+			// The first line of a collection goes after the dash.
+			collection := &bytes.Buffer{}
+			writeYAML(collection, item, indent+"  ")
+			fmt.Fprintf(buf, "%s- %s", indent, collection.Bytes()[len(indent)+2:])
+		}
+	}
+}
+
+// writeYAMLValue writes the value of a key or a list item, which follows
+// on the same line unless it's a collection.
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent string) {
+	if isYAMLCollection(v) {
+		buf.WriteString("\n")
+		writeYAML(buf, v, indent)
+		return
+	}
+
+	fmt.Fprintf(buf, " %s\n", yamlScalar(v))
+}
+
+func isYAMLCollection(v interface{}) bool {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return len(v) > 0
+	case []interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+func yamlScalar(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return "{}"
+	case []interface{}:
+		return "[]"
+	case nil:
+		return "null"
+	case json.Number:
+		// YAML 1.1 parsers only take numbers with an exponent as floats
+		// if they have a decimal point.
+		number := v.String()
+		if i := strings.IndexAny(number, "eE"); i >= 0 && !strings.Contains(number, ".") {
+			number = number[:i] + ".0" + number[i:]
+		}
+		return number
+	case string:
+		if plainYAMLPattern.MatchString(v) && !reservedYAMLPattern.MatchString(v) && !strings.HasSuffix(v, ":") {
+			return v
+		}
+		data, _ := json.Marshal(v)
+		return unprintableYAMLPattern.ReplaceAllStringFunc(string(data), func(c string) string {
+			return fmt.Sprintf(`\u%04X`, []rune(c)[0])
+		})
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// useEventLogger makes the log messages and the steps machines go through
+// be written as JSON lines of events, until the returned function is
+// called.
+func useEventLogger(w io.Writer) func() {
+	previous := log.SetLogger(log.NewEventMachineLogger(w))
+	return func() {
+		log.SetLogger(previous)
+	}
+}
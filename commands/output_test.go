@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckOutput(t *testing.T) {
+	assert.NoError(t, checkOutput("", outputJSON))
+	assert.NoError(t, checkOutput("yaml", outputJSON, outputYAML))
+	assert.Equal(t, errUnsupportedOutput{"yaml"}, checkOutput("yaml", outputJSON))
+}
+
+func TestPrintOutputYAML(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	err := printOutput(buf, outputYAML, []interface{}{
+		map[string]interface{}{
+			"Name":  "foo",
+			"State": "Running",
+			"Tags":  map[string]string{"owner": "alice", "team": "core infra"},
+			"Empty": map[string]string{},
+			"Count": 2,
+			"Error": "",
+		},
+		"yes",
+		"key:",
+		[]string{"a"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, `- Count: 2
+  Empty: {}
+  Error: ""
+  Name: foo
+  State: Running
+  Tags:
+    owner: alice
+    team: "core infra"
+- "yes"
+- "key:"
+- - a
+`, buf.String())
+}
+
+func TestPrintOutputYAMLScalars(t *testing.T) {
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"", `""`},
+		{"tcp://1.2.3.4:2376", "tcp://1.2.3.4:2376"},
+		{"/path/to", "/path/to"},
+		{" padded ", `" padded "`},
+		{"No", `"No"`},
+		{"~", `"~"`},
+		{"123", `"123"`},
+		{".inf", `".inf"`},
+		{"- item", `"- item"`},
+		{"a: b", `"a: b"`},
+		{"a #comment", `"a #comment"`},
+		{"*alias", `"*alias"`},
+		{"{a}", `"{a}"`},
+		{"line\nbreak\ttab", `"line\nbreak\ttab"`},
+		{"bell\x07", `"bell\u0007"`},
+		{"next\u0085line", `"next\u0085line"`},
+		{"\ufeffbom", `"\uFEFFbom"`},
+		{"café", `"café"`},
+		{1e21, "1.0e+21"},
+		{1.5, "1.5"},
+		{true, "true"},
+		{nil, "null"},
+		{[]string{}, "[]"},
+		{map[string]string{}, "{}"},
+	}
+
+	for _, test := range tests {
+		buf := &bytes.Buffer{}
+		assert.NoError(t, printOutput(buf, outputYAML, test.value))
+		assert.Equal(t, test.expected+"\n", buf.String(), "%q", test.value)
+	}
+}
+
+func TestPrintOutputJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+
+	err := printOutput(buf, outputJSON, urlOutput{Name: "foo", URL: "tcp://1.2.3.4:2376"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n    \"Name\": \"foo\",\n    \"URL\": \"tcp://1.2.3.4:2376\"\n}\n", buf.String())
+}
@@ -20,6 +20,13 @@ func cmdRegenerateCerts(c CommandLine, api libmachine.API) error {
 	log.Infof("Regenerating TLS certificates")
 
 	if c.Bool("client-certs") {
+		// The CA and client certificates are shared by every machine.
+		unlock, err := lockStore(api)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
 		return runAction("configureAllAuth", c, api)
 	}
 	return runAction("configureAuth", c, api)
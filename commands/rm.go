@@ -29,7 +29,13 @@ func cmdRm(c CommandLine, api libmachine.API) error {
 	}
 
 	for _, hostName := range c.Args() {
-		err := removeRemoteMachine(hostName, api)
+		unlock, err := lockMachines(api, []string{hostName})
+		if err != nil {
+			errorOccurred = collectError(fmt.Sprintf("Error removing host %q: %s", hostName, err), force, errorOccurred)
+			continue
+		}
+
+		err = removeRemoteMachine(hostName, api)
 		if err != nil {
 			errorOccurred = collectError(fmt.Sprintf("Error removing host %q: %s", hostName, err), force, errorOccurred)
 		}
@@ -42,6 +48,8 @@ func cmdRm(c CommandLine, api libmachine.API) error {
 				log.Infof("Successfully removed %s", hostName)
 			}
 		}
+
+		unlock()
 	}
 
 	if len(errorOccurred) > 0 && !force {
@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"reflect"
+	"strconv"
 	"strings"
 
+	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/persist"
+	"github.com/docker/machine/libmachine/ssh"
 )
 
 var (
 	errWrongNumberArguments = errors.New("Improper number of arguments")
+	errScpJumpHosts         = errors.New("Error: both machines must be reached through the same jump hosts to copy between them")
 
 	// TODO: possibly move this to ssh package
 	baseSSHArgs = []string{
@@ -78,6 +83,15 @@ func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInf
 		return nil, err
 	}
 
+	// The ProxyCommand option applies to both hosts, which must be reached
+	// through the same jump hosts.
+	jumpArgs := sshJumpArgs(srcHost)
+	if srcHost == nil {
+		jumpArgs = sshJumpArgs(destHost)
+	} else if destHost != nil && !reflect.DeepEqual(jumpHostsOf(srcHost), jumpHostsOf(destHost)) {
+		return nil, errScpJumpHosts
+	}
+
 	// TODO: Check that "-3" flag is available in user's version of scp.
 	// It is on every system I've checked, but the manual mentioned it's "newer"
 	sshArgs := baseSSHArgs
@@ -99,6 +113,12 @@ func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInf
 	// Append needed -i / private key flags to command.
 	sshArgs = append(sshArgs, srcOpts...)
 	sshArgs = append(sshArgs, destOpts...)
+	sshArgs = append(sshArgs, jumpArgs...)
+
+	sshArgs, err = checkHostKeys(sshArgs, srcHost, destHost)
+	if err != nil {
+		return nil, err
+	}
 
 	// Append actual arguments for the scp command (i.e. docker@<ip>:/path)
 	locationArg, err := generateLocationArg(srcHost, srcUser, srcPath)
@@ -109,6 +129,11 @@ func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInf
 	// TODO: Check that "--progress" flag is available in user's version of rsync.
 	// Use quiet mode as a workaround, if it should happen to not be supported...
 	if delta {
+		for i, arg := range sshArgs {
+			if strings.HasPrefix(arg, "ProxyCommand=") {
+				sshArgs[i] = strconv.Quote(arg)
+			}
+		}
 		sshArgs = append([]string{"-e"}, "ssh "+strings.Join(sshArgs, " "))
 		if !quiet {
 			sshArgs = append([]string{"--progress"}, sshArgs...)
@@ -130,6 +155,80 @@ func getScpCmd(src, dest string, recursive bool, delta bool, quiet bool, hostInf
 	return cmd, nil
 }
 
+// sshJumpArgs returns the ssh options which reach the host through its jump
+// hosts, none if it has none.
+func sshJumpArgs(h HostInfo) []string {
+	if h == nil {
+		return nil
+	}
+
+	// The keys of the jump hosts are in the known_hosts file of the machine
+	// checkHostKeys writes.
+	auth := sshAuthOf(h)
+	knownHostsFile := auth.KnownHostsFile
+	if auth.HostKey == "" {
+		knownHostsFile = ""
+	}
+
+	proxyCommand := ssh.ProxyCommand(auth.JumpHosts, "%h:%p", knownHostsFile)
+	if proxyCommand == "" {
+		return nil
+	}
+
+	return []string{"-o", "ProxyCommand=" + proxyCommand}
+}
+
+func jumpHostsOf(h HostInfo) []ssh.JumpHost {
+	return sshAuthOf(h).JumpHosts
+}
+
+// sshAuthOf returns how the machine is reached over SSH, as its driver was
+// given when loaded.
+func sshAuthOf(h HostInfo) ssh.Auth {
+	if holder, ok := h.(drivers.SSHAuthHolder); ok {
+		return holder.GetSSHAuth()
+	}
+	return ssh.Auth{}
+}
+
+// checkHostKeys makes ssh check the pinned SSH host keys of the remote
+// hosts. Machines created before host keys were pinned have none, ssh
+// doesn't check any host key then.
+func checkHostKeys(args []string, hosts ...HostInfo) ([]string, error) {
+	knownHostsFiles := []string{}
+	for _, h := range hosts {
+		if h == nil {
+			continue
+		}
+
+		auth := sshAuthOf(h)
+		if auth.HostKey == "" || auth.KnownHostsFile == "" {
+			continue
+		}
+
+		hostname, err := h.GetSSHHostname()
+		if err != nil {
+			return nil, err
+		}
+
+		port, err := h.GetSSHPort()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := ssh.WriteKnownHosts(auth.KnownHostsFile, hostname, port, auth.HostKey, auth.JumpHosts); err != nil {
+			return nil, fmt.Errorf("Error writing the known hosts file: %s", err)
+		}
+		knownHostsFiles = append(knownHostsFiles, auth.KnownHostsFile)
+	}
+
+	if len(knownHostsFiles) == 0 {
+		return args, nil
+	}
+
+	return ssh.CheckHostKeys(args, knownHostsFiles...), nil
+}
+
 func missesExplicitSSHKey(hostInfo HostInfo) bool {
 	return hostInfo != nil && hostInfo.GetSSHKeyPath() == ""
 }
@@ -0,0 +1,582 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/term"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/pkg/sftp"
+)
+
+// deltaBlockSize is the size of the blocks compared by delta copies.
+const deltaBlockSize = 32 * 1024
+
+var (
+	newSFTPClient = ssh.NewSFTPClient
+	newSSHClient  = ssh.NewNativeClient
+)
+
+// scpFS is the file system of one end of a copy, local or on a machine.
+type scpFS interface {
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Mkdir(name string, perm os.FileMode) error
+	Remove(name string) error
+	OpenFile(name string, flag int, perm os.FileMode) (scpFile, error)
+	Chmod(name string, mode os.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	Join(elem ...string) string
+	Base(name string) string
+	Close() error
+}
+
+type scpFile interface {
+	io.Reader
+	io.Writer
+	io.ReaderAt
+	io.WriterAt
+	io.Closer
+	Truncate(size int64) error
+}
+
+type localFS struct{}
+
+func (localFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (localFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (localFS) Mkdir(name string, perm os.FileMode) error {
+	return os.Mkdir(name, perm)
+}
+
+func (localFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (localFS) OpenFile(name string, flag int, perm os.FileMode) (scpFile, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+func (localFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (localFS) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (localFS) Join(elem ...string) string {
+	return filepath.Join(elem...)
+}
+
+func (localFS) Base(name string) string {
+	return filepath.Base(name)
+}
+
+func (localFS) Close() error {
+	return nil
+}
+
+// blockSummer is implemented by the file systems which checksum the blocks
+// of their files where they are, for delta copies not to read them.
+type blockSummer interface {
+	BlockSums(name string, size int64) ([]string, error)
+}
+
+type remoteFS struct {
+	*sftp.Client
+
+	// shell runs commands on the machine.
+	shell ssh.Client
+}
+
+// BlockSums checksums the blocks of a file on the machine with the split of
+// GNU coreutils. Machines without it have their files read instead.
+func (fs remoteFS) BlockSums(name string, size int64) ([]string, error) {
+	command := fmt.Sprintf("split -b %d --filter=sha256sum -- %s", deltaBlockSize, ssh.ShellQuote(name))
+	output, err := fs.shell.Output(command)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", err, strings.TrimSpace(output))
+	}
+
+	sums := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil || len(fields[0]) != 2*sha256.Size {
+			return nil, fmt.Errorf("unexpected output of split: %q", output)
+		}
+		sums = append(sums, fields[0])
+	}
+
+	if int64(len(sums)) != (size+deltaBlockSize-1)/deltaBlockSize {
+		return nil, fmt.Errorf("unexpected output of split: %q", output)
+	}
+
+	return sums, nil
+}
+
+// ReadDir returns the entries of a directory sorted by name, as
+// ioutil.ReadDir does.
+func (fs remoteFS) ReadDir(name string) ([]os.FileInfo, error) {
+	entries, err := fs.Client.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+func (fs remoteFS) Mkdir(name string, perm os.FileMode) error {
+	if err := fs.Client.Mkdir(name); err != nil {
+		return err
+	}
+	return fs.Client.Chmod(name, perm)
+}
+
+// OpenFile opens a file on the machine. Files are created with the
+// permissions they're given before anything is written to them.
+func (fs remoteFS) OpenFile(name string, flag int, perm os.FileMode) (scpFile, error) {
+	f, err := fs.Client.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+
+	if flag&os.O_CREATE != 0 {
+		if err := f.Chmod(perm); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (remoteFS) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+func (remoteFS) Base(name string) string {
+	return path.Base(name)
+}
+
+// useSFTP tells whether to copy over SFTP rather than with the scp or rsync
+// binary: with the native SSH client, or when the binary is missing.
+func useSFTP(delta bool) bool {
+	if ssh.DefaultClient() == ssh.Native {
+		return true
+	}
+
+	binary := "scp"
+	if delta {
+		binary = "rsync"
+	}
+	if _, err := exec.LookPath(binary); err != nil {
+		log.Debugf("%s binary not found, copying over SFTP", binary)
+		return true
+	}
+	return false
+}
+
+// sshAuth returns how to log in to a machine over SSH and check its host.
+func sshAuth(h HostInfo) *ssh.Auth {
+	auth := sshAuthOf(h)
+	if h.GetSSHKeyPath() != "" {
+		auth.Keys = []string{h.GetSSHKeyPath()}
+	}
+
+	return &auth
+}
+
+// scpEndpoint returns the file system and the path of an argument of scp.
+func scpEndpoint(hostAndPath string, hostInfoLoader HostInfoLoader) (scpFS, string, error) {
+	h, user, filePath, _, err := getInfoForScpArg(hostAndPath, hostInfoLoader)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if h == nil {
+		return localFS{}, filePath, nil
+	}
+
+	hostname, err := h.GetSSHHostname()
+	if err != nil {
+		return nil, "", err
+	}
+
+	port, err := h.GetSSHPort()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if user == "" {
+		user = h.GetSSHUsername()
+	}
+
+	client, err := newSFTPClient(user, hostname, port, sshAuth(h))
+	if err != nil {
+		return nil, "", err
+	}
+
+	shell, err := newSSHClient(user, hostname, port, sshAuth(h))
+	if err != nil {
+		client.Close()
+		return nil, "", err
+	}
+
+	// Relative paths are relative to the home directory.
+	if filePath == "" {
+		filePath = "."
+	}
+
+	return remoteFS{Client: client, shell: shell}, filePath, nil
+}
+
+// sftpCopy copies files over SFTP. Files copied between two machines are
+// streamed from one to the other, they aren't stored locally.
+func sftpCopy(src, dest string, recursive, delta, quiet bool, hostInfoLoader HostInfoLoader) error {
+	srcFS, srcPath, err := scpEndpoint(src, hostInfoLoader)
+	if err != nil {
+		return err
+	}
+	defer srcFS.Close()
+
+	destFS, destPath, err := scpEndpoint(dest, hostInfoLoader)
+	if err != nil {
+		return err
+	}
+	defer destFS.Close()
+
+	copier := &sftpCopier{
+		src:       srcFS,
+		dest:      destFS,
+		recursive: recursive,
+		delta:     delta,
+	}
+	if !quiet && term.IsTerminal(os.Stdout.Fd()) {
+		copier.progress = os.Stdout
+	}
+
+	return copier.copy(srcPath, destPath)
+}
+
+// sftpCopier copies files between two file systems, preserving their
+// permissions and modification times.
+type sftpCopier struct {
+	src       scpFS
+	dest      scpFS
+	recursive bool
+
+	// delta only copies the blocks which differ from the ones of the
+	// existing destination files, as told by their checksums. Files of the
+	// same size and modification time are skipped, as rsync does.
+	delta bool
+
+	// progress is where progress bars are shown, if anywhere.
+	progress io.Writer
+}
+
+func (c *sftpCopier) copy(srcPath, destPath string) error {
+	fi, err := c.src.Stat(srcPath)
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() && !c.recursive {
+		return fmt.Errorf("%s is a directory, use --recursive to copy it", srcPath)
+	}
+
+	if destInfo, err := c.dest.Stat(destPath); err == nil && destInfo.IsDir() {
+		destPath = c.dest.Join(destPath, c.src.Base(srcPath))
+	}
+
+	return c.copyEntry(srcPath, destPath, fi)
+}
+
+func (c *sftpCopier) copyEntry(srcPath, destPath string, fi os.FileInfo) error {
+	switch {
+	case fi.IsDir():
+		return c.copyDir(srcPath, destPath, fi)
+	case fi.Mode().IsRegular():
+		return c.copyFile(srcPath, destPath, fi)
+	}
+
+	log.Warnf("Skipping %s, it's not a regular file", srcPath)
+	return nil
+}
+
+func (c *sftpCopier) copyDir(srcPath, destPath string, fi os.FileInfo) error {
+	if destInfo, err := c.dest.Stat(destPath); err != nil || !destInfo.IsDir() {
+		// Entries are written before the permissions are preserved.
+		if err := c.dest.Mkdir(destPath, fi.Mode().Perm()|0700); err != nil {
+			return err
+		}
+	}
+
+	entries, err := c.src.ReadDir(srcPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		entryPath := c.src.Join(srcPath, entry.Name())
+
+		// Symbolic links are followed, as scp does.
+		entryInfo, err := c.src.Stat(entryPath)
+		if err != nil {
+			return err
+		}
+
+		if err := c.copyEntry(entryPath, c.dest.Join(destPath, entry.Name()), entryInfo); err != nil {
+			return err
+		}
+	}
+
+	return c.preserve(destPath, fi)
+}
+
+func (c *sftpCopier) copyFile(srcPath, destPath string, fi os.FileInfo) error {
+	if c.delta {
+		if destInfo, err := c.dest.Stat(destPath); err == nil && destInfo.Mode().IsRegular() {
+			if destInfo.Size() == fi.Size() && destInfo.ModTime().Unix() == fi.ModTime().Unix() {
+				log.Debugf("Skipping %s, it's up to date", srcPath)
+				return nil
+			}
+			return c.updateFile(srcPath, destPath, fi, destInfo)
+		}
+	}
+
+	in, err := c.src.OpenFile(srcPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.dest.OpenFile(destPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	progress := c.newProgress(c.src.Base(srcPath), fi.Size())
+	_, err = io.Copy(out, io.TeeReader(in, progress))
+	progress.done()
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error copying %s: %s", srcPath, err)
+	}
+
+	return c.preserve(destPath, fi)
+}
+
+// updateFile only copies the blocks of the source file which differ from
+// the ones of the destination file.
+func (c *sftpCopier) updateFile(srcPath, destPath string, fi, destInfo os.FileInfo) error {
+	srcSums, err := blockSums(c.src, srcPath, fi.Size())
+	if err != nil {
+		return err
+	}
+
+	destSums, err := blockSums(c.dest, destPath, destInfo.Size())
+	if err != nil {
+		return err
+	}
+
+	in, err := c.src.OpenFile(srcPath, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.dest.OpenFile(destPath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	progress := c.newProgress(c.src.Base(srcPath), fi.Size())
+	err = updateBlocks(in, out, srcSums, destSums, fi.Size(), progress)
+	progress.done()
+
+	if err == nil {
+		err = out.Truncate(fi.Size())
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("Error copying %s: %s", srcPath, err)
+	}
+
+	return c.preserve(destPath, fi)
+}
+
+// blockSums returns the SHA-256 checksums of the blocks of a file, where
+// it is if the file system can, otherwise by reading it.
+func blockSums(fs scpFS, name string, size int64) ([]string, error) {
+	if summer, ok := fs.(blockSummer); ok {
+		sums, err := summer.BlockSums(name, size)
+		if err == nil {
+			return sums, nil
+		}
+		log.Debugf("Error checksumming %s where it is, reading it instead: %s", name, err)
+	}
+
+	f, err := fs.OpenFile(name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return readBlockSums(f)
+}
+
+func readBlockSums(r io.Reader) ([]string, error) {
+	sums := []string{}
+	block := make([]byte, deltaBlockSize)
+
+	for {
+		n, err := io.ReadFull(r, block)
+		if n > 0 {
+			sum := sha256.Sum256(block[:n])
+			sums = append(sums, hex.EncodeToString(sum[:]))
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return sums, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// updateBlocks writes the blocks of the source file whose checksums differ
+// from the ones of the destination file.
+func updateBlocks(in io.ReaderAt, out io.WriterAt, srcSums, destSums []string, size int64, progress io.Writer) error {
+	block := make([]byte, deltaBlockSize)
+
+	for i, sum := range srcSums {
+		offset := int64(i) * deltaBlockSize
+		n := int64(deltaBlockSize)
+		if size-offset < n {
+			n = size - offset
+		}
+		if n <= 0 {
+			return nil
+		}
+
+		if i >= len(destSums) || destSums[i] != sum {
+			if m, err := in.ReadAt(block[:n], offset); int64(m) < n {
+				return err
+			}
+			if _, err := out.WriteAt(block[:n], offset); err != nil {
+				return err
+			}
+		}
+
+		progress.Write(block[:n])
+	}
+
+	return nil
+}
+
+func (c *sftpCopier) preserve(destPath string, fi os.FileInfo) error {
+	if err := c.dest.Chmod(destPath, fi.Mode().Perm()); err != nil {
+		return err
+	}
+	return c.dest.Chtimes(destPath, fi.ModTime(), fi.ModTime())
+}
+
+func (c *sftpCopier) newProgress(name string, size int64) *scpProgress {
+	return &scpProgress{
+		out:  c.progress,
+		name: name,
+		size: size,
+	}
+}
+
+// scpProgress shows the progress bar of a file as it's copied, as scp does.
+type scpProgress struct {
+	out     io.Writer
+	name    string
+	size    int64
+	copied  int64
+	started time.Time
+	shown   time.Time
+}
+
+func (p *scpProgress) Write(b []byte) (int, error) {
+	p.copied += int64(len(b))
+	if p.started.IsZero() {
+		p.started = time.Now()
+	}
+	if time.Since(p.shown) >= 100*time.Millisecond {
+		p.show()
+	}
+	return len(b), nil
+}
+
+func (p *scpProgress) show() {
+	if p.out == nil {
+		return
+	}
+	p.shown = time.Now()
+
+	percent := int64(100)
+	if p.size > 0 {
+		percent = p.copied * 100 / p.size
+	}
+
+	rate := ""
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 && !p.started.IsZero() {
+		rate = humanSize(int64(float64(p.copied)/elapsed)) + "/s"
+	}
+
+	fmt.Fprintf(p.out, "\r%-40s %3d%% %9s %11s", p.name, percent, humanSize(p.copied), rate)
+}
+
+func (p *scpProgress) done() {
+	if p.out == nil {
+		return
+	}
+	p.show()
+	fmt.Fprintln(p.out)
+}
+
+func humanSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d%s", size, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
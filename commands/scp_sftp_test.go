@@ -0,0 +1,239 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func sftpTestLoader(t *testing.T) (*MockHostInfoLoader, *sshtest.Server) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+
+	host, port := server.Host()
+	return &MockHostInfoLoader{hostInfo: MockHostInfo{
+		ip:          host,
+		sshPort:     port,
+		sshUsername: "docker",
+	}}, server
+}
+
+func sftpTestDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	return dir
+}
+
+func TestSFTPCopyFileToMachine(t *testing.T) {
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "file")
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, ioutil.WriteFile(src, []byte("hello"), 0640))
+	assert.NoError(t, os.Chtimes(src, mtime, mtime))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "dest"), 0755))
+
+	err := sftpCopy(src, "myfunhost:"+filepath.Join(dir, "dest"), false, false, true, loader)
+	assert.NoError(t, err)
+
+	copied := filepath.Join(dir, "dest", "file")
+	content, err := ioutil.ReadFile(copied)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+
+	fi, err := os.Stat(copied)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), fi.Mode())
+	assert.True(t, fi.ModTime().Equal(mtime))
+}
+
+func TestSFTPCopyDirectoryNeedsRecursive(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	err := sftpCopy(dir, filepath.Join(dir, "copy"), false, false, true, nil)
+	assert.EqualError(t, err, dir+" is a directory, use --recursive to copy it")
+}
+
+func TestSFTPCopyBetweenMachines(t *testing.T) {
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	assert.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "a"), []byte("a"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(src, "sub", "b"), []byte("b"), 0600))
+
+	err := sftpCopy("machine1:"+src, "machine2:"+filepath.Join(dir, "dest"), true, false, true, loader)
+	assert.NoError(t, err)
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "dest", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+
+	fi, err := os.Stat(filepath.Join(dir, "dest", "sub", "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode())
+
+	assert.Equal(t, 2, server.Connections())
+}
+
+func TestSFTPCopyDelta(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// Files of the same size and modification time are up to date.
+	assert.NoError(t, ioutil.WriteFile(src, []byte("hello"), 0644))
+	assert.NoError(t, ioutil.WriteFile(dest, []byte("world"), 0644))
+	assert.NoError(t, os.Chtimes(src, mtime, mtime))
+	assert.NoError(t, os.Chtimes(dest, mtime, mtime))
+
+	assert.NoError(t, sftpCopy(src, dest, false, true, true, nil))
+	content, err := ioutil.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(content))
+
+	// Others are updated.
+	large := bytes.Repeat([]byte("x"), 3*deltaBlockSize)
+	assert.NoError(t, ioutil.WriteFile(src, large, 0644))
+	assert.NoError(t, ioutil.WriteFile(dest, append(large, "trailing"...), 0644))
+	copy(large[deltaBlockSize:], "changed")
+	assert.NoError(t, ioutil.WriteFile(src, large, 0644))
+
+	assert.NoError(t, sftpCopy(src, dest, false, true, true, nil))
+	content, err = ioutil.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, large, content)
+}
+
+type recordingFile struct {
+	*os.File
+	writes []int64
+}
+
+func (f *recordingFile) WriteAt(b []byte, offset int64) (int, error) {
+	f.writes = append(f.writes, offset)
+	return f.File.WriteAt(b, offset)
+}
+
+func TestUpdateBlocksWritesDifferences(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	content := bytes.Repeat([]byte("x"), 3*deltaBlockSize)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dest"), content, 0644))
+	destSums, err := readBlockSums(bytes.NewReader(content))
+	assert.NoError(t, err)
+
+	f, err := os.OpenFile(filepath.Join(dir, "dest"), os.O_RDWR, 0)
+	assert.NoError(t, err)
+	defer f.Close()
+	out := &recordingFile{File: f}
+
+	copy(content[deltaBlockSize+10:], "changed")
+	content = append(content, "more"...)
+	srcSums, err := readBlockSums(bytes.NewReader(content))
+	assert.NoError(t, err)
+
+	assert.NoError(t, updateBlocks(bytes.NewReader(content), out, srcSums, destSums, int64(len(content)), ioutil.Discard))
+	assert.Equal(t, []int64{deltaBlockSize, 3 * deltaBlockSize}, out.writes)
+
+	written, err := ioutil.ReadFile(filepath.Join(dir, "dest"))
+	assert.NoError(t, err)
+	assert.Equal(t, content, written)
+}
+
+func TestSFTPDeltaCopyChecksumsOnMachine(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no split on windows")
+	}
+	if err := exec.Command("split", "-b", "1", "--filter=true", "/dev/null").Run(); err != nil {
+		t.Skip("no split with --filter")
+	}
+
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	commands := make(chan string, 10)
+	server.Run = func(command string, stdin io.Reader, stdout io.Writer) int {
+		commands <- command
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdout = stdout
+		if err := cmd.Run(); err != nil {
+			return 1
+		}
+		return 0
+	}
+
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dest := filepath.Join(dir, "dest")
+
+	content := bytes.Repeat([]byte("x"), 3*deltaBlockSize)
+	assert.NoError(t, ioutil.WriteFile(dest, content, 0644))
+	copy(content[deltaBlockSize:], "changed")
+	assert.NoError(t, ioutil.WriteFile(src, content, 0644))
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(src, mtime, mtime))
+
+	assert.NoError(t, sftpCopy(src, "myfunhost:"+dest, false, true, true, loader))
+
+	written, err := ioutil.ReadFile(dest)
+	assert.NoError(t, err)
+	assert.Equal(t, content, written)
+	assert.Len(t, commands, 1)
+	assert.Equal(t, "split -b 32768 --filter=sha256sum -- '"+dest+"'", <-commands)
+}
+
+func TestRemoteBlockSumsRejectsUnexpectedOutput(t *testing.T) {
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	fs, _, err := scpEndpoint("myfunhost:/file", loader)
+	assert.NoError(t, err)
+	defer fs.Close()
+
+	// The test server prints the commands it's sent.
+	_, err = fs.(remoteFS).BlockSums("/file", 10)
+	assert.Error(t, err)
+}
+
+func TestSFTPProgress(t *testing.T) {
+	out := &bytes.Buffer{}
+	progress := &scpProgress{out: out, name: "file", size: 2048}
+
+	progress.Write(make([]byte, 2048))
+	progress.done()
+
+	assert.Contains(t, out.String(), "\rfile")
+	assert.Contains(t, out.String(), " 100%     2.0KB")
+	assert.True(t, bytes.HasSuffix(out.Bytes(), []byte("\n")))
+}
+
+func TestHumanSize(t *testing.T) {
+	assert.Equal(t, "512B", humanSize(512))
+	assert.Equal(t, "1.5KB", humanSize(1536))
+	assert.Equal(t, "3.0GB", humanSize(3*1024*1024*1024))
+}
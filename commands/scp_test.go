@@ -1,10 +1,14 @@
 package commands
 
 import (
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,6 +18,7 @@ type MockHostInfo struct {
 	sshPort     int
 	sshUsername string
 	sshKeyPath  string
+	sshAuth     ssh.Auth
 }
 
 func (h *MockHostInfo) GetMachineName() string {
@@ -36,13 +41,26 @@ func (h *MockHostInfo) GetSSHKeyPath() string {
 	return h.sshKeyPath
 }
 
+func (h *MockHostInfo) SetSSHAuth(auth ssh.Auth) error {
+	h.sshAuth = auth
+	return nil
+}
+
+func (h *MockHostInfo) GetSSHAuth() ssh.Auth {
+	return h.sshAuth
+}
+
 type MockHostInfoLoader struct {
 	hostInfo MockHostInfo
+	sshAuths map[string]ssh.Auth
 }
 
 func (l *MockHostInfoLoader) load(name string) (HostInfo, error) {
 	info := l.hostInfo
 	info.name = name
+	if auth, ok := l.sshAuths[name]; ok {
+		info.sshAuth = auth
+	}
 	return &info, nil
 }
 
@@ -63,7 +81,7 @@ func TestGetInfoForLocalScpArg(t *testing.T) {
 }
 
 func TestGetInfoForRemoteScpArg(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		sshKeyPath: "/fake/keypath/id_rsa",
 	}}
 
@@ -107,7 +125,7 @@ func TestRemoteLocation(t *testing.T) {
 }
 
 func TestGetScpCmd(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "12.34.56.78",
 		sshPort:     234,
 		sshUsername: "root",
@@ -136,7 +154,7 @@ func TestGetScpCmd(t *testing.T) {
 }
 
 func TestGetScpCmdWithoutSshKey(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "1.2.3.4",
 		sshUsername: "user",
 	}}
@@ -157,7 +175,7 @@ func TestGetScpCmdWithoutSshKey(t *testing.T) {
 }
 
 func TestGetScpCmdWithDelta(t *testing.T) {
-	hostInfoLoader := MockHostInfoLoader{MockHostInfo{
+	hostInfoLoader := MockHostInfoLoader{hostInfo: MockHostInfo{
 		ip:          "1.2.3.4",
 		sshUsername: "user",
 	}}
@@ -177,3 +195,66 @@ func TestGetScpCmdWithDelta(t *testing.T) {
 	assert.Equal(t, expectedCmd, cmd)
 	assert.NoError(t, err)
 }
+
+func TestGetScpCmdWithJumpHosts(t *testing.T) {
+	hostInfoLoader := MockHostInfoLoader{
+		hostInfo: MockHostInfo{
+			ip:          "10.0.0.5",
+			sshUsername: "docker",
+		},
+		sshAuths: map[string]ssh.Auth{
+			"myfunhost": {JumpHosts: []ssh.JumpHost{{Hostname: "bastion", User: "admin"}}},
+		},
+	}
+
+	cmd, err := getScpCmd("/tmp/foo", "myfunhost:/home/docker/foo", false, false, false, &hostInfoLoader)
+
+	expectedArgs := append(
+		baseSSHArgs,
+		"-3",
+		"-o",
+		"ProxyCommand=ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=quiet -p 22 -W '%h:%p' 'admin@bastion'",
+		"/tmp/foo",
+		"docker@10.0.0.5:/home/docker/foo",
+	)
+	expectedCmd := exec.Command("/usr/bin/scp", expectedArgs...)
+
+	assert.Equal(t, expectedCmd, cmd)
+	assert.NoError(t, err)
+}
+
+func TestGetScpCmdWithDifferentJumpHosts(t *testing.T) {
+	hostInfoLoader := MockHostInfoLoader{
+		hostInfo: MockHostInfo{
+			ip:          "10.0.0.5",
+			sshUsername: "docker",
+		},
+		sshAuths: map[string]ssh.Auth{
+			"behindbastion": {JumpHosts: []ssh.JumpHost{{Hostname: "bastion", User: "admin"}}},
+		},
+	}
+
+	_, err := getScpCmd("behindbastion:/tmp/foo", "myfunhost:/home/docker/foo", false, false, false, &hostInfoLoader)
+
+	assert.Equal(t, errScpJumpHosts, err)
+}
+
+func TestCheckHostKeysSkipsUnpinnedMachines(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	hostKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"
+	knownHostsFile := filepath.Join(tmpDir, "known_hosts")
+
+	unpinned := &MockHostInfo{name: "unpinned", ip: "10.0.0.4", sshPort: 22}
+	pinned := &MockHostInfo{name: "pinned", ip: "10.0.0.5", sshPort: 22}
+	pinned.SetSSHAuth(ssh.Auth{HostKey: hostKey, KnownHostsFile: knownHostsFile})
+
+	args, err := checkHostKeys(baseSSHArgs, unpinned, pinned)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ssh.CheckHostKeys(baseSSHArgs, knownHostsFile), args)
+	content, _ := ioutil.ReadFile(knownHostsFile)
+	assert.Equal(t, "10.0.0.5 "+hostKey+"\n", string(content))
+}
@@ -18,6 +18,10 @@ func cmdScp(c CommandLine, api libmachine.API) error {
 
 	hostInfoLoader := &storeHostInfoLoader{api}
 
+	if useSFTP(c.Bool("delta")) {
+		return sftpCopy(src, dest, c.Bool("recursive"), c.Bool("delta"), c.Bool("quiet"), hostInfoLoader)
+	}
+
 	cmd, err := getScpCmd(src, dest, c.Bool("recursive"), c.Bool("delta"), c.Bool("quiet"), hostInfoLoader)
 	if err != nil {
 		return err
@@ -47,5 +47,7 @@ func cmdSSH(c CommandLine, api libmachine.API) error {
 		return err
 	}
 
+	touchHost(api, host)
+
 	return client.Shell(c.Args().Tail()...)
 }
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/ssh"
+)
+
+var (
+	scanSSHHostKey = func(h *host.Host) (string, error) {
+		return h.ScanSSHHostKey()
+	}
+)
+
+// cmdSSHKeyscan checks the key a machine presents over SSH against the one
+// pinned for it. With --update, the presented key is pinned instead, for
+// machines which were legitimately rebuilt, along with the keys of its jump
+// hosts.
+func cmdSSHKeyscan(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 1 {
+		return ErrExpectedOneMachine
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("update") {
+		unlock, err := lockMachines(api, []string{target})
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	h, err := api.Load(target)
+	if err != nil {
+		return err
+	}
+
+	// The jump hosts may have been rebuilt along with the machine, their
+	// keys are pinned again before the machine is reached through them.
+	if c.Bool("update") && len(h.SSHJumpHosts()) > 0 {
+		jumpHosts := append([]ssh.JumpHost{}, h.SSHJumpHosts()...)
+		for i := range jumpHosts {
+			jumpHosts[i].HostKey = ""
+		}
+
+		if h.HostOptions.SSHJumpHosts, err = ssh.PinJumpHostKeys(jumpHosts); err != nil {
+			return err
+		}
+	}
+
+	hostKey, err := scanSSHHostKey(h)
+	if err != nil {
+		return err
+	}
+
+	fingerprint, err := ssh.Fingerprint(hostKey)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("update") {
+		h.SSHHostKey = hostKey
+		if err := api.Save(h); err != nil {
+			return fmt.Errorf("Error saving host to store: %s", err)
+		}
+
+		fmt.Printf("Pinned the SSH host key of %s: %s\n", h.Name, fingerprint)
+		return nil
+	}
+
+	if h.SSHHostKey == "" {
+		fmt.Printf("%s presents %s, no SSH host key is pinned for it, run 'docker-machine ssh-keyscan --update %s' to pin it\n", h.Name, fingerprint, h.Name)
+		return nil
+	}
+
+	pinned, err := ssh.Fingerprint(h.SSHHostKey)
+	if err != nil {
+		return err
+	}
+
+	if pinned != fingerprint {
+		return ssh.ErrHostKeyMismatch{
+			Address:  h.Name,
+			Expected: pinned,
+			Actual:   fingerprint,
+		}
+	}
+
+	fmt.Printf("%s presents its pinned SSH host key: %s\n", h.Name, fingerprint)
+	return nil
+}
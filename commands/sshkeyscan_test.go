@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testHostKey      = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"
+	testOtherHostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAINxrioCQBmRCfN3JWiJu1jduqd2/dQlXmZ3UZJLobZOQ"
+)
+
+func stubScanSSHHostKey(hostKey string) func() {
+	previous := scanSSHHostKey
+	scanSSHHostKey = func(h *host.Host) (string, error) {
+		return hostKey, nil
+	}
+	return func() { scanSSHHostKey = previous }
+}
+
+func TestCmdSSHKeyscanUpdate(t *testing.T) {
+	defer stubScanSSHHostKey(testOtherHostKey)()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs:    []string{"foo"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{"update": true}},
+	}
+	h := &host.Host{Name: "foo", SSHHostKey: testHostKey}
+	api := &libmachinetest.FakeAPI{Hosts: []*host.Host{h}}
+
+	err := cmdSSHKeyscan(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, testOtherHostKey, h.SSHHostKey)
+}
+
+func TestCmdSSHKeyscanMismatch(t *testing.T) {
+	defer stubScanSSHHostKey(testOtherHostKey)()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs:    []string{"foo"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+	h := &host.Host{Name: "foo", SSHHostKey: testHostKey}
+	api := &libmachinetest.FakeAPI{Hosts: []*host.Host{h}}
+
+	err := cmdSSHKeyscan(commandLine, api)
+
+	assert.Equal(t, ssh.ErrHostKeyMismatch{
+		Address:  "foo",
+		Expected: "SHA256:WanU0av6hrg2s3u4NvTgZIzMVAy1AT6TSRxQUjIa68Y",
+		Actual:   "SHA256:GOMZ+JMOZEqEasB2bmMdbx9AoexVeLOz9R9Gk7dLZ/A",
+	}, err)
+	assert.Equal(t, testHostKey, h.SSHHostKey)
+}
+
+func TestCmdSSHKeyscanMatch(t *testing.T) {
+	defer stubScanSSHHostKey(testHostKey)()
+
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs:    []string{"foo"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+	api := &libmachinetest.FakeAPI{Hosts: []*host.Host{{Name: "foo", SSHHostKey: testHostKey}}}
+
+	assert.NoError(t, cmdSSHKeyscan(commandLine, api))
+}
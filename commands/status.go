@@ -2,15 +2,27 @@ package commands
 
 import (
 	"fmt"
+	"os"
+
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/log"
 )
 
+type statusOutput struct {
+	Name  string
+	State string
+}
+
 func cmdStatus(c CommandLine, api libmachine.API) error {
 	if len(c.Args()) > 1 {
 		return ErrExpectedOneMachine
 	}
 
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
 	target, err := targetHost(c, api)
 	if err != nil {
 		return err
@@ -26,6 +38,13 @@ func cmdStatus(c CommandLine, api libmachine.API) error {
 		return fmt.Errorf("error getting state for host %s: %s", host.Name, err)
 	}
 
+	if output != "" {
+		return printOutput(os.Stdout, output, statusOutput{
+			Name:  host.Name,
+			State: currentState.String(),
+		})
+	}
+
 	log.Info(currentState)
 
 	return nil
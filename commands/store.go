@@ -0,0 +1,257 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/persist"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+var (
+	errStoreNotCheckable   = errors.New("Error: The machine store doesn't support consistency checks")
+	errStoreInconsistent   = errors.New("Error: Some machines have problems, see above")
+	errNoDatabase          = errors.New("Error: Expected the path of a database file as an argument")
+	errStoreNotEncryptable = errors.New("Error: The machine store doesn't support encryption")
+	errNoStorePassphrase   = errors.New("Error: The machine store is encrypted, set MACHINE_STORE_PASSPHRASE or MACHINE_STORE_KEY_FILE to unlock it")
+	errPassphraseMismatch  = errors.New("Error: The passphrases don't match")
+	errEmptyPassphrase     = errors.New("Error: The passphrase can't be empty")
+)
+
+func cmdStoreFsck(c CommandLine, api libmachine.API) error {
+	checker, ok := storeOf(api).(persist.Checker)
+	if !ok {
+		return errStoreNotCheckable
+	}
+
+	unlock, err := lockStore(api)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	names := c.Args()
+	if len(names) == 0 {
+		if names, err = api.List(); err != nil {
+			return err
+		}
+	}
+
+	repair := c.Bool("repair")
+	failed := false
+
+	for _, name := range names {
+		result := checker.Check(name)
+
+		if result.ConfigErr != nil && repair {
+			log.Infof("%s: %s", name, result.ConfigErr)
+
+			revision, err := checker.Rollback(name)
+			if err != nil {
+				log.Errorf("%s: Unable to roll back: %s", name, err)
+				failed = true
+				continue
+			}
+
+			log.Infof("%s: Rolled back to %s", name, revision)
+			result = checker.Check(name)
+		}
+
+		if result.OK() {
+			log.Infof("%s: OK", name)
+			continue
+		}
+
+		failed = true
+
+		if result.ConfigErr != nil {
+			log.Errorf("%s: %s", name, result.ConfigErr)
+			if !repair {
+				log.Errorf("%s: Run with --repair to roll back to the last valid revision", name)
+			}
+		}
+
+		for _, problem := range result.Problems {
+			log.Errorf("%s: %s", name, problem)
+		}
+	}
+
+	if failed {
+		return errStoreInconsistent
+	}
+
+	return nil
+}
+
+func cmdStoreServe(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) != 1 {
+		c.ShowHelp()
+		return errNoDatabase
+	}
+
+	handler := &persist.BackendHandler{
+		Backend: persist.NewBoltBackend(c.Args().First()),
+	}
+
+	if auth := c.String("auth"); auth != "" {
+		parts := strings.SplitN(auth, ":", 2)
+		if len(parts) != 2 {
+			return errors.New("Error: --auth must be in the form user:password")
+		}
+		handler.Username, handler.Password = parts[0], parts[1]
+	}
+
+	tlsCert, tlsKey := c.String("tls-cert"), c.String("tls-key")
+	if (tlsCert == "") != (tlsKey == "") {
+		return errors.New("Error: --tls-cert and --tls-key must be given together")
+	}
+
+	// The store holds the keys of every machine, it's only served to other
+	// hosts over TLS and to authenticated clients.
+	listen := c.String("listen")
+	if !isLoopbackAddress(listen) && (tlsCert == "" || handler.Username == "") {
+		return fmt.Errorf("Error: serving the store on %s requires --tls-cert, --tls-key and --auth, only loopback addresses can be served without them", listen)
+	}
+
+	log.Infof("Serving %s on %s", c.Args().First(), listen)
+
+	if tlsCert != "" {
+		return http.ListenAndServeTLS(listen, tlsCert, tlsKey, handler)
+	}
+
+	return http.ListenAndServe(listen, handler)
+}
+
+// isLoopbackAddress tells whether a listen address only accepts
+// connections from the local host.
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func cmdStoreEncrypt(c CommandLine, api libmachine.API) error {
+	encrypter, ok := storeOf(api).(persist.Encrypter)
+	if !ok {
+		return errStoreNotEncryptable
+	}
+
+	unlock, err := lockStore(api)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Running it again on an encrypted store seals the secrets which were
+	// left in plaintext, e.g. by an interrupted create.
+	var passphrase []byte
+	if encrypter.IsEncrypted() {
+		passphrase, err = storePassphrase()
+	} else {
+		passphrase, err = newStorePassphrase()
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := encrypter.Encrypt(passphrase); err != nil {
+		return err
+	}
+
+	log.Info("The machine store is encrypted")
+	return nil
+}
+
+func cmdStoreDecrypt(c CommandLine, api libmachine.API) error {
+	encrypter, ok := storeOf(api).(persist.Encrypter)
+	if !ok {
+		return errStoreNotEncryptable
+	}
+
+	unlock, err := lockStore(api)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := encrypter.Decrypt(); err != nil {
+		return err
+	}
+
+	log.Info("The machine store is decrypted")
+	return nil
+}
+
+// storePassphrase returns the key of an encrypted store: the content of the
+// key file or the passphrase set in the environment, or else the passphrase
+// typed in by the user.
+func storePassphrase() ([]byte, error) {
+	if keyFile := os.Getenv("MACHINE_STORE_KEY_FILE"); keyFile != "" {
+		return ioutil.ReadFile(keyFile)
+	}
+
+	if passphrase := os.Getenv("MACHINE_STORE_PASSPHRASE"); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errNoStorePassphrase
+	}
+
+	return readPassphrase("Machine store passphrase: ")
+}
+
+// newStorePassphrase returns the key to encrypt a store with. Passphrases
+// typed in are asked twice.
+func newStorePassphrase() ([]byte, error) {
+	if os.Getenv("MACHINE_STORE_KEY_FILE") != "" || os.Getenv("MACHINE_STORE_PASSPHRASE") != "" {
+		return storePassphrase()
+	}
+
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, errNoStorePassphrase
+	}
+
+	passphrase, err := readPassphrase("New machine store passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(passphrase) == 0 {
+		return nil, errEmptyPassphrase
+	}
+
+	confirmation, err := readPassphrase("Confirm the passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(passphrase, confirmation) {
+		return nil, errPassphraseMismatch
+	}
+
+	return passphrase, nil
+}
+
+func readPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+
+	return terminal.ReadPassword(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsLoopbackAddress(t *testing.T) {
+	assert.True(t, isLoopbackAddress("127.0.0.1:2380"))
+	assert.True(t, isLoopbackAddress("[::1]:2380"))
+	assert.True(t, isLoopbackAddress("localhost:2380"))
+	assert.False(t, isLoopbackAddress(":2380"))
+	assert.False(t, isLoopbackAddress("0.0.0.0:2380"))
+	assert.False(t, isLoopbackAddress("192.168.1.10:2380"))
+	assert.False(t, isLoopbackAddress("machines.example.com:2380"))
+}
+
+func TestStoreServeRequiresTLSAndAuth(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"/tmp/machines.db"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"listen":   "0.0.0.0:2380",
+				"tls-cert": "/certs/cert.pem",
+				"tls-key":  "/certs/key.pem",
+			},
+		},
+	}
+
+	err := cmdStoreServe(commandLine, nil)
+
+	assert.EqualError(t, err, "Error: serving the store on 0.0.0.0:2380 requires --tls-cert, --tls-key and --auth, only loopback addresses can be served without them")
+
+	commandLine.LocalFlags.Data["auth"] = "team:secret"
+	delete(commandLine.LocalFlags.Data, "tls-key")
+
+	err = cmdStoreServe(commandLine, nil)
+
+	assert.EqualError(t, err, "Error: --tls-cert and --tls-key must be given together")
+}
@@ -0,0 +1,553 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/sftp"
+)
+
+const (
+	syncIgnoreFile      = ".dockerignore"
+	syncDefaultInterval = 1
+)
+
+var (
+	errSyncNotDirectory = errors.New("Error: the source to sync must be a local directory")
+)
+
+// syncedFile is what a file on the machine was when it was last synced, to
+// tell whether it was changed there since.
+type syncedFile struct {
+	size  int64
+	mtime int64
+}
+
+// conflictedFile is the local file which conflicted with the one on the
+// machine, to only report the conflict again once the file changes.
+type conflictedFile struct {
+	info    os.FileInfo
+	removed bool
+}
+
+// syncer mirrors a local directory to a directory on a machine. Files which
+// were changed on the machine aren't overwritten or removed, they're
+// reported as conflicts.
+type syncer struct {
+	local  string
+	remote string
+	dest   scpFS
+	ignore *syncIgnore
+	copier *sftpCopier
+
+	// connect connects to the machine again once the connection to it is
+	// lost while watching, if set.
+	connect func() (scpFS, error)
+
+	// files are the local files as last scanned, by path relative to the
+	// local directory, with forward slashes.
+	files map[string]os.FileInfo
+
+	synced map[string]syncedFile
+
+	// conflicted are the files which conflicted, they're synced again until
+	// the conflicts are resolved on the machine.
+	conflicted map[string]conflictedFile
+	conflicts  int
+}
+
+func newSyncer(local, remote string, dest scpFS, ignore *syncIgnore) *syncer {
+	return &syncer{
+		local:  local,
+		remote: remote,
+		dest:   dest,
+		ignore: ignore,
+		copier: &sftpCopier{
+			src:   localFS{},
+			dest:  dest,
+			delta: true,
+		},
+		files:      map[string]os.FileInfo{},
+		synced:     map[string]syncedFile{},
+		conflicted: map[string]conflictedFile{},
+	}
+}
+
+func (s *syncer) localPath(name string) string {
+	return filepath.Join(s.local, filepath.FromSlash(name))
+}
+
+func (s *syncer) remotePath(name string) string {
+	return s.dest.Join(s.remote, name)
+}
+
+// scan lists the local files which aren't ignored. Symbolic links to files
+// are followed, other files which aren't regular are skipped.
+func (s *syncer) scan() (map[string]os.FileInfo, error) {
+	files := map[string]os.FileInfo{}
+
+	err := filepath.Walk(s.local, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// Files removed during the scan are left to the next one.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		name, err := filepath.Rel(s.local, p)
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		name = filepath.ToSlash(name)
+
+		if s.ignore.matches(name) {
+			// Files under an ignored directory can be re-included.
+			if fi.IsDir() && !s.ignore.exceptions {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if target, err := os.Stat(p); err == nil && target.Mode().IsRegular() {
+				fi = target
+			}
+		}
+
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			log.Debugf("Skipping %s, it's not a regular file", p)
+			return nil
+		}
+
+		files[name] = fi
+		return nil
+	})
+
+	return files, err
+}
+
+// sync pushes the local changes since the last scan, or all the files the
+// first time, only sending the parts of the files which differ.
+func (s *syncer) sync() (err error) {
+	files, err := s.scan()
+	if err != nil {
+		return err
+	}
+
+	// The changes are pushed again by the next sync if they couldn't be.
+	previous := s.files
+	s.files = files
+	defer func() {
+		if err != nil {
+			s.files = previous
+		}
+	}()
+
+	if err := s.mkdir("."); err != nil {
+		return err
+	}
+
+	names := []string{}
+	for name, fi := range files {
+		if before, ok := previous[name]; !ok || changed(before, fi) || s.isConflicted(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fi := files[name]
+		if fi.IsDir() {
+			err = s.mkdir(name)
+		} else {
+			err = s.push(name, fi)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	removed := []string{}
+	removedInfo := map[string]os.FileInfo{}
+	for name, fi := range previous {
+		if _, ok := files[name]; !ok {
+			removed = append(removed, name)
+			removedInfo[name] = fi
+		}
+	}
+	for name, c := range s.conflicted {
+		if _, ok := files[name]; !ok && c.removed && removedInfo[name] == nil {
+			removed = append(removed, name)
+			removedInfo[name] = c.info
+		}
+	}
+
+	// Directories are removed after what they contain.
+	sort.Sort(sort.Reverse(sort.StringSlice(removed)))
+
+	for _, name := range removed {
+		if err := s.remove(name, removedInfo[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func changed(previous, current os.FileInfo) bool {
+	if previous.IsDir() != current.IsDir() || previous.Mode() != current.Mode() {
+		return true
+	}
+	if current.IsDir() {
+		return false
+	}
+	return previous.Size() != current.Size() || !previous.ModTime().Equal(current.ModTime())
+}
+
+// mkdir creates a directory on the machine, along with its parents.
+func (s *syncer) mkdir(name string) error {
+	remotePath := s.remotePath(name)
+
+	if fi, err := s.dest.Stat(remotePath); err == nil {
+		if !fi.IsDir() {
+			return fmt.Errorf("Error: %s isn't a directory on the machine", remotePath)
+		}
+		return nil
+	}
+
+	if name != "." {
+		if err := s.mkdir(path.Dir(name)); err != nil {
+			return err
+		}
+	}
+
+	perm := os.FileMode(0755)
+	if fi, ok := s.files[name]; ok {
+		perm = fi.Mode().Perm() | 0700
+	}
+
+	return s.dest.Mkdir(remotePath, perm)
+}
+
+// push copies a local file to the machine, unless the file there was
+// changed since it was last synced.
+func (s *syncer) push(name string, fi os.FileInfo) error {
+	remotePath := s.remotePath(name)
+
+	remoteInfo, err := s.dest.Stat(remotePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if err == nil {
+		if s.changedRemotely(name, remoteInfo, fi) {
+			s.conflict(name, "not overwriting it", conflictedFile{info: fi})
+			return nil
+		}
+
+		if remoteInfo.Size() == fi.Size() && remoteInfo.ModTime().Unix() == fi.ModTime().Unix() {
+			s.synced[name] = syncedFile{size: fi.Size(), mtime: fi.ModTime().Unix()}
+			delete(s.conflicted, name)
+			return nil
+		}
+	}
+
+	if err := s.mkdir(path.Dir(name)); err != nil {
+		return err
+	}
+
+	if err := s.copier.copyFile(s.localPath(name), remotePath, fi); err != nil {
+		return err
+	}
+
+	log.Infof("Synced %s", name)
+	s.synced[name] = syncedFile{size: fi.Size(), mtime: fi.ModTime().Unix()}
+	delete(s.conflicted, name)
+
+	return nil
+}
+
+// remove removes a file which was removed locally from the machine, unless
+// it was changed there since it was last synced.
+func (s *syncer) remove(name string, fi os.FileInfo) error {
+	remotePath := s.remotePath(name)
+
+	remoteInfo, err := s.dest.Stat(remotePath)
+	if os.IsNotExist(err) {
+		delete(s.synced, name)
+		delete(s.conflicted, name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if fi.IsDir() {
+		// Directories with files left in them on the machine are kept.
+		if err := s.dest.Remove(remotePath); err != nil {
+			log.Warnf("Not removing %s on the machine: %s", name, err)
+			return nil
+		}
+		log.Infof("Removed %s", name)
+		return nil
+	}
+
+	if _, ok := s.synced[name]; !ok || s.changedRemotely(name, remoteInfo, fi) {
+		s.conflict(name, "not removing it", conflictedFile{info: fi, removed: true})
+		return nil
+	}
+
+	if err := s.dest.Remove(remotePath); err != nil {
+		return err
+	}
+
+	log.Infof("Removed %s", name)
+	delete(s.synced, name)
+	delete(s.conflicted, name)
+
+	return nil
+}
+
+// changedRemotely tells whether a file on the machine was changed since it
+// was last synced. Files which weren't synced yet are only overwritten if
+// they're older than the local ones, and didn't conflict before.
+func (s *syncer) changedRemotely(name string, remoteInfo, fi os.FileInfo) bool {
+	if !remoteInfo.Mode().IsRegular() {
+		return true
+	}
+
+	if synced, ok := s.synced[name]; ok {
+		return remoteInfo.Size() != synced.size || remoteInfo.ModTime().Unix() != synced.mtime
+	}
+
+	if remoteInfo.Size() == fi.Size() && remoteInfo.ModTime().Unix() == fi.ModTime().Unix() {
+		return false
+	}
+
+	return s.isConflicted(name) || remoteInfo.ModTime().Unix() > fi.ModTime().Unix()
+}
+
+func (s *syncer) isConflicted(name string) bool {
+	_, ok := s.conflicted[name]
+	return ok
+}
+
+// conflict reports a conflict, unless it was already reported for the same
+// local file.
+func (s *syncer) conflict(name, action string, c conflictedFile) {
+	if previous, ok := s.conflicted[name]; ok && previous.removed == c.removed && !changed(previous.info, c.info) {
+		return
+	}
+
+	log.Warnf("Conflict: %s was changed on the machine, %s", name, action)
+	s.conflicted[name] = c
+	s.conflicts++
+}
+
+// watch pushes the local changes at each interval until stopped. The local
+// directory is watched with file change notifications, and only synced again
+// once it changed or while conflicts are left. It's polled instead when poll
+// is set, as notifications are missed on network file systems, or when the
+// notifications can't be used. Once the connection to the machine is lost,
+// it's connected again at each interval until it's back.
+func (s *syncer) watch(interval time.Duration, poll bool, stop <-chan struct{}) error {
+	var (
+		watcher *syncWatcher
+		events  <-chan fsnotify.Event
+		errs    <-chan error
+	)
+
+	stopWatching := func(err error) {
+		log.Warnf("Error watching %s for changes, polling it instead: %s", s.local, err)
+		watcher.Close()
+		watcher, events, errs = nil, nil, nil
+	}
+
+	if !poll {
+		w, err := newSyncWatcher(s.local, s.ignore)
+		if err != nil {
+			log.Warnf("Error watching %s for changes, polling it instead: %s", s.local, err)
+		} else {
+			watcher, events, errs = w, w.Events, w.Errors
+			defer func() {
+				if watcher != nil {
+					watcher.Close()
+				}
+			}()
+		}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// The changes made before the notifications started are pushed first.
+	changed := true
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				stopWatching(errors.New("the notifications stopped"))
+				continue
+			}
+			changed = true
+			if err := watcher.handle(event); err != nil {
+				stopWatching(err)
+			}
+			continue
+		case err, ok := <-errs:
+			if !ok {
+				stopWatching(errors.New("the notifications stopped"))
+				continue
+			}
+			// Changes may have been missed, the next sync scans them all.
+			changed = true
+			if err != fsnotify.ErrEventOverflow {
+				stopWatching(err)
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		if watcher != nil && !changed && len(s.conflicted) == 0 && s.dest != nil {
+			continue
+		}
+
+		if s.dest == nil {
+			if err := s.reconnect(); err != nil {
+				log.Warnf("Error connecting to the machine again: %s", err)
+				continue
+			}
+			log.Info("Connected to the machine again")
+		}
+
+		err := s.sync()
+		if err == nil {
+			changed = false
+			continue
+		}
+		if s.connect == nil || !s.disconnected() {
+			return err
+		}
+
+		log.Warnf("Lost the connection to the machine, reconnecting: %s", err)
+		s.close()
+	}
+}
+
+// disconnected tells whether the connection to the machine was lost.
+func (s *syncer) disconnected() bool {
+	_, err := s.dest.Stat(s.remote)
+	if pathErr, ok := err.(*os.PathError); ok {
+		err = pathErr.Err
+	}
+
+	return err == sftp.ErrSSHFxConnectionLost
+}
+
+func (s *syncer) reconnect() error {
+	dest, err := s.connect()
+	if err != nil {
+		return err
+	}
+
+	s.dest = dest
+	s.copier.dest = dest
+	return nil
+}
+
+func (s *syncer) close() {
+	if s.dest != nil {
+		s.dest.Close()
+	}
+	s.dest = nil
+	s.copier.dest = nil
+}
+
+func cmdSync(c CommandLine, api libmachine.API) error {
+	args := c.Args()
+	if len(args) != 2 {
+		c.ShowHelp()
+		return errWrongNumberArguments
+	}
+
+	local, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	if fi, err := os.Stat(local); err != nil || !fi.IsDir() {
+		return errSyncNotDirectory
+	}
+
+	interval := time.Duration(c.Int("interval")) * time.Second
+	if interval <= 0 {
+		return fmt.Errorf("Error: the interval must be positive")
+	}
+
+	patterns, err := readSyncIgnore(filepath.Join(local, syncIgnoreFile))
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", syncIgnoreFile, err)
+	}
+
+	ignore, err := newSyncIgnore(append(patterns, c.StringSlice("exclude")...))
+	if err != nil {
+		return fmt.Errorf("Error parsing the exclude patterns: %s", err)
+	}
+
+	// The checksums of the files to update are computed over the connection
+	// of the sync.
+	defer ssh.PoolConnections()()
+
+	hostInfoLoader := &storeHostInfoLoader{api}
+	dest, remote, err := scpEndpoint(args[1], hostInfoLoader)
+	if err != nil {
+		return err
+	}
+
+	s := newSyncer(local, remote, dest, ignore)
+	defer s.close()
+
+	s.connect = func() (scpFS, error) {
+		dest, _, err := scpEndpoint(args[1], hostInfoLoader)
+		return dest, err
+	}
+	if err := s.sync(); err != nil {
+		return err
+	}
+
+	if !c.Bool("watch") {
+		if s.conflicts > 0 {
+			return fmt.Errorf("Error: %d files were changed on the machine and weren't synced", s.conflicts)
+		}
+		return nil
+	}
+
+	log.Infof("Watching %s for changes, press Ctrl-C to stop", local)
+
+	interrupt := make(chan os.Signal, 1)
+	defer notifySignals(interrupt, os.Interrupt)()
+
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	return s.watch(interval, c.Bool("poll"), stop)
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// syncIgnore matches paths against .dockerignore patterns. The last pattern
+// matching a path wins, patterns starting with ! re-include paths, and a
+// pattern matching a directory matches everything under it.
+type syncIgnore struct {
+	patterns   []ignorePattern
+	exceptions bool
+}
+
+type ignorePattern struct {
+	re        *regexp.Regexp
+	exclusion bool
+}
+
+func newSyncIgnore(patterns []string) (*syncIgnore, error) {
+	ignore := &syncIgnore{}
+
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+
+		exclusion := false
+		if strings.HasPrefix(pattern, "!") {
+			exclusion = true
+			pattern = strings.TrimSpace(pattern[1:])
+		}
+
+		pattern = strings.TrimPrefix(path.Clean(filepath.ToSlash(pattern)), "/")
+		if pattern == "" || pattern == "." {
+			continue
+		}
+
+		re, err := regexp.Compile(ignoreRegexp(pattern))
+		if err != nil {
+			return nil, err
+		}
+
+		ignore.patterns = append(ignore.patterns, ignorePattern{re: re, exclusion: exclusion})
+		ignore.exceptions = ignore.exceptions || exclusion
+	}
+
+	return ignore, nil
+}
+
+// readSyncIgnore reads the patterns of an ignore file, if it exists.
+func readSyncIgnore(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+
+	return patterns, scanner.Err()
+}
+
+// ignoreRegexp translates a pattern to a regular expression the way docker
+// build does: * and ? don't match /, and ** matches any number of
+// directories.
+func ignoreRegexp(pattern string) string {
+	re := "^"
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '*' && i+1 < len(pattern) && pattern[i+1] == '*':
+			i++
+			switch {
+			case i+1 == len(pattern):
+				re += ".*"
+			case pattern[i+1] == '/':
+				i++
+				re += "(.*/)?"
+			default:
+				re += ".*"
+			}
+		case c == '*':
+			re += "[^/]*"
+		case c == '?':
+			re += "[^/]"
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re += regexp.QuoteMeta(pattern[i : i+1])
+		default:
+			re += regexp.QuoteMeta(pattern[i : i+1])
+		}
+	}
+
+	return re + "$"
+}
+
+// matches tells whether a slash separated path, relative to the synced
+// directory, is ignored.
+func (i *syncIgnore) matches(name string) bool {
+	matched := false
+
+	for _, pattern := range i.patterns {
+		// Only the patterns which would change the outcome are tried.
+		if pattern.exclusion != matched {
+			continue
+		}
+
+		for p := name; p != "."; p = path.Dir(p) {
+			if pattern.re.MatchString(p) {
+				matched = !pattern.exclusion
+				break
+			}
+		}
+	}
+
+	return matched
+}
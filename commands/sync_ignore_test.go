@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncIgnore(t *testing.T) {
+	ignore, err := newSyncIgnore([]string{
+		"# comment",
+		"",
+		"*.log",
+		"!keep.log",
+		"/build",
+		"**/node_modules",
+		"docs/*.md",
+		"!docs/README.md",
+	})
+	assert.NoError(t, err)
+
+	for name, ignored := range map[string]bool{
+		"app.log":                   true,
+		"keep.log":                  false,
+		"sub/app.log":               false,
+		"build":                     true,
+		"build/out/app":             true,
+		"src/build":                 false,
+		"node_modules/lib/index.js": true,
+		"web/node_modules/lib/a.js": true,
+		"docs/guide.md":             true,
+		"docs/README.md":            false,
+		"docs/images/diagram.md":    false,
+		"main.go":                   false,
+		"# comment":                 false,
+	} {
+		assert.Equal(t, ignored, ignore.matches(name), name)
+	}
+
+	assert.True(t, ignore.exceptions)
+}
+
+func TestSyncIgnoreEscapes(t *testing.T) {
+	ignore, err := newSyncIgnore([]string{`\*.txt`, "a?c", "x/**"})
+	assert.NoError(t, err)
+
+	assert.True(t, ignore.matches("*.txt"))
+	assert.False(t, ignore.matches("notes.txt"))
+	assert.True(t, ignore.matches("abc"))
+	assert.False(t, ignore.matches("a/c"))
+	assert.True(t, ignore.matches("x/y/z"))
+	assert.False(t, ignore.exceptions)
+}
+
+func TestReadSyncIgnore(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	patterns, err := readSyncIgnore(filepath.Join(dir, ".dockerignore"))
+	assert.NoError(t, err)
+	assert.Empty(t, patterns)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".dockerignore"), []byte(".git\n*.swp\n"), 0644))
+
+	patterns, err = readSyncIgnore(filepath.Join(dir, ".dockerignore"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{".git", "*.swp"}, patterns)
+}
@@ -0,0 +1,299 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	syncOld = time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	syncNew = time.Date(2016, 10, 2, 12, 0, 0, 0, time.UTC)
+)
+
+func writeSyncFile(t *testing.T, name, content string, mtime time.Time) {
+	assert.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+	assert.NoError(t, ioutil.WriteFile(name, []byte(content), 0644))
+	assert.NoError(t, os.Chtimes(name, mtime, mtime))
+}
+
+func assertSyncFile(t *testing.T, name, content string) {
+	data, err := ioutil.ReadFile(name)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
+
+func TestSyncToMachine(t *testing.T) {
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+
+	writeSyncFile(t, filepath.Join(local, "main.go"), "package main", syncOld)
+	writeSyncFile(t, filepath.Join(local, "lib", "lib.go"), "package lib", syncOld)
+	writeSyncFile(t, filepath.Join(local, "app.log"), "log", syncOld)
+	writeSyncFile(t, filepath.Join(local, "build", "app"), "binary", syncOld)
+
+	// Older files on the machine are updated, newer ones are conflicts.
+	writeSyncFile(t, filepath.Join(remote, "lib", "lib.go"), "package old", time.Date(2016, 9, 1, 0, 0, 0, 0, time.UTC))
+	writeSyncFile(t, filepath.Join(remote, "main.go"), "package edited", syncNew)
+
+	ignore, err := newSyncIgnore([]string{"*.log", "build"})
+	assert.NoError(t, err)
+
+	dest, remotePath, err := scpEndpoint("myfunhost:"+remote, loader)
+	assert.NoError(t, err)
+	defer dest.Close()
+
+	s := newSyncer(local, remotePath, dest, ignore)
+	assert.NoError(t, s.sync())
+
+	assertSyncFile(t, filepath.Join(remote, "lib", "lib.go"), "package lib")
+	assertSyncFile(t, filepath.Join(remote, "main.go"), "package edited")
+	assert.Equal(t, 1, s.conflicts)
+
+	_, err = os.Stat(filepath.Join(remote, "app.log"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(remote, "build"))
+	assert.True(t, os.IsNotExist(err))
+
+	// The conflicting file isn't overwritten once changed locally.
+	writeSyncFile(t, filepath.Join(local, "main.go"), "package main // changed", time.Now())
+	assert.NoError(t, s.sync())
+	assertSyncFile(t, filepath.Join(remote, "main.go"), "package edited")
+	assert.Equal(t, 2, s.conflicts)
+}
+
+func TestSyncPushesChanges(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+
+	writeSyncFile(t, filepath.Join(local, "a"), "a", syncOld)
+	writeSyncFile(t, filepath.Join(local, "b"), "b", syncOld)
+	writeSyncFile(t, filepath.Join(local, "sub", "c"), "c", syncOld)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	s := newSyncer(local, remote, localFS{}, ignore)
+	assert.NoError(t, s.sync())
+	assertSyncFile(t, filepath.Join(remote, "sub", "c"), "c")
+
+	writeSyncFile(t, filepath.Join(local, "a"), "changed", syncNew)
+	writeSyncFile(t, filepath.Join(local, "new", "d"), "d", syncNew)
+	assert.NoError(t, os.Remove(filepath.Join(local, "b")))
+	assert.NoError(t, os.RemoveAll(filepath.Join(local, "sub")))
+
+	assert.NoError(t, s.sync())
+
+	assertSyncFile(t, filepath.Join(remote, "a"), "changed")
+	assertSyncFile(t, filepath.Join(remote, "new", "d"), "d")
+	_, err = os.Stat(filepath.Join(remote, "b"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(remote, "sub"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Equal(t, 0, s.conflicts)
+}
+
+func TestSyncReportsRemoteChanges(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+
+	writeSyncFile(t, filepath.Join(local, "a"), "a", syncOld)
+	writeSyncFile(t, filepath.Join(local, "sub", "b"), "b", syncOld)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	s := newSyncer(local, remote, localFS{}, ignore)
+	assert.NoError(t, s.sync())
+
+	// Files changed on the machine since they were synced are kept, even
+	// when they're older than the local ones.
+	writeSyncFile(t, filepath.Join(remote, "a"), "edited on the machine", syncOld)
+	writeSyncFile(t, filepath.Join(remote, "sub", "b"), "edited too", syncOld)
+	writeSyncFile(t, filepath.Join(local, "a"), "edited locally", syncNew)
+	assert.NoError(t, os.RemoveAll(filepath.Join(local, "sub")))
+
+	assert.NoError(t, s.sync())
+
+	assertSyncFile(t, filepath.Join(remote, "a"), "edited on the machine")
+	assertSyncFile(t, filepath.Join(remote, "sub", "b"), "edited too")
+	assert.Equal(t, 2, s.conflicts)
+
+	// Removing the file on the machine resolves the conflict.
+	assert.NoError(t, os.Remove(filepath.Join(remote, "a")))
+	writeSyncFile(t, filepath.Join(local, "a"), "edited again", time.Now())
+
+	assert.NoError(t, s.sync())
+	assertSyncFile(t, filepath.Join(remote, "a"), "edited again")
+}
+
+func TestSyncRetriesConflicts(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+
+	writeSyncFile(t, filepath.Join(local, "a"), "a", syncOld)
+	writeSyncFile(t, filepath.Join(local, "b"), "b", syncOld)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	s := newSyncer(local, remote, localFS{}, ignore)
+	assert.NoError(t, s.sync())
+
+	writeSyncFile(t, filepath.Join(remote, "a"), "edited on the machine", syncOld)
+	writeSyncFile(t, filepath.Join(remote, "b"), "edited too", syncOld)
+	writeSyncFile(t, filepath.Join(local, "a"), "edited locally", syncNew)
+	assert.NoError(t, os.Remove(filepath.Join(local, "b")))
+
+	assert.NoError(t, s.sync())
+	assert.Equal(t, 2, s.conflicts)
+
+	// The conflicts are only reported once while the local files don't
+	// change.
+	assert.NoError(t, s.sync())
+	assert.Equal(t, 2, s.conflicts)
+
+	// They're resolved on the machine without changing the local files.
+	assert.NoError(t, os.Remove(filepath.Join(remote, "a")))
+	assert.NoError(t, os.Remove(filepath.Join(remote, "b")))
+
+	assert.NoError(t, s.sync())
+	assertSyncFile(t, filepath.Join(remote, "a"), "edited locally")
+	assert.Empty(t, s.conflicted)
+	assert.Equal(t, 2, s.conflicts)
+}
+
+func waitForSyncFile(t *testing.T, name, content string) {
+	for i := 0; i < 500; i++ {
+		if data, err := ioutil.ReadFile(name); err == nil && string(data) == content {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertSyncFile(t, name, content)
+}
+
+func testSyncWatch(t *testing.T, poll bool) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+	writeSyncFile(t, filepath.Join(local, "a"), "a", syncOld)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	s := newSyncer(local, remote, localFS{}, ignore)
+	assert.NoError(t, s.sync())
+
+	stop := make(chan struct{})
+	watched := make(chan error)
+	go func() {
+		watched <- s.watch(10*time.Millisecond, poll, stop)
+	}()
+
+	writeSyncFile(t, filepath.Join(local, "a"), "changed", syncNew)
+	waitForSyncFile(t, filepath.Join(remote, "a"), "changed")
+
+	// Files in new directories are pushed too.
+	writeSyncFile(t, filepath.Join(local, "new", "sub", "b"), "b", syncNew)
+	waitForSyncFile(t, filepath.Join(remote, "new", "sub", "b"), "b")
+	writeSyncFile(t, filepath.Join(local, "new", "sub", "b"), "changed", syncOld)
+	waitForSyncFile(t, filepath.Join(remote, "new", "sub", "b"), "changed")
+
+	close(stop)
+	assert.NoError(t, <-watched)
+}
+
+func TestSyncWatch(t *testing.T) {
+	testSyncWatch(t, false)
+}
+
+func TestSyncWatchPolling(t *testing.T) {
+	testSyncWatch(t, true)
+}
+
+func TestSyncWatchStops(t *testing.T) {
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	s := newSyncer(filepath.Join(dir, "app"), filepath.Join(dir, "remote"), localFS{}, ignore)
+	assert.NoError(t, os.Mkdir(s.local, 0755))
+
+	stop := make(chan struct{})
+	close(stop)
+
+	assert.NoError(t, s.watch(time.Millisecond, false, stop))
+}
+
+func TestSyncWatchReconnects(t *testing.T) {
+	loader, server := sftpTestLoader(t)
+	defer server.Close()
+
+	dir := sftpTestDir(t)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "app")
+	remote := filepath.Join(dir, "remote")
+	writeSyncFile(t, filepath.Join(local, "main.go"), "package main", syncOld)
+
+	ignore, err := newSyncIgnore(nil)
+	assert.NoError(t, err)
+
+	connect := func() (scpFS, error) {
+		dest, _, err := scpEndpoint("myfunhost:"+remote, loader)
+		return dest, err
+	}
+
+	dest, err := connect()
+	assert.NoError(t, err)
+
+	s := newSyncer(local, remote, dest, ignore)
+	s.connect = connect
+	defer s.close()
+	assert.NoError(t, s.sync())
+
+	server.DropConnections()
+	writeSyncFile(t, filepath.Join(local, "lib.go"), "package lib", syncNew)
+
+	stop := make(chan struct{})
+	watched := make(chan error)
+	go func() {
+		watched <- s.watch(10*time.Millisecond, false, stop)
+	}()
+
+	for i := 0; i < 500; i++ {
+		if _, err := os.Stat(filepath.Join(remote, "lib.go")); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(stop)
+
+	assert.NoError(t, <-watched)
+	assertSyncFile(t, filepath.Join(remote, "lib.go"), "package lib")
+	assert.True(t, server.Connections() > 1)
+}
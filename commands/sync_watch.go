@@ -0,0 +1,80 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// syncWatcher tells when the files under a local directory change, with the
+// file change notifications of the platform.
+type syncWatcher struct {
+	*fsnotify.Watcher
+	local  string
+	ignore *syncIgnore
+}
+
+func newSyncWatcher(local string, ignore *syncIgnore) (*syncWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	w := &syncWatcher{
+		Watcher: watcher,
+		local:   local,
+		ignore:  ignore,
+	}
+
+	if err := w.addTree(local); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// addTree watches a directory and the ones under it which aren't ignored,
+// as notifications aren't recursive.
+func (w *syncWatcher) addTree(dir string) error {
+	return filepath.Walk(dir, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			// Directories removed meanwhile aren't watched anymore anyway.
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !fi.IsDir() {
+			return nil
+		}
+
+		if p != w.local {
+			name, err := filepath.Rel(w.local, p)
+			if err != nil {
+				return err
+			}
+			if w.ignore.matches(filepath.ToSlash(name)) && !w.ignore.exceptions {
+				return filepath.SkipDir
+			}
+		}
+
+		return w.Add(p)
+	})
+}
+
+// handle watches the directories created under the watched ones.
+func (w *syncWatcher) handle(event fsnotify.Event) error {
+	if event.Op&fsnotify.Create == 0 {
+		return nil
+	}
+
+	fi, err := os.Lstat(event.Name)
+	if err != nil || !fi.IsDir() {
+		return nil
+	}
+
+	return w.addTree(event.Name)
+}
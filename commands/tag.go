@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+)
+
+var validTagKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.\-/]*$`)
+
+// parseTag parses a key=value tag.
+func parseTag(tag string) (string, string, error) {
+	kv := strings.SplitN(tag, "=", 2)
+	if len(kv) != 2 {
+		return "", "", fmt.Errorf("Invalid tag %q, expected key=value", tag)
+	}
+
+	if !validTagKeyPattern.MatchString(kv[0]) {
+		return "", "", fmt.Errorf("Invalid tag key %q", kv[0])
+	}
+
+	return kv[0], kv[1], nil
+}
+
+// applyTags sets the key=value tags on a machine and removes the key- ones.
+func applyTags(h *host.Host, tags []string) error {
+	for _, tag := range tags {
+		if !strings.Contains(tag, "=") && strings.HasSuffix(tag, "-") {
+			h.RemoveTag(strings.TrimSuffix(tag, "-"))
+			continue
+		}
+
+		key, value, err := parseTag(tag)
+		if err != nil {
+			return err
+		}
+
+		h.SetTag(key, value)
+	}
+
+	return nil
+}
+
+func sortedTags(tags map[string]string) []string {
+	list := []string{}
+	for key, value := range tags {
+		list = append(list, key+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+func cmdTag(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) == 0 {
+		c.ShowHelp()
+		return ErrExpectedOneMachine
+	}
+
+	name := c.Args().First()
+	tags := c.Args().Tail()
+
+	if len(tags) == 0 {
+		h, err := api.Load(name)
+		if err != nil {
+			return err
+		}
+
+		for _, tag := range sortedTags(h.Tags()) {
+			fmt.Println(tag)
+		}
+
+		return nil
+	}
+
+	unlock, err := lockMachines(api, []string{name})
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	h, err := api.Load(name)
+	if err != nil {
+		return err
+	}
+
+	if err := applyTags(h, tags); err != nil {
+		return err
+	}
+
+	if err := api.Save(h); err != nil {
+		return fmt.Errorf("Error saving host to store: %s", err)
+	}
+
+	return nil
+}
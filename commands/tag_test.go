@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"testing"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTag(t *testing.T) {
+	key, value, err := parseTag("cost-center=r&d=42")
+	assert.NoError(t, err)
+	assert.Equal(t, "cost-center", key)
+	assert.Equal(t, "r&d=42", value)
+
+	_, _, err = parseTag("owner")
+	assert.EqualError(t, err, `Invalid tag "owner", expected key=value`)
+
+	_, _, err = parseTag("-owner=alice")
+	assert.EqualError(t, err, `Invalid tag key "-owner"`)
+}
+
+func TestApplyTags(t *testing.T) {
+	h := &host.Host{}
+
+	assert.NoError(t, applyTags(h, []string{"owner=alice", "project=web"}))
+	assert.Equal(t, map[string]string{"owner": "alice", "project": "web"}, h.Tags())
+	assert.Equal(t, host.MachineMetadataVersion, h.Metadata.Version)
+
+	assert.NoError(t, applyTags(h, []string{"owner-", "project=api"}))
+	assert.Equal(t, []string{"project=api"}, sortedTags(h.Tags()))
+
+	assert.Error(t, applyTags(h, []string{"owner"}))
+}
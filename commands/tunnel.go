@@ -0,0 +1,149 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	tunnelDefaultRemote = "/var/run/docker.sock"
+)
+
+var (
+	errTunnelLocal = errors.New("Error: --socket and --local can't be used together")
+)
+
+// parseTunnelRemote returns the network and the address of what a tunnel
+// goes to: a unix socket if it's a path, otherwise a TCP port, alone for a
+// port on localhost, or host:port.
+func parseTunnelRemote(remote string) (string, string, error) {
+	if strings.HasPrefix(remote, "/") {
+		return "unix", remote, nil
+	}
+
+	if _, err := strconv.ParseUint(remote, 10, 16); err == nil {
+		return "tcp", net.JoinHostPort("localhost", remote), nil
+	}
+
+	_, port, err := net.SplitHostPort(remote)
+	if err != nil {
+		return "", "", fmt.Errorf("Error: invalid remote %q, expected a socket path, a port or host:port", remote)
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", "", fmt.Errorf("Error: invalid port in remote %q", remote)
+	}
+
+	return "tcp", remote, nil
+}
+
+// tunnelListener listens on the local TCP address if there's one, otherwise
+// on the unix socket, where a socket left by a previous tunnel is removed.
+// Other files are never removed.
+func tunnelListener(local, socket string) (net.Listener, error) {
+	if local != "" {
+		return net.Listen("tcp", local)
+	}
+
+	fi, err := os.Lstat(socket)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	case fi.Mode()&os.ModeSocket == 0:
+		return nil, fmt.Errorf("Error: %s already exists and isn't a socket", socket)
+	default:
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", socket)
+}
+
+func cmdTunnel(c CommandLine, api libmachine.API) error {
+	if len(c.Args()) > 1 {
+		return ErrExpectedOneMachine
+	}
+
+	local := c.String("local")
+	socket := c.String("socket")
+	if local != "" && socket != "" {
+		return errTunnelLocal
+	}
+
+	remote := c.String("remote")
+	if remote == "" {
+		remote = tunnelDefaultRemote
+	}
+
+	remoteNetwork, remoteAddress, err := parseTunnelRemote(remote)
+	if err != nil {
+		return err
+	}
+
+	target, err := targetHost(c, api)
+	if err != nil {
+		return err
+	}
+
+	h, err := api.Load(target)
+	if err != nil {
+		return err
+	}
+
+	currentState, err := h.Driver.GetState()
+	if err != nil {
+		return err
+	}
+
+	if currentState != state.Running {
+		return errStateInvalidForSSH{h.Name}
+	}
+
+	if local == "" && socket == "" {
+		socket = filepath.Join(mcndirs.GetMachineDir(), h.Name, "docker.sock")
+	}
+	if socket != "" {
+		if socket, err = filepath.Abs(socket); err != nil {
+			return err
+		}
+	}
+
+	tunnel, err := h.CreateSSHTunnel(remoteNetwork, remoteAddress)
+	if err != nil {
+		return err
+	}
+
+	listener, err := tunnelListener(local, socket)
+	if err != nil {
+		return fmt.Errorf("Error listening for the tunnel: %s", err)
+	}
+
+	touchHost(api, h)
+
+	log.Infof("Forwarding %s to %s on %s, press Ctrl-C to stop", listener.Addr(), remoteAddress, h.Name)
+	if socket != "" && remoteAddress == tunnelDefaultRemote {
+		log.Infof("Run 'export DOCKER_HOST=unix://%s' to use it with the Docker client", socket)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	defer notifySignals(interrupt, os.Interrupt)()
+
+	stop := make(chan struct{})
+	go func() {
+		<-interrupt
+		close(stop)
+	}()
+
+	return tunnel.Serve(listener, stop)
+}
@@ -0,0 +1,110 @@
+package commands
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTunnelRemote(t *testing.T) {
+	cases := []struct {
+		remote          string
+		expectedNetwork string
+		expectedAddress string
+		expectedErr     string
+	}{
+		{"/var/run/docker.sock", "unix", "/var/run/docker.sock", ""},
+		{"8080", "tcp", "localhost:8080", ""},
+		{"10.0.0.2:5432", "tcp", "10.0.0.2:5432", ""},
+		{"[::1]:2375", "tcp", "[::1]:2375", ""},
+		{"docker.sock", "", "", `Error: invalid remote "docker.sock", expected a socket path, a port or host:port`},
+		{"localhost:http", "", "", `Error: invalid port in remote "localhost:http"`},
+	}
+
+	for _, c := range cases {
+		network, address, err := parseTunnelRemote(c.remote)
+		if c.expectedErr != "" {
+			assert.EqualError(t, err, c.expectedErr)
+			continue
+		}
+
+		assert.NoError(t, err)
+		assert.Equal(t, c.expectedNetwork, network)
+		assert.Equal(t, c.expectedAddress, address)
+	}
+}
+
+func TestCmdTunnelLocalAndSocket(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"foo"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"socket": "docker.sock",
+				"local":  "localhost:2375",
+			},
+		},
+	}
+
+	err := cmdTunnel(commandLine, &libmachinetest.FakeAPI{})
+
+	assert.Equal(t, errTunnelLocal, err)
+}
+
+func TestCmdTunnelNotRunning(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs:    []string{"foo"},
+		LocalFlags: &commandstest.FakeFlagger{Data: map[string]interface{}{}},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name:   "foo",
+				Driver: &fakedriver.Driver{MockState: state.Stopped},
+			},
+		},
+	}
+
+	err := cmdTunnel(commandLine, api)
+
+	assert.Equal(t, errStateInvalidForSSH{"foo"}, err)
+}
+
+func TestTunnelListenerReplacesSocketsOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix sockets aren't files on windows")
+	}
+
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	file := filepath.Join(tmpDir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("keep me"), 0600))
+
+	_, err = tunnelListener("", file)
+	assert.EqualError(t, err, "Error: "+file+" already exists and isn't a socket")
+	content, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, "keep me", string(content))
+
+	// A socket left by a tunnel which didn't exit cleanly is replaced.
+	socket := filepath.Join(tmpDir, "docker.sock")
+	stale, err := net.Listen("unix", socket)
+	assert.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err := tunnelListener("", socket)
+	assert.NoError(t, err)
+	listener.Close()
+}
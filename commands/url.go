@@ -2,15 +2,26 @@ package commands
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/docker/machine/libmachine"
 )
 
+type urlOutput struct {
+	Name string
+	URL  string
+}
+
 func cmdURL(c CommandLine, api libmachine.API) error {
 	if len(c.Args()) > 1 {
 		return ErrExpectedOneMachine
 	}
 
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
 	target, err := targetHost(c, api)
 	if err != nil {
 		return err
@@ -26,6 +37,13 @@ func cmdURL(c CommandLine, api libmachine.API) error {
 		return err
 	}
 
+	if output != "" {
+		return printOutput(os.Stdout, output, urlOutput{
+			Name: host.Name,
+			URL:  url,
+		})
+	}
+
 	fmt.Println(url)
 
 	return nil
@@ -55,3 +55,33 @@ func TestCmdURL(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "tcp://120.0.0.1:2376\n", stdoutGetter.Output())
 }
+
+func TestCmdURLOutputYAML(t *testing.T) {
+	commandLine := &commandstest.FakeCommandLine{
+		CliArgs: []string{"machine"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"output": "yaml",
+			},
+		},
+	}
+	api := &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name: "machine",
+				Driver: &fakedriver.Driver{
+					MockState: state.Running,
+					MockIP:    "120.0.0.1",
+				},
+			},
+		},
+	}
+
+	stdoutGetter := commandstest.NewStdoutGetter()
+	defer stdoutGetter.Stop()
+
+	err := cmdURL(commandLine, api)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "Name: machine\nURL: tcp://120.0.0.1:2376\n", stdoutGetter.Output())
+}
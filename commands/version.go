@@ -8,14 +8,37 @@ import (
 
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/mcndockerclient"
+	machineversion "github.com/docker/machine/version"
 )
 
+type versionOutput struct {
+	Version   string
+	GitCommit string
+}
+
+type machineVersionOutput struct {
+	Name          string
+	DockerVersion string
+}
+
 func cmdVersion(c CommandLine, api libmachine.API) error {
 	return printVersion(c, api, os.Stdout)
 }
 
 func printVersion(c CommandLine, api libmachine.API, out io.Writer) error {
+	output := c.String("output")
+	if err := checkOutput(output, outputJSON, outputYAML); err != nil {
+		return err
+	}
+
 	if len(c.Args()) == 0 {
+		if output != "" {
+			return printOutput(out, output, versionOutput{
+				Version:   machineversion.Version,
+				GitCommit: machineversion.GitCommit,
+			})
+		}
+
 		c.ShowVersion()
 		return nil
 	}
@@ -29,11 +52,23 @@ func printVersion(c CommandLine, api libmachine.API, out io.Writer) error {
 		return err
 	}
 
-	version, err := mcndockerclient.DockerVersion(host)
+	var version string
+	if host.NoTLS() {
+		version, err = host.DockerVersion()
+	} else {
+		version, err = mcndockerclient.DockerVersion(host)
+	}
 	if err != nil {
 		return err
 	}
 
+	if output != "" {
+		return printOutput(out, output, machineVersionOutput{
+			Name:          host.Name,
+			DockerVersion: version,
+		})
+	}
+
 	fmt.Fprintln(out, version)
 
 	return nil
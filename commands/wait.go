@@ -0,0 +1,205 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/check"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/persist"
+	"github.com/docker/machine/libmachine/state"
+)
+
+const (
+	waitDefaultTimeout = "5m"
+
+	// exitCodeTimeout is the exit code of wait when it timed out, the same
+	// as the one of the timeout command.
+	exitCodeTimeout = 124
+)
+
+var (
+	waitInterval = 3 * time.Second
+
+	errNoWaitCondition = errors.New("Error: expected at least one condition to wait for, with --for")
+)
+
+type errNotSwarmMaster struct {
+	Name string
+}
+
+func (e errNotSwarmMaster) Error() string {
+	return fmt.Sprintf("Error: %q is not a swarm master", e.Name)
+}
+
+// errWaitTimeout is returned when machines weren't ready in time.
+type errWaitTimeout struct {
+	Names   []string
+	Timeout time.Duration
+}
+
+func (e errWaitTimeout) Error() string {
+	return fmt.Sprintf("Error: timed out after %s waiting for %s", e.Timeout, strings.Join(e.Names, ", "))
+}
+
+func (e errWaitTimeout) ExitCode() int {
+	return exitCodeTimeout
+}
+
+// waitCondition is something a machine can be waited for.
+type waitCondition struct {
+	Name      string
+	Condition func(h *host.Host) mcnutils.Condition
+}
+
+// parseWaitCondition parses state=<state>, ssh, docker or swarm.
+func parseWaitCondition(condition string) (waitCondition, error) {
+	kv := strings.SplitN(condition, "=", 2)
+
+	switch {
+	case kv[0] == "state" && len(kv) == 2:
+		desiredState, err := state.Parse(kv[1])
+		if err != nil {
+			return waitCondition{}, err
+		}
+		return waitCondition{condition, inState(desiredState)}, nil
+	case condition == "ssh":
+		return waitCondition{condition, sshAvailable}, nil
+	case condition == "docker":
+		return waitCondition{condition, dockerAvailable}, nil
+	case condition == "swarm":
+		return waitCondition{condition, swarmAvailable}, nil
+	}
+
+	return waitCondition{}, fmt.Errorf("Error: unknown condition %q, expected state=<state>, ssh, docker or swarm", condition)
+}
+
+func inState(desiredState state.State) func(h *host.Host) mcnutils.Condition {
+	return func(h *host.Host) mcnutils.Condition {
+		return func() (bool, error) {
+			return drivers.MachineInState(h.Driver, desiredState)(), nil
+		}
+	}
+}
+
+func sshAvailable(h *host.Host) mcnutils.Condition {
+	return func() (bool, error) {
+		return drivers.SSHAvailable(h.Driver)(), nil
+	}
+}
+
+func dockerAvailable(h *host.Host) mcnutils.Condition {
+	return func() (bool, error) {
+		_, err := h.DockerVersion()
+		if err != nil {
+			log.Debugf("Docker isn't available on %s yet: %s", h.Name, err)
+		}
+		return err == nil, nil
+	}
+}
+
+func swarmAvailable(h *host.Host) mcnutils.Condition {
+	return func() (bool, error) {
+		if h.HostOptions == nil || h.HostOptions.SwarmOptions == nil || !h.HostOptions.SwarmOptions.Master {
+			return false, errNotSwarmMaster{h.Name}
+		}
+
+		_, _, err := check.DefaultConnChecker.Check(h, true)
+		if err != nil {
+			log.Debugf("Swarm isn't available on %s yet: %s", h.Name, err)
+		}
+		return err == nil, nil
+	}
+}
+
+// waitForMachine waits for the conditions on a machine one after the other,
+// until deadline.
+func waitForMachine(h *host.Host, conditions []waitCondition, deadline time.Time) error {
+	for _, condition := range conditions {
+		log.Debugf("Waiting for %s on %s", condition.Name, h.Name)
+
+		if err := mcnutils.WaitUntil(condition.Condition(h), deadline.Sub(time.Now()), waitInterval); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func cmdWait(c CommandLine, api libmachine.API) error {
+	conditions := []waitCondition{}
+	for _, flag := range c.StringSlice("for") {
+		condition, err := parseWaitCondition(flag)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, condition)
+	}
+	if len(conditions) == 0 {
+		return errNoWaitCondition
+	}
+
+	timeout, err := time.ParseDuration(c.String("timeout"))
+	if err != nil {
+		return fmt.Errorf("Error: invalid timeout: %s", err)
+	}
+
+	names, err := targetHosts(c, api)
+	if err != nil {
+		return err
+	}
+
+	hosts, hostsInError := persist.LoadHosts(api, names)
+	if len(hostsInError) > 0 {
+		errs := []error{}
+		for _, err := range hostsInError {
+			errs = append(errs, err)
+		}
+		return consolidateErrs(errs)
+	}
+
+	deadline := time.Now().Add(timeout)
+	results := make([]machineResult, len(hosts))
+
+	var wg sync.WaitGroup
+	for i, h := range hosts {
+		wg.Add(1)
+		go func(i int, h *host.Host) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := waitForMachine(h, conditions, deadline)
+
+			results[i] = machineResult{
+				Name:     h.Name,
+				Err:      err,
+				Duration: time.Since(start),
+			}
+		}(i, h)
+	}
+	wg.Wait()
+
+	if len(results) > 1 {
+		printResults(os.Stderr, "wait", results)
+	}
+
+	timedOut := []string{}
+	for _, result := range results {
+		if _, ok := result.Err.(mcnutils.ErrTimeout); ok {
+			timedOut = append(timedOut, result.Name)
+		}
+	}
+	if len(timedOut) > 0 {
+		return errWaitTimeout{timedOut, timeout}
+	}
+
+	return resultsErr("wait", results)
+}
@@ -0,0 +1,84 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/machine/commands/commandstest"
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/libmachinetest"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseWaitCondition(t *testing.T) {
+	for _, condition := range []string{"state=Running", "state=stopped", "ssh", "docker", "swarm"} {
+		parsed, err := parseWaitCondition(condition)
+		assert.NoError(t, err)
+		assert.Equal(t, condition, parsed.Name)
+	}
+
+	for _, condition := range []string{"state", "state=Flying", "dns", "ssh=yes"} {
+		_, err := parseWaitCondition(condition)
+		assert.Error(t, err, condition)
+	}
+}
+
+func waitCommandLine(timeout string, conditions ...string) *commandstest.FakeCommandLine {
+	return &commandstest.FakeCommandLine{
+		CliArgs: []string{"foo", "bar"},
+		LocalFlags: &commandstest.FakeFlagger{
+			Data: map[string]interface{}{
+				"for":     conditions,
+				"timeout": timeout,
+			},
+		},
+	}
+}
+
+func waitTestAPI(fooState, barState state.State) libmachine.API {
+	return &libmachinetest.FakeAPI{
+		Hosts: []*host.Host{
+			{
+				Name:   "foo",
+				Driver: &fakedriver.Driver{MockState: fooState},
+			},
+			{
+				Name:   "bar",
+				Driver: &fakedriver.Driver{MockState: barState},
+			},
+		},
+	}
+}
+
+func TestCmdWait(t *testing.T) {
+	defer func(interval time.Duration) { waitInterval = interval }(waitInterval)
+	waitInterval = time.Millisecond
+
+	err := cmdWait(waitCommandLine("1s", "state=running"), waitTestAPI(state.Running, state.Running))
+	assert.NoError(t, err)
+
+	err = cmdWait(waitCommandLine("10ms", "state=running"), waitTestAPI(state.Running, state.Stopped))
+	assert.Equal(t, errWaitTimeout{[]string{"bar"}, 10 * time.Millisecond}, err)
+
+	err = cmdWait(waitCommandLine("1s", "swarm"), waitTestAPI(state.Running, state.Running))
+	assert.EqualError(t, err, "Error: wait failed on 2 of 2 machines")
+}
+
+func TestCmdWaitErrors(t *testing.T) {
+	api := waitTestAPI(state.Running, state.Running)
+
+	assert.Equal(t, errNoWaitCondition, cmdWait(waitCommandLine("1s"), api))
+	assert.Error(t, cmdWait(waitCommandLine("soon", "ssh"), api))
+	assert.Error(t, cmdWait(waitCommandLine("1s", "dns"), api))
+}
+
+func TestReturnExitCodeOnWaitTimeout(t *testing.T) {
+	command := func(commandLine CommandLine, api libmachine.API) error {
+		return errWaitTimeout{[]string{"foo"}, time.Minute}
+	}
+
+	assert.Equal(t, exitCodeTimeout, checkErrorCodeForCommand(command))
+}
@@ -121,20 +121,23 @@ type clientFactory interface {
 
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			Name:   "amazonec2-access-key",
 			Usage:  "AWS Access Key",
 			EnvVar: "AWS_ACCESS_KEY_ID",
+			Field:  "AccessKey",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			Name:   "amazonec2-secret-key",
 			Usage:  "AWS Secret Key",
 			EnvVar: "AWS_SECRET_ACCESS_KEY",
+			Field:  "SecretKey",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			Name:   "amazonec2-session-token",
 			Usage:  "AWS Session Token",
 			EnvVar: "AWS_SESSION_TOKEN",
+			Field:  "SessionToken",
 		},
 		mcnflag.StringFlag{
 			Name:   "amazonec2-ami",
@@ -255,14 +258,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage: "Create an EBS optimized instance",
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-ssh-keypath",
-			Usage:  "SSH Key for Instance",
-			EnvVar: "AWS_SSH_KEYPATH",
+			Name:       "amazonec2-ssh-keypath",
+			Usage:      "SSH Key for Instance",
+			EnvVar:     "AWS_SSH_KEYPATH",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
-			Name:   "amazonec2-keypair-name",
-			Usage:  "AWS keypair to use; requires --amazonec2-ssh-keypath",
-			EnvVar: "AWS_KEYPAIR_NAME",
+			Name:       "amazonec2-keypair-name",
+			Usage:      "AWS keypair to use; requires --amazonec2-ssh-keypath",
+			EnvVar:     "AWS_KEYPAIR_NAME",
+			PerMachine: true,
 		},
 		mcnflag.IntFlag{
 			Name:  "amazonec2-retries",
@@ -457,6 +462,13 @@ func (d *Driver) DriverName() string {
 	return driverName
 }
 
+// MaxParallelism is low because EC2 throttles the API calls of an account in
+// a region, and fails the calls of the other machines with
+// RequestLimitExceeded once creates start polling their instances.
+func (d *Driver) MaxParallelism() int {
+	return 5
+}
+
 func (d *Driver) checkPrereqs() error {
 	// check for existing keypair
 	keyName := d.KeyName
@@ -1083,6 +1095,21 @@ func (d *Driver) configureTags(tagGroups string) error {
 	return nil
 }
 
+// Rename renames the instance by changing its Name tag.
+func (d *Driver) Rename(name string) error {
+	_, err := d.getClient().CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{&d.InstanceId},
+		Tags: []*ec2.Tag{
+			{
+				Key:   aws.String("Name"),
+				Value: aws.String(name),
+			},
+		},
+	})
+
+	return err
+}
+
 func (d *Driver) configureSecurityGroups(groupNames []string) error {
 	if len(groupNames) == 0 {
 		log.Debugf("no security groups to configure in %s", d.VpcId)
@@ -228,10 +228,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Azure Service Principal Account ID (optional, browser auth is used if not specified)",
 			EnvVar: "AZURE_CLIENT_ID",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			Name:   flAzureClientSecret,
 			Usage:  "Azure Service Principal Account password (optional, browser auth is used if not specified)",
 			EnvVar: "AZURE_CLIENT_SECRET",
+			Field:  "ClientSecret",
 		},
 	}
 }
@@ -291,6 +292,19 @@ func (d *Driver) SetConfigFromFlags(fl drivers.DriverOptions) error {
 // DriverName returns the name of the driver.
 func (d *Driver) DriverName() string { return driverName }
 
+// MaxParallelism is low because Azure Resource Manager limits the writes of
+// a subscription, and each machine creates a VM along with its network
+// interface, public IP, security group and virtual network.
+func (d *Driver) MaxParallelism() int {
+	return 5
+}
+
+// BoundToMachineName is true, the names of the VM and of the resources
+// around it are derived from the machine name.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 // PreCreateCheck validates if driver values are valid to create the machine.
 func (d *Driver) PreCreateCheck() (err error) {
 	if d.CustomDataFile != "" {
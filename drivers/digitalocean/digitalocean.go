@@ -51,10 +51,11 @@ const (
 // "docker hosts create"
 func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 	return []mcnflag.Flag{
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "DIGITALOCEAN_ACCESS_TOKEN",
 			Name:   "digitalocean-access-token",
 			Usage:  "Digital Ocean access token",
+			Field:  "AccessToken",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "DIGITALOCEAN_SSH_USER",
@@ -63,14 +64,16 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  defaultSSHUser,
 		},
 		mcnflag.StringFlag{
-			EnvVar: "DIGITALOCEAN_SSH_KEY_FINGERPRINT",
-			Name:   "digitalocean-ssh-key-fingerprint",
-			Usage:  "SSH key fingerprint",
+			EnvVar:     "DIGITALOCEAN_SSH_KEY_FINGERPRINT",
+			Name:       "digitalocean-ssh-key-fingerprint",
+			Usage:      "SSH key fingerprint",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
-			EnvVar: "DIGITALOCEAN_SSH_KEY_PATH",
-			Name:   "digitalocean-ssh-key-path",
-			Usage:  "SSH private key path ",
+			EnvVar:     "DIGITALOCEAN_SSH_KEY_PATH",
+			Name:       "digitalocean-ssh-key-path",
+			Usage:      "SSH private key path ",
+			PerMachine: true,
 		},
 		mcnflag.IntFlag{
 			EnvVar: "DIGITALOCEAN_SSH_PORT",
@@ -150,6 +153,13 @@ func (d *Driver) DriverName() string {
 	return "digitalocean"
 }
 
+// MaxParallelism is low because the DigitalOcean API allows a token 250
+// requests a minute, which the droplet status polls of machines being
+// created use up quickly.
+func (d *Driver) MaxParallelism() int {
+	return 5
+}
+
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.AccessToken = flags.String("digitalocean-access-token")
 	d.Image = flags.String("digitalocean-image")
@@ -207,6 +217,12 @@ func (d *Driver) PreCreateCheck() error {
 }
 
 func (d *Driver) Create() error {
+	return d.CreateContext(context.Background())
+}
+
+// CreateContext creates the droplet, until the context is done. The SSH key
+// and the droplet created by then are removed by Remove.
+func (d *Driver) CreateContext(ctx context.Context) error {
 	var userdata string
 	if d.UserDataFile != "" {
 		buf, err := ioutil.ReadFile(d.UserDataFile)
@@ -218,7 +234,7 @@ func (d *Driver) Create() error {
 
 	log.Infof("Creating SSH key...")
 
-	key, err := d.createSSHKey()
+	key, err := d.createSSHKey(ctx)
 	if err != nil {
 		return err
 	}
@@ -243,7 +259,7 @@ func (d *Driver) Create() error {
 		Tags:              d.getTags(),
 	}
 
-	newDroplet, _, err := client.Droplets.Create(context.TODO(), createRequest)
+	newDroplet, _, err := client.Droplets.Create(ctx, createRequest)
 	if err != nil {
 		return err
 	}
@@ -252,7 +268,7 @@ func (d *Driver) Create() error {
 
 	log.Info("Waiting for IP address to be assigned to the Droplet...")
 	for {
-		newDroplet, _, err = client.Droplets.Get(context.TODO(), d.DropletID)
+		newDroplet, _, err = client.Droplets.Get(ctx, d.DropletID)
 		if err != nil {
 			return err
 		}
@@ -266,7 +282,11 @@ func (d *Driver) Create() error {
 			break
 		}
 
-		time.Sleep(1 * time.Second)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(1 * time.Second):
+		}
 	}
 
 	log.Debugf("Created droplet ID %d, IP address %s",
@@ -276,12 +296,12 @@ func (d *Driver) Create() error {
 	return nil
 }
 
-func (d *Driver) createSSHKey() (*godo.Key, error) {
+func (d *Driver) createSSHKey(ctx context.Context) (*godo.Key, error) {
 	d.SSHKeyPath = d.GetSSHKeyPath()
 
 	if d.SSHKeyFingerprint != "" {
-		key, resp, err := d.getClient().Keys.GetByFingerprint(context.TODO(), d.SSHKeyFingerprint)
-		if err != nil && resp.StatusCode == 404 {
+		key, resp, err := d.getClient().Keys.GetByFingerprint(ctx, d.SSHKeyFingerprint)
+		if err != nil && resp != nil && resp.StatusCode == 404 {
 			return nil, fmt.Errorf("Digital Ocean SSH key with fingerprint %s doesn't exist", d.SSHKeyFingerprint)
 		}
 
@@ -310,7 +330,7 @@ func (d *Driver) createSSHKey() (*godo.Key, error) {
 		PublicKey: string(publicKey),
 	}
 
-	key, _, err := d.getClient().Keys.Create(context.TODO(), createRequest)
+	key, _, err := d.getClient().Keys.Create(ctx, createRequest)
 	if err != nil {
 		return key, err
 	}
@@ -332,7 +352,11 @@ func (d *Driver) GetURL() (string, error) {
 }
 
 func (d *Driver) GetState() (state.State, error) {
-	droplet, _, err := d.getClient().Droplets.Get(context.TODO(), d.DropletID)
+	return d.GetStateContext(context.Background())
+}
+
+func (d *Driver) GetStateContext(ctx context.Context) (state.State, error) {
+	droplet, _, err := d.getClient().Droplets.Get(ctx, d.DropletID)
 	if err != nil {
 		return state.Error, err
 	}
@@ -348,38 +372,64 @@ func (d *Driver) GetState() (state.State, error) {
 }
 
 func (d *Driver) Start() error {
-	_, _, err := d.getClient().DropletActions.PowerOn(context.TODO(), d.DropletID)
+	return d.StartContext(context.Background())
+}
+
+func (d *Driver) StartContext(ctx context.Context) error {
+	_, _, err := d.getClient().DropletActions.PowerOn(ctx, d.DropletID)
 	return err
 }
 
 func (d *Driver) Stop() error {
-	_, _, err := d.getClient().DropletActions.Shutdown(context.TODO(), d.DropletID)
+	return d.StopContext(context.Background())
+}
+
+func (d *Driver) StopContext(ctx context.Context) error {
+	_, _, err := d.getClient().DropletActions.Shutdown(ctx, d.DropletID)
 	return err
 }
 
 func (d *Driver) Restart() error {
-	_, _, err := d.getClient().DropletActions.Reboot(context.TODO(), d.DropletID)
+	return d.RestartContext(context.Background())
+}
+
+func (d *Driver) RestartContext(ctx context.Context) error {
+	_, _, err := d.getClient().DropletActions.Reboot(ctx, d.DropletID)
 	return err
 }
 
 func (d *Driver) Kill() error {
-	_, _, err := d.getClient().DropletActions.PowerOff(context.TODO(), d.DropletID)
+	return d.KillContext(context.Background())
+}
+
+func (d *Driver) KillContext(ctx context.Context) error {
+	_, _, err := d.getClient().DropletActions.PowerOff(ctx, d.DropletID)
+	return err
+}
+
+// Rename renames the droplet.
+func (d *Driver) Rename(name string) error {
+	_, _, err := d.getClient().DropletActions.Rename(context.TODO(), d.DropletID, name)
 	return err
 }
 
 func (d *Driver) Remove() error {
+	return d.RemoveContext(context.Background())
+}
+
+func (d *Driver) RemoveContext(ctx context.Context) error {
 	client := d.getClient()
 	if d.SSHKeyFingerprint == "" {
-		if resp, err := client.Keys.DeleteByID(context.TODO(), d.SSHKeyID); err != nil {
-			if resp.StatusCode == 404 {
+		if resp, err := client.Keys.DeleteByID(ctx, d.SSHKeyID); err != nil {
+			if resp != nil && resp.StatusCode == 404 {
 				log.Infof("Digital Ocean SSH key doesn't exist, assuming it is already deleted")
 			} else {
 				return err
 			}
 		}
 	}
-	if resp, err := client.Droplets.Delete(context.TODO(), d.DropletID); err != nil {
-		if resp.StatusCode == 404 {
+	if resp, err := client.Droplets.Delete(ctx, d.DropletID); err != nil {
+		if resp != nil && resp.StatusCode == 404 {
 			log.Infof("Digital Ocean droplet doesn't exist, assuming it is already deleted")
 		} else {
 			return err
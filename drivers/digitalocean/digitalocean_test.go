@@ -1,9 +1,11 @@
 package digitalocean
 
 import (
+	"context"
 	"testing"
 
 	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -113,3 +115,17 @@ func TestTagsEmpty(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Nil(t, driver.getTags())
 }
+
+func TestGetStateContextCanceled(t *testing.T) {
+	d := NewDriver("default", "path")
+	d.DropletID = 42
+	var driver drivers.ContextDriver = d
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s, err := driver.GetStateContext(ctx)
+
+	assert.Equal(t, state.Error, s)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+}
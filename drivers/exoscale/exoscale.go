@@ -66,15 +66,17 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "exoscale-url",
 			Usage:  "exoscale API endpoint",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "EXOSCALE_API_KEY",
 			Name:   "exoscale-api-key",
 			Usage:  "exoscale API key",
+			Field:  "ApiKey",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "EXOSCALE_API_SECRET",
 			Name:   "exoscale-api-secret-key",
 			Usage:  "exoscale API secret key",
+			Field:  "ApiSecretKey",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "EXOSCALE_INSTANCE_PROFILE",
@@ -113,10 +115,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "name of the ssh user",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "EXOSCALE_SSH_KEY",
-			Name:   "exoscale-ssh-key",
-			Value:  "",
-			Usage:  "path to the SSH user private key",
+			EnvVar:     "EXOSCALE_SSH_KEY",
+			Name:       "exoscale-ssh-key",
+			Value:      "",
+			Usage:      "path to the SSH user private key",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "EXOSCALE_USERDATA",
@@ -14,6 +14,7 @@ import (
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 )
 
@@ -38,9 +39,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "GENERIC_ENGINE_PORT",
 		},
 		mcnflag.StringFlag{
-			Name:   "generic-ip-address",
-			Usage:  "IP Address of machine",
-			EnvVar: "GENERIC_IP_ADDRESS",
+			Name:       "generic-ip-address",
+			Usage:      "IP Address of machine",
+			EnvVar:     "GENERIC_IP_ADDRESS",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			Name:   "generic-ssh-user",
@@ -49,10 +51,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "GENERIC_SSH_USER",
 		},
 		mcnflag.StringFlag{
-			Name:   "generic-ssh-key",
-			Usage:  "SSH private key path (if not provided, default SSH key will be used)",
-			Value:  "",
-			EnvVar: "GENERIC_SSH_KEY",
+			Name:       "generic-ssh-key",
+			Usage:      "SSH private key path (if not provided, default SSH key will be used)",
+			Value:      "",
+			EnvVar:     "GENERIC_SSH_KEY",
+			PerMachine: true,
 		},
 		mcnflag.IntFlag{
 			Name:   "generic-ssh-port",
@@ -154,10 +157,19 @@ func (d *Driver) GetURL() (string, error) {
 func (d *Driver) GetState() (state.State, error) {
 	address := net.JoinHostPort(d.IPAddress, strconv.Itoa(d.SSHPort))
 
-	_, err := net.DialTimeout("tcp", address, defaultTimeout)
+	var (
+		conn net.Conn
+		err  error
+	)
+	if jumpHosts := d.GetSSHAuth().JumpHosts; len(jumpHosts) > 0 {
+		conn, err = ssh.DialThrough(jumpHosts, "tcp", address)
+	} else {
+		conn, err = net.DialTimeout("tcp", address, defaultTimeout)
+	}
 	if err != nil {
 		return state.Stopped, nil
 	}
+	conn.Close()
 
 	return state.Running, nil
 }
@@ -183,6 +195,11 @@ func (d *Driver) Remove() error {
 	return nil
 }
 
+// Rename has nothing to do, the host is only known by its address.
+func (d *Driver) Rename(name string) error {
+	return nil
+}
+
 func copySSHKey(src, dst string) error {
 	if err := mcnutils.CopyFile(src, dst); err != nil {
 		return fmt.Errorf("unable to copy ssh key: %s", err)
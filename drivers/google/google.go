@@ -118,9 +118,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "GOOGLE_SUBNETWORK",
 		},
 		mcnflag.StringFlag{
-			Name:   "google-address",
-			Usage:  "GCE Instance External IP",
-			EnvVar: "GOOGLE_ADDRESS",
+			Name:       "google-address",
+			Usage:      "GCE Instance External IP",
+			EnvVar:     "GOOGLE_ADDRESS",
+			PerMachine: true,
 		},
 		mcnflag.BoolFlag{
 			Name:   "google-preemptible",
@@ -193,6 +194,19 @@ func (d *Driver) DriverName() string {
 	return "google"
 }
 
+// MaxParallelism is low because GCE counts the API requests of a project
+// against a per-minute quota, and every instance operation is polled until
+// it's done.
+func (d *Driver) MaxParallelism() int {
+	return 5
+}
+
+// BoundToMachineName is true, the instance is named after the machine and
+// the GCE API is called with its name.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 // SetConfigFromFlags initializes the driver based on the command line flags.
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Project = flags.String("google-project")
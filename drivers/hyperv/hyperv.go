@@ -81,9 +81,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			EnvVar: "HYPERV_CPU_COUNT",
 		},
 		mcnflag.StringFlag{
-			Name:   "hyperv-static-macaddress",
-			Usage:  "Hyper-V network adapter's static MAC address.",
-			EnvVar: "HYPERV_STATIC_MACADDRESS",
+			Name:       "hyperv-static-macaddress",
+			Usage:      "Hyper-V network adapter's static MAC address.",
+			EnvVar:     "HYPERV_STATIC_MACADDRESS",
+			PerMachine: true,
 		},
 		mcnflag.IntFlag{
 			Name:   "hyperv-vlan-id",
@@ -123,6 +124,18 @@ func (d *Driver) DriverName() string {
 	return "hyperv"
 }
 
+// MaxParallelism is low because each Hyper-V call starts PowerShell and
+// loads the Hyper-V module, which takes seconds of CPU on the host.
+func (d *Driver) MaxParallelism() int {
+	return 2
+}
+
+// BoundToMachineName is true, the Hyper-V cmdlets find the VM by the machine
+// name.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 func (d *Driver) GetURL() (string, error) {
 	ip, err := d.GetIP()
 	if err != nil {
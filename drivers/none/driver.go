@@ -83,6 +83,11 @@ func (d *Driver) Remove() error {
 	return nil
 }
 
+// Rename has nothing to do, there is no VM to rename.
+func (d *Driver) Rename(name string) error {
+	return nil
+}
+
 func (d *Driver) Restart() error {
 	return fmt.Errorf("hosts without a driver cannot be restarted")
 }
@@ -98,11 +98,12 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "OpenStack username",
 			Value:  "",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "OS_PASSWORD",
 			Name:   "openstack-password",
 			Usage:  "OpenStack password",
 			Value:  "",
+			Field:  "Password",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_TENANT_NAME",
@@ -159,10 +160,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "OS_KEYPAIR_NAME",
-			Name:   "openstack-keypair-name",
-			Usage:  "OpenStack keypair to use to SSH to the instance",
-			Value:  "",
+			EnvVar:     "OS_KEYPAIR_NAME",
+			Name:       "openstack-keypair-name",
+			Usage:      "OpenStack keypair to use to SSH to the instance",
+			Value:      "",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_NETWORK_ID",
@@ -171,10 +173,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  "",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "OS_PRIVATE_KEY_FILE",
-			Name:   "openstack-private-key-file",
-			Usage:  "Private keyfile to use for SSH (absolute path)",
-			Value:  "",
+			EnvVar:     "OS_PRIVATE_KEY_FILE",
+			Name:       "openstack-private-key-file",
+			Usage:      "Private keyfile to use for SSH (absolute path)",
+			Value:      "",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_USER_DATA_FILE",
@@ -36,11 +36,12 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "Rackspace account username",
 			Value:  "",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "OS_API_KEY",
 			Name:   "rackspace-api-key",
 			Usage:  "Rackspace API key",
 			Value:  "",
+			Field:  "APIKey",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "OS_REGION_NAME",
@@ -104,10 +104,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "softlayer-user",
 			Usage:  "softlayer user account name",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "SOFTLAYER_API_KEY",
 			Name:   "softlayer-api-key",
 			Usage:  "softlayer user API key",
+			Field:  "Client.ApiKey",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "SOFTLAYER_REGION",
@@ -122,9 +123,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Value:  defaultCpus,
 		},
 		mcnflag.StringFlag{
-			EnvVar: "SOFTLAYER_HOSTNAME",
-			Name:   "softlayer-hostname",
-			Usage:  "hostname for the machine - defaults to machine name",
+			EnvVar:     "SOFTLAYER_HOSTNAME",
+			Name:       "softlayer-hostname",
+			Usage:      "hostname for the machine - defaults to machine name",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "SOFTLAYER_DOMAIN",
@@ -216,6 +216,12 @@ func (d *Driver) DriverName() string {
 	return "virtualbox"
 }
 
+// BoundToMachineName is true, VBoxManage is given the machine name to find
+// the VM.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 func (d *Driver) GetURL() (string, error) {
 	ip, err := d.GetIP()
 	if err != nil {
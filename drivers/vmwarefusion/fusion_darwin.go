@@ -142,6 +142,12 @@ func (d *Driver) DriverName() string {
 	return "vmwarefusion"
 }
 
+// BoundToMachineName is true, the vmx and vmdk files of the VM are named
+// after the machine.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.Memory = flags.Int("vmwarefusion-memory-size")
 	d.CPU = flags.Int("vmwarefusion-cpu-count")
@@ -56,10 +56,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "vmwarevcloudair-username",
 			Usage:  "vCloud Air username",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "VCLOUDAIR_PASSWORD",
 			Name:   "vmwarevcloudair-password",
 			Usage:  "vCloud Air password",
+			Field:  "UserPassword",
 		},
 		mcnflag.StringFlag{
 			EnvVar: "VCLOUDAIR_COMPUTEID",
@@ -82,9 +83,10 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Usage:  "vCloud Air Org Edge Gateway (Default is <vdcid>)",
 		},
 		mcnflag.StringFlag{
-			EnvVar: "VCLOUDAIR_PUBLICIP",
-			Name:   "vmwarevcloudair-publicip",
-			Usage:  "vCloud Air Org Public IP to use",
+			EnvVar:     "VCLOUDAIR_PUBLICIP",
+			Name:       "vmwarevcloudair-publicip",
+			Usage:      "vCloud Air Org Public IP to use",
+			PerMachine: true,
 		},
 		mcnflag.StringFlag{
 			EnvVar: "VCLOUDAIR_CATALOG",
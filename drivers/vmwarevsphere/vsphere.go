@@ -122,10 +122,11 @@ func (d *Driver) GetCreateFlags() []mcnflag.Flag {
 			Name:   "vmwarevsphere-username",
 			Usage:  "vSphere username",
 		},
-		mcnflag.StringFlag{
+		mcnflag.SecretFlag{
 			EnvVar: "VSPHERE_PASSWORD",
 			Name:   "vmwarevsphere-password",
 			Usage:  "vSphere password",
+			Field:  "Password",
 		},
 		mcnflag.StringSliceFlag{
 			EnvVar: "VSPHERE_NETWORK",
@@ -202,6 +203,12 @@ func (d *Driver) DriverName() string {
 	return "vmwarevsphere"
 }
 
+// BoundToMachineName is true, the VM is looked up in the datacenter by the
+// machine name.
+func (d *Driver) BoundToMachineName() bool {
+	return true
+}
+
 func (d *Driver) SetConfigFromFlags(flags drivers.DriverOptions) error {
 	d.SSHUser = "docker"
 	d.SSHPort = 22
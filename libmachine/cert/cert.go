@@ -11,6 +11,7 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"errors"
@@ -292,3 +293,30 @@ func CheckCertificateDate(certPath string) (bool, error) {
 
 	return true, nil
 }
+
+// CertificateHasName tells whether a certificate is valid for the DNS name
+// name, or for a domain name starting with it such as name.local.
+func CertificateHasName(certPath, name string) (bool, error) {
+	certBytes, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return false, err
+	}
+
+	pemBlock, _ := pem.Decode(certBytes)
+	if pemBlock == nil {
+		return false, errors.New("Failed to decode PEM data")
+	}
+
+	cert, err := x509.ParseCertificate(pemBlock.Bytes)
+	if err != nil {
+		return false, err
+	}
+
+	for _, dnsName := range cert.DNSNames {
+		if dnsName == name || strings.HasPrefix(dnsName, name+".") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
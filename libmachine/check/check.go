@@ -1,19 +1,23 @@
 package check
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"net"
 	"net/url"
 	"strings"
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/cert"
 	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/ssh"
 )
 
 var (
 	DefaultConnChecker ConnChecker
 	ErrSwarmNotStarted = errors.New("Connection to Swarm cannot be checked but the certs are valid. Maybe swarm is not started")
+	ErrSwarmNoTLS      = errors.New("Swarm can't be reached on a machine whose daemon only listens on its unix socket")
 )
 
 func init() {
@@ -40,6 +44,10 @@ type ConnChecker interface {
 type MachineConnChecker struct{}
 
 func (mcc *MachineConnChecker) Check(h *host.Host, swarm bool) (string, *auth.Options, error) {
+	if h.NoTLS() {
+		return checkSSH(h, swarm)
+	}
+
 	dockerHost, err := h.Driver.GetURL()
 	if err != nil {
 		return "", &auth.Options{}, err
@@ -60,7 +68,14 @@ func (mcc *MachineConnChecker) Check(h *host.Host, swarm bool) (string, *auth.Op
 
 	authOptions := h.AuthOptions()
 
-	if err := checkCert(u.Host, authOptions); err != nil {
+	validate := checkCert
+	if jumpHosts := h.SSHJumpHosts(); len(jumpHosts) > 0 {
+		validate = func(hostURL string, authOptions *auth.Options) error {
+			return checkCertThrough(jumpHosts, hostURL, authOptions)
+		}
+	}
+
+	if err := validate(u.Host, authOptions); err != nil {
 		if swarm {
 			// Connection to the swarm port cannot be checked. Maybe it's just the swarm containers that are down
 			// TODO: check the containers and restart them
@@ -76,6 +91,24 @@ func (mcc *MachineConnChecker) Check(h *host.Host, swarm bool) (string, *auth.Op
 	return dockerURL, authOptions, nil
 }
 
+// checkSSH checks the connection to a daemon which is reached over SSH.
+func checkSSH(h *host.Host, swarm bool) (string, *auth.Options, error) {
+	if swarm {
+		return "", &auth.Options{}, ErrSwarmNoTLS
+	}
+
+	dockerURL, err := h.URL()
+	if err != nil {
+		return "", &auth.Options{}, err
+	}
+
+	if _, err := h.DockerVersion(); err != nil {
+		return "", &auth.Options{}, fmt.Errorf("Error checking the connection to the daemon over SSH: %s", err)
+	}
+
+	return dockerURL, h.AuthOptions(), nil
+}
+
 func checkCert(hostURL string, authOptions *auth.Options) error {
 	valid, err := cert.ValidateCertificate(hostURL, authOptions)
 	if !valid || err != nil {
@@ -88,6 +121,37 @@ func checkCert(hostURL string, authOptions *auth.Options) error {
 	return nil
 }
 
+// checkCertThrough checks the certs of a daemon which is reached through
+// jump hosts, with a TLS handshake over a tunnelled connection.
+func checkCertThrough(jumpHosts []ssh.JumpHost, hostURL string, authOptions *auth.Options) error {
+	tlsConfig, err := cert.ReadTLSConfig(hostURL, authOptions)
+	if err != nil {
+		return ErrCertInvalid{
+			wrappedErr: err,
+			hostURL:    hostURL,
+		}
+	}
+
+	if host, _, err := net.SplitHostPort(hostURL); err == nil {
+		tlsConfig.ServerName = host
+	}
+
+	conn, err := ssh.DialThrough(jumpHosts, "tcp", hostURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := tls.Client(conn, tlsConfig).Handshake(); err != nil {
+		return ErrCertInvalid{
+			wrappedErr: err,
+			hostURL:    hostURL,
+		}
+	}
+
+	return nil
+}
+
 // TODO: This could use a unit test.
 func parseSwarm(hostURL string, h *host.Host) (string, error) {
 	swarmOptions := h.HostOptions.SwarmOptions
@@ -3,6 +3,8 @@ package drivers
 import (
 	"errors"
 	"path/filepath"
+
+	"github.com/docker/machine/libmachine/ssh"
 )
 
 const (
@@ -23,6 +25,9 @@ type BaseDriver struct {
 	SwarmMaster    bool
 	SwarmHost      string
 	SwarmDiscovery string
+
+	// sshAuth is kept with the host, not in the driver config.
+	sshAuth ssh.Auth
 }
 
 // DriverName returns the name of the driver
@@ -68,6 +73,18 @@ func (d *BaseDriver) GetSSHUsername() string {
 	return d.SSHUser
 }
 
+// SetSSHAuth sets how the machine is reached over SSH, through its jump
+// hosts and with its pinned host key.
+func (d *BaseDriver) SetSSHAuth(auth ssh.Auth) error {
+	d.sshAuth = auth
+	return nil
+}
+
+// GetSSHAuth returns how the machine is reached over SSH.
+func (d *BaseDriver) GetSSHAuth() ssh.Auth {
+	return d.sshAuth
+}
+
 // PreCreateCheck is called to enforce pre-creation steps
 func (d *BaseDriver) PreCreateCheck() error {
 	return nil
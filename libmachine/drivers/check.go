@@ -12,8 +12,14 @@ type CheckDriverOptions struct {
 func (o *CheckDriverOptions) String(key string) string {
 	for _, flag := range o.CreateFlags {
 		if flag.String() == key {
-			f, ok := flag.(mcnflag.StringFlag)
-			if !ok {
+			var defaultValue string
+
+			switch f := flag.(type) {
+			case mcnflag.StringFlag:
+				defaultValue = f.Value
+			case mcnflag.SecretFlag:
+				defaultValue = f.Value
+			default:
 				o.InvalidFlags = append(o.InvalidFlags, flag.String())
 			}
 
@@ -21,7 +27,7 @@ func (o *CheckDriverOptions) String(key string) string {
 			if present {
 				return value
 			}
-			return f.Value
+			return defaultValue
 		}
 	}
 
@@ -0,0 +1,182 @@
+package drivers
+
+import (
+	"context"
+
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/docker/machine/libmachine/state"
+)
+
+// ContextDriver is implemented by drivers whose operations can be canceled,
+// or given a deadline, with a context. The operations should stop as soon
+// as the context is done and return its error. A canceled CreateContext
+// should leave the machine in a state Remove cleans up.
+//
+// The operations of drivers which don't implement it can't be canceled: the
+// context is only checked before they start, and they then run to the end.
+type ContextDriver interface {
+	CreateContext(ctx context.Context) error
+	RemoveContext(ctx context.Context) error
+	StartContext(ctx context.Context) error
+	StopContext(ctx context.Context) error
+	RestartContext(ctx context.Context) error
+	KillContext(ctx context.Context) error
+	GetStateContext(ctx context.Context) (state.State, error)
+}
+
+// Create creates the machine of a driver with a context.
+func Create(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.CreateContext(ctx)
+	}
+	return runBlocking(ctx, d.Create)
+}
+
+// Remove removes the machine of a driver with a context.
+func Remove(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.RemoveContext(ctx)
+	}
+	return runBlocking(ctx, d.Remove)
+}
+
+// Start starts the machine of a driver with a context.
+func Start(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.StartContext(ctx)
+	}
+	return runBlocking(ctx, d.Start)
+}
+
+// Stop stops the machine of a driver with a context.
+func Stop(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.StopContext(ctx)
+	}
+	return runBlocking(ctx, d.Stop)
+}
+
+// Restart restarts the machine of a driver with a context.
+func Restart(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.RestartContext(ctx)
+	}
+	return runBlocking(ctx, d.Restart)
+}
+
+// Kill kills the machine of a driver with a context.
+func Kill(ctx context.Context, d Driver) error {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.KillContext(ctx)
+	}
+	return runBlocking(ctx, d.Kill)
+}
+
+// GetState gets the state of a machine with a context. As getting the state
+// doesn't change anything, drivers which don't implement ContextDriver are
+// given up on when the context is done.
+func GetState(ctx context.Context, d Driver) (state.State, error) {
+	if cd, ok := d.(ContextDriver); ok {
+		return cd.GetStateContext(ctx)
+	}
+	return getStateUntilDone(ctx, d.GetState)
+}
+
+func getStateUntilDone(ctx context.Context, getState func() (state.State, error)) (state.State, error) {
+	s := state.Error
+	err := mcnutils.RunContext(ctx, func() error {
+		var err error
+		s, err = getState()
+		return err
+	})
+	if err != nil {
+		return state.Error, err
+	}
+
+	return s, nil
+}
+
+// runBlocking runs an operation of a driver which doesn't implement
+// ContextDriver. Such operations can't be canceled: the context is only
+// checked before the operation is started, which then runs to the end
+// however long it takes, and its error is returned rather than the one of the
+// context. It's never left running in the background, so nothing undoing it
+// runs meanwhile.
+func runBlocking(ctx context.Context, operation func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return operation()
+}
+
+// contextDriver runs the operations of a driver with a context, for code
+// which only knows about drivers, such as the provisioners. The SSH
+// commands run on its machine fail once the context is done.
+type contextDriver struct {
+	Driver
+	ctx context.Context
+}
+
+// Context returns the context the operations of a driver run with, the
+// background one for drivers which weren't given one with WithContext.
+func Context(d Driver) context.Context {
+	if cd, ok := d.(*contextDriver); ok {
+		return cd.ctx
+	}
+	return context.Background()
+}
+
+// WithContext returns a driver running the operations of d with ctx.
+func WithContext(ctx context.Context, d Driver) Driver {
+	if cd, ok := d.(*contextDriver); ok {
+		d = cd.Driver
+	}
+
+	return &contextDriver{
+		Driver: d,
+		ctx:    ctx,
+	}
+}
+
+func (d *contextDriver) SetSSHAuth(auth ssh.Auth) error {
+	if holder, ok := d.Driver.(SSHAuthHolder); ok {
+		return holder.SetSSHAuth(auth)
+	}
+	return nil
+}
+
+func (d *contextDriver) GetSSHAuth() ssh.Auth {
+	if holder, ok := d.Driver.(SSHAuthHolder); ok {
+		return holder.GetSSHAuth()
+	}
+	return ssh.Auth{}
+}
+
+func (d *contextDriver) Create() error {
+	return Create(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) Remove() error {
+	return Remove(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) Start() error {
+	return Start(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) Stop() error {
+	return Stop(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) Restart() error {
+	return Restart(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) Kill() error {
+	return Kill(d.ctx, d.Driver)
+}
+
+func (d *contextDriver) GetState() (state.State, error) {
+	return GetState(d.ctx, d.Driver)
+}
@@ -0,0 +1,200 @@
+package drivers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/mcnutils"
+	"github.com/docker/machine/libmachine/state"
+	"github.com/stretchr/testify/assert"
+)
+
+// BlockingDriver is a driver without contexts whose Create and GetState
+// block until released. Create closes started, if set.
+type BlockingDriver struct {
+	MockDriver
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *BlockingDriver) Create() error {
+	if d.started != nil {
+		close(d.started)
+	}
+	<-d.release
+	return nil
+}
+
+func (d *BlockingDriver) GetState() (state.State, error) {
+	<-d.release
+	return state.Running, nil
+}
+
+type MockContextDriver struct {
+	MockDriver
+	ctx context.Context
+}
+
+func (d *MockContextDriver) CreateContext(ctx context.Context) error {
+	d.ctx = ctx
+	d.calls.record("CreateContext")
+	return nil
+}
+
+func (d *MockContextDriver) RemoveContext(ctx context.Context) error {
+	d.calls.record("RemoveContext")
+	return nil
+}
+
+func (d *MockContextDriver) StartContext(ctx context.Context) error {
+	d.calls.record("StartContext")
+	return nil
+}
+
+func (d *MockContextDriver) StopContext(ctx context.Context) error {
+	d.calls.record("StopContext")
+	return nil
+}
+
+func (d *MockContextDriver) RestartContext(ctx context.Context) error {
+	d.calls.record("RestartContext")
+	return nil
+}
+
+func (d *MockContextDriver) KillContext(ctx context.Context) error {
+	d.calls.record("KillContext")
+	return nil
+}
+
+func (d *MockContextDriver) GetStateContext(ctx context.Context) (state.State, error) {
+	d.calls.record("GetStateContext")
+	return state.Running, nil
+}
+
+func TestCreateWithContextDriver(t *testing.T) {
+	callRecorder := &CallRecorder{}
+	driver := &MockContextDriver{MockDriver: MockDriver{calls: callRecorder}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	assert.NoError(t, Create(ctx, driver))
+	assert.Equal(t, []string{"CreateContext"}, callRecorder.calls)
+	assert.Equal(t, ctx, driver.ctx)
+}
+
+func TestCreateWithoutContextDriver(t *testing.T) {
+	callRecorder := &CallRecorder{}
+	driver := &MockDriver{calls: callRecorder}
+
+	assert.NoError(t, Create(context.Background(), driver))
+	assert.Equal(t, []string{"Create"}, callRecorder.calls)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Equal(t, context.Canceled, Create(ctx, driver))
+	assert.Equal(t, context.Canceled, Start(ctx, driver))
+	assert.Equal(t, []string{"Create"}, callRecorder.calls)
+}
+
+func TestGetStateGivesUpOnDriverWithoutContext(t *testing.T) {
+	driver := &BlockingDriver{release: make(chan struct{})}
+	defer close(driver.release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	s, err := GetState(ctx, driver)
+
+	assert.Equal(t, state.Error, s)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestCreateWithoutContextDriverRunsToTheEnd(t *testing.T) {
+	driver := &BlockingDriver{started: make(chan struct{}), release: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	created := make(chan error)
+	go func() {
+		created <- Create(ctx, driver)
+	}()
+
+	<-driver.started
+	cancel()
+	select {
+	case err := <-created:
+		t.Fatalf("Expected Create not to be given up on, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(driver.release)
+	assert.NoError(t, <-created)
+}
+
+func TestGetStateGivenUpOnIsPending(t *testing.T) {
+	driver := &BlockingDriver{release: make(chan struct{})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctx, waitPending := mcnutils.WithPending(ctx)
+
+	_, err := GetState(ctx, driver)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	waited := make(chan struct{})
+	go func() {
+		waitPending()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("Expected GetState to be waited for")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(driver.release)
+	<-waited
+}
+
+func TestWithContext(t *testing.T) {
+	callRecorder := &CallRecorder{}
+	driver := &MockContextDriver{MockDriver: MockDriver{calls: callRecorder, sshHostname: "10.0.0.5", sshPort: 22}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wrapped := WithContext(ctx, driver)
+	assert.Equal(t, ctx, Context(wrapped))
+	assert.Equal(t, context.Background(), Context(driver))
+
+	assert.NoError(t, wrapped.Stop())
+	s, err := wrapped.GetState()
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+	assert.Equal(t, []string{"StopContext", "GetStateContext"}, callRecorder.calls)
+
+	// SSH commands aren't run once the context is done.
+	cancel()
+	_, err = RunSSHCommandFromDriver(wrapped, "uname")
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, []string{"StopContext", "GetStateContext"}, callRecorder.calls)
+
+	// Contexts replace each other.
+	assert.Equal(t, driver, WithContext(context.Background(), wrapped).(*contextDriver).Driver)
+}
+
+func TestSerialDriverContext(t *testing.T) {
+	callRecorder := &CallRecorder{}
+
+	driver := newSerialDriverWithLock(&MockContextDriver{MockDriver: MockDriver{calls: callRecorder}}, &MockLocker{calls: callRecorder})
+	assert.NoError(t, Create(context.Background(), driver))
+	assert.Equal(t, []string{"Lock", "CreateContext", "Unlock"}, callRecorder.calls)
+
+	callRecorder = &CallRecorder{}
+	driver = newSerialDriverWithLock(&MockDriver{calls: callRecorder, state: state.Stopped}, &MockLocker{calls: callRecorder})
+	s, err := GetState(context.Background(), driver)
+	assert.NoError(t, err)
+	assert.Equal(t, state.Stopped, s)
+	assert.Equal(t, []string{"Lock", "GetState", "Unlock"}, callRecorder.calls)
+}
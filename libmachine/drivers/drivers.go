@@ -5,6 +5,7 @@ import (
 
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 )
 
@@ -72,7 +73,45 @@ type Driver interface {
 	Stop() error
 }
 
-var ErrHostIsNotRunning = errors.New("Host is not running")
+var (
+	ErrHostIsNotRunning   = errors.New("Host is not running")
+	ErrRenameNotSupported = errors.New("Renaming machines is not supported by this driver")
+)
+
+// Renamer is implemented by drivers which can rename the machine they
+// manage, such as its VM or cloud instance. The machine name of the driver
+// is changed by the store afterwards.
+type Renamer interface {
+	Rename(name string) error
+}
+
+// NameBound is implemented by drivers which look their VM or instance up by
+// machine name. Their machines can't be renamed in the store alone, the
+// driver would lose track of them.
+type NameBound interface {
+	// BoundToMachineName returns whether the driver finds its VM by the
+	// machine name.
+	BoundToMachineName() bool
+}
+
+// ParallelismLimiter is implemented by drivers which can only act on a few
+// machines at once, such as cloud drivers whose API is rate limited or
+// hypervisors which slow down when too many VMs start together.
+type ParallelismLimiter interface {
+	// MaxParallelism returns how many machines of the driver commands act
+	// on at once, 0 for no limit of its own.
+	MaxParallelism() int
+}
+
+// SSHAuthHolder is implemented by drivers which are given how to reach their
+// machine over SSH, such as its jump hosts and its pinned host key. These are
+// kept with the host
+// rather than in the driver config. Drivers embedding BaseDriver implement
+// it.
+type SSHAuthHolder interface {
+	SetSSHAuth(auth ssh.Auth) error
+	GetSSHAuth() ssh.Auth
+}
 
 type DriverOptions interface {
 	String(key string) string
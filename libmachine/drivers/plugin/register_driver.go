@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/rpc"
 	"os"
+	"os/signal"
 	"time"
 
 	"github.com/docker/machine/libmachine/drivers"
@@ -32,6 +33,10 @@ Please use this plugin through the main 'docker-machine' binary.
 	log.SetDebug(true)
 	os.Setenv("MACHINE_DEBUG", "1")
 
+	// Ctrl-C reaches the plugins along with docker-machine, which cancels
+	// their operations over RPC and closes them.
+	signal.Ignore(os.Interrupt)
+
 	rpcd := rpcdriver.NewRPCServerDriver(d)
 	rpc.RegisterName(rpcdriver.RPCServiceNameV0, rpcd)
 	rpc.RegisterName(rpcdriver.RPCServiceNameV1, rpcd)
@@ -1,9 +1,12 @@
 package rpcdriver
 
 import (
+	"context"
 	"fmt"
 	"net/rpc"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"io"
@@ -12,12 +15,16 @@ import (
 	"github.com/docker/machine/libmachine/drivers/plugin/localbinary"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/version"
 )
 
 var (
 	heartbeatInterval = 5 * time.Second
+
+	// lastContextID is the ID of the last call made with a context.
+	lastContextID uint64
 )
 
 type RPCClientDriverFactory interface {
@@ -41,6 +48,9 @@ type RPCClientDriver struct {
 	plugin          localbinary.DriverPlugin
 	heartbeatDoneCh chan bool
 	Client          *InternalClient
+	closeOnce       sync.Once
+	closeErr        error
+	sshAuth         ssh.Auth
 }
 
 type RPCCall struct {
@@ -78,11 +88,23 @@ const (
 	PreCreateCheckMethod     = `.PreCreateCheck`
 	CreateMethod             = `.Create`
 	RemoveMethod             = `.Remove`
+	RenameMethod             = `.Rename`
 	StartMethod              = `.Start`
 	StopMethod               = `.Stop`
 	RestartMethod            = `.Restart`
 	KillMethod               = `.Kill`
 	UpgradeMethod            = `.Upgrade`
+	SetSSHAuthMethod         = `.SetSSHAuth`
+	MaxParallelismMethod     = `.MaxParallelism`
+	BoundToMachineNameMethod = `.BoundToMachineName`
+	CancelMethod             = `.Cancel`
+	CreateContextMethod      = `.CreateContext`
+	RemoveContextMethod      = `.RemoveContext`
+	StartContextMethod       = `.StartContext`
+	StopContextMethod        = `.StopContext`
+	RestartContextMethod     = `.RestartContext`
+	KillContextMethod        = `.KillContext`
+	GetStateContextMethod    = `.GetStateContext`
 )
 
 func (ic *InternalClient) Call(serviceMethod string, args interface{}, reply interface{}) error {
@@ -92,6 +114,12 @@ func (ic *InternalClient) Call(serviceMethod string, args interface{}, reply int
 	return ic.RPCClient.Call(ic.rpcServiceName+serviceMethod, args, reply)
 }
 
+// Go calls a method asynchronously, the call is done once it returns.
+func (ic *InternalClient) Go(serviceMethod string, args interface{}, reply interface{}) *rpc.Call {
+	log.Debugf("(%s) Calling %+v", ic.MachineName, serviceMethod)
+	return ic.RPCClient.Go(ic.rpcServiceName+serviceMethod, args, reply, nil)
+}
+
 func (ic *InternalClient) switchToV0() {
 	ic.rpcServiceName = RPCServiceNameV0
 }
@@ -108,7 +136,7 @@ func (f *DefaultRPCClientDriverFactory) Close() error {
 	defer f.openedDriversLock.Unlock()
 
 	for _, openedDriver := range f.openedDrivers {
-		if err := openedDriver.close(); err != nil {
+		if err := openedDriver.Close(); err != nil {
 			// No need to display an error.
 			// There's nothing we can do and it doesn't add value to the user.
 		}
@@ -206,6 +234,15 @@ func (c *RPCClientDriver) UnmarshalJSON(data []byte) error {
 	return c.SetConfigRaw(data)
 }
 
+// Close stops the plugin of a driver which is no longer used, before its
+// factory is closed. Drivers are only closed once.
+func (c *RPCClientDriver) Close() error {
+	c.closeOnce.Do(func() {
+		c.closeErr = c.close()
+	})
+	return c.closeErr
+}
+
 func (c *RPCClientDriver) close() error {
 	c.heartbeatDoneCh <- true
 	close(c.heartbeatDoneCh)
@@ -346,6 +383,66 @@ func (c *RPCClientDriver) Remove() error {
 	return c.Client.Call(RemoveMethod, struct{}{}, nil)
 }
 
+// Rename renames the machine if the driver supports it. Drivers built
+// before renaming was introduced don't have the method at all.
+func (c *RPCClientDriver) Rename(name string) error {
+	err := c.Client.Call(RenameMethod, &name, nil)
+	if err != nil && (err.Error() == drivers.ErrRenameNotSupported.Error() || strings.Contains(err.Error(), "can't find method")) {
+		return drivers.ErrRenameNotSupported
+	}
+
+	return err
+}
+
+// SetSSHAuth sets how the machine is reached over SSH, for this process and
+// the plugin. Drivers built before jump hosts were introduced don't have the
+// method, they reach the machine directly. They can't check a pinned host
+// key though.
+func (c *RPCClientDriver) SetSSHAuth(auth ssh.Auth) error {
+	c.sshAuth = auth
+
+	err := c.Client.Call(SetSSHAuthMethod, &auth, nil)
+	if err != nil && strings.Contains(err.Error(), "can't find method") {
+		if auth.HostKey != "" {
+			return fmt.Errorf("The %s driver can't check the pinned SSH host key, it needs to be updated", c.DriverName())
+		}
+		log.Debugf("The %s driver doesn't support jump hosts", c.DriverName())
+		return nil
+	}
+
+	return err
+}
+
+// GetSSHAuth returns how the machine is reached over SSH.
+func (c *RPCClientDriver) GetSSHAuth() ssh.Auth {
+	return c.sshAuth
+}
+
+// BoundToMachineName returns whether the driver finds its VM by the machine
+// name. Drivers built before it was introduced don't have the method.
+func (c *RPCClientDriver) BoundToMachineName() bool {
+	var bound bool
+	if err := c.Client.Call(BoundToMachineNameMethod, struct{}{}, &bound); err != nil {
+		log.Debugf("Unable to get whether the %s driver is bound to machine names: %s", c.DriverName(), err)
+		return false
+	}
+
+	return bound
+}
+
+// MaxParallelism returns how many machines of the driver commands act on at
+// once. Drivers built before it was introduced don't have the method, and
+// have no limit of their own.
+func (c *RPCClientDriver) MaxParallelism() int {
+	var parallelism int
+	if err := c.Client.Call(MaxParallelismMethod, struct{}{}, &parallelism); err != nil {
+		log.Debugf("Unable to get the parallelism of the %s driver: %s", c.DriverName(), err)
+		return 0
+	}
+
+	return parallelism
+}
+
 func (c *RPCClientDriver) Start() error {
 	return c.Client.Call(StartMethod, struct{}{}, nil)
 }
@@ -365,3 +462,90 @@ func (c *RPCClientDriver) Kill() error {
 func (c *RPCClientDriver) Upgrade() error {
 	return c.Client.Call(UpgradeMethod, struct{}{}, nil)
 }
+
+// callContext calls a method of the driver with a context. When the context
+// is done, the plugin is asked to cancel the call, which returns once the
+// driver stopped. Drivers built before contexts were introduced don't have
+// the method, the fallback is called instead.
+func (c *RPCClientDriver) callContext(ctx context.Context, method string, reply interface{}, fallback func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	args := &RPCContext{
+		ID: atomic.AddUint64(&lastContextID, 1),
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		args.Deadline = deadline
+	}
+
+	call := c.Client.Go(method, args, reply)
+
+	select {
+	case <-call.Done:
+	case <-ctx.Done():
+		if err := c.Client.Call(CancelMethod, &args.ID, nil); err != nil {
+			log.Debugf("Error canceling the call to %s: %s", method, err)
+		}
+		<-call.Done
+	}
+
+	err := call.Error
+	if err == nil {
+		return nil
+	}
+
+	if strings.Contains(err.Error(), "can't find method") {
+		log.Debugf("The %s driver doesn't support contexts", c.DriverName())
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fallback()
+	}
+
+	// The error of the context is only known by its message on this side.
+	if ctx.Err() != nil && err.Error() == ctx.Err().Error() {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+func (c *RPCClientDriver) CreateContext(ctx context.Context) error {
+	return c.callContext(ctx, CreateContextMethod, nil, c.Create)
+}
+
+func (c *RPCClientDriver) RemoveContext(ctx context.Context) error {
+	return c.callContext(ctx, RemoveContextMethod, nil, c.Remove)
+}
+
+func (c *RPCClientDriver) StartContext(ctx context.Context) error {
+	return c.callContext(ctx, StartContextMethod, nil, c.Start)
+}
+
+func (c *RPCClientDriver) StopContext(ctx context.Context) error {
+	return c.callContext(ctx, StopContextMethod, nil, c.Stop)
+}
+
+func (c *RPCClientDriver) RestartContext(ctx context.Context) error {
+	return c.callContext(ctx, RestartContextMethod, nil, c.Restart)
+}
+
+func (c *RPCClientDriver) KillContext(ctx context.Context) error {
+	return c.callContext(ctx, KillContextMethod, nil, c.Kill)
+}
+
+func (c *RPCClientDriver) GetStateContext(ctx context.Context) (state.State, error) {
+	var s state.State
+
+	err := c.callContext(ctx, GetStateContextMethod, &s, func() error {
+		var err error
+		s, err = c.GetState()
+		return err
+	})
+	if err != nil {
+		return state.Error, err
+	}
+
+	return s, nil
+}
@@ -1,14 +1,18 @@
 package rpcdriver
 
 import (
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"runtime/debug"
+	"sync"
+	"time"
 
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 	"github.com/docker/machine/libmachine/version"
 )
@@ -33,10 +37,26 @@ func init() {
 	gob.Register(new(mcnflag.StringFlag))
 	gob.Register(new(mcnflag.StringSliceFlag))
 	gob.Register(new(mcnflag.BoolFlag))
+	gob.Register(new(mcnflag.SecretFlag))
 }
 
 type RPCFlags struct {
 	Values map[string]interface{}
+
+	// Secrets are the names of the flags holding credentials, whose values
+	// the driver redacts from its logs.
+	Secrets []string
+}
+
+// SecretValues returns the values of the secret flags.
+func (r RPCFlags) SecretValues() []string {
+	values := []string{}
+	for _, key := range r.Secrets {
+		if value, ok := r.Values[key].(string); ok && value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
 }
 
 func (r RPCFlags) Get(key string) interface{} {
@@ -80,10 +100,23 @@ func (r RPCFlags) Bool(key string) bool {
 	return val
 }
 
+// RPCContext is what is carried over RPC of the context of a call: an ID to
+// cancel the call with, and its deadline if it has one.
+type RPCContext struct {
+	ID       uint64
+	Deadline time.Time
+}
+
 type RPCServerDriver struct {
 	ActualDriver drivers.Driver
 	CloseCh      chan bool
 	HeartbeatCh  chan bool
+
+	// cancels are the cancel functions of the calls running with a
+	// context, by ID. Calls canceled before they started are in canceled.
+	cancelsLock sync.Mutex
+	cancels     map[uint64]context.CancelFunc
+	canceled    map[uint64]bool
 }
 
 func NewRPCServerDriver(d drivers.Driver) *RPCServerDriver {
@@ -205,11 +238,52 @@ func (r *RPCServerDriver) Remove(_ *struct{}, _ *struct{}) error {
 	return r.ActualDriver.Remove()
 }
 
+func (r *RPCServerDriver) Rename(name *string, _ *struct{}) error {
+	renamer, ok := r.ActualDriver.(drivers.Renamer)
+	if !ok {
+		return drivers.ErrRenameNotSupported
+	}
+
+	return renamer.Rename(*name)
+}
+
+func (r *RPCServerDriver) BoundToMachineName(_ *struct{}, reply *bool) error {
+	if bound, ok := r.ActualDriver.(drivers.NameBound); ok {
+		*reply = bound.BoundToMachineName()
+	}
+	return nil
+}
+
+func (r *RPCServerDriver) MaxParallelism(_ *struct{}, reply *int) error {
+	if limiter, ok := r.ActualDriver.(drivers.ParallelismLimiter); ok {
+		*reply = limiter.MaxParallelism()
+	}
+	return nil
+}
+
+func (r *RPCServerDriver) SetSSHAuth(auth *ssh.Auth, _ *struct{}) error {
+	if holder, ok := r.ActualDriver.(drivers.SSHAuthHolder); ok {
+		return holder.SetSSHAuth(*auth)
+	}
+	if auth.HostKey != "" {
+		return fmt.Errorf("The %s driver can't check the pinned SSH host key", r.ActualDriver.DriverName())
+	}
+	return nil
+}
+
 func (r *RPCServerDriver) Restart(_ *struct{}, _ *struct{}) error {
 	return r.ActualDriver.Restart()
 }
 
 func (r *RPCServerDriver) SetConfigFromFlags(flags *drivers.DriverOptions, _ *struct{}) error {
+	if secretFlags, ok := (*flags).(interface {
+		SecretValues() []string
+	}); ok {
+		for _, secret := range secretFlags.SecretValues() {
+			log.RegisterSecret(secret)
+		}
+	}
+
 	return r.ActualDriver.SetConfigFromFlags(*flags)
 }
 
@@ -221,6 +295,111 @@ func (r *RPCServerDriver) Stop(_ *struct{}, _ *struct{}) error {
 	return r.ActualDriver.Stop()
 }
 
+// context returns the context of a call, and the function to call once it's
+// done.
+func (r *RPCServerDriver) context(args *RPCContext) (context.Context, func()) {
+	parent, release := context.Background(), func() {}
+	if !args.Deadline.IsZero() {
+		parent, release = context.WithDeadline(parent, args.Deadline)
+	}
+	ctx, cancel := context.WithCancel(parent)
+
+	r.cancelsLock.Lock()
+	defer r.cancelsLock.Unlock()
+
+	if r.canceled[args.ID] {
+		delete(r.canceled, args.ID)
+		cancel()
+	} else {
+		if r.cancels == nil {
+			r.cancels = map[uint64]context.CancelFunc{}
+		}
+		r.cancels[args.ID] = cancel
+	}
+
+	return ctx, func() {
+		r.cancelsLock.Lock()
+		delete(r.cancels, args.ID)
+		r.cancelsLock.Unlock()
+
+		cancel()
+		release()
+	}
+}
+
+// Cancel cancels a call made with a context. Calls are run concurrently, the
+// cancellation may be received before the call it's for.
+func (r *RPCServerDriver) Cancel(id *uint64, _ *struct{}) error {
+	r.cancelsLock.Lock()
+	defer r.cancelsLock.Unlock()
+
+	if cancel, ok := r.cancels[*id]; ok {
+		cancel()
+		return nil
+	}
+
+	if r.canceled == nil {
+		r.canceled = map[uint64]bool{}
+	}
+	r.canceled[*id] = true
+
+	return nil
+}
+
+func (r *RPCServerDriver) CreateContext(args *RPCContext, _ *struct{}) (err error) {
+	// As with Create, panics are recovered.
+	defer trapPanic(&err)
+
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Create(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) RemoveContext(args *RPCContext, _ *struct{}) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Remove(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) StartContext(args *RPCContext, _ *struct{}) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Start(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) StopContext(args *RPCContext, _ *struct{}) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Stop(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) RestartContext(args *RPCContext, _ *struct{}) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Restart(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) KillContext(args *RPCContext, _ *struct{}) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	return drivers.Kill(ctx, r.ActualDriver)
+}
+
+func (r *RPCServerDriver) GetStateContext(args *RPCContext, reply *state.State) error {
+	ctx, done := r.context(args)
+	defer done()
+
+	s, err := drivers.GetState(ctx, r.ActualDriver)
+	*reply = s
+	return err
+}
+
 func (r *RPCServerDriver) Heartbeat(_ *struct{}, _ *struct{}) error {
 	r.HeartbeatCh <- true
 	return nil
@@ -1,10 +1,17 @@
 package rpcdriver
 
 import (
+	"context"
 	"errors"
+	"net"
+	"net/rpc"
 	"testing"
+	"time"
 
 	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/ssh"
+	"github.com/docker/machine/libmachine/state"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,3 +80,170 @@ func TestRPCServerDriverCreate(t *testing.T) {
 		assert.Equal(t, tc.expectedErr, tc.serverDriver.Create(nil, nil))
 	}
 }
+
+// contextDriver is a driver whose Create runs until canceled.
+type contextDriver struct {
+	*fakedriver.Driver
+	started chan struct{}
+}
+
+func (d *contextDriver) CreateContext(ctx context.Context) error {
+	close(d.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (d *contextDriver) RemoveContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *contextDriver) StartContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *contextDriver) StopContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *contextDriver) RestartContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *contextDriver) KillContext(ctx context.Context) error {
+	return nil
+}
+
+func (d *contextDriver) GetStateContext(ctx context.Context) (state.State, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		return state.Error, errors.New("no deadline")
+	}
+	return state.Running, nil
+}
+
+// oldRPCServerDriver is a plugin built before contexts were introduced.
+type oldRPCServerDriver struct {
+	created bool
+}
+
+func (r *oldRPCServerDriver) Create(_, _ *struct{}) error {
+	r.created = true
+	return nil
+}
+
+func (r *oldRPCServerDriver) DriverName(_ *struct{}, reply *string) error {
+	*reply = "old"
+	return nil
+}
+
+func newTestRPCClientDriver(t *testing.T, serverDriver interface{}) *RPCClientDriver {
+	server := rpc.NewServer()
+	assert.NoError(t, server.RegisterName(RPCServiceNameV1, serverDriver))
+
+	clientConn, serverConn := net.Pipe()
+	go server.ServeConn(serverConn)
+
+	return &RPCClientDriver{
+		Client: NewInternalClient(rpc.NewClient(clientConn)),
+	}
+}
+
+func TestRPCDriverCreateContextCanceled(t *testing.T) {
+	driver := &contextDriver{started: make(chan struct{})}
+	client := newTestRPCClientDriver(t, NewRPCServerDriver(driver))
+	defer client.Client.RPCClient.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-driver.started
+		cancel()
+	}()
+
+	assert.Equal(t, context.Canceled, client.CreateContext(ctx))
+}
+
+func TestRPCDriverContextDeadline(t *testing.T) {
+	client := newTestRPCClientDriver(t, NewRPCServerDriver(&contextDriver{}))
+	defer client.Client.RPCClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	s, err := client.GetStateContext(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, state.Running, s)
+}
+
+func TestRPCDriverContextWithOldPlugin(t *testing.T) {
+	serverDriver := &oldRPCServerDriver{}
+	client := newTestRPCClientDriver(t, serverDriver)
+	defer client.Client.RPCClient.Close()
+
+	assert.NoError(t, client.CreateContext(context.Background()))
+	assert.True(t, serverDriver.created)
+}
+
+func TestRPCServerDriverCancelBeforeCall(t *testing.T) {
+	serverDriver := &RPCServerDriver{}
+
+	id := uint64(7)
+	assert.NoError(t, serverDriver.Cancel(&id, nil))
+
+	ctx, done := serverDriver.context(&RPCContext{ID: id})
+	defer done()
+
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Empty(t, serverDriver.canceled)
+}
+
+type limitedDriver struct {
+	*fakedriver.Driver
+}
+
+func (d *limitedDriver) MaxParallelism() int {
+	return 3
+}
+
+func TestRPCDriverMaxParallelism(t *testing.T) {
+	client := newTestRPCClientDriver(t, NewRPCServerDriver(&limitedDriver{&fakedriver.Driver{}}))
+	defer client.Client.RPCClient.Close()
+
+	assert.Equal(t, 3, client.MaxParallelism())
+
+	unlimited := newTestRPCClientDriver(t, NewRPCServerDriver(&fakedriver.Driver{}))
+	defer unlimited.Client.RPCClient.Close()
+
+	assert.Equal(t, 0, unlimited.MaxParallelism())
+
+	old := newTestRPCClientDriver(t, &oldRPCServerDriver{})
+	defer old.Client.RPCClient.Close()
+
+	assert.Equal(t, 0, old.MaxParallelism())
+}
+
+func TestRPCDriverSetSSHAuth(t *testing.T) {
+	driver := &fakedriver.Driver{BaseDriver: &drivers.BaseDriver{}}
+	client := newTestRPCClientDriver(t, NewRPCServerDriver(driver))
+	defer client.Client.RPCClient.Close()
+
+	auth := ssh.Auth{
+		JumpHosts:      []ssh.JumpHost{{Hostname: "bastion", User: "admin"}},
+		HostKey:        "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe",
+		KnownHostsFile: "/machines/default/known_hosts",
+	}
+
+	assert.NoError(t, client.SetSSHAuth(auth))
+	assert.Equal(t, auth, client.GetSSHAuth())
+	assert.Equal(t, auth, driver.GetSSHAuth())
+}
+
+func TestRPCDriverSetSSHAuthWithOldPlugin(t *testing.T) {
+	client := newTestRPCClientDriver(t, &oldRPCServerDriver{})
+	defer client.Client.RPCClient.Close()
+
+	assert.NoError(t, client.SetSSHAuth(ssh.Auth{JumpHosts: []ssh.JumpHost{{Hostname: "bastion"}}}))
+
+	err := client.SetSSHAuth(ssh.Auth{HostKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"})
+
+	assert.EqualError(t, err, "The old driver can't check the pinned SSH host key, it needs to be updated")
+}
@@ -1,11 +1,14 @@
 package drivers
 
 import (
+	"context"
+	"io"
 	"sync"
 
 	"encoding/json"
 
 	"github.com/docker/machine/libmachine/mcnflag"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/docker/machine/libmachine/state"
 )
 
@@ -66,6 +69,65 @@ func (d *SerialDriver) GetIP() (string, error) {
 	return d.Driver.GetIP()
 }
 
+// MaxParallelism returns how many machines of the driver commands act on at
+// once, if the driver limits it.
+func (d *SerialDriver) MaxParallelism() int {
+	limiter, ok := d.Driver.(ParallelismLimiter)
+	if !ok {
+		return 0
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return limiter.MaxParallelism()
+}
+
+// BoundToMachineName returns whether the driver finds its VM by the machine
+// name.
+func (d *SerialDriver) BoundToMachineName() bool {
+	bound, ok := d.Driver.(NameBound)
+	if !ok {
+		return false
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return bound.BoundToMachineName()
+}
+
+// SetSSHAuth sets how the machine is reached over SSH, if the driver holds
+// it.
+func (d *SerialDriver) SetSSHAuth(auth ssh.Auth) error {
+	holder, ok := d.Driver.(SSHAuthHolder)
+	if !ok {
+		return nil
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return holder.SetSSHAuth(auth)
+}
+
+// GetSSHAuth returns how the machine is reached over SSH.
+func (d *SerialDriver) GetSSHAuth() ssh.Auth {
+	if holder, ok := d.Driver.(SSHAuthHolder); ok {
+		return holder.GetSSHAuth()
+	}
+	return ssh.Auth{}
+}
+
+// Close stops the inner driver, if it can be.
+func (d *SerialDriver) Close() error {
+	closer, ok := d.Driver.(io.Closer)
+	if !ok {
+		return nil
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return closer.Close()
+}
+
 // GetMachineName returns the name of the machine
 func (d *SerialDriver) GetMachineName() string {
 	d.Lock()
@@ -167,6 +229,61 @@ func (d *SerialDriver) Stop() error {
 	return d.Driver.Stop()
 }
 
+// CreateContext creates a host with a context
+func (d *SerialDriver) CreateContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Create(ctx, d.Driver)
+}
+
+// RemoveContext removes a host with a context
+func (d *SerialDriver) RemoveContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Remove(ctx, d.Driver)
+}
+
+// StartContext starts a host with a context
+func (d *SerialDriver) StartContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Start(ctx, d.Driver)
+}
+
+// StopContext stops a host gracefully with a context
+func (d *SerialDriver) StopContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Stop(ctx, d.Driver)
+}
+
+// RestartContext restarts a host with a context
+func (d *SerialDriver) RestartContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Restart(ctx, d.Driver)
+}
+
+// KillContext stops a host forcefully with a context
+func (d *SerialDriver) KillContext(ctx context.Context) error {
+	d.Lock()
+	defer d.Unlock()
+	return Kill(ctx, d.Driver)
+}
+
+// GetStateContext returns the state of the host with a context. A driver
+// given up on keeps the lock until it returns.
+func (d *SerialDriver) GetStateContext(ctx context.Context) (state.State, error) {
+	cd, ok := d.Driver.(ContextDriver)
+	if !ok {
+		return getStateUntilDone(ctx, d.GetState)
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	return cd.GetStateContext(ctx)
+}
+
 func (d *SerialDriver) MarshalJSON() ([]byte, error) {
 	return json.Marshal(d.Driver)
 }
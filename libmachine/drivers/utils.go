@@ -8,6 +8,20 @@ import (
 	"github.com/docker/machine/libmachine/ssh"
 )
 
+// SSHAuth returns how to log in to the machine over SSH and check its host.
+func SSHAuth(d Driver) *ssh.Auth {
+	auth := &ssh.Auth{}
+	if holder, ok := d.(SSHAuthHolder); ok {
+		*auth = holder.GetSSHAuth()
+	}
+
+	if d.GetSSHKeyPath() != "" {
+		auth.Keys = []string{d.GetSSHKeyPath()}
+	}
+
+	return auth
+}
+
 func GetSSHClientFromDriver(d Driver) (ssh.Client, error) {
 	address, err := d.GetSSHHostname()
 	if err != nil {
@@ -19,21 +33,23 @@ func GetSSHClientFromDriver(d Driver) (ssh.Client, error) {
 		return nil, err
 	}
 
-	var auth *ssh.Auth
-	if d.GetSSHKeyPath() == "" {
-		auth = &ssh.Auth{}
-	} else {
-		auth = &ssh.Auth{
-			Keys: []string{d.GetSSHKeyPath()},
-		}
-	}
-
-	client, err := ssh.NewClient(d.GetSSHUsername(), address, port, auth)
+	client, err := ssh.NewClient(d.GetSSHUsername(), address, port, SSHAuth(d))
 	return client, err
 
 }
 
 func RunSSHCommandFromDriver(d Driver, command string) (string, error) {
+	// The command is given up on once the context of the driver is done.
+	if cd, ok := d.(*contextDriver); ok {
+		var output string
+		err := mcnutils.RunContext(cd.ctx, func() error {
+			var err error
+			output, err = RunSSHCommandFromDriver(cd.Driver, command)
+			return err
+		})
+		return output, err
+	}
+
 	client, err := GetSSHClientFromDriver(d)
 	if err != nil {
 		return "", err
@@ -53,7 +69,8 @@ output  : %s`, command, err, output)
 	return output, nil
 }
 
-func sshAvailableFunc(d Driver) func() bool {
+// SSHAvailable tells whether a command can be run on the machine with SSH.
+func SSHAvailable(d Driver) func() bool {
 	return func() bool {
 		log.Debug("Getting to WaitForSSH function...")
 		if _, err := RunSSHCommandFromDriver(d, "exit 0"); err != nil {
@@ -66,7 +83,7 @@ func sshAvailableFunc(d Driver) func() bool {
 
 func WaitForSSH(d Driver) error {
 	// Try to dial SSH for 30 seconds before timing out.
-	if err := mcnutils.WaitFor(sshAvailableFunc(d)); err != nil {
+	if err := mcnutils.WaitForContext(Context(d), SSHAvailable(d)); err != nil {
 		return fmt.Errorf("Too many retries waiting for SSH to be available.  Last error: %s", err)
 	}
 	return nil
@@ -1,7 +1,13 @@
 package host
 
 import (
+	"context"
+	"net"
+	"net/url"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/cert"
@@ -44,6 +50,22 @@ type Host struct {
 	HostOptions   *Options
 	Name          string
 	RawDriver     []byte `json:"-"`
+
+	// SecretFields are the driver config fields holding credentials,
+	// which stores keep apart from the config.
+	SecretFields []string `json:",omitempty"`
+
+	// Metadata is nil for machines created before it was introduced.
+	Metadata *MachineMetadata `json:",omitempty"`
+
+	// DriverFlags are the values of the driver flags the machine was
+	// created with, except for the secret ones.
+	DriverFlags map[string]interface{} `json:",omitempty"`
+
+	// SSHHostKey is the key the machine presented over SSH on first
+	// contact, in the authorized_keys format. It's empty for machines
+	// created before host keys were pinned.
+	SSHHostKey string `json:",omitempty"`
 }
 
 type Options struct {
@@ -53,6 +75,10 @@ type Options struct {
 	EngineOptions *engine.Options
 	SwarmOptions  *swarm.Options
 	AuthOptions   *auth.Options
+
+	// SSHJumpHosts are the SSH servers the machine is reached through, in
+	// order.
+	SSHJumpHosts []ssh.JumpHost `json:",omitempty"`
 }
 
 type Metadata struct {
@@ -61,6 +87,65 @@ type Metadata struct {
 	HostOptions   Options
 }
 
+// MachineMetadataVersion is the version of the MachineMetadata format.
+const MachineMetadataVersion = 1
+
+// MachineMetadata is what is known about a machine besides its
+// configuration: when it was created and last used, and the tags users put
+// on it.
+type MachineMetadata struct {
+	Version  int
+	Created  time.Time
+	LastUsed time.Time
+	Tags     map[string]string `json:",omitempty"`
+}
+
+func NewMachineMetadata() *MachineMetadata {
+	now := time.Now().UTC()
+
+	return &MachineMetadata{
+		Version:  MachineMetadataVersion,
+		Created:  now,
+		LastUsed: now,
+	}
+}
+
+func (h *Host) metadata() *MachineMetadata {
+	if h.Metadata == nil {
+		h.Metadata = &MachineMetadata{
+			Version: MachineMetadataVersion,
+		}
+	}
+	return h.Metadata
+}
+
+// Touch records that the machine was just used.
+func (h *Host) Touch() {
+	h.metadata().LastUsed = time.Now().UTC()
+}
+
+// Tags returns the tags of the machine.
+func (h *Host) Tags() map[string]string {
+	if h.Metadata == nil || h.Metadata.Tags == nil {
+		return map[string]string{}
+	}
+	return h.Metadata.Tags
+}
+
+func (h *Host) SetTag(key, value string) {
+	metadata := h.metadata()
+	if metadata.Tags == nil {
+		metadata.Tags = map[string]string{}
+	}
+	metadata.Tags[key] = value
+}
+
+func (h *Host) RemoveTag(key string) {
+	if h.Metadata != nil {
+		delete(h.Metadata.Tags, key)
+	}
+}
+
 func ValidateHostName(name string) bool {
 	return validHostNamePattern.MatchString(name)
 }
@@ -73,6 +158,38 @@ func (h *Host) CreateSSHClient() (ssh.Client, error) {
 	return stdSSHClientCreator.CreateSSHClient(h.Driver)
 }
 
+// ScanSSHHostKey returns the key the host presents over SSH, in the
+// authorized_keys format.
+func (h *Host) ScanSSHHostKey() (string, error) {
+	addr, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return "", err
+	}
+
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return "", err
+	}
+
+	return ssh.ScanHostKey(addr, port, h.SSHJumpHosts())
+}
+
+// CreateSSHTunnel returns a tunnel to an address on the host, with the
+// native SSH client.
+func (h *Host) CreateSSHTunnel(remoteNetwork, remoteAddress string) (*ssh.Tunnel, error) {
+	addr, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return nil, err
+	}
+
+	return ssh.NewTunnel(h.Driver.GetSSHUsername(), addr, port, drivers.SSHAuth(h.Driver), remoteNetwork, remoteAddress)
+}
+
 func (creator *StandardSSHClientCreator) CreateSSHClient(d drivers.Driver) (ssh.Client, error) {
 	addr, err := d.GetSSHHostname()
 	if err != nil {
@@ -84,52 +201,74 @@ func (creator *StandardSSHClientCreator) CreateSSHClient(d drivers.Driver) (ssh.
 		return &ssh.ExternalClient{}, err
 	}
 
-	auth := &ssh.Auth{}
-	if d.GetSSHKeyPath() != "" {
-		auth.Keys = []string{d.GetSSHKeyPath()}
-	}
-
-	return ssh.NewClient(d.GetSSHUsername(), addr, port, auth)
+	return ssh.NewClient(d.GetSSHUsername(), addr, port, drivers.SSHAuth(d))
 }
 
-func (h *Host) runActionForState(action func() error, desiredState state.State) error {
-	if drivers.MachineInState(h.Driver, desiredState)() {
+func (h *Host) runActionForState(ctx context.Context, action func(context.Context, drivers.Driver) error, desiredState state.State) error {
+	d := drivers.WithContext(ctx, h.Driver)
+
+	if drivers.MachineInState(d, desiredState)() {
 		return mcnerror.ErrHostAlreadyInState{
 			Name:  h.Name,
 			State: desiredState,
 		}
 	}
 
-	if err := action(); err != nil {
+	if err := action(ctx, h.Driver); err != nil {
 		return err
 	}
 
-	return mcnutils.WaitFor(drivers.MachineInState(h.Driver, desiredState))
+	return mcnutils.WaitForContext(ctx, drivers.MachineInState(d, desiredState))
 }
 
 func (h *Host) WaitForDocker() error {
-	provisioner, err := provision.DetectProvisioner(h.Driver)
+	return h.waitForDocker(context.Background())
+}
+
+func (h *Host) waitForDocker(ctx context.Context) error {
+	defer ssh.PoolConnections()()
+
+	provisioner, err := provision.DetectProvisionerContext(ctx, h.Driver)
 	if err != nil {
 		return err
 	}
 
-	return provision.WaitForDocker(provisioner, engine.DefaultPort)
+	return mcnutils.RunContext(ctx, func() error {
+		if h.NoTLS() {
+			return provision.WaitForDockerSocket(provisioner)
+		}
+		return provision.WaitForDocker(provisioner, engine.DefaultPort)
+	})
 }
 
 func (h *Host) Start() error {
+	return h.StartContext(context.Background())
+}
+
+// StartContext starts the machine and waits for Docker to be up, until the
+// context is done.
+func (h *Host) StartContext(ctx context.Context) error {
+	log.Progress(h.Name, "start")
 	log.Infof("Starting %q...", h.Name)
-	if err := h.runActionForState(h.Driver.Start, state.Running); err != nil {
+	if err := h.runActionForState(ctx, drivers.Start, state.Running); err != nil {
 		return err
 	}
 
 	log.Infof("Machine %q was started.", h.Name)
 
-	return h.WaitForDocker()
+	log.Progress(h.Name, "wait-for-docker")
+	return h.waitForDocker(ctx)
 }
 
 func (h *Host) Stop() error {
+	return h.StopContext(context.Background())
+}
+
+// StopContext stops the machine gracefully, until the context is done.
+func (h *Host) StopContext(ctx context.Context) error {
+	log.Progress(h.Name, "stop")
 	log.Infof("Stopping %q...", h.Name)
-	if err := h.runActionForState(h.Driver.Stop, state.Stopped); err != nil {
+	if err := h.runActionForState(ctx, drivers.Stop, state.Stopped); err != nil {
 		return err
 	}
 
@@ -138,8 +277,14 @@ func (h *Host) Stop() error {
 }
 
 func (h *Host) Kill() error {
+	return h.KillContext(context.Background())
+}
+
+// KillContext stops the machine forcefully, until the context is done.
+func (h *Host) KillContext(ctx context.Context) error {
+	log.Progress(h.Name, "kill")
 	log.Infof("Killing %q...", h.Name)
-	if err := h.runActionForState(h.Driver.Kill, state.Stopped); err != nil {
+	if err := h.runActionForState(ctx, drivers.Kill, state.Stopped); err != nil {
 		return err
 	}
 
@@ -148,24 +293,41 @@ func (h *Host) Kill() error {
 }
 
 func (h *Host) Restart() error {
+	return h.RestartContext(context.Background())
+}
+
+// RestartContext restarts the machine and waits for Docker to be up, until
+// the context is done.
+func (h *Host) RestartContext(ctx context.Context) error {
+	log.Progress(h.Name, "restart")
 	log.Infof("Restarting %q...", h.Name)
-	if drivers.MachineInState(h.Driver, state.Stopped)() {
-		if err := h.Start(); err != nil {
+
+	d := drivers.WithContext(ctx, h.Driver)
+	if drivers.MachineInState(d, state.Stopped)() {
+		if err := h.StartContext(ctx); err != nil {
 			return err
 		}
-	} else if drivers.MachineInState(h.Driver, state.Running)() {
-		if err := h.Driver.Restart(); err != nil {
+	} else if drivers.MachineInState(d, state.Running)() {
+		if err := drivers.Restart(ctx, h.Driver); err != nil {
 			return err
 		}
-		if err := mcnutils.WaitFor(drivers.MachineInState(h.Driver, state.Running)); err != nil {
+		if err := mcnutils.WaitForContext(ctx, drivers.MachineInState(d, state.Running)); err != nil {
 			return err
 		}
 	}
 
-	return h.WaitForDocker()
+	return h.waitForDocker(ctx)
 }
 
 func (h *Host) DockerVersion() (string, error) {
+	if h.NoTLS() {
+		output, err := h.RunSSHCommand("docker version --format '{{.Server.Version}}'")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(output), nil
+	}
+
 	url, err := h.Driver.GetURL()
 	if err != nil {
 		return "", err
@@ -174,6 +336,7 @@ func (h *Host) DockerVersion() (string, error) {
 	dockerHost := &mcndockerclient.RemoteDocker{
 		HostURL:    url,
 		AuthOption: h.AuthOptions(),
+		JumpHosts:  h.SSHJumpHosts(),
 	}
 	dockerVersion, err := mcndockerclient.DockerVersion(dockerHost)
 	if err != nil {
@@ -243,8 +406,53 @@ func (h *Host) Upgrade() error {
 	return provisioner.Service("docker", serviceaction.Restart)
 }
 
+// URL returns the URL of the Docker daemon of the host, an ssh:// URL if the
+// daemon only listens on its unix socket.
 func (h *Host) URL() (string, error) {
-	return h.Driver.GetURL()
+	dockerURL, err := h.Driver.GetURL()
+	if err != nil || dockerURL == "" || !h.NoTLS() {
+		return dockerURL, err
+	}
+
+	return h.SSHURL()
+}
+
+// SSHURL returns the URL to reach the Docker daemon of the host over SSH.
+func (h *Host) SSHURL() (string, error) {
+	hostname, err := h.Driver.GetSSHHostname()
+	if err != nil {
+		return "", err
+	}
+
+	port, err := h.Driver.GetSSHPort()
+	if err != nil {
+		return "", err
+	}
+
+	u := &url.URL{
+		Scheme: "ssh",
+		User:   url.User(h.Driver.GetSSHUsername()),
+		Host:   hostname,
+	}
+	if port != 22 {
+		u.Host = net.JoinHostPort(hostname, strconv.Itoa(port))
+	}
+
+	return u.String(), nil
+}
+
+// NoTLS tells whether the Docker daemon of the host only listens on its
+// unix socket.
+func (h *Host) NoTLS() bool {
+	return h.HostOptions != nil && h.HostOptions.EngineOptions != nil && h.HostOptions.EngineOptions.NoTLS
+}
+
+// SSHJumpHosts returns the SSH servers the host is reached through.
+func (h *Host) SSHJumpHosts() []ssh.JumpHost {
+	if h.HostOptions == nil {
+		return nil
+	}
+	return h.HostOptions.SSHJumpHosts
 }
 
 func (h *Host) AuthOptions() *auth.Options {
@@ -255,6 +463,8 @@ func (h *Host) AuthOptions() *auth.Options {
 }
 
 func (h *Host) ConfigureAuth() error {
+	defer ssh.PoolConnections()()
+
 	provisioner, err := provision.DetectProvisioner(h.Driver)
 	if err != nil {
 		return err
@@ -277,10 +487,20 @@ func (h *Host) ConfigureAllAuth() error {
 }
 
 func (h *Host) Provision() error {
-	provisioner, err := provision.DetectProvisioner(h.Driver)
+	return h.ProvisionContext(context.Background())
+}
+
+// ProvisionContext provisions the machine, until the context is done.
+func (h *Host) ProvisionContext(ctx context.Context) error {
+	// Provisioning runs many commands, which share an SSH connection.
+	defer ssh.PoolConnections()()
+
+	log.Progress(h.Name, "detect-os")
+	provisioner, err := provision.DetectProvisionerContext(ctx, h.Driver)
 	if err != nil {
 		return err
 	}
 
-	return provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
+	log.Progress(h.Name, "provision")
+	return provision.ProvisionContext(ctx, provisioner, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions)
 }
@@ -1,10 +1,13 @@
 package host
 
 import (
+	"context"
 	"testing"
 
 	"github.com/docker/machine/drivers/fakedriver"
 	_ "github.com/docker/machine/drivers/none"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/provision"
 	"github.com/docker/machine/libmachine/state"
 )
@@ -55,3 +58,84 @@ func TestStart(t *testing.T) {
 		t.Fatalf("Expected no error but got one: %s", err)
 	}
 }
+
+func TestStartContextCanceled(t *testing.T) {
+	driver := &fakedriver.Driver{
+		MockState: state.Stopped,
+	}
+	host := &Host{
+		Driver: driver,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := host.StartContext(ctx); err != context.Canceled {
+		t.Fatalf("Expected the start to be canceled, got %v", err)
+	}
+	if driver.MockState != state.Stopped {
+		t.Fatalf("Expected the machine not to be started, got %s", driver.MockState)
+	}
+}
+
+type sshDriver struct {
+	fakedriver.Driver
+	port int
+}
+
+func (d *sshDriver) GetSSHHostname() (string, error) {
+	return d.MockIP, nil
+}
+
+func (d *sshDriver) GetSSHPort() (int, error) {
+	return d.port, nil
+}
+
+func (d *sshDriver) GetSSHUsername() string {
+	return "docker"
+}
+
+func TestURLNoTLS(t *testing.T) {
+	cases := []struct {
+		noTLS    bool
+		port     int
+		expected string
+	}{
+		{false, 22, "tcp://1.2.3.4:2376"},
+		{true, 22, "ssh://docker@1.2.3.4"},
+		{true, 2222, "ssh://docker@1.2.3.4:2222"},
+	}
+
+	for _, c := range cases {
+		h := &Host{
+			Driver: &sshDriver{
+				Driver: fakedriver.Driver{MockState: state.Running, MockIP: "1.2.3.4"},
+				port:   c.port,
+			},
+			HostOptions: &Options{
+				EngineOptions: &engine.Options{NoTLS: c.noTLS},
+			},
+		}
+
+		url, err := h.URL()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if url != c.expected {
+			t.Fatalf("Expected URL %q, got %q", c.expected, url)
+		}
+	}
+}
+
+func TestURLNoTLSNotRunning(t *testing.T) {
+	h := &Host{
+		Driver: &sshDriver{Driver: fakedriver.Driver{MockState: state.Stopped}},
+		HostOptions: &Options{
+			EngineOptions: &engine.Options{NoTLS: true},
+		},
+	}
+
+	if _, err := h.URL(); err != drivers.ErrHostIsNotRunning {
+		t.Fatalf("Expected %q for a stopped host, got %v", drivers.ErrHostIsNotRunning, err)
+	}
+}
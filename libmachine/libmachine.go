@@ -1,8 +1,12 @@
 package libmachine
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"io"
 
@@ -17,6 +21,7 @@ import (
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/docker/machine/libmachine/mcnflag"
 	"github.com/docker/machine/libmachine/mcnutils"
 	"github.com/docker/machine/libmachine/persist"
 	"github.com/docker/machine/libmachine/provision"
@@ -30,6 +35,7 @@ type API interface {
 	io.Closer
 	NewHost(driverName string, rawDriver []byte) (*host.Host, error)
 	Create(h *host.Host) error
+	CreateContext(ctx context.Context, h *host.Host) error
 	persist.Store
 	GetMachinesDir() string
 }
@@ -39,20 +45,43 @@ type Client struct {
 	IsDebug        bool
 	SSHClientType  ssh.ClientType
 	GithubAPIToken string
-	*persist.Filestore
+	persist.Store
 	clientDriverFactory rpcdriver.RPCClientDriverFactory
 }
 
 func NewClient(storePath, certsDir string) *Client {
+	return NewClientWithStore(persist.NewFilestore(storePath, certsDir, certsDir), certsDir)
+}
+
+// NewClientWithStore creates a client which keeps its machines in any
+// persist.Store implementation. certsDir is the local directory holding the
+// certificates used by new machines.
+func NewClientWithStore(store persist.Store, certsDir string) *Client {
 	return &Client{
 		certsDir:            certsDir,
 		IsDebug:             false,
 		SSHClientType:       ssh.External,
-		Filestore:           persist.NewFilestore(storePath, certsDir, certsDir),
+		Store:               store,
 		clientDriverFactory: rpcdriver.NewRPCClientDriverFactory(),
 	}
 }
 
+// GetMachinesDir returns the local directory of the machines, where drivers
+// keep their files.
+func (api *Client) GetMachinesDir() string {
+	if localStore, ok := api.Store.(persist.LocalStore); ok {
+		return localStore.GetMachinesDir()
+	}
+
+	return filepath.Join(filepath.Dir(api.certsDir), "machines")
+}
+
+// knownHostsFile returns where the ssh binary checks the SSH host key of a
+// machine.
+func (api *Client) knownHostsFile(name string) string {
+	return filepath.Join(api.GetMachinesDir(), name, "known_hosts")
+}
+
 func (api *Client) NewHost(driverName string, rawDriver []byte) (*host.Host, error) {
 	driver, err := api.clientDriverFactory.NewRPCClientDriver(driverName, rawDriver)
 	if err != nil {
@@ -64,6 +93,8 @@ func (api *Client) NewHost(driverName string, rawDriver []byte) (*host.Host, err
 		Name:          driver.GetMachineName(),
 		Driver:        driver,
 		DriverName:    driver.DriverName(),
+		SecretFields:  mcnflag.SecretFields(driver.GetCreateFlags()),
+		Metadata:      host.NewMachineMetadata(),
 		HostOptions: &host.Options{
 			AuthOptions: &auth.Options{
 				CertDir:          api.certsDir,
@@ -89,7 +120,7 @@ func (api *Client) NewHost(driverName string, rawDriver []byte) (*host.Host, err
 }
 
 func (api *Client) Load(name string) (*host.Host, error) {
-	h, err := api.Filestore.Load(name)
+	h, err := api.Store.Load(name)
 	if err != nil {
 		return nil, err
 	}
@@ -104,24 +135,131 @@ func (api *Client) Load(name string) (*host.Host, error) {
 		return nil, err
 	}
 
+	if err := api.setSSHAuth(h, d); err != nil {
+		return nil, err
+	}
+
 	if h.DriverName == "virtualbox" {
 		h.Driver = drivers.NewSerialDriver(d)
 	} else {
 		h.Driver = d
 	}
 
+	// Machines created before their driver had secret flags get their
+	// credentials moved out of the config on the next save.
+	if secretFields := mcnflag.SecretFields(d.GetCreateFlags()); len(secretFields) > 0 {
+		h.SecretFields = secretFields
+	}
+
+	registerSecrets(h)
+
 	return h, nil
 }
 
+// registerSecrets makes the logs redact the credentials of a loaded machine,
+// as create does with the values of secret flags.
+func registerSecrets(h *host.Host) {
+	if len(h.SecretFields) == 0 {
+		return
+	}
+
+	var config interface{}
+	if err := json.Unmarshal(h.RawDriver, &config); err != nil {
+		return
+	}
+
+	for _, field := range h.SecretFields {
+		value := config
+		for _, key := range strings.Split(field, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = object[key]
+		}
+
+		if secret, ok := value.(string); ok && secret != "" {
+			log.RegisterSecret(secret)
+		}
+	}
+}
+
+// setSSHAuth gives the driver of the machine how to reach it over SSH, as
+// stored with the host. A driver which can't be given the pinned SSH host key
+// isn't used, it wouldn't check it.
+func (api *Client) setSSHAuth(h *host.Host, d drivers.Driver) error {
+	auth := ssh.Auth{
+		JumpHosts: h.SSHJumpHosts(),
+	}
+	if h.SSHHostKey != "" {
+		auth.HostKey = h.SSHHostKey
+		auth.KnownHostsFile = api.knownHostsFile(h.Name)
+	}
+
+	holder, ok := d.(drivers.SSHAuthHolder)
+	if !ok {
+		if auth.HostKey != "" {
+			return fmt.Errorf("The %s driver can't check the pinned SSH host key of %s", h.DriverName, h.Name)
+		}
+		return nil
+	}
+
+	if err := holder.SetSSHAuth(auth); err != nil {
+		return fmt.Errorf("Error passing the SSH settings of %s to its driver: %s", h.Name, err)
+	}
+
+	return nil
+}
+
 // Create is the wrapper method which covers all of the boilerplate around
 // actually creating, provisioning, and persisting an instance in the store.
 func (api *Client) Create(h *host.Host) error {
+	return api.CreateContext(context.Background(), h)
+}
+
+// CreateContext creates a machine until the context is done. What was
+// created by then is removed, once the operations given up on have returned.
+// Drivers which don't implement drivers.ContextDriver can't be interrupted
+// while they create the machine, it's only removed afterwards.
+func (api *Client) CreateContext(ctx context.Context, h *host.Host) (err error) {
+	defer func(start time.Time) {
+		persist.RecordHistory(api.Store, h.Name, "create", start, err)
+	}(time.Now())
+
+	// The SSH commands and checks given up on once the context is done could
+	// still change the machine while it's removed.
+	ctx, waitPending := mcnutils.WithPending(ctx)
+
+	// Provisioning runs many commands on the machine, they share an SSH
+	// connection to it.
+	defer ssh.PoolConnections()()
+
+	// The SSH host keys of the jump hosts are trusted on first contact too,
+	// before the machine is reached through them.
+	if len(h.SSHJumpHosts()) > 0 {
+		jumpHosts, err := ssh.PinJumpHostKeys(h.SSHJumpHosts())
+		if err != nil {
+			return fmt.Errorf("Error pinning the SSH host keys of the jump hosts: %s", err)
+		}
+		h.HostOptions.SSHJumpHosts = jumpHosts
+	}
+
+	if err := api.setSSHAuth(h, h.Driver); err != nil {
+		return err
+	}
+
 	if err := cert.BootstrapCertificates(h.AuthOptions()); err != nil {
 		return fmt.Errorf("Error generating certificates: %s", err)
 	}
 
+	log.Progress(h.Name, "pre-create-check")
 	log.Info("Running pre-create checks...")
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	if err := h.Driver.PreCreateCheck(); err != nil {
 		return mcnerror.ErrDuringPreCreate{
 			Cause: err,
@@ -132,9 +270,14 @@ func (api *Client) Create(h *host.Host) error {
 		return fmt.Errorf("Error saving host to store before attempting creation: %s", err)
 	}
 
+	log.Progress(h.Name, "create")
 	log.Info("Creating machine...")
 
-	if err := api.performCreate(h); err != nil {
+	if err := api.performCreate(ctx, h); err != nil {
+		if ctx.Err() != nil {
+			waitPending()
+			api.rollbackCreate(h)
+		}
 		return fmt.Errorf("Error creating machine: %s", err)
 	}
 
@@ -143,8 +286,23 @@ func (api *Client) Create(h *host.Host) error {
 	return nil
 }
 
-func (api *Client) performCreate(h *host.Host) error {
-	if err := h.Driver.Create(); err != nil {
+// rollbackCreate removes a machine whose creation was interrupted. It's
+// kept in the store if the driver fails to remove it, to be removed with rm.
+func (api *Client) rollbackCreate(h *host.Host) {
+	log.Infof("Creation of %q was interrupted, removing what was created...", h.Name)
+
+	if err := drivers.Remove(context.Background(), h.Driver); err != nil {
+		log.Warnf("Error removing %q, remove it with 'docker-machine rm -f %s': %s", h.Name, h.Name, err)
+		return
+	}
+
+	if err := api.Remove(h.Name); err != nil {
+		log.Warnf("Error removing %q from the store: %s", h.Name, err)
+	}
+}
+
+func (api *Client) performCreate(ctx context.Context, h *host.Host) error {
+	if err := drivers.Create(ctx, h.Driver); err != nil {
 		return fmt.Errorf("Error in driver during machine creation: %s", err)
 	}
 
@@ -157,23 +315,46 @@ func (api *Client) performCreate(h *host.Host) error {
 		return nil
 	}
 
+	log.Progress(h.Name, "wait-for-running")
 	log.Info("Waiting for machine to be running, this may take a few minutes...")
-	if err := mcnutils.WaitFor(drivers.MachineInState(h.Driver, state.Running)); err != nil {
+	if err := mcnutils.WaitForContext(ctx, drivers.MachineInState(drivers.WithContext(ctx, h.Driver), state.Running)); err != nil {
 		return fmt.Errorf("Error waiting for machine to be running: %s", err)
 	}
 
+	log.Progress(h.Name, "detect-os")
 	log.Info("Detecting operating system of created instance...")
-	provisioner, err := provision.DetectProvisioner(h.Driver)
+	provisioner, err := provision.DetectProvisionerContext(ctx, h.Driver)
 	if err != nil {
 		return fmt.Errorf("Error detecting OS: %s", err)
 	}
 
+	// The SSH host key is trusted on first contact, and checked from then
+	// on.
+	hostKey, err := h.ScanSSHHostKey()
+	if err != nil {
+		return err
+	}
+	h.SSHHostKey = hostKey
+	if err := api.setSSHAuth(h, h.Driver); err != nil {
+		return err
+	}
+
+	if err := api.Save(h); err != nil {
+		return fmt.Errorf("Error saving host to store after pinning its SSH host key: %s", err)
+	}
+
+	log.Progress(h.Name, "provision")
 	log.Infof("Provisioning with %s...", provisioner.String())
-	if err := provisioner.Provision(*h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
+	if err := provision.ProvisionContext(ctx, provisioner, *h.HostOptions.SwarmOptions, *h.HostOptions.AuthOptions, *h.HostOptions.EngineOptions); err != nil {
 		return fmt.Errorf("Error running provisioning: %s", err)
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	// We should check the connection to docker here
+	log.Progress(h.Name, "check-connection")
 	log.Info("Checking connection to Docker...")
 	if _, _, err = check.DefaultConnChecker.Check(h, false); err != nil {
 		return fmt.Errorf("Error checking the host: %s", err)
@@ -184,5 +365,11 @@ func (api *Client) performCreate(h *host.Host) error {
 }
 
 func (api *Client) Close() error {
+	if closer, ok := api.Store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Warnf("Error closing the machine store: %s", err)
+		}
+	}
+
 	return api.clientDriverFactory.Close()
 }
@@ -1,6 +1,8 @@
 package libmachinetest
 
 import (
+	"context"
+
 	"github.com/docker/machine/libmachine"
 	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/host"
@@ -28,6 +30,10 @@ func (api *FakeAPI) Create(h *host.Host) error {
 	return nil
 }
 
+func (api *FakeAPI) CreateContext(ctx context.Context, h *host.Host) error {
+	return nil
+}
+
 func (api *FakeAPI) Exists(name string) (bool, error) {
 	for _, host := range api.Hosts {
 		if name == host.Name {
@@ -39,7 +45,11 @@ func (api *FakeAPI) Exists(name string) (bool, error) {
 }
 
 func (api *FakeAPI) List() ([]string, error) {
-	return []string{}, nil
+	names := []string{}
+	for _, host := range api.Hosts {
+		names = append(names, host.Name)
+	}
+	return names, nil
 }
 
 func (api *FakeAPI) Load(name string) (*host.Host, error) {
@@ -0,0 +1,159 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a log message or a step a machine went through, as written by
+// the EventMachineLogger.
+type Event struct {
+	Time    time.Time
+	Machine string `json:",omitempty"`
+	Step    string `json:",omitempty"`
+	Level   string `json:",omitempty"`
+	Message string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// EventMachineLogger writes log messages and the steps machines go through
+// as JSON lines, for programs to follow the progress of a command.
+type EventMachineLogger struct {
+	lock    *sync.Mutex
+	writer  io.Writer
+	debug   bool
+	history *HistoryRecorder
+
+	// steps holds the current step of each machine in progress.
+	steps map[string]string
+}
+
+// NewEventMachineLogger creates a MachineLogger writing JSON lines to w.
+func NewEventMachineLogger(w io.Writer) *EventMachineLogger {
+	return &EventMachineLogger{
+		lock:    &sync.Mutex{},
+		writer:  w,
+		history: NewHistoryRecorder(),
+		steps:   map[string]string{},
+	}
+}
+
+func (ml *EventMachineLogger) write(event Event) {
+	ml.lock.Lock()
+	defer ml.lock.Unlock()
+
+	// Messages are attributed to the machine in progress, when there's
+	// only one.
+	if event.Machine == "" && len(ml.steps) == 1 {
+		for machine, step := range ml.steps {
+			event.Machine, event.Step = machine, step
+		}
+	}
+
+	event.Time = time.Now()
+	event.Message = redactSecrets(event.Message)
+	event.Error = redactSecrets(event.Error)
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	ml.writer.Write(append(data, '\n'))
+}
+
+func (ml *EventMachineLogger) log(level, message string) {
+	message = strings.TrimSuffix(message, "\n")
+
+	ml.history.Record(message)
+	if level == "debug" && !ml.debug {
+		return
+	}
+
+	ml.write(Event{
+		Level:   level,
+		Message: message,
+	})
+}
+
+// Step records that a machine went on to a step.
+func (ml *EventMachineLogger) Step(machine, step string) {
+	ml.lock.Lock()
+	ml.steps[machine] = step
+	ml.lock.Unlock()
+
+	ml.write(Event{
+		Machine: machine,
+		Step:    step,
+	})
+}
+
+// Done records that a machine is done, with the error it failed with if
+// any.
+func (ml *EventMachineLogger) Done(machine string, err error) {
+	ml.lock.Lock()
+	delete(ml.steps, machine)
+	ml.lock.Unlock()
+
+	event := Event{
+		Machine: machine,
+		Step:    "done",
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	ml.write(event)
+}
+
+func (ml *EventMachineLogger) SetDebug(debug bool) {
+	ml.debug = debug
+}
+
+func (ml *EventMachineLogger) SetOutWriter(out io.Writer) {
+	ml.writer = out
+}
+
+// SetErrWriter does nothing, errors are events like any other message.
+func (ml *EventMachineLogger) SetErrWriter(err io.Writer) {
+}
+
+func (ml *EventMachineLogger) Debug(args ...interface{}) {
+	ml.log("debug", fmt.Sprintln(args...))
+}
+
+func (ml *EventMachineLogger) Debugf(fmtString string, args ...interface{}) {
+	ml.log("debug", fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *EventMachineLogger) Error(args ...interface{}) {
+	ml.log("error", fmt.Sprintln(args...))
+}
+
+func (ml *EventMachineLogger) Errorf(fmtString string, args ...interface{}) {
+	ml.log("error", fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *EventMachineLogger) Info(args ...interface{}) {
+	ml.log("info", fmt.Sprintln(args...))
+}
+
+func (ml *EventMachineLogger) Infof(fmtString string, args ...interface{}) {
+	ml.log("info", fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *EventMachineLogger) Warn(args ...interface{}) {
+	ml.log("warn", fmt.Sprintln(args...))
+}
+
+func (ml *EventMachineLogger) Warnf(fmtString string, args ...interface{}) {
+	ml.log("warn", fmt.Sprintf(fmtString, args...))
+}
+
+func (ml *EventMachineLogger) History() []string {
+	return ml.history.records
+}
@@ -0,0 +1,65 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readEvents(t *testing.T, buf *bytes.Buffer) []Event {
+	events := []Event{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		event := Event{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestEventMachineLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	testLogger := NewEventMachineLogger(buf)
+
+	testLogger.Info("before")
+	testLogger.Step("foo", "provision")
+	testLogger.Infof("Provisioning with %s...", "boot2docker")
+	testLogger.Debug("hidden")
+	testLogger.Step("bar", "start")
+	testLogger.Warn("whose?")
+	testLogger.Done("foo", errors.New("provisioning failed"))
+	testLogger.Error("bar again")
+
+	events := readEvents(t, buf)
+	assert.Len(t, events, 7)
+
+	assert.Equal(t, Event{Time: events[0].Time, Level: "info", Message: "before"}, events[0])
+	assert.Equal(t, Event{Time: events[1].Time, Machine: "foo", Step: "provision"}, events[1])
+	assert.Equal(t, Event{Time: events[2].Time, Machine: "foo", Step: "provision", Level: "info", Message: "Provisioning with boot2docker..."}, events[2])
+	assert.Equal(t, Event{Time: events[3].Time, Machine: "bar", Step: "start"}, events[3])
+	assert.Equal(t, Event{Time: events[4].Time, Level: "warn", Message: "whose?"}, events[4])
+	assert.Equal(t, Event{Time: events[5].Time, Machine: "foo", Step: "done", Error: "provisioning failed"}, events[5])
+	assert.Equal(t, Event{Time: events[6].Time, Machine: "bar", Step: "start", Level: "error", Message: "bar again"}, events[6])
+
+	assert.Equal(t, []string{"before", "Provisioning with boot2docker...", "hidden", "whose?", "bar again"}, testLogger.History())
+}
+
+func TestProgressGoesToEventLogger(t *testing.T) {
+	buf := &bytes.Buffer{}
+	previous := SetLogger(NewEventMachineLogger(buf))
+	defer SetLogger(previous)
+
+	Progress("foo", "create")
+	Done("foo", nil)
+
+	events := readEvents(t, buf)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "create", events[0].Step)
+	assert.Equal(t, "done", events[1].Step)
+	assert.Empty(t, events[1].Error)
+}
@@ -38,47 +38,55 @@ func (ml *FmtMachineLogger) SetErrWriter(err io.Writer) {
 func (ml *FmtMachineLogger) Debug(args ...interface{}) {
 	ml.history.Record(args...)
 	if ml.debug {
-		fmt.Fprintln(ml.errWriter, args...)
+		fprintln(ml.errWriter, args...)
 	}
 }
 
 func (ml *FmtMachineLogger) Debugf(fmtString string, args ...interface{}) {
 	ml.history.Recordf(fmtString, args...)
 	if ml.debug {
-		fmt.Fprintf(ml.errWriter, fmtString+"\n", args...)
+		fprintf(ml.errWriter, fmtString+"\n", args...)
 	}
 }
 
 func (ml *FmtMachineLogger) Error(args ...interface{}) {
 	ml.history.Record(args...)
-	fmt.Fprintln(ml.errWriter, args...)
+	fprintln(ml.errWriter, args...)
 }
 
 func (ml *FmtMachineLogger) Errorf(fmtString string, args ...interface{}) {
 	ml.history.Recordf(fmtString, args...)
-	fmt.Fprintf(ml.errWriter, fmtString+"\n", args...)
+	fprintf(ml.errWriter, fmtString+"\n", args...)
 }
 
 func (ml *FmtMachineLogger) Info(args ...interface{}) {
 	ml.history.Record(args...)
-	fmt.Fprintln(ml.outWriter, args...)
+	fprintln(ml.outWriter, args...)
 }
 
 func (ml *FmtMachineLogger) Infof(fmtString string, args ...interface{}) {
 	ml.history.Recordf(fmtString, args...)
-	fmt.Fprintf(ml.outWriter, fmtString+"\n", args...)
+	fprintf(ml.outWriter, fmtString+"\n", args...)
 }
 
 func (ml *FmtMachineLogger) Warn(args ...interface{}) {
 	ml.history.Record(args...)
-	fmt.Fprintln(ml.outWriter, args...)
+	fprintln(ml.outWriter, args...)
 }
 
 func (ml *FmtMachineLogger) Warnf(fmtString string, args ...interface{}) {
 	ml.history.Recordf(fmtString, args...)
-	fmt.Fprintf(ml.outWriter, fmtString+"\n", args...)
+	fprintf(ml.outWriter, fmtString+"\n", args...)
 }
 
 func (ml *FmtMachineLogger) History() []string {
 	return ml.history.records
 }
+
+func fprintln(w io.Writer, args ...interface{}) {
+	io.WriteString(w, redactSecrets(fmt.Sprintln(args...)))
+}
+
+func fprintf(w io.Writer, fmtString string, args ...interface{}) {
+	io.WriteString(w, redactSecrets(fmt.Sprintf(fmtString, args...)))
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"bytes"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -89,3 +90,16 @@ CAlTWS3abehlCERn6Ze9IfZBtpI=
 		assert.Equal(t, tc.expected, stripSecrets(tc.input))
 	}
 }
+
+func TestRegisteredSecretsAreRedacted(t *testing.T) {
+	RegisterSecret("s3cr3t-t0k3n")
+
+	assert.Equal(t, []string{"Using token <REDACTED>"}, stripSecrets([]string{"Using token s3cr3t-t0k3n"}))
+
+	out := &bytes.Buffer{}
+	testLogger := NewFmtMachineLogger()
+	testLogger.SetOutWriter(out)
+	testLogger.Infof("Authenticating with %s", "s3cr3t-t0k3n")
+
+	assert.Equal(t, "Authenticating with <REDACTED>\n", out.String())
+}
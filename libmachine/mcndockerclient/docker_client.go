@@ -2,8 +2,11 @@ package mcndockerclient
 
 import (
 	"fmt"
+	"net"
+	"net/http"
 
 	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/ssh"
 	"github.com/samalba/dockerclient"
 )
 
@@ -19,7 +22,24 @@ func DockerClient(dockerHost DockerHost) (*dockerclient.DockerClient, error) {
 		return nil, fmt.Errorf("Unable to read TLS config: %s", err)
 	}
 
-	return dockerclient.NewDockerClient(url, tlsConfig)
+	client, err := dockerclient.NewDockerClient(url, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	// The engine of a host behind jump hosts is reached through them.
+	if jumpHostser, ok := dockerHost.(SSHJumpHostser); ok {
+		if jumpHosts := jumpHostser.SSHJumpHosts(); len(jumpHosts) > 0 {
+			client.HTTPClient.Transport = &http.Transport{
+				TLSClientConfig: tlsConfig,
+				Dial: func(network, address string) (net.Conn, error) {
+					return ssh.DialThrough(jumpHosts, network, address)
+				},
+			}
+		}
+	}
+
+	return client, nil
 }
 
 // CreateContainer creates a docker container.
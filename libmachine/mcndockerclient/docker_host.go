@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/ssh"
 )
 
 type URLer interface {
@@ -16,6 +17,11 @@ type AuthOptionser interface {
 	AuthOptions() *auth.Options
 }
 
+type SSHJumpHostser interface {
+	// SSHJumpHosts returns the SSH servers the Docker host is reached through
+	SSHJumpHosts() []ssh.JumpHost
+}
+
 type DockerHost interface {
 	URLer
 	AuthOptionser
@@ -24,6 +30,7 @@ type DockerHost interface {
 type RemoteDocker struct {
 	HostURL    string
 	AuthOption *auth.Options
+	JumpHosts  []ssh.JumpHost
 }
 
 // URL returns the Docker host URL
@@ -39,3 +46,8 @@ func (rd *RemoteDocker) URL() (string, error) {
 func (rd *RemoteDocker) AuthOptions() *auth.Options {
 	return rd.AuthOption
 }
+
+// SSHJumpHosts returns the SSH servers the Docker host is reached through
+func (rd *RemoteDocker) SSHJumpHosts() []ssh.JumpHost {
+	return rd.JumpHosts
+}
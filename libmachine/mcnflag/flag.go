@@ -12,6 +12,11 @@ type StringFlag struct {
 	Usage  string
 	EnvVar string
 	Value  string
+
+	// PerMachine flags identify a single machine, such as its IP address
+	// or key pair. Their value is not carried over to new machines created
+	// like an existing one.
+	PerMachine bool
 }
 
 // TODO: Could this be done more succinctly using embedding?
@@ -55,6 +60,72 @@ func (f IntFlag) Default() interface{} {
 	return f.Value
 }
 
+// SecretFlag is a string flag holding a credential, such as an API key or
+// a password. Its value is redacted in logs and in inspect output, and
+// stores keep it apart from the machine config. Field is the driver config
+// field the value ends up in, nested fields are separated by dots, e.g.
+// "Client.ApiKey".
+type SecretFlag struct {
+	Name   string
+	Usage  string
+	EnvVar string
+	Value  string
+	Field  string
+}
+
+// TODO: Could this be done more succinctly using embedding?
+func (f SecretFlag) String() string {
+	return f.Name
+}
+
+func (f SecretFlag) Default() interface{} {
+	return f.Value
+}
+
+// PerMachineFlags returns the names of the flags among flags which only
+// apply to a single machine.
+func PerMachineFlags(flags []Flag) map[string]bool {
+	names := map[string]bool{}
+
+	for _, flag := range flags {
+		switch f := flag.(type) {
+		case StringFlag:
+			if f.PerMachine {
+				names[f.Name] = true
+			}
+		case *StringFlag:
+			if f.PerMachine {
+				names[f.Name] = true
+			}
+		}
+	}
+
+	return names
+}
+
+// SecretFields returns the driver config fields of the secret flags among
+// flags.
+func SecretFields(flags []Flag) []string {
+	fields := []string{}
+
+	for _, flag := range flags {
+		var field string
+
+		switch f := flag.(type) {
+		case SecretFlag:
+			field = f.Field
+		case *SecretFlag:
+			field = f.Field
+		}
+
+		if field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
+
 type BoolFlag struct {
 	Name   string
 	Usage  string
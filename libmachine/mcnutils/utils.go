@@ -1,6 +1,7 @@
 package mcnutils
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -8,6 +9,7 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -79,17 +81,7 @@ func CopyFile(src, dst string) error {
 }
 
 func WaitForSpecificOrError(f func() (bool, error), maxAttempts int, waitInterval time.Duration) error {
-	for i := 0; i < maxAttempts; i++ {
-		stop, err := f()
-		if err != nil {
-			return err
-		}
-		if stop {
-			return nil
-		}
-		time.Sleep(waitInterval)
-	}
-	return fmt.Errorf("Maximum number of retries (%d) exceeded", maxAttempts)
+	return waitUntil(context.Background(), f, maxAttempts, waitInterval)
 }
 
 func WaitForSpecific(f func() bool, maxAttempts int, waitInterval time.Duration) error {
@@ -102,6 +94,122 @@ func WaitFor(f func() bool) error {
 	return WaitForSpecific(f, 60, 3*time.Second)
 }
 
+// WaitForContext is WaitFor, which stops waiting with the error of the
+// context once it's done.
+func WaitForContext(ctx context.Context, f func() bool) error {
+	return WaitForSpecificContext(ctx, f, 60, 3*time.Second)
+}
+
+// WaitForSpecificContext is WaitForSpecific, which stops waiting with the
+// error of the context once it's done.
+func WaitForSpecificContext(ctx context.Context, f func() bool, maxAttempts int, waitInterval time.Duration) error {
+	return waitUntil(ctx, func() (bool, error) {
+		return f(), nil
+	}, maxAttempts, waitInterval)
+}
+
+type pendingKey struct{}
+
+// WithPending returns a context under which the functions RunContext gives
+// up on are tracked, and a function waiting for them to return. It's for
+// callers which undo what the functions do once the context is done, such as
+// removing a machine whose creation was interrupted.
+func WithPending(ctx context.Context) (context.Context, func()) {
+	pending := &sync.WaitGroup{}
+	return context.WithValue(ctx, pendingKey{}, pending), pending.Wait
+}
+
+// RunContext runs f and returns its error, or the error of the context as
+// soon as it's done. f is then left to return on its own, so it must not
+// change anything the caller uses afterwards, unless the caller waits for it
+// with a context from WithPending.
+func RunContext(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Contexts which are never done don't need f to run on its own.
+	if ctx.Done() == nil {
+		return f()
+	}
+
+	pending, _ := ctx.Value(pendingKey{}).(*sync.WaitGroup)
+	if pending != nil {
+		pending.Add(1)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		if pending != nil {
+			defer pending.Done()
+		}
+		done <- f()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Condition tells whether something is ready. An error means it never will
+// be, and stops waiting for it.
+type Condition func() (bool, error)
+
+// ErrTimeout is returned when a condition isn't met in time.
+type ErrTimeout struct {
+	Timeout time.Duration
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("Timed out after %s", e.Timeout)
+}
+
+// WaitUntil checks a condition every interval until it's met, it fails or
+// timeout passed. The condition is checked at least once, and a check still
+// running once timeout passed is given up on.
+func WaitUntil(condition Condition, timeout, interval time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := waitUntil(ctx, condition, 0, interval)
+	if err == context.DeadlineExceeded {
+		return ErrTimeout{timeout}
+	}
+	return err
+}
+
+// waitUntil checks a condition every interval until it's met, it fails,
+// maxAttempts checks were made if it's positive, or ctx is done. Checks are
+// run under ctx, and given up on once it's done.
+func waitUntil(ctx context.Context, condition Condition, maxAttempts int, interval time.Duration) error {
+	for attempt := 1; ; attempt++ {
+		var ready bool
+		err := RunContext(ctx, func() (err error) {
+			ready, err = condition()
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if ready {
+			return nil
+		}
+
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return fmt.Errorf("Maximum number of retries (%d) exceeded", maxAttempts)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
 // TruncateID returns a shorten id
 // Following two functions are from github.com/docker/docker/utils module. It
 // was way overkill to include the whole module, so we just have these bits
@@ -1,11 +1,14 @@
 package mcnutils
 
 import (
+	"context"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestCopyFile(t *testing.T) {
@@ -99,3 +102,145 @@ func TestShortenIdInvalid(t *testing.T) {
 		t.Fatalf("Id returned is incorrect: truncate on %s returned %s", id, truncID)
 	}
 }
+
+func TestWaitUntil(t *testing.T) {
+	attempts := 0
+	err := WaitUntil(func() (bool, error) {
+		attempts++
+		return attempts == 3, nil
+	}, time.Second, time.Millisecond)
+	if err != nil || attempts != 3 {
+		t.Fatalf("Expected the condition to be met on the third attempt, got %v after %d", err, attempts)
+	}
+
+	err = WaitUntil(func() (bool, error) {
+		return false, nil
+	}, 10*time.Millisecond, time.Millisecond)
+	if err != (ErrTimeout{10 * time.Millisecond}) {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	err = WaitUntil(func() (bool, error) {
+		return false, errors.New("never")
+	}, time.Second, time.Millisecond)
+	if err == nil || err.Error() != "never" {
+		t.Fatalf("Expected the error of the condition, got %v", err)
+	}
+
+	// A check which hangs doesn't delay the timeout.
+	block := make(chan struct{})
+	defer close(block)
+
+	start := time.Now()
+	err = WaitUntil(func() (bool, error) {
+		<-block
+		return true, nil
+	}, 10*time.Millisecond, time.Millisecond)
+	if err != (ErrTimeout{10 * time.Millisecond}) {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the wait to stop at the timeout, took %s", elapsed)
+	}
+}
+
+func TestWaitForSpecificOrError(t *testing.T) {
+	attempts := 0
+	err := WaitForSpecificOrError(func() (bool, error) {
+		attempts++
+		return false, nil
+	}, 3, time.Millisecond)
+	if err == nil || err.Error() != "Maximum number of retries (3) exceeded" || attempts != 3 {
+		t.Fatalf("Expected the retries to be exceeded after 3 attempts, got %v after %d", err, attempts)
+	}
+}
+
+func TestWaitForContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts := 0
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	err := WaitForContext(ctx, func() bool {
+		attempts++
+		return false
+	})
+	if err != context.Canceled || attempts != 1 {
+		t.Fatalf("Expected the wait to be canceled after the first attempt, got %v after %d", err, attempts)
+	}
+
+	if err := WaitForContext(context.Background(), func() bool { return true }); err != nil {
+		t.Fatalf("Expected the condition to be met, got %v", err)
+	}
+}
+
+func TestRunContext(t *testing.T) {
+	if err := RunContext(context.Background(), func() error { return errors.New("failed") }); err == nil || err.Error() != "failed" {
+		t.Fatalf("Expected the error of the function, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	block := make(chan struct{})
+	defer close(block)
+
+	err := RunContext(ctx, func() error {
+		<-block
+		return nil
+	})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expected the deadline to be exceeded, got %v", err)
+	}
+
+	called := false
+	err = RunContext(ctx, func() error {
+		called = true
+		return nil
+	})
+	if err != context.DeadlineExceeded || called {
+		t.Fatalf("Expected the function not to be run once the context is done, got %v", err)
+	}
+}
+
+func TestRunContextWithPending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, waitPending := WithPending(ctx)
+
+	block := make(chan struct{})
+	returned := make(chan struct{})
+
+	go cancel()
+	err := RunContext(ctx, func() error {
+		<-block
+		close(returned)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected the context to be canceled, got %v", err)
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		waitPending()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("Expected the function given up on to be waited for")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(block)
+	<-waited
+
+	select {
+	case <-returned:
+	default:
+		t.Fatal("Expected the function to have returned once waited for")
+	}
+}
@@ -0,0 +1,147 @@
+package persist
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltBucket = []byte("machine")
+)
+
+// BoltBackend keeps a store in a single bolt database file. The database is
+// only opened for the duration of each operation, since bolt locks it
+// exclusively and other docker-machine processes need it too. Keys are
+// locked with lock files in a directory next to it.
+type BoltBackend struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func NewBoltBackend(path string) *BoltBackend {
+	return &BoltBackend{
+		Path:    path,
+		Timeout: DefaultLockTimeout,
+	}
+}
+
+func (b *BoltBackend) open() (*bolt.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(b.Path), 0700); err != nil {
+		return nil, err
+	}
+
+	return bolt.Open(b.Path, 0600, &bolt.Options{Timeout: b.Timeout})
+}
+
+func (b *BoltBackend) view(fn func(bucket *bolt.Bucket) error) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(boltBucket))
+	})
+}
+
+func (b *BoltBackend) update(fn func(bucket *bolt.Bucket) error) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(boltBucket)
+		if err != nil {
+			return err
+		}
+		return fn(bucket)
+	})
+}
+
+func (b *BoltBackend) Get(key string) ([]byte, error) {
+	var value []byte
+
+	err := b.view(func(bucket *bolt.Bucket) error {
+		if bucket != nil {
+			if v := bucket.Get([]byte(key)); v != nil {
+				// Values are only valid during the transaction.
+				value = append([]byte{}, v...)
+				return nil
+			}
+		}
+		return ErrKeyNotFound
+	})
+
+	return value, err
+}
+
+func (b *BoltBackend) Put(key string, value []byte) error {
+	return b.update(func(bucket *bolt.Bucket) error {
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (b *BoltBackend) Delete(key string) error {
+	return b.update(func(bucket *bolt.Bucket) error {
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+
+		// Collect first, deleting while iterating would skip keys.
+		prefix := []byte(key + "/")
+		keys := [][]byte{}
+
+		c := bucket.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte{}, k...))
+		}
+
+		for _, k := range keys {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltBackend) List(prefix string) ([]string, error) {
+	keys := []string{}
+
+	err := b.view(func(bucket *bolt.Bucket) error {
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, _ := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = c.Next() {
+			keys = append(keys, string(k))
+		}
+
+		return nil
+	})
+
+	return keys, err
+}
+
+func (b *BoltBackend) LockKey(key string, shared bool, command string, timeout time.Duration) (func() error, error) {
+	lock, err := acquireLock(lockRequest{
+		path:    filepath.Join(b.Path+".locks", filepath.FromSlash(key)+".lock"),
+		command: command,
+		timeout: timeout,
+		shared:  shared,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lock.Unlock, nil
+}
@@ -0,0 +1,563 @@
+package persist
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnerror"
+)
+
+const (
+	bundleVersion      = 1
+	bundleManifestFile = "manifest.json"
+	bundleConfigFile   = "config.json"
+	bundleCertsDir     = "certs"
+
+	// maxBundleEntrySize bounds the files read from a bundle, which are
+	// only a config, keys and certificates.
+	maxBundleEntrySize = 1 << 20
+)
+
+var (
+	ErrInvalidBundle = errors.New("Invalid machine bundle")
+
+	ErrBundleWithoutCerts = errors.New("The machine bundle doesn't include the CA the machine's certificates are signed with, export it with --certs or import it with --regenerate-certs")
+)
+
+// Bundler is implemented by stores which can export a machine to a portable
+// bundle and import it back, possibly into another store.
+type Bundler interface {
+	// Export writes a bundle of a machine to w
+	Export(name string, w io.Writer, includeCerts bool) error
+
+	// Import creates a machine from a bundle and returns its name. Bundles
+	// without certificates are only imported with newCerts, the machine
+	// then uses the CA of the store and its certificates have to be
+	// regenerated.
+	Import(r io.Reader, force, newCerts bool) (string, error)
+}
+
+// BundleManifest describes the content of a machine bundle.
+type BundleManifest struct {
+	Version int
+	Name    string
+
+	// StorePath and MachineDir are the locations the machine was exported
+	// from, paths below them are rebased when importing.
+	StorePath  string
+	MachineDir string
+
+	HasSSHKey bool
+	HasCerts  bool
+}
+
+type bundleFile struct {
+	name string
+	path string
+}
+
+func (s Filestore) Export(name string, w io.Writer, includeCerts bool) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	machineDir := filepath.Join(s.GetMachinesDir(), name)
+	configPath := filepath.Join(machineDir, bundleConfigFile)
+
+	data, err := ioutil.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return mcnerror.ErrHostDoesNotExist{
+			Name: name,
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	h, err := validateConfig(name, data)
+	if err != nil {
+		return fmt.Errorf("Error reading config of %q: %s", name, err)
+	}
+
+	// Bundles are meant to move between stores, their secrets are
+	// decrypted and put back into the config.
+	sealer, err := s.sealer()
+	if err != nil {
+		return err
+	}
+
+	if data, err = s.mergeSecrets(name, data); err != nil {
+		return fmt.Errorf("Error reading secrets of %q: %s", name, err)
+	}
+
+	if sealer != nil {
+		config, err := decodeConfig(data)
+		if err != nil {
+			return err
+		}
+
+		if _, err := transformSecrets(config, sealer.OpenString); err != nil {
+			return err
+		}
+
+		if data, err = json.MarshalIndent(config, "", "    "); err != nil {
+			return err
+		}
+	}
+
+	manifest := BundleManifest{
+		Version:    bundleVersion,
+		Name:       name,
+		StorePath:  s.Path,
+		MachineDir: machineDir,
+	}
+
+	files := []bundleFile{}
+
+	authOptions := h.HostOptions.AuthOptions
+	files = appendIfExists(files, "server.pem", authOptions.ServerCertPath)
+	files = appendIfExists(files, "server-key.pem", authOptions.ServerKeyPath)
+
+	sshKeyPath := driverSSHKeyPath(h.RawDriver)
+	if sshKeyPath == "" {
+		sshKeyPath = filepath.Join(machineDir, "id_rsa")
+	}
+	if _, err := os.Stat(sshKeyPath); err == nil {
+		manifest.HasSSHKey = true
+		files = append(files, bundleFile{"id_rsa", sshKeyPath})
+		files = appendIfExists(files, "id_rsa.pub", sshKeyPath+".pub")
+	}
+
+	if includeCerts {
+		manifest.HasCerts = true
+		files = appendIfExists(files, bundleCertsDir+"/ca.pem", authOptions.CaCertPath)
+		files = appendIfExists(files, bundleCertsDir+"/ca-key.pem", authOptions.CaPrivateKeyPath)
+		files = appendIfExists(files, bundleCertsDir+"/cert.pem", authOptions.ClientCertPath)
+		files = appendIfExists(files, bundleCertsDir+"/key.pem", authOptions.ClientKeyPath)
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := writeBundleEntry(tarWriter, bundleManifestFile, manifestData); err != nil {
+		return err
+	}
+
+	if err := writeBundleEntry(tarWriter, bundleConfigFile, data); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		content, err := ioutil.ReadFile(f.path)
+		if err != nil {
+			return err
+		}
+
+		if sealer != nil {
+			if content, err = sealer.OpenFile(content); err != nil {
+				return fmt.Errorf("Error decrypting %s: %s", f.path, err)
+			}
+		}
+
+		if err := writeBundleEntry(tarWriter, f.name, content); err != nil {
+			return err
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+
+	return gzipWriter.Close()
+}
+
+func (s Filestore) Import(r io.Reader, force, newCerts bool) (string, error) {
+	entries, err := readBundle(r)
+	if err != nil {
+		return "", err
+	}
+
+	var manifest BundleManifest
+	if err := json.Unmarshal(entries[bundleManifestFile], &manifest); err != nil {
+		return "", ErrInvalidBundle
+	}
+
+	if manifest.Version != bundleVersion {
+		return "", fmt.Errorf("Unsupported machine bundle version %d", manifest.Version)
+	}
+
+	// The server certificate is signed by the CA of the exporting store,
+	// it's useless without it.
+	if _, ok := entries["server.pem"]; ok && !manifest.HasCerts {
+		if !newCerts {
+			return "", ErrBundleWithoutCerts
+		}
+		delete(entries, "server.pem")
+		delete(entries, "server-key.pem")
+	}
+
+	name := manifest.Name
+	if !host.ValidateHostName(name) {
+		return "", mcnerror.ErrInvalidHostname
+	}
+
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Unlock()
+
+	exists, err := s.Exists(name)
+	if err != nil {
+		return "", err
+	}
+
+	if exists && !force {
+		return "", mcnerror.ErrHostAlreadyExists{
+			Name: name,
+		}
+	}
+
+	machineDir := filepath.Join(s.GetMachinesDir(), name)
+
+	data, err := rebaseConfig(entries[bundleConfigFile], manifest, s.Path, machineDir)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := validateConfig(name, data); err != nil {
+		return "", fmt.Errorf("Error reading config of %q: %s", name, err)
+	}
+
+	// The machine is staged next to the existing one, which is only
+	// replaced once the import went through.
+	if err := os.MkdirAll(s.GetMachinesDir(), 0700); err != nil {
+		return "", err
+	}
+
+	staging, err := ioutil.TempDir(s.GetMachinesDir(), "."+name+".import-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+
+	if err := writeBundleFiles(staging, entries, manifest.HasCerts); err != nil {
+		return "", err
+	}
+
+	backup := ""
+	if exists {
+		backup = staging + ".old"
+		if err := os.Rename(machineDir, backup); err != nil {
+			return "", err
+		}
+	}
+
+	restore := func() {
+		if backup == "" {
+			return
+		}
+		if err := os.Rename(backup, machineDir); err != nil {
+			log.Warnf("Unable to move %s back to %s: %s", backup, machineDir, err)
+		}
+	}
+
+	if err := os.Rename(staging, machineDir); err != nil {
+		restore()
+		return "", err
+	}
+
+	if err := s.saveImportedConfig(name, data); err != nil {
+		os.RemoveAll(machineDir)
+		restore()
+		return "", err
+	}
+
+	if backup != "" {
+		os.RemoveAll(backup)
+	}
+
+	return name, nil
+}
+
+func writeBundleFiles(dir string, entries map[string][]byte, hasCerts bool) error {
+	if hasCerts {
+		if err := os.MkdirAll(filepath.Join(dir, bundleCertsDir), 0700); err != nil {
+			return err
+		}
+	}
+
+	for entryName, content := range entries {
+		if entryName == bundleManifestFile || entryName == bundleConfigFile {
+			continue
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, filepath.FromSlash(entryName)), content, 0600); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveImportedConfig saves the config of an imported machine, whose
+// credentials come back out of it as they would on save.
+func (s Filestore) saveImportedConfig(name string, data []byte) error {
+	sealer, err := s.sealer()
+	if err != nil {
+		return err
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return err
+	}
+
+	if err := s.extractSecrets(name, config, nil); err != nil {
+		return err
+	}
+
+	if data, err = json.MarshalIndent(config, "", "    "); err != nil {
+		return err
+	}
+
+	if err := s.saveToFile(data, filepath.Join(s.GetMachinesDir(), name, bundleConfigFile)); err != nil {
+		return err
+	}
+
+	if sealer != nil {
+		return s.sealMachine(name, sealer)
+	}
+
+	return nil
+}
+
+func appendIfExists(files []bundleFile, name, path string) []bundleFile {
+	if path == "" {
+		return files
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return files
+	}
+
+	return append(files, bundleFile{name, path})
+}
+
+func driverSSHKeyPath(rawDriver []byte) string {
+	var driver struct {
+		SSHKeyPath string
+	}
+
+	json.Unmarshal(rawDriver, &driver)
+
+	return driver.SSHKeyPath
+}
+
+func writeBundleEntry(w *tar.Writer, name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+
+	if err := w.WriteHeader(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(content)
+	return err
+}
+
+func readBundle(r io.Reader) (map[string][]byte, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, ErrInvalidBundle
+	}
+	defer gzipReader.Close()
+
+	entries := map[string][]byte{}
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrInvalidBundle
+		}
+
+		if !isBundleEntryName(header.Name) {
+			return nil, fmt.Errorf("Unexpected file %q in machine bundle", header.Name)
+		}
+
+		if _, ok := entries[header.Name]; ok {
+			return nil, fmt.Errorf("Duplicate file %q in machine bundle", header.Name)
+		}
+
+		if header.Size > maxBundleEntrySize {
+			return nil, fmt.Errorf("File %q in machine bundle is too large", header.Name)
+		}
+
+		content, err := ioutil.ReadAll(io.LimitReader(tarReader, maxBundleEntrySize+1))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(content) > maxBundleEntrySize {
+			return nil, fmt.Errorf("File %q in machine bundle is too large", header.Name)
+		}
+
+		entries[header.Name] = content
+	}
+
+	if _, ok := entries[bundleManifestFile]; !ok {
+		return nil, ErrInvalidBundle
+	}
+
+	if _, ok := entries[bundleConfigFile]; !ok {
+		return nil, ErrInvalidBundle
+	}
+
+	return entries, nil
+}
+
+// isBundleEntryName only accepts the files we export, which also keeps a
+// crafted bundle from writing outside of the machine directory.
+func isBundleEntryName(name string) bool {
+	switch name {
+	case bundleManifestFile, bundleConfigFile, "server.pem", "server-key.pem", "id_rsa", "id_rsa.pub",
+		bundleCertsDir + "/ca.pem", bundleCertsDir + "/ca-key.pem", bundleCertsDir + "/cert.pem", bundleCertsDir + "/key.pem":
+		return true
+	}
+	return false
+}
+
+// rebaseConfig rewrites the paths of an exported config so that they point
+// into the machine directory of the importing store.
+func rebaseConfig(data []byte, manifest BundleManifest, storePath, machineDir string) ([]byte, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, ErrInvalidBundle
+	}
+
+	rebaseStrings(config, func(s string) string {
+		if p, ok := rebasePath(s, manifest.MachineDir, machineDir); ok {
+			return p
+		}
+		if p, ok := rebasePath(s, manifest.StorePath, storePath); ok {
+			return p
+		}
+		return s
+	})
+
+	if driver, ok := config["Driver"].(map[string]interface{}); ok {
+		if _, ok := driver["StorePath"]; ok {
+			driver["StorePath"] = storePath
+		}
+		if manifest.HasSSHKey {
+			driver["SSHKeyPath"] = filepath.Join(machineDir, "id_rsa")
+		}
+	}
+
+	if hostOptions, ok := config["HostOptions"].(map[string]interface{}); ok {
+		if authOptions, ok := hostOptions["AuthOptions"].(map[string]interface{}); ok {
+			authOptions["StorePath"] = machineDir
+			authOptions["ServerCertPath"] = filepath.Join(machineDir, "server.pem")
+			authOptions["ServerKeyPath"] = filepath.Join(machineDir, "server-key.pem")
+
+			// The machine's server certificate is signed by the exporter's
+			// CA, so it has to keep using it instead of ours.
+			if manifest.HasCerts {
+				certsDir := filepath.Join(machineDir, bundleCertsDir)
+				authOptions["CertDir"] = certsDir
+				authOptions["CaCertPath"] = filepath.Join(certsDir, "ca.pem")
+				authOptions["CaPrivateKeyPath"] = filepath.Join(certsDir, "ca-key.pem")
+				authOptions["ClientCertPath"] = filepath.Join(certsDir, "cert.pem")
+				authOptions["ClientKeyPath"] = filepath.Join(certsDir, "key.pem")
+			}
+		}
+	}
+
+	return json.MarshalIndent(config, "", "    ")
+}
+
+// rebaseConfigPaths moves every path of a config from below oldRoot to
+// below newRoot.
+func rebaseConfigPaths(data []byte, oldRoot, newRoot string) ([]byte, error) {
+	var config map[string]interface{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	rebaseStrings(config, func(s string) string {
+		if p, ok := rebasePath(s, oldRoot, newRoot); ok {
+			return p
+		}
+		return s
+	})
+
+	return json.MarshalIndent(config, "", "    ")
+}
+
+func rebaseStrings(v interface{}, rebase func(string) string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for key, value := range t {
+			if s, ok := value.(string); ok {
+				t[key] = rebase(s)
+			} else {
+				rebaseStrings(value, rebase)
+			}
+		}
+	case []interface{}:
+		for i, value := range t {
+			if s, ok := value.(string); ok {
+				t[i] = rebase(s)
+			} else {
+				rebaseStrings(value, rebase)
+			}
+		}
+	}
+}
+
+// rebasePath moves path from below oldRoot to below newRoot. Separators are
+// normalized so that bundles can move between Windows and Unix hosts.
+func rebasePath(path, oldRoot, newRoot string) (string, bool) {
+	if oldRoot == "" {
+		return "", false
+	}
+
+	slashPath := strings.Replace(path, `\`, "/", -1)
+	slashRoot := strings.TrimSuffix(strings.Replace(oldRoot, `\`, "/", -1), "/")
+
+	if slashPath == slashRoot {
+		return newRoot, true
+	}
+
+	if !strings.HasPrefix(slashPath, slashRoot+"/") {
+		return "", false
+	}
+
+	return filepath.Join(newRoot, filepath.FromSlash(slashPath[len(slashRoot)+1:])), true
+}
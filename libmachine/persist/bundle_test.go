@@ -0,0 +1,212 @@
+package persist
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImport(t *testing.T) {
+	defer cleanup()
+
+	src := getTestStore()
+	defer os.RemoveAll(src.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineDir := filepath.Join(src.GetMachinesDir(), h.Name)
+	h.HostOptions.AuthOptions.StorePath = machineDir
+	h.HostOptions.AuthOptions.ServerCertPath = filepath.Join(machineDir, "server.pem")
+	h.HostOptions.AuthOptions.CaCertPath = filepath.Join(src.Path, "certs", "ca.pem")
+
+	if err := src.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(src.Path, "certs"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{filepath.Join(machineDir, "server.pem"), filepath.Join(machineDir, "id_rsa"), filepath.Join(src.Path, "certs", "ca.pem")} {
+		if err := ioutil.WriteFile(f, []byte(filepath.Base(f)), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bundle := &bytes.Buffer{}
+	assert.NoError(t, src.Export(h.Name, bundle, true))
+
+	dest := getTestStore()
+	defer os.RemoveAll(dest.Path)
+
+	name, err := dest.Import(bytes.NewReader(bundle.Bytes()), false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, h.Name, name)
+
+	imported, err := dest.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importedDir := filepath.Join(dest.GetMachinesDir(), name)
+	authOptions := imported.HostOptions.AuthOptions
+	assert.Equal(t, importedDir, authOptions.StorePath)
+	assert.Equal(t, filepath.Join(importedDir, "server.pem"), authOptions.ServerCertPath)
+	assert.Equal(t, filepath.Join(importedDir, "certs", "ca.pem"), authOptions.CaCertPath)
+	assert.Equal(t, filepath.Join(importedDir, "id_rsa"), driverSSHKeyPath(imported.RawDriver))
+
+	content, err := ioutil.ReadFile(authOptions.CaCertPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "ca.pem", string(content))
+
+	_, err = dest.Import(bytes.NewReader(bundle.Bytes()), false, false)
+	assert.Equal(t, mcnerror.ErrHostAlreadyExists{Name: h.Name}, err)
+
+	_, err = dest.Import(bytes.NewReader(bundle.Bytes()), true, false)
+	assert.NoError(t, err)
+}
+
+func TestRebasePath(t *testing.T) {
+	var tests = []struct {
+		path, oldRoot, newRoot string
+		expected               string
+		ok                     bool
+	}{
+		{"/home/alice/.docker/machine/machines/dev/id_rsa", "/home/alice/.docker/machine", "/home/bob/store", filepath.Join("/home/bob/store", "machines", "dev", "id_rsa"), true},
+		{`C:\Users\alice\.docker\machine\certs\ca.pem`, `C:\Users\alice\.docker\machine`, "/home/bob/store", filepath.Join("/home/bob/store", "certs", "ca.pem"), true},
+		{"/home/alice/.docker/machine", "/home/alice/.docker/machine/", "/home/bob/store", "/home/bob/store", true},
+		{"/home/alice/.docker/machine2/foo", "/home/alice/.docker/machine", "/home/bob/store", "", false},
+		{"tcp://1.2.3.4:2376", "/home/alice/.docker/machine", "/home/bob/store", "", false},
+	}
+
+	for _, test := range tests {
+		actual, ok := rebasePath(test.path, test.oldRoot, test.newRoot)
+		assert.Equal(t, test.ok, ok)
+		assert.Equal(t, test.expected, actual)
+	}
+}
+
+func writeTestBundle(t *testing.T, entries map[string][]byte) *bytes.Buffer {
+	bundle := &bytes.Buffer{}
+	gzipWriter := gzip.NewWriter(bundle)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	for name, content := range entries {
+		assert.NoError(t, writeBundleEntry(tarWriter, name, content))
+	}
+
+	assert.NoError(t, tarWriter.Close())
+	assert.NoError(t, gzipWriter.Close())
+
+	return bundle
+}
+
+func exportTestMachine(t *testing.T, includeCerts bool) (*bytes.Buffer, string) {
+	src := getTestStore()
+	defer os.RemoveAll(src.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineDir := filepath.Join(src.GetMachinesDir(), h.Name)
+	h.HostOptions.AuthOptions.StorePath = machineDir
+	h.HostOptions.AuthOptions.ServerCertPath = filepath.Join(machineDir, "server.pem")
+	h.HostOptions.AuthOptions.CaCertPath = filepath.Join(src.Path, "certs", "ca.pem")
+
+	if err := src.Save(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(machineDir, "server.pem"), []byte("server.pem"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle := &bytes.Buffer{}
+	assert.NoError(t, src.Export(h.Name, bundle, includeCerts))
+
+	return bundle, h.Name
+}
+
+func TestImportWithoutCerts(t *testing.T) {
+	defer cleanup()
+
+	bundle, name := exportTestMachine(t, false)
+
+	dest := getTestStore()
+	defer os.RemoveAll(dest.Path)
+
+	_, err := dest.Import(bytes.NewReader(bundle.Bytes()), false, false)
+	assert.Equal(t, ErrBundleWithoutCerts, err)
+
+	exists, err := dest.Exists(name)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = dest.Import(bytes.NewReader(bundle.Bytes()), false, true)
+	assert.NoError(t, err)
+
+	imported, err := dest.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The certificates signed by the other CA are left out.
+	authOptions := imported.HostOptions.AuthOptions
+	assert.Equal(t, filepath.Join(dest.Path, "certs", "ca.pem"), authOptions.CaCertPath)
+	_, err = os.Stat(authOptions.ServerCertPath)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestImportForceKeepsMachineOnError(t *testing.T) {
+	defer cleanup()
+
+	bundle, name := exportTestMachine(t, true)
+
+	dest := getTestStore()
+	defer os.RemoveAll(dest.Path)
+
+	_, err := dest.Import(bytes.NewReader(bundle.Bytes()), false, false)
+	assert.NoError(t, err)
+
+	invalid := writeTestBundle(t, map[string][]byte{
+		bundleManifestFile: []byte(`{"Version": 1, "Name": "` + name + `"}`),
+		bundleConfigFile:   []byte(`{"Name": "other"}`),
+	})
+
+	_, err = dest.Import(invalid, true, false)
+	assert.Error(t, err)
+
+	_, err = dest.Load(name)
+	assert.NoError(t, err)
+
+	// Nothing is left staged.
+	files, err := ioutil.ReadDir(dest.GetMachinesDir())
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+}
+
+func TestImportRejectsLargeEntries(t *testing.T) {
+	defer cleanup()
+
+	dest := getTestStore()
+	defer os.RemoveAll(dest.Path)
+
+	bundle := writeTestBundle(t, map[string][]byte{
+		bundleManifestFile: []byte(`{"Version": 1, "Name": "test"}`),
+		bundleConfigFile:   make([]byte, maxBundleEntrySize+1),
+	})
+
+	_, err := dest.Import(bundle, false, false)
+	assert.EqualError(t, err, `File "config.json" in machine bundle is too large`)
+}
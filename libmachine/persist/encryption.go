@@ -0,0 +1,872 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	encryptionFile    = "encryption.json"
+	encryptionVersion = 1
+
+	// unsealedDir holds the runtime directories of the processes using
+	// the store, with their decrypted keys.
+	unsealedDir      = "unsealed"
+	runtimeLockFile  = ".lock"
+	runtimeSavedFile = "saved"
+
+	// encryptionCheck is sealed in the encryption config, to tell a wrong
+	// passphrase from a damaged secret.
+	encryptionCheck = "docker-machine"
+)
+
+var (
+	ErrStoreLocked       = errors.New("The machine store is encrypted and no passphrase was given to unlock it")
+	ErrWrongPassphrase   = errors.New("Wrong passphrase for the encrypted machine store")
+	ErrStoreNotEncrypted = errors.New("The machine store is not encrypted")
+
+	// scrypt cost parameters of encrypted stores. Stores with other ones
+	// are refused, rather than spending whatever memory and CPU time the
+	// encryption config asks for.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	// keyPathFields are the config fields pointing at private keys.
+	keyPathFields = [][]string{
+		{"Driver", "SSHKeyPath"},
+		{"HostOptions", "AuthOptions", "CaPrivateKeyPath"},
+		{"HostOptions", "AuthOptions", "ServerKeyPath"},
+	}
+)
+
+// Encrypter is implemented by stores which can keep the private keys and
+// driver credentials of their machines encrypted at rest.
+type Encrypter interface {
+	IsEncrypted() bool
+
+	// Encrypt seals the secrets of the store with a key derived from
+	// passphrase, which can be the content of a key file
+	Encrypt(passphrase []byte) error
+
+	// Decrypt turns an encrypted store back into a plaintext one
+	Decrypt() error
+}
+
+type encryptionConfig struct {
+	Version int
+	Salt    []byte
+	N       int
+	R       int
+	P       int
+	Check   string
+}
+
+// Encryption unlocks an encrypted file store and keeps track of the private
+// keys decrypted for the current process. ssh and the certificate code need
+// keys as files, so sealed keys are decrypted into a private directory of
+// the process in the store, which the loaded machines point at, until
+// Close. The directories of processes which didn't get to close the store
+// are cleaned up by the next one to unlock it.
+type Encryption struct {
+	// Passphrase returns the passphrase of the store, or the content of
+	// its key file. It is only called for encrypted stores, the first time
+	// a secret is needed.
+	Passphrase func() ([]byte, error)
+
+	mu         sync.Mutex
+	sealer     *Sealer
+	runtimeDir string
+
+	// runtimeLock is locked as long as the runtime directory is in use.
+	runtimeLock *os.File
+
+	// unsealed maps the decrypted copies of keys to the store files they
+	// were decrypted from.
+	unsealed map[string]*unsealedFile
+
+	// saved are the machines saved by this process, drivers may have
+	// written new keys for them which are sealed on Close.
+	saved map[string]bool
+}
+
+type unsealedFile struct {
+	storePath string
+	content   []byte
+}
+
+func (s Filestore) getEncryptionConfigPath() string {
+	return filepath.Join(s.Path, encryptionFile)
+}
+
+// IsEncrypted returns whether the secrets of the store are sealed.
+func (s Filestore) IsEncrypted() bool {
+	_, err := os.Stat(s.getEncryptionConfigPath())
+	return err == nil
+}
+
+// sealer returns the sealer of an encrypted store, unlocking the store the
+// first time, or nil for a plaintext store.
+func (s Filestore) sealer() (*Sealer, error) {
+	if !s.IsEncrypted() {
+		return nil, nil
+	}
+
+	if s.Encryption == nil {
+		return nil, ErrStoreLocked
+	}
+
+	s.Encryption.mu.Lock()
+	defer s.Encryption.mu.Unlock()
+
+	if s.Encryption.sealer != nil {
+		return s.Encryption.sealer, nil
+	}
+
+	if s.Encryption.Passphrase == nil {
+		return nil, ErrStoreLocked
+	}
+
+	passphrase, err := s.Encryption.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := s.unlock(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Encryption.sealer = sealer
+
+	// Without mu, since sealing machines needs the sealer.
+	s.Encryption.mu.Unlock()
+	s.cleanStaleRuntimeDirs(sealer)
+	s.Encryption.mu.Lock()
+
+	return sealer, nil
+}
+
+func (s Filestore) unlock(passphrase []byte) (*Sealer, error) {
+	data, err := ioutil.ReadFile(s.getEncryptionConfigPath())
+	if err != nil {
+		return nil, err
+	}
+
+	var config encryptionConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Invalid store encryption config: %s", err)
+	}
+
+	if config.Version != encryptionVersion {
+		return nil, fmt.Errorf("Unsupported store encryption version %d", config.Version)
+	}
+
+	if config.N != scryptN || config.R != scryptR || config.P != scryptP {
+		return nil, fmt.Errorf("Unsupported store encryption parameters N=%d, r=%d, p=%d", config.N, config.R, config.P)
+	}
+
+	// A check value in plaintext would be opened as is, whatever the
+	// passphrase.
+	if !isSealedString(config.Check) {
+		return nil, errors.New("Invalid store encryption config: the passphrase check isn't sealed")
+	}
+
+	key, err := DeriveKey(passphrase, config.Salt, config.N, config.R, config.P)
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := NewSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if check, err := sealer.OpenString(config.Check); err != nil || check != encryptionCheck {
+		return nil, ErrWrongPassphrase
+	}
+
+	return sealer, nil
+}
+
+func (s Filestore) createEncryptionConfig(passphrase []byte) (*Sealer, error) {
+	config := encryptionConfig{
+		Version: encryptionVersion,
+		Salt:    make([]byte, 32),
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+	}
+
+	if _, err := io.ReadFull(rand.Reader, config.Salt); err != nil {
+		return nil, err
+	}
+
+	key, err := DeriveKey(passphrase, config.Salt, config.N, config.R, config.P)
+	if err != nil {
+		return nil, err
+	}
+
+	sealer, err := NewSealer(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Check, err = sealer.SealString(encryptionCheck); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(s.Path, 0700); err != nil {
+		return nil, err
+	}
+
+	return sealer, s.saveToFile(data, s.getEncryptionConfigPath())
+}
+
+// Encrypt turns the store into an encrypted one, or seals the secrets
+// left in plaintext if it already is encrypted with this passphrase.
+func (s Filestore) Encrypt(passphrase []byte) error {
+	var (
+		sealer *Sealer
+		err    error
+	)
+
+	if s.IsEncrypted() {
+		sealer, err = s.unlock(passphrase)
+	} else {
+		sealer, err = s.createEncryptionConfig(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	if s.Encryption != nil {
+		s.Encryption.mu.Lock()
+		s.Encryption.sealer = sealer
+		s.Encryption.mu.Unlock()
+	}
+
+	err = s.forEachMachine(func(name string) error {
+		return s.sealMachine(name, sealer)
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sealFile(s.getCaPrivateKeyPath(), sealer)
+}
+
+// Decrypt writes the secrets of an encrypted store back in plaintext.
+func (s Filestore) Decrypt() error {
+	sealer, err := s.sealer()
+	if err != nil {
+		return err
+	}
+
+	if sealer == nil {
+		return ErrStoreNotEncrypted
+	}
+
+	err = s.forEachMachine(func(name string) error {
+		return s.openMachine(name, sealer)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.openFile(s.getCaPrivateKeyPath(), sealer); err != nil {
+		return err
+	}
+
+	// Last, so that an interrupted decryption can be run again.
+	return os.Remove(s.getEncryptionConfigPath())
+}
+
+// Close seals the keys written for the machines saved by this process and
+// removes the decrypted copies of keys.
+func (s Filestore) Close() error {
+	if s.Encryption == nil {
+		return nil
+	}
+
+	e := s.Encryption
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.sealer != nil && s.IsEncrypted() {
+		nowait := s
+		nowait.LockTimeout = 0
+
+		for name := range e.saved {
+			// Whoever holds the lock saves the machine again later on.
+			lock, err := nowait.LockMachine(name)
+			if err != nil {
+				continue
+			}
+
+			err = s.sealMachine(name, e.sealer)
+			lock.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	e.saved = nil
+	e.unsealed = nil
+
+	if e.runtimeDir == "" {
+		return nil
+	}
+
+	dir := e.runtimeDir
+	e.runtimeDir = ""
+
+	unlockFile(e.runtimeLock)
+	e.runtimeLock.Close()
+	e.runtimeLock = nil
+
+	return os.RemoveAll(dir)
+}
+
+func (s Filestore) getUnsealedDir() string {
+	return filepath.Join(s.Path, unsealedDir)
+}
+
+// createRuntimeDir creates the directory of this process for decrypted keys,
+// which is locked until Close. It must be called with mu held.
+func (s Filestore) createRuntimeDir() error {
+	e := s.Encryption
+	if e.runtimeDir != "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(s.getUnsealedDir(), 0700); err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir(s.getUnsealedDir(), fmt.Sprintf("%d-", os.Getpid()))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, runtimeLockFile), os.O_RDWR|os.O_CREATE, 0600)
+	if err == nil {
+		var locked bool
+		if locked, err = tryLockFile(f, false); err == nil && !locked {
+			err = fmt.Errorf("Unable to lock %s", f.Name())
+		}
+		if err != nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	e.runtimeDir = dir
+	e.runtimeLock = f
+
+	return nil
+}
+
+// recordSaved notes a machine saved by this process in its runtime
+// directory, for its new keys to be sealed even if the process doesn't get
+// to close the store. It must be called with mu held.
+func (s Filestore) recordSaved(name string) error {
+	if err := s.createRuntimeDir(); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filepath.Join(s.Encryption.runtimeDir, runtimeSavedFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(f, name); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// cleanStaleRuntimeDirs removes the decrypted keys of the processes which
+// exited without closing the store, e.g. because they were killed, and
+// seals the keys written for the machines they saved.
+func (s Filestore) cleanStaleRuntimeDirs(sealer *Sealer) {
+	dirs, err := ioutil.ReadDir(s.getUnsealedDir())
+	if err != nil {
+		return
+	}
+
+	nowait := s
+	nowait.LockTimeout = 0
+
+	for _, dir := range dirs {
+		path := filepath.Join(s.getUnsealedDir(), dir.Name())
+
+		f, err := os.OpenFile(filepath.Join(path, runtimeLockFile), os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			continue
+		}
+
+		if locked, err := tryLockFile(f, false); err != nil || !locked {
+			f.Close()
+			continue
+		}
+
+		saved, _ := ioutil.ReadFile(filepath.Join(path, runtimeSavedFile))
+		for _, name := range strings.Fields(string(saved)) {
+			lock, err := nowait.LockMachine(name)
+			if err != nil {
+				continue
+			}
+
+			if err := s.sealMachine(name, sealer); err != nil {
+				log.Debugf("Unable to seal the keys of %s: %s", name, err)
+			}
+			lock.Unlock()
+		}
+
+		unlockFile(f)
+		f.Close()
+
+		if err := os.RemoveAll(path); err != nil {
+			log.Debugf("Unable to remove %s: %s", path, err)
+		}
+	}
+}
+
+func (s Filestore) getCaPrivateKeyPath() string {
+	return filepath.Join(s.Path, "certs", "ca-key.pem")
+}
+
+func (s Filestore) forEachMachine(fn func(name string) error) error {
+	names, err := s.List()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		lock, err := s.LockMachine(name)
+		if err != nil {
+			return err
+		}
+
+		err = fn(name)
+		lock.Unlock()
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// machineConfigFiles returns the config of a machine along with its
+// revisions and migration backup, which hold the same secrets.
+func (s Filestore) machineConfigFiles(name string) []string {
+	configPath := filepath.Join(s.GetMachinesDir(), name, "config.json")
+
+	files := []string{configPath}
+	files = append(files, s.GetRevisions(name)...)
+
+	if _, err := os.Stat(configPath + ".bak"); err == nil {
+		files = append(files, configPath+".bak")
+	}
+
+	return files
+}
+
+// sealMachine seals the driver credentials in the configs of a machine and
+// the private keys it refers to.
+func (s Filestore) sealMachine(name string, sealer *Sealer) error {
+	return s.transformMachine(name, sealer.SealString, func(path string) error {
+		return s.sealFile(path, sealer)
+	})
+}
+
+func (s Filestore) openMachine(name string, sealer *Sealer) error {
+	return s.transformMachine(name, sealer.OpenString, func(path string) error {
+		return s.openFile(path, sealer)
+	})
+}
+
+func (s Filestore) transformMachine(name string, transformSecret func(string) (string, error), transformKey func(string) error) error {
+	if err := s.transformSecretsFile(name, transformSecret); err != nil {
+		return err
+	}
+
+	for _, file := range s.machineConfigFiles(name) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		config, err := decodeConfig(data)
+		if err != nil {
+			// Broken configs are for fsck to deal with.
+			continue
+		}
+
+		changed, err := transformSecrets(config, transformSecret)
+		if err != nil {
+			return err
+		}
+
+		if file == filepath.Join(s.GetMachinesDir(), name, "config.json") {
+			for _, path := range s.keyPaths(name, config) {
+				if err := transformKey(path); err != nil {
+					return err
+				}
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		if data, err = json.MarshalIndent(config, "", "    "); err != nil {
+			return err
+		}
+
+		if err := s.saveToFile(data, file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// keyPaths returns the private keys referred to by a machine config which
+// live in the store. Keys elsewhere belong to the user and are left alone.
+func (s Filestore) keyPaths(name string, config map[string]interface{}) []string {
+	paths := []string{}
+
+	for _, field := range keyPathFields {
+		path, _ := configString(config, field...)
+		if path == "" && field[len(field)-1] == "SSHKeyPath" {
+			path = filepath.Join(s.GetMachinesDir(), name, "id_rsa")
+		}
+
+		if relPath, ok := rebasePath(path, s.Path, ""); ok && relPath != "" {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths
+}
+
+func (s Filestore) sealFile(path string, sealer *Sealer) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || isSealedFile(content) {
+		return err
+	}
+
+	sealed, err := sealer.SealFile(content)
+	if err != nil {
+		return err
+	}
+
+	return s.saveToFile(sealed, path)
+}
+
+func (s Filestore) openFile(path string, sealer *Sealer) error {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil || !isSealedFile(content) {
+		return err
+	}
+
+	plaintext, err := sealer.OpenFile(content)
+	if err != nil {
+		return err
+	}
+
+	return s.saveToFile(plaintext, path)
+}
+
+// unsealConfig decrypts the credentials of a machine config read from an
+// encrypted store, and points it at decrypted copies of its keys.
+func (s Filestore) unsealConfig(name string, data []byte) ([]byte, error) {
+	sealer, err := s.sealer()
+	if err != nil || sealer == nil {
+		return data, err
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := transformSecrets(config, sealer.OpenString); err != nil {
+		return nil, err
+	}
+
+	for _, field := range keyPathFields {
+		path, ok := configString(config, field...)
+		if !ok {
+			continue
+		}
+		if path == "" && field[len(field)-1] == "SSHKeyPath" {
+			path = filepath.Join(s.GetMachinesDir(), name, "id_rsa")
+		}
+
+		runtimePath, err := s.unsealKey(path, sealer, false)
+		if err != nil {
+			return nil, err
+		}
+
+		setConfigString(config, runtimePath, field...)
+	}
+
+	return json.MarshalIndent(config, "", "    ")
+}
+
+// unsealKey returns the decrypted copy of a sealed key, or path itself if
+// it is in plaintext, unless moving plaintext keys out of the store is asked.
+func (s Filestore) unsealKey(path string, sealer *Sealer, moveOut bool) (string, error) {
+	e := s.Encryption
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.unsealed[path]; ok {
+		return path, nil
+	}
+
+	for runtimePath, f := range e.unsealed {
+		if f.storePath == path {
+			return runtimePath, nil
+		}
+	}
+
+	relPath, ok := rebasePath(path, s.Path, "")
+	if !ok || relPath == "" {
+		return path, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return path, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sealed := isSealedFile(content)
+	if !sealed && !moveOut {
+		return path, nil
+	}
+
+	plaintext, err := sealer.OpenFile(content)
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting %s: %s", path, err)
+	}
+
+	if err := s.createRuntimeDir(); err != nil {
+		return "", err
+	}
+
+	runtimePath := filepath.Join(e.runtimeDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(runtimePath), 0700); err != nil {
+		return "", err
+	}
+
+	if err := ioutil.WriteFile(runtimePath, plaintext, 0600); err != nil {
+		return "", err
+	}
+
+	if e.unsealed == nil {
+		e.unsealed = map[string]*unsealedFile{}
+	}
+
+	e.unsealed[runtimePath] = &unsealedFile{
+		storePath: path,
+		content:   plaintext,
+	}
+
+	if !sealed {
+		if err := s.sealFile(path, sealer); err != nil {
+			return "", err
+		}
+	}
+
+	return runtimePath, nil
+}
+
+// unsealAuthKeys points the certificate keys of a machine saved to an
+// encrypted store at decrypted copies, the same way they are on load, and
+// seals the keys which were written to the store in plaintext. The keys
+// are moved before the config is written since provisioning still needs
+// them.
+func (s Filestore) unsealAuthKeys(h *host.Host, sealer *Sealer) error {
+	authOptions := h.AuthOptions()
+	if authOptions == nil {
+		return nil
+	}
+
+	for _, path := range []*string{&authOptions.CaPrivateKeyPath, &authOptions.ServerKeyPath} {
+		runtimePath, err := s.unsealKey(*path, sealer, true)
+		if err != nil {
+			return err
+		}
+		*path = runtimePath
+	}
+
+	return nil
+}
+
+// sealConfig prepares the config of a machine saved to an encrypted store:
+// decrypted copies of keys which changed are sealed back into the store,
+// the config points at the store files again and its credentials are
+// sealed.
+func (s Filestore) sealConfig(name string, config map[string]interface{}, sealer *Sealer) error {
+	if err := s.syncUnsealed(sealer); err != nil {
+		return err
+	}
+
+	s.Encryption.mu.Lock()
+	rebaseStrings(config, func(value string) string {
+		if f, ok := s.Encryption.unsealed[value]; ok {
+			return f.storePath
+		}
+		return value
+	})
+
+	if s.Encryption.saved == nil {
+		s.Encryption.saved = map[string]bool{}
+	}
+	if !s.Encryption.saved[name] {
+		if err := s.recordSaved(name); err != nil {
+			s.Encryption.mu.Unlock()
+			return err
+		}
+		s.Encryption.saved[name] = true
+	}
+	s.Encryption.mu.Unlock()
+
+	_, err := transformSecrets(config, sealer.SealString)
+	return err
+}
+
+// syncUnsealed seals the decrypted copies of keys which were changed, e.g.
+// by regenerate-certs, back into the store.
+func (s Filestore) syncUnsealed(sealer *Sealer) error {
+	s.Encryption.mu.Lock()
+	defer s.Encryption.mu.Unlock()
+
+	for runtimePath, f := range s.Encryption.unsealed {
+		content, err := ioutil.ReadFile(runtimePath)
+		if err != nil || bytes.Equal(content, f.content) {
+			continue
+		}
+
+		sealed, err := sealer.SealFile(content)
+		if err != nil {
+			return err
+		}
+
+		if err := s.saveToFile(sealed, f.storePath); err != nil {
+			return err
+		}
+
+		f.content = content
+	}
+
+	return nil
+}
+
+// transformSecrets applies transform to the credentials of the driver of a
+// machine config, the fields listed in its SecretFields, and returns
+// whether any of them changed.
+func transformSecrets(config map[string]interface{}, transform func(string) (string, error)) (bool, error) {
+	changed := false
+
+	for _, field := range configSecretFields(config) {
+		path := secretFieldPath(field)
+
+		secret, ok := configString(config, path...)
+		if !ok || secret == "" {
+			continue
+		}
+
+		transformed, err := transform(secret)
+		if err != nil {
+			return false, fmt.Errorf("Error with driver field %s: %s", field, err)
+		}
+
+		if transformed != secret {
+			setConfigString(config, transformed, path...)
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+func decodeConfig(data []byte) (map[string]interface{}, error) {
+	var config map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func configString(config map[string]interface{}, fields ...string) (string, bool) {
+	var value interface{} = config
+
+	for _, field := range fields {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		if value, ok = object[field]; !ok {
+			return "", false
+		}
+	}
+
+	str, ok := value.(string)
+	return str, ok
+}
+
+func setConfigString(config map[string]interface{}, value string, fields ...string) {
+	object := config
+
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := object[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = next
+	}
+
+	object[fields[len(fields)-1]] = value
+}
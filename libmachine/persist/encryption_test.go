@@ -0,0 +1,250 @@
+package persist
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/drivers/none"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealer(t *testing.T) {
+	sealer, err := NewSealer(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := sealer.SealString("secret")
+	assert.NoError(t, err)
+	assert.True(t, isSealedString(sealed))
+
+	opened, err := sealer.OpenString(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", opened)
+
+	opened, err = sealer.OpenString("plaintext")
+	assert.NoError(t, err)
+	assert.Equal(t, "plaintext", opened)
+
+	sealedFile, err := sealer.SealFile([]byte("key"))
+	assert.NoError(t, err)
+	assert.True(t, isSealedFile(sealedFile))
+
+	openedFile, err := sealer.OpenFile(sealedFile)
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(openedFile))
+
+	other, _ := NewSealer([]byte(strings.Repeat("k", 32)))
+	_, err = other.OpenString(sealed)
+	assert.Equal(t, ErrUnsealFailed, err)
+}
+
+func getTestEncryptedStore(path, passphrase string) Filestore {
+	return Filestore{
+		Path: path,
+		Encryption: &Encryption{
+			Passphrase: func() ([]byte, error) {
+				return []byte(passphrase), nil
+			},
+		},
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	defer cleanup()
+
+	defaultScryptN := scryptN
+	scryptN = 1 << 10
+	defer func() { scryptN = defaultScryptN }()
+
+	plain := getTestStore()
+	defer os.RemoveAll(plain.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineDir := filepath.Join(plain.GetMachinesDir(), h.Name)
+	sshKeyPath := filepath.Join(machineDir, "id_rsa")
+	caKeyPath := filepath.Join(plain.Path, "certs", "ca-key.pem")
+
+	h.HostOptions.AuthOptions.CaPrivateKeyPath = caKeyPath
+	h.HostOptions.AuthOptions.ServerKeyPath = filepath.Join(machineDir, "server-key.pem")
+	h.Driver = &host.RawDataDriver{
+		Driver: none.NewDriver(h.Name, plain.Path),
+		Data:   []byte(`{"MachineName": "test-host", "AccessToken": "t0ps3cret", "SSHKeyPath": "` + filepath.ToSlash(sshKeyPath) + `"}`),
+	}
+	h.SecretFields = []string{"AccessToken"}
+
+	assert.NoError(t, plain.Save(h))
+
+	assert.NoError(t, os.MkdirAll(filepath.Dir(caKeyPath), 0700))
+	assert.NoError(t, ioutil.WriteFile(sshKeyPath, []byte("ssh key"), 0600))
+	assert.NoError(t, ioutil.WriteFile(caKeyPath, []byte("ca key"), 0600))
+
+	assert.NoError(t, plain.Encrypt([]byte("passphrase")))
+	assert.True(t, plain.IsEncrypted())
+
+	configPath := filepath.Join(machineDir, "config.json")
+	assert.NotContains(t, readTestFile(t, configPath), "t0ps3cret")
+	assert.NotContains(t, readTestFile(t, filepath.Join(machineDir, secretsFile)), "t0ps3cret")
+	assert.True(t, isSealedFile([]byte(readTestFile(t, sshKeyPath))))
+	assert.True(t, isSealedFile([]byte(readTestFile(t, caKeyPath))))
+
+	_, err = getTestEncryptedStore(plain.Path, "wrong").Load(h.Name)
+	assert.EqualError(t, err, "Error decrypting config: "+ErrWrongPassphrase.Error())
+
+	_, err = Filestore{Path: plain.Path}.Load(h.Name)
+	assert.EqualError(t, err, "Error decrypting config: "+ErrStoreLocked.Error())
+
+	store := getTestEncryptedStore(plain.Path, "passphrase")
+
+	loaded, err := store.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(loaded.RawDriver), "t0ps3cret")
+
+	// The loaded machine uses decrypted copies of its keys, in the private
+	// directory of the process, outside of the machines.
+	runtimeKeyPath := driverSSHKeyPath(loaded.RawDriver)
+	assert.True(t, strings.HasPrefix(runtimeKeyPath, filepath.Join(plain.Path, unsealedDir)+string(filepath.Separator)))
+	assert.NotEqual(t, sshKeyPath, runtimeKeyPath)
+	assert.Equal(t, "ssh key", readTestFile(t, runtimeKeyPath))
+
+	runtimeCaKeyPath := loaded.HostOptions.AuthOptions.CaPrivateKeyPath
+	assert.NotEqual(t, caKeyPath, runtimeCaKeyPath)
+	assert.Equal(t, "ca key", readTestFile(t, runtimeCaKeyPath))
+
+	// Keys changed through the copies are sealed back on save, and the
+	// config keeps pointing at the store.
+	assert.NoError(t, ioutil.WriteFile(runtimeCaKeyPath, []byte("new ca key"), 0600))
+	assert.NoError(t, store.Save(loaded))
+
+	config := readTestFile(t, configPath)
+	assert.NotContains(t, config, "t0ps3cret")
+	assert.NotContains(t, config, filepath.Dir(runtimeKeyPath))
+	assert.True(t, isSealedFile([]byte(readTestFile(t, caKeyPath))))
+
+	assert.NoError(t, store.Close())
+	_, err = os.Stat(runtimeKeyPath)
+	assert.True(t, os.IsNotExist(err))
+
+	store = getTestEncryptedStore(plain.Path, "passphrase")
+	assert.NoError(t, store.Decrypt())
+	assert.False(t, store.IsEncrypted())
+
+	assert.Contains(t, readTestFile(t, filepath.Join(machineDir, secretsFile)), "t0ps3cret")
+	assert.Equal(t, "ssh key", readTestFile(t, sshKeyPath))
+	assert.Equal(t, "new ca key", readTestFile(t, caKeyPath))
+	assert.NoError(t, store.Close())
+}
+
+func TestEncryptedStoreCleansStaleRuntimeDirs(t *testing.T) {
+	defer cleanup()
+
+	defaultScryptN := scryptN
+	scryptN = 1 << 10
+	defer func() { scryptN = defaultScryptN }()
+
+	plain := getTestStore()
+	defer os.RemoveAll(plain.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sshKeyPath := filepath.Join(plain.GetMachinesDir(), h.Name, "id_rsa")
+	h.Driver = &host.RawDataDriver{
+		Driver: none.NewDriver(h.Name, plain.Path),
+		Data:   []byte(`{"MachineName": "test-host", "SSHKeyPath": "` + filepath.ToSlash(sshKeyPath) + `"}`),
+	}
+
+	assert.NoError(t, plain.Save(h))
+	assert.NoError(t, ioutil.WriteFile(sshKeyPath, []byte("ssh key"), 0600))
+	assert.NoError(t, plain.Encrypt([]byte("passphrase")))
+
+	crashed := getTestEncryptedStore(plain.Path, "passphrase")
+
+	loaded, err := crashed.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, crashed.Save(loaded))
+
+	// A new key is written in the machine directory, and the process
+	// exits without closing the store.
+	assert.NoError(t, ioutil.WriteFile(sshKeyPath, []byte("new ssh key"), 0600))
+	runtimeDir := crashed.Encryption.runtimeDir
+	crashed.Encryption.runtimeLock.Close()
+
+	// Directories of running processes are left alone.
+	running := getTestEncryptedStore(plain.Path, "passphrase")
+	_, err = running.Load(h.Name)
+	assert.NoError(t, err)
+
+	store := getTestEncryptedStore(plain.Path, "passphrase")
+	_, err = store.Load(h.Name)
+	assert.NoError(t, err)
+
+	_, err = os.Stat(runtimeDir)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(running.Encryption.runtimeDir)
+	assert.NoError(t, err)
+	assert.True(t, isSealedFile([]byte(readTestFile(t, sshKeyPath))))
+
+	assert.NoError(t, running.Close())
+	assert.NoError(t, store.Close())
+}
+
+func TestEncryptedStoreRefusesInvalidConfig(t *testing.T) {
+	defer cleanup()
+
+	defaultScryptN := scryptN
+	scryptN = 1 << 10
+	defer func() { scryptN = defaultScryptN }()
+
+	store := getTestStore()
+	defer os.RemoveAll(store.Path)
+
+	assert.NoError(t, store.Encrypt([]byte("passphrase")))
+
+	configPath := store.getEncryptionConfigPath()
+	valid := readTestFile(t, configPath)
+
+	var config encryptionConfig
+	assert.NoError(t, json.Unmarshal([]byte(valid), &config))
+
+	config.N = 1 << 30
+	data, _ := json.Marshal(config)
+	assert.NoError(t, ioutil.WriteFile(configPath, data, 0600))
+
+	_, err := store.unlock([]byte("passphrase"))
+	assert.EqualError(t, err, "Unsupported store encryption parameters N=1073741824, r=8, p=1")
+
+	// A plaintext check value would accept any passphrase.
+	assert.NoError(t, json.Unmarshal([]byte(valid), &config))
+	config.Check = encryptionCheck
+	data, _ = json.Marshal(config)
+	assert.NoError(t, ioutil.WriteFile(configPath, data, 0600))
+
+	_, err = store.unlock([]byte("wrong"))
+	assert.EqualError(t, err, "Invalid store encryption config: the passphrase check isn't sealed")
+}
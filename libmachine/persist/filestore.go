@@ -7,15 +7,45 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/mcnerror"
 )
 
+const (
+	// DefaultRevisions is the number of previous config revisions kept
+	// for each machine.
+	DefaultRevisions = 3
+)
+
 type Filestore struct {
 	Path             string
 	CaCertPath       string
 	CaPrivateKeyPath string
+
+	// Revisions is the number of previous versions of each machine's
+	// config kept next to it.
+	Revisions int
+
+	// LockTimeout is how long to wait for a lock held by another process.
+	LockTimeout time.Duration
+
+	// LockCommand describes the operation holding our locks, so that other
+	// processes can report what they are waiting on.
+	LockCommand string
+
+	// Encryption unlocks the store if its secrets are encrypted.
+	Encryption *Encryption
+
+	// CredentialHelper is the docker-credential-* helper the driver
+	// credentials of new machines are kept with, e.g. "osxkeychain". They
+	// are kept in a secrets file next to the config otherwise.
+	CredentialHelper string
+
+	// backend is the backend of the remote store this store is the cache
+	// of, if it can lock keys. Its locks are taken along with ours.
+	backend BackendLocker
 }
 
 func NewFilestore(path, caCertPath, caPrivateKeyPath string) *Filestore {
@@ -23,6 +53,9 @@ func NewFilestore(path, caCertPath, caPrivateKeyPath string) *Filestore {
 		Path:             path,
 		CaCertPath:       caCertPath,
 		CaPrivateKeyPath: caPrivateKeyPath,
+		Revisions:        DefaultRevisions,
+		LockTimeout:      DefaultLockTimeout,
+		Encryption:       &Encryption{},
 	}
 }
 
@@ -30,18 +63,106 @@ func (s Filestore) GetMachinesDir() string {
 	return filepath.Join(s.Path, "machines")
 }
 
-func (s Filestore) saveToFile(data []byte, file string) error {
-	if _, err := os.Stat(file); os.IsNotExist(err) {
-		return ioutil.WriteFile(file, data, 0600)
+func (s Filestore) getLocksDir() string {
+	return filepath.Join(s.Path, "locks")
+}
+
+func (s Filestore) getMachineLockPath(name string) string {
+	return filepath.Join(s.getLocksDir(), name+".lock")
+}
+
+func (s Filestore) getStoreLockPath() string {
+	return filepath.Join(s.getLocksDir(), ".store.lock")
+}
+
+// LockMachine takes the advisory lock of a single machine, holding the store
+// lock shared. The machine doesn't need to exist yet, which lets create
+// reserve a name.
+func (s Filestore) LockMachine(name string) (*Lock, error) {
+	if !host.ValidateHostName(name) {
+		return nil, mcnerror.ErrInvalidHostname
 	}
 
-	tmpfi, err := ioutil.TempFile(filepath.Dir(file), "config.json.tmp")
+	storeLock, err := acquireLock(lockRequest{
+		path:    s.getStoreLockPath(),
+		command: s.lockCommand(),
+		timeout: s.LockTimeout,
+		shared:  true,
+		remote:  s.remoteLock("", backendStoreLockKey, true),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := acquireLock(lockRequest{
+		name:    name,
+		path:    s.getMachineLockPath(name),
+		command: s.lockCommand(),
+		timeout: s.LockTimeout,
+		remote:  s.remoteLock(name, machineKey(name, ""), false),
+	})
+	if err != nil {
+		storeLock.Unlock()
+		return nil, err
+	}
+
+	lock.store = storeLock
+	return lock, nil
+}
+
+// LockStore takes the advisory lock of the whole store, which waits for the
+// machine locks of other processes to be released. It has to be taken
+// before any machine lock.
+func (s Filestore) LockStore() (*Lock, error) {
+	return acquireLock(lockRequest{
+		path:    s.getStoreLockPath(),
+		command: s.lockCommand(),
+		timeout: s.LockTimeout,
+		remote:  s.remoteLock("", backendStoreLockKey, false),
+	})
+}
+
+// remoteLock returns how to take the lock of key in the backend of the
+// remote store we're the cache of, if any.
+func (s Filestore) remoteLock(name, key string, shared bool) func() (func() error, error) {
+	if s.backend == nil {
+		return nil
+	}
+
+	return func() (func() error, error) {
+		unlock, err := s.backend.LockKey(key, shared, s.lockCommand(), s.LockTimeout)
+		if locked, ok := err.(ErrLocked); ok {
+			locked.Name = name
+			return nil, locked
+		}
+		return unlock, err
+	}
+}
+
+func (s Filestore) lockCommand() string {
+	if s.LockCommand == "" {
+		return "docker-machine"
+	}
+	return s.LockCommand
+}
+
+// saveToFile atomically replaces file with data: the data is synced to a
+// temporary file in the same directory which is then renamed over file, so
+// readers see either the old or the new content, never a partial write.
+func (s Filestore) saveToFile(data []byte, file string) error {
+	tmpfi, err := ioutil.TempFile(filepath.Dir(file), filepath.Base(file)+".tmp")
 	if err != nil {
 		return err
 	}
 	defer os.Remove(tmpfi.Name())
 
-	if err = ioutil.WriteFile(tmpfi.Name(), data, 0600); err != nil {
+	if _, err = tmpfi.Write(data); err != nil {
+		tmpfi.Close()
+		return err
+	}
+
+	if err = tmpfi.Sync(); err != nil {
+		tmpfi.Close()
 		return err
 	}
 
@@ -49,19 +170,74 @@ func (s Filestore) saveToFile(data []byte, file string) error {
 		return err
 	}
 
-	if err = os.Remove(file); err != nil {
+	if err = os.Chmod(tmpfi.Name(), 0600); err != nil {
 		return err
 	}
 
-	err = os.Rename(tmpfi.Name(), file)
-	return err
+	return os.Rename(tmpfi.Name(), file)
+}
+
+// saveRevision keeps the current content of file as its most recent
+// revision, shifting older revisions and dropping the oldest one.
+func (s Filestore) saveRevision(file string) error {
+	if s.Revisions <= 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+
+	os.Remove(revisionPath(file, s.Revisions))
+	for i := s.Revisions - 1; i > 0; i-- {
+		if err := os.Rename(revisionPath(file, i), revisionPath(file, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return copyFile(file, revisionPath(file, 1))
+}
+
+func revisionPath(file string, revision int) string {
+	return fmt.Sprintf("%s.%d", file, revision)
+}
+
+func copyFile(src, dst string) error {
+	// Hard links are cheap and atomic, only copy where they aren't supported.
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, data, 0600)
+}
+
+// GetRevisions returns the paths of the saved revisions of a machine's
+// config, most recent first.
+func (s Filestore) GetRevisions(name string) []string {
+	configPath := filepath.Join(s.GetMachinesDir(), name, "config.json")
+
+	revisions := []string{}
+	for i := 1; ; i++ {
+		if _, err := os.Stat(revisionPath(configPath, i)); err != nil {
+			break
+		}
+		revisions = append(revisions, revisionPath(configPath, i))
+	}
+
+	return revisions
 }
 
 func (s Filestore) Save(host *host.Host) error {
-	data, err := json.MarshalIndent(host, "", "    ")
+	lock, err := s.LockMachine(host.Name)
 	if err != nil {
 		return err
 	}
+	defer lock.Unlock()
 
 	hostPath := filepath.Join(s.GetMachinesDir(), host.Name)
 
@@ -70,12 +246,138 @@ func (s Filestore) Save(host *host.Host) error {
 		return err
 	}
 
-	return s.saveToFile(data, filepath.Join(hostPath, "config.json"))
+	data, err := s.marshalHost(host)
+	if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(hostPath, "config.json")
+	if err := s.saveRevision(configPath); err != nil {
+		return fmt.Errorf("Error saving config revision: %s", err)
+	}
+
+	if err := s.saveToFile(data, configPath); err != nil {
+		return err
+	}
+
+	// The configs saved before the credentials of the machine were moved
+	// out, such as the one just kept as a revision, still hold them.
+	if err := s.scrubSecrets(host.Name, host.SecretFields); err != nil {
+		return fmt.Errorf("Error removing secrets from config revisions: %s", err)
+	}
+
+	return nil
+}
+
+func (s Filestore) Touch(name string) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	configPath := filepath.Join(s.GetMachinesDir(), name, "config.json")
+
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	// The metadata is never sealed, the config is updated as it is.
+	config, err := decodeConfig(data)
+	if err != nil {
+		return err
+	}
+
+	metadata, ok := config["Metadata"].(map[string]interface{})
+	if !ok {
+		metadata = map[string]interface{}{
+			"Version": host.MachineMetadataVersion,
+		}
+		config["Metadata"] = metadata
+	}
+	metadata["LastUsed"] = time.Now().UTC()
+
+	if data, err = json.MarshalIndent(config, "", "    "); err != nil {
+		return err
+	}
+
+	return s.saveToFile(data, configPath)
+}
+
+// ConfigStamp returns the modification time and size of the config of a
+// machine.
+func (s Filestore) ConfigStamp(name string) (string, error) {
+	fi, err := os.Stat(filepath.Join(s.GetMachinesDir(), name, "config.json"))
+	if os.IsNotExist(err) {
+		return "", mcnerror.ErrHostDoesNotExist{
+			Name: name,
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%d-%d", fi.ModTime().UnixNano(), fi.Size()), nil
+}
+
+// marshalHost encodes the config of a machine. Its credentials are moved
+// out to its secrets, and in an encrypted store the rest is sealed.
+func (s Filestore) marshalHost(h *host.Host) ([]byte, error) {
+	sealer, err := s.sealer()
+	if err != nil {
+		return nil, err
+	}
+
+	if sealer != nil {
+		if err := s.unsealAuthKeys(h, sealer); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.MarshalIndent(h, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+
+	if sealer == nil && len(h.SecretFields) == 0 && !s.hasSecrets(h.Name) {
+		return data, nil
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.extractSecrets(h.Name, config, sealer); err != nil {
+		return nil, err
+	}
+
+	if sealer != nil {
+		if err := s.sealConfig(h.Name, config, sealer); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.MarshalIndent(config, "", "    ")
 }
 
 func (s Filestore) Remove(name string) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	s.eraseSecrets(name)
+
 	hostPath := filepath.Join(s.GetMachinesDir(), name)
-	return os.RemoveAll(hostPath)
+	if err := os.RemoveAll(hostPath); err != nil {
+		return err
+	}
+
+	removeLockFile(s.getMachineLockPath(name))
+	return nil
 }
 
 func (s Filestore) List() ([]string, error) {
@@ -117,7 +419,17 @@ func (s Filestore) loadConfig(h *host.Host) error {
 	// struct in the migration.
 	name := h.Name
 
-	migratedHost, migrationPerformed, err := host.MigrateHost(h, data)
+	// The backup below keeps the config as it was on disk, still sealed.
+	unsealedData, err := s.unsealConfig(name, data)
+	if err != nil {
+		return fmt.Errorf("Error decrypting config: %s", err)
+	}
+
+	if unsealedData, err = s.mergeSecrets(name, unsealedData); err != nil {
+		return fmt.Errorf("Error reading secrets: %s", err)
+	}
+
+	migratedHost, migrationPerformed, err := host.MigrateHost(h, unsealedData)
 	if err != nil {
 		return fmt.Errorf("Error getting migrated host: %s", err)
 	}
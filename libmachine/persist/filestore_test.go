@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"testing"
+	"time"
 
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/drivers/none"
@@ -247,3 +248,87 @@ func TestStoreLoad(t *testing.T) {
 		t.Fatalf("GetURL is not %q, got %q", expectedURL, actualURL)
 	}
 }
+
+func TestStoreTouch(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	store.Revisions = 2
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Metadata = host.NewMachineMetadata()
+	h.Metadata.LastUsed = h.Metadata.LastUsed.Add(-time.Hour)
+
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Touch(h.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if revisions := store.GetRevisions(h.Name); len(revisions) != 0 {
+		t.Fatalf("Expected no config revision after a touch, got %v", revisions)
+	}
+
+	loaded, err := store.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !loaded.Metadata.LastUsed.After(h.Metadata.LastUsed) {
+		t.Fatalf("Expected the last use to be updated, got %s", loaded.Metadata.LastUsed)
+	}
+	if !loaded.Metadata.Created.Equal(h.Metadata.Created) {
+		t.Fatalf("Expected the creation time to be kept, got %s", loaded.Metadata.Created)
+	}
+}
+
+func TestStoreConfigStamp(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.ConfigStamp(h.Name); err == nil {
+		t.Fatal("Expected an error for a machine which doesn't exist")
+	}
+
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	stamp, err := store.ConfigStamp(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unchanged, err := store.ConfigStamp(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged != stamp {
+		t.Fatalf("Expected the stamp to be kept, got %s and %s", stamp, unchanged)
+	}
+
+	h.HostOptions.EngineOptions.Labels = []string{"changed=yes"}
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := store.ConfigStamp(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed == stamp {
+		t.Fatalf("Expected the stamp to change after a save, got %s", changed)
+	}
+}
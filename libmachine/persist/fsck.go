@@ -0,0 +1,161 @@
+package persist
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/host"
+)
+
+var (
+	ErrNoGoodRevision = errors.New("No valid config revision to roll back to")
+)
+
+// Checker is implemented by stores which can validate the configuration of
+// their machines and repair it.
+type Checker interface {
+	// Check validates the stored configuration of a machine
+	Check(name string) CheckResult
+
+	// Rollback restores the most recent valid revision of a machine's
+	// configuration and returns the path it was restored from
+	Rollback(name string) (string, error)
+}
+
+// CheckResult describes what is wrong with a machine's configuration.
+type CheckResult struct {
+	Name string
+
+	// ConfigErr is set when the config itself can't be loaded. Rolling back
+	// to a previous revision may fix it.
+	ConfigErr error
+
+	// Problems lists the issues found in a config which does load, such as
+	// missing certificates.
+	Problems []string
+}
+
+func (r CheckResult) OK() bool {
+	return r.ConfigErr == nil && len(r.Problems) == 0
+}
+
+func (s Filestore) Check(name string) CheckResult {
+	result := CheckResult{
+		Name: name,
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.GetMachinesDir(), name, "config.json"))
+	if err != nil {
+		result.ConfigErr = err
+		return result
+	}
+
+	h, err := validateConfig(name, data)
+	if err != nil {
+		result.ConfigErr = err
+		return result
+	}
+
+	result.Problems = checkCertPaths(h)
+
+	return result
+}
+
+func (s Filestore) Rollback(name string) (string, error) {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Unlock()
+
+	for _, revision := range s.GetRevisions(name) {
+		data, err := ioutil.ReadFile(revision)
+		if err != nil {
+			continue
+		}
+
+		if _, err := validateConfig(name, data); err != nil {
+			continue
+		}
+
+		// Don't go through Save, which would turn the broken config into
+		// the most recent revision.
+		if err := s.saveToFile(data, filepath.Join(s.GetMachinesDir(), name, "config.json")); err != nil {
+			return "", err
+		}
+
+		return revision, nil
+	}
+
+	return "", ErrNoGoodRevision
+}
+
+// validateConfig makes sure that a config can be loaded by the current
+// version of machine.
+func validateConfig(name string, data []byte) (*host.Host, error) {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("Invalid JSON: %s", err)
+	}
+	if raw == nil {
+		return nil, errors.New("Empty config")
+	}
+
+	// The migration of old configs expects a driver.
+	if driver, ok := raw["Driver"]; !ok || driver == nil {
+		return nil, errors.New("Missing driver configuration")
+	}
+
+	h, _, err := host.MigrateHost(&host.Host{Name: name}, data)
+	if err != nil {
+		return nil, fmt.Errorf("Incompatible config: %s", err)
+	}
+
+	if len(h.RawDriver) == 0 {
+		return nil, errors.New("Missing driver configuration")
+	}
+
+	var rawDriver map[string]interface{}
+	if err := json.Unmarshal(h.RawDriver, &rawDriver); err != nil {
+		return nil, fmt.Errorf("Invalid driver configuration: %s", err)
+	}
+
+	if h.HostOptions == nil || h.HostOptions.AuthOptions == nil {
+		return nil, errors.New("Missing TLS configuration")
+	}
+
+	return h, nil
+}
+
+func checkCertPaths(h *host.Host) []string {
+	authOptions := h.HostOptions.AuthOptions
+
+	paths := []struct {
+		description string
+		path        string
+	}{
+		{"CA certificate", authOptions.CaCertPath},
+		{"CA private key", authOptions.CaPrivateKeyPath},
+		{"client certificate", authOptions.ClientCertPath},
+		{"client key", authOptions.ClientKeyPath},
+		{"server certificate", authOptions.ServerCertPath},
+		{"server key", authOptions.ServerKeyPath},
+	}
+
+	problems := []string{}
+	for _, p := range paths {
+		if p.path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(p.path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s is missing", p.description, p.path))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,111 @@
+package persist
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreSaveKeepsRevisions(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	store.Revisions = 2
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := store.Save(h); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	configPath := filepath.Join(store.GetMachinesDir(), h.Name, "config.json")
+
+	assert.Equal(t, []string{configPath + ".1", configPath + ".2"}, store.GetRevisions(h.Name))
+}
+
+func TestCheckAndRollbackTruncatedConfig(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	store.Revisions = 2
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	configPath := filepath.Join(store.GetMachinesDir(), h.Name, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"ConfigVersion": 3, "Dri`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := store.Check(h.Name)
+	assert.False(t, result.OK())
+	assert.Error(t, result.ConfigErr)
+
+	revision, err := store.Rollback(h.Name)
+	assert.NoError(t, err)
+	assert.Equal(t, configPath+".1", revision)
+
+	result = store.Check(h.Name)
+	assert.NoError(t, result.ConfigErr)
+
+	_, err = store.Load(h.Name)
+	assert.NoError(t, err)
+}
+
+func TestRollbackWithoutRevision(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.Rollback(h.Name)
+	assert.Equal(t, ErrNoGoodRevision, err)
+}
+
+func TestCheckMissingCertificates(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	result := store.Check(h.Name)
+
+	assert.NoError(t, result.ConfigErr)
+	assert.Equal(t, []string{
+		"CA certificate test-cert is missing",
+		"CA private key test-key is missing",
+	}, result.Problems)
+}
@@ -0,0 +1,176 @@
+package persist
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+const (
+	historyFile = "history.jsonl"
+
+	HistoryResultSuccess = "success"
+	HistoryResultError   = "error"
+)
+
+// HistoryRecord is an operation run against a machine.
+type HistoryRecord struct {
+	Time     time.Time
+	User     string
+	Command  string
+	Args     []string
+	Duration time.Duration
+	Result   string
+	Error    string `json:",omitempty"`
+}
+
+// HistoryStore is implemented by stores which keep an append-only history
+// of the operations run against their machines.
+type HistoryStore interface {
+	// AppendHistory adds a record to the history of a machine
+	AppendHistory(name string, record HistoryRecord) error
+
+	// History returns the history of a machine, oldest record first
+	History(name string) ([]HistoryRecord, error)
+}
+
+// NewHistoryRecord creates the record of a command which started at start
+// and returned err. The arguments are the ones of the running process, with
+// their secrets stripped.
+func NewHistoryRecord(command string, start time.Time, err error) HistoryRecord {
+	record := HistoryRecord{
+		Time:     start.UTC(),
+		User:     mcnutils.GetUsername(),
+		Command:  command,
+		Args:     log.StripSecrets(os.Args[1:]),
+		Duration: time.Since(start),
+		Result:   HistoryResultSuccess,
+	}
+
+	if err != nil {
+		record.Result = HistoryResultError
+		record.Error = log.StripSecrets([]string{err.Error()})[0]
+	}
+
+	return record
+}
+
+// RecordHistory records a command in the history of a machine, if the
+// store keeps one. Failing to is not worth failing the command for.
+func RecordHistory(s Store, name, command string, start time.Time, err error) {
+	historyStore, ok := s.(HistoryStore)
+	if !ok {
+		return
+	}
+
+	if err := historyStore.AppendHistory(name, NewHistoryRecord(command, start, err)); err != nil {
+		log.Debugf("Error recording %s in the history of %s: %s", command, name, err)
+	}
+}
+
+func (s Filestore) getHistoryPath(name string) string {
+	return filepath.Join(s.GetMachinesDir(), name, historyFile)
+}
+
+func (s Filestore) AppendHistory(name string, record HistoryRecord) error {
+	// Machines which failed before being saved have no history.
+	if _, err := os.Stat(filepath.Join(s.GetMachinesDir(), name)); os.IsNotExist(err) {
+		return nil
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(s.getHistoryPath(name), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	// A single write keeps concurrent appends from interleaving.
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (s Filestore) History(name string) ([]HistoryRecord, error) {
+	data, err := ioutil.ReadFile(s.getHistoryPath(name))
+	if os.IsNotExist(err) {
+		return []HistoryRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHistory(data)
+}
+
+func (s *RemoteStore) AppendHistory(name string, record HistoryRecord) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if exists, err := s.Exists(name); err != nil || !exists {
+		return err
+	}
+
+	data, err := s.Backend.Get(machineKey(name, historyFile))
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.Backend.Put(machineKey(name, historyFile), append(append(data, line...), '\n'))
+}
+
+func (s *RemoteStore) History(name string) ([]HistoryRecord, error) {
+	data, err := s.Backend.Get(machineKey(name, historyFile))
+	if err == ErrKeyNotFound {
+		return []HistoryRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return parseHistory(data)
+}
+
+// parseHistory parses the records of a history, skipping the ones which
+// can't be read such as a record cut short by a crash.
+func parseHistory(data []byte) ([]HistoryRecord, error) {
+	records := []HistoryRecord{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record HistoryRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Warnf("Skipping invalid history record on line %d: %s", line, err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
@@ -0,0 +1,85 @@
+package persist
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func testHistoryStore(t *testing.T, store Store) {
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Machines which were never saved have no history.
+	RecordHistory(store, h.Name, "create", time.Now(), errors.New("failed"))
+
+	assert.NoError(t, store.Save(h))
+
+	history, err := store.(HistoryStore).History(h.Name)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	log.RegisterSecret("t0ps3cret")
+	defer func(args []string) { os.Args = args }(os.Args)
+	os.Args = []string{"docker-machine", "create", "--token", "t0ps3cret", h.Name}
+
+	RecordHistory(store, h.Name, "create", time.Now(), nil)
+	RecordHistory(store, h.Name, "stop", time.Now(), errors.New("stopping failed: t0ps3cret"))
+
+	history, err = store.(HistoryStore).History(h.Name)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	assert.Equal(t, "create", history[0].Command)
+	assert.Equal(t, []string{"create", "--token", "<REDACTED>", h.Name}, history[0].Args)
+	assert.Equal(t, HistoryResultSuccess, history[0].Result)
+	assert.NotEmpty(t, history[0].User)
+
+	assert.Equal(t, "stop", history[1].Command)
+	assert.Equal(t, HistoryResultError, history[1].Result)
+	assert.Equal(t, "stopping failed: <REDACTED>", history[1].Error)
+}
+
+func TestFilestoreHistory(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	defer os.RemoveAll(store.Path)
+
+	testHistoryStore(t, store)
+
+	// A record cut short doesn't hide the others.
+	f, err := os.OpenFile(store.getHistoryPath(hosttest.DefaultHostName), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"Time": "2016`)
+	f.Close()
+
+	history, err := store.History(hosttest.DefaultHostName)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func TestRemoteStoreHistory(t *testing.T) {
+	defer cleanup()
+
+	backend, cleanupBackend := getTestBoltBackend(t)
+	defer cleanupBackend()
+
+	store, cleanupStore := getTestRemoteStore(t, backend)
+	defer cleanupStore()
+
+	testHistoryStore(t, store)
+
+	_, err := ioutil.ReadFile(store.cache.getHistoryPath(hosttest.DefaultHostName))
+	assert.True(t, os.IsNotExist(err), "the history is only kept in the backend")
+}
@@ -0,0 +1,379 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	httpKeyPath  = "/kv/"
+	httpListPath = "/keys"
+	httpLockPath = "/locks/"
+
+	// httpLockTTL is how long the server keeps a lock its client stopped
+	// renewing, e.g. because it was killed.
+	httpLockTTL = 30 * time.Second
+
+	httpLockPollInterval = 500 * time.Millisecond
+)
+
+var (
+	errKeyLocked = errors.New("Key is locked")
+)
+
+// HTTPBackend keeps a store on a store server, such as the one started by
+// "docker-machine store serve", so that a team can share its machines.
+// Credentials in the URL are sent with HTTP basic authentication.
+type HTTPBackend struct {
+	URL    *url.URL
+	Client *http.Client
+}
+
+func NewHTTPBackend(u *url.URL) *HTTPBackend {
+	return &HTTPBackend{
+		URL: u,
+		Client: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (b *HTTPBackend) do(method, path string, query url.Values, body []byte) ([]byte, error) {
+	u := *b.URL
+	u.User = nil
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	if b.URL.User != nil {
+		password, _ := b.URL.User.Password()
+		req.SetBasicAuth(b.URL.User.Username(), password)
+	}
+
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, ErrKeyNotFound
+	case resp.StatusCode == http.StatusConflict:
+		return data, errKeyLocked
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("Store server error on %s %s: %s %s", method, u.String(), resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	return data, nil
+}
+
+func (b *HTTPBackend) Get(key string) ([]byte, error) {
+	return b.do("GET", httpKeyPath+key, nil, nil)
+}
+
+func (b *HTTPBackend) Put(key string, value []byte) error {
+	_, err := b.do("PUT", httpKeyPath+key, nil, value)
+	return err
+}
+
+func (b *HTTPBackend) Delete(key string) error {
+	_, err := b.do("DELETE", httpKeyPath+key, nil, nil)
+	return err
+}
+
+func (b *HTTPBackend) List(prefix string) ([]string, error) {
+	data, err := b.do("GET", httpListPath, url.Values{"prefix": {prefix}}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("Invalid key list from store server: %s", err)
+	}
+
+	return keys, nil
+}
+
+// httpLockRequest takes or renews the lock of a key on a store server.
+type httpLockRequest struct {
+	Token  string
+	Shared bool
+	TTL    time.Duration
+	Info   LockInfo
+}
+
+// LockKey takes a lease on the lock of key from the store server, which is
+// renewed until it's released.
+func (b *HTTPBackend) LockKey(key string, shared bool, command string, timeout time.Duration) (func() error, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(httpLockRequest{
+		Token:  token,
+		Shared: shared,
+		TTL:    httpLockTTL,
+		Info: LockInfo{
+			Pid:     os.Getpid(),
+			Command: command,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		data, err := b.do("POST", httpLockPath+key, nil, body)
+		if err == nil {
+			break
+		}
+		if err != errKeyLocked {
+			return nil, err
+		}
+
+		if time.Now().After(deadline) {
+			var info LockInfo
+			json.Unmarshal(data, &info)
+			return nil, ErrLocked{
+				Pid:     info.Pid,
+				Command: info.Command,
+			}
+		}
+
+		time.Sleep(httpLockPollInterval)
+	}
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(httpLockTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := b.do("POST", httpLockPath+key, nil, body); err != nil {
+					log.Warnf("Error renewing the lock of %s on the store server: %s", key, err)
+				}
+			}
+		}
+	}()
+
+	return func() error {
+		close(stop)
+		<-stopped
+
+		_, err := b.do("DELETE", httpLockPath+key, url.Values{"token": {token}}, nil)
+		return err
+	}, nil
+}
+
+func randomToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
+
+// BackendHandler serves a Backend to HTTPBackend clients.
+type BackendHandler struct {
+	Backend Backend
+
+	// Username and Password, if set, are required from clients.
+	Username string
+	Password string
+
+	locksMu sync.Mutex
+	locks   map[string]map[string]*httpLease
+}
+
+// httpLease is a lock held by a client of a store server, until it expires
+// or is released.
+type httpLease struct {
+	shared  bool
+	info    LockInfo
+	expires time.Time
+}
+
+func (h *BackendHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Username != "" || h.Password != "" {
+		username, password, ok := r.BasicAuth()
+		if !ok || !secureEqual(username, h.Username) || !secureEqual(password, h.Password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="docker-machine"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	switch {
+	case r.URL.Path == httpListPath && r.Method == "GET":
+		h.list(w, r.URL.Query().Get("prefix"))
+	case strings.HasPrefix(r.URL.Path, httpKeyPath):
+		h.key(w, r, strings.TrimPrefix(r.URL.Path, httpKeyPath))
+	case strings.HasPrefix(r.URL.Path, httpLockPath):
+		h.lock(w, r, strings.TrimPrefix(r.URL.Path, httpLockPath))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *BackendHandler) list(w http.ResponseWriter, prefix string) {
+	keys, err := h.Backend.List(prefix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+func (h *BackendHandler) key(w http.ResponseWriter, r *http.Request, key string) {
+	var err error
+
+	switch r.Method {
+	case "GET":
+		var value []byte
+		if value, err = h.Backend.Get(key); err == nil {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(value)
+			return
+		}
+	case "PUT":
+		var value []byte
+		if value, err = ioutil.ReadAll(r.Body); err == nil {
+			err = h.Backend.Put(key, value)
+		}
+	case "DELETE":
+		err = h.Backend.Delete(key)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch err {
+	case nil:
+		w.WriteHeader(http.StatusNoContent)
+	case ErrKeyNotFound:
+		http.NotFound(w, r)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *BackendHandler) lock(w http.ResponseWriter, r *http.Request, key string) {
+	switch r.Method {
+	case "POST":
+		var req httpLockRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+			http.Error(w, "Invalid lock request", http.StatusBadRequest)
+			return
+		}
+
+		holder, ok := h.acquireLease(key, req)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(holder)
+			return
+		}
+	case "DELETE":
+		h.releaseLease(key, r.URL.Query().Get("token"))
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// acquireLease takes or renews a lock. It returns a client holding it
+// otherwise.
+func (h *BackendHandler) acquireLease(key string, req httpLockRequest) (LockInfo, bool) {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	if h.locks == nil {
+		h.locks = map[string]map[string]*httpLease{}
+	}
+
+	now := time.Now()
+	leases := h.locks[key]
+	for token, lease := range leases {
+		if now.After(lease.expires) {
+			delete(leases, token)
+		}
+	}
+
+	if lease, ok := leases[req.Token]; ok {
+		lease.expires = now.Add(req.TTL)
+		return LockInfo{}, true
+	}
+
+	for _, lease := range leases {
+		if !req.Shared || !lease.shared {
+			return lease.info, false
+		}
+	}
+
+	if leases == nil {
+		leases = map[string]*httpLease{}
+		h.locks[key] = leases
+	}
+
+	leases[req.Token] = &httpLease{
+		shared:  req.Shared,
+		info:    req.Info,
+		expires: now.Add(req.TTL),
+	}
+
+	return LockInfo{}, true
+}
+
+func (h *BackendHandler) releaseLease(key, token string) {
+	h.locksMu.Lock()
+	defer h.locksMu.Unlock()
+
+	delete(h.locks[key], token)
+	if len(h.locks[key]) == 0 {
+		delete(h.locks, key)
+	}
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
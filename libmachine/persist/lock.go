@@ -0,0 +1,322 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	// DefaultLockTimeout is how long we wait for a lock held by another
+	// process before giving up.
+	DefaultLockTimeout = 30 * time.Second
+
+	lockPollInterval = 100 * time.Millisecond
+)
+
+var (
+	heldLocksMu sync.Mutex
+	heldLocks   = map[string]*heldLock{}
+)
+
+// Locker is implemented by stores which can coordinate concurrent
+// docker-machine processes with advisory locks.
+type Locker interface {
+	// LockMachine takes the lock for a single machine
+	LockMachine(name string) (*Lock, error)
+
+	// LockStore takes the lock for the whole store. It excludes every
+	// machine lock, which hold the store lock shared.
+	LockStore() (*Lock, error)
+}
+
+// LockInfo is written to a lock file by the process holding it.
+type LockInfo struct {
+	Pid     int
+	Command string
+}
+
+type ErrLocked struct {
+	Name    string
+	Pid     int
+	Command string
+}
+
+func (e ErrLocked) Error() string {
+	if e.Name == "" {
+		// Machine locks hold the store lock shared and don't record
+		// their owner in it.
+		if e.Pid == 0 {
+			return "Machine store is in use by other docker-machine commands"
+		}
+		return fmt.Sprintf("Machine store is locked by pid %d running `%s`", e.Pid, e.Command)
+	}
+	return fmt.Sprintf("Machine %q is locked by pid %d running `%s`", e.Name, e.Pid, e.Command)
+}
+
+// Lock is an acquired advisory lock. Locks are reentrant within a process,
+// so nested acquisitions of the same lock (e.g. a command holding a machine
+// lock and then calling Save) do not block each other.
+type Lock struct {
+	path string
+
+	// store is the store lock a machine lock holds shared.
+	store *Lock
+}
+
+type heldLock struct {
+	file   *os.File
+	count  int
+	shared bool
+
+	// release releases the matching lock of a remote store.
+	release func() error
+}
+
+// lockRequest describes a lock to acquire.
+type lockRequest struct {
+	name    string
+	path    string
+	command string
+	timeout time.Duration
+	shared  bool
+
+	// remote, if set, takes the matching lock of a remote store once the
+	// local one is held. It's released along with it.
+	remote func() (func() error, error)
+}
+
+func (l *Lock) Unlock() error {
+	err := l.unlock()
+
+	if l.store != nil {
+		if storeErr := l.store.Unlock(); err == nil {
+			err = storeErr
+		}
+	}
+
+	return err
+}
+
+func (l *Lock) unlock() error {
+	heldLocksMu.Lock()
+
+	held, ok := heldLocks[l.path]
+	if !ok {
+		heldLocksMu.Unlock()
+		return nil
+	}
+
+	held.count--
+	if held.count > 0 {
+		heldLocksMu.Unlock()
+		return nil
+	}
+
+	delete(heldLocks, l.path)
+	heldLocksMu.Unlock()
+
+	// Remote locks may be local locks too, e.g. with bolt files.
+	var err error
+	if held.release != nil {
+		err = held.release()
+	}
+
+	// Clear the owner information so that a stale file never points
+	// at a process which no longer holds the lock.
+	if !held.shared {
+		held.file.Truncate(0)
+	}
+
+	if unlockErr := unlockFile(held.file); unlockErr != nil {
+		held.file.Close()
+		return unlockErr
+	}
+
+	if closeErr := held.file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// reuseHeldLock shares a lock this process already holds. A shared lock
+// can't be made exclusive, which would deadlock against other processes
+// doing the same. It must be called with heldLocksMu held.
+func reuseHeldLock(path string, shared bool) (*Lock, bool, error) {
+	held, ok := heldLocks[path]
+	if !ok {
+		return nil, false, nil
+	}
+
+	if held.shared && !shared {
+		return nil, true, fmt.Errorf("Error locking %s: it is already held shared by this process", path)
+	}
+
+	held.count++
+	return &Lock{path: path}, true, nil
+}
+
+// acquireLock takes a lock, either exclusive or shared. Only the holder of
+// an exclusive lock records itself in the lock file.
+func acquireLock(req lockRequest) (*Lock, error) {
+	heldLocksMu.Lock()
+	lock, ok, err := reuseHeldLock(req.path, req.shared)
+	heldLocksMu.Unlock()
+	if ok {
+		return lock, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(req.path), 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := lockFile(req.name, req.path, req.timeout, req.shared)
+	if err != nil {
+		return nil, err
+	}
+
+	if !req.shared {
+		if err := writeLockInfo(f, req.command); err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, err
+		}
+	}
+
+	var release func() error
+	if req.remote != nil {
+		if release, err = req.remote(); err != nil {
+			unlockFile(f)
+			f.Close()
+			return nil, err
+		}
+	}
+
+	heldLocksMu.Lock()
+
+	// Another goroutine of this process may have been waiting on the same
+	// lock, in which case it now shares ours.
+	if lock, ok, err := reuseHeldLock(req.path, req.shared); ok {
+		heldLocksMu.Unlock()
+		if release != nil {
+			release()
+		}
+		unlockFile(f)
+		f.Close()
+		return lock, err
+	}
+
+	heldLocks[req.path] = &heldLock{
+		file:    f,
+		count:   1,
+		shared:  req.shared,
+		release: release,
+	}
+	heldLocksMu.Unlock()
+
+	return &Lock{path: req.path}, nil
+}
+
+// lockFile opens and locks path, waiting up to timeout for other processes
+// to release it. Lock files are removed along with their machine, so the
+// file which was locked has to still be the one at path.
+func lockFile(name, path string, timeout time.Duration, shared bool) (*os.File, error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		locked, err := tryLockFile(f, shared)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("Error locking %s: %s", path, err)
+		}
+
+		if locked {
+			if isLockedPath(f, path) {
+				return f, nil
+			}
+
+			unlockFile(f)
+			f.Close()
+			continue
+		}
+
+		f.Close()
+
+		if time.Now().After(deadline) {
+			info := readLockInfo(path)
+			return nil, ErrLocked{
+				Name:    name,
+				Pid:     info.Pid,
+				Command: info.Command,
+			}
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
+
+func isLockedPath(f *os.File, path string) bool {
+	locked, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(locked, current)
+}
+
+// removeLockFile removes the lock file of a machine which is gone, while its
+// lock is held. A lock file left behind is harmless.
+func removeLockFile(path string) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		log.Debugf("Unable to remove %s: %s", path, err)
+	}
+}
+
+func writeLockInfo(f *os.File, command string) error {
+	data, err := json.Marshal(LockInfo{
+		Pid:     os.Getpid(),
+		Command: command,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+
+	_, err = f.WriteAt(data, 0)
+	return err
+}
+
+func readLockInfo(path string) LockInfo {
+	info := LockInfo{
+		Command: "unknown",
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return info
+	}
+
+	json.Unmarshal(data, &info)
+
+	return info
+}
@@ -0,0 +1,226 @@
+package persist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/mcnerror"
+)
+
+func TestLockMachineIsReentrant(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	lock, err := store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Save takes the lock again and must not block on ourselves.
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLockMachineHeldByOtherProcess(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	lockPath := filepath.Join(store.getLocksDir(), "test.lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second open file description behaves like another process
+	// holding the lock.
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	locked, err := tryLockFile(f, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("Expected to lock a fresh lock file")
+	}
+	if _, err := f.WriteString(`{"Pid":1234,"Command":"create"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.LockMachine("test")
+
+	expected := ErrLocked{Name: "test", Pid: 1234, Command: "create"}
+	if err != expected {
+		t.Fatalf("Expected error %v, got %v", expected, err)
+	}
+	if err.Error() != "Machine \"test\" is locked by pid 1234 running `create`" {
+		t.Fatalf("Unexpected error message: %s", err)
+	}
+
+	if err := unlockFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+}
+
+func TestLockStoreExcludesMachineLocks(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	store.LockTimeout = 0
+
+	storeLockPath := filepath.Join(store.getLocksDir(), ".store.lock")
+	if err := os.MkdirAll(filepath.Dir(storeLockPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another process taking a machine lock holds the store lock shared.
+	f, err := os.OpenFile(storeLockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	locked, err := tryLockFile(f, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !locked {
+		t.Fatal("Expected to lock a fresh lock file")
+	}
+
+	_, err = store.LockStore()
+	if err == nil || err.Error() != "Machine store is in use by other docker-machine commands" {
+		t.Fatalf("Expected the store to be in use, got %v", err)
+	}
+
+	// Machine locks share the store lock.
+	lock, err := store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+
+	if err := unlockFile(f); err != nil {
+		t.Fatal(err)
+	}
+
+	// And wait for the store lock held exclusively.
+	if locked, err := tryLockFile(f, false); err != nil || !locked {
+		t.Fatalf("Expected to lock the store, got %v", err)
+	}
+
+	if _, err := store.LockMachine("test"); err == nil {
+		t.Fatal("Expected the machine lock to wait for the store lock")
+	}
+
+	unlockFile(f)
+}
+
+func TestLockStoreWithMachineLocks(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	storeLock, err := store.LockStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The process holding the store lock can lock its machines.
+	lock, err := store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+	storeLock.Unlock()
+
+	lock, err = store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	// The store lock can't be taken once a machine lock holds it shared.
+	if _, err := store.LockStore(); err == nil {
+		t.Fatal("Expected an error upgrading the store lock")
+	}
+}
+
+func TestLockMachineInvalidName(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	if _, err := store.LockMachine("../test"); err != mcnerror.ErrInvalidHostname {
+		t.Fatalf("Expected an invalid hostname error, got %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(store.Path, "test.lock")); !os.IsNotExist(err) {
+		t.Fatal("Expected no lock file outside of the locks directory")
+	}
+}
+
+func TestRemoveRemovesLockFile(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save(h); err != nil {
+		t.Fatal(err)
+	}
+
+	lockPath := store.getMachineLockPath(h.Name)
+
+	// Another process waiting on the lock has the removed file open.
+	f, err := os.OpenFile(lockPath, os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := store.Remove(h.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the lock file to be removed, got %v", err)
+	}
+
+	if locked, err := tryLockFile(f, false); err != nil || !locked {
+		t.Fatalf("Expected to lock the removed file, got %v", err)
+	}
+	defer unlockFile(f)
+
+	// Which doesn't lock the machine anymore.
+	lock, err := store.LockMachine(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.Unlock()
+}
@@ -0,0 +1,347 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/mcnerror"
+)
+
+const (
+	// remoteStorePath replaces the local cache directory in the configs we
+	// send to a backend, since every client has its own cache.
+	remoteStorePath = "/$MACHINE_STORAGE_PATH"
+
+	// backendStoreLockKey is the key of the store lock in backends, machine
+	// locks use the key of their machine.
+	backendStoreLockKey = "store"
+)
+
+var (
+	ErrKeyNotFound = errors.New("Key not found")
+
+	// remoteMachineFiles and remoteCertFiles are the files that are kept
+	// in the backend along with the machine configs.
+	remoteMachineFiles = []string{"id_rsa", "id_rsa.pub", "server.pem", "server-key.pem", secretsFile}
+	remoteCertFiles    = []string{"ca.pem", "ca-key.pem", "cert.pem", "key.pem"}
+)
+
+// Backend is the key/value storage behind a remote store. Keys are slash
+// separated paths such as "machines/default/config.json".
+type Backend interface {
+	// Get returns the value of a key, or ErrKeyNotFound
+	Get(key string) ([]byte, error)
+
+	// Put sets the value of a key
+	Put(key string, value []byte) error
+
+	// Delete removes a key and all the keys below it
+	Delete(key string) error
+
+	// List returns the keys starting with prefix
+	List(prefix string) ([]string, error)
+}
+
+// BackendLocker is implemented by backends which can lock keys for all the
+// clients sharing them, so that they don't change a machine at the same
+// time.
+type BackendLocker interface {
+	// LockKey takes the lock of key, shared or exclusive, waiting up to
+	// timeout for other clients to release it. It returns ErrLocked if
+	// they don't, and how to release the lock otherwise.
+	LockKey(key string, shared bool, command string, timeout time.Duration) (func() error, error)
+}
+
+// LocalStore is implemented by stores which have a local directory for the
+// files of their machines, such as disk images written by drivers.
+type LocalStore interface {
+	GetMachinesDir() string
+}
+
+// RemoteStore keeps machines in a Backend. The configs, SSH keys and
+// certificates are mirrored to a local file store on load, because drivers,
+// provisioners and the Docker client need them on local disk. Locks are
+// taken in the backend as well if it's a BackendLocker, without which
+// clients on different hosts aren't kept from changing a machine at the
+// same time.
+type RemoteStore struct {
+	Backend Backend
+	cache   *Filestore
+}
+
+// NewRemoteStore creates a remote store and fetches the shared certificates
+// into its cache, so that we never generate a CA while the backend already
+// has one.
+func NewRemoteStore(backend Backend, cache *Filestore) (*RemoteStore, error) {
+	s := &RemoteStore{
+		Backend: backend,
+		cache:   cache,
+	}
+
+	if locker, ok := backend.(BackendLocker); ok {
+		cache.backend = locker
+	}
+
+	if err := s.pullFiles("certs", filepath.Join(cache.Path, "certs"), remoteCertFiles); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *RemoteStore) GetMachinesDir() string {
+	return s.cache.GetMachinesDir()
+}
+
+func (s *RemoteStore) LockMachine(name string) (*Lock, error) {
+	return s.cache.LockMachine(name)
+}
+
+func (s *RemoteStore) LockStore() (*Lock, error) {
+	return s.cache.LockStore()
+}
+
+func (s *RemoteStore) Close() error {
+	return s.cache.Close()
+}
+
+func (s *RemoteStore) Exists(name string) (bool, error) {
+	_, err := s.Backend.Get(machineKey(name, "config.json"))
+	if err == ErrKeyNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *RemoteStore) List() ([]string, error) {
+	keys, err := s.Backend.List("machines/")
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+
+	for _, key := range keys {
+		parts := strings.Split(key, "/")
+		if len(parts) != 3 || parts[2] != "config.json" || seen[parts[1]] {
+			continue
+		}
+
+		seen[parts[1]] = true
+		names = append(names, parts[1])
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (s *RemoteStore) Load(name string) (*host.Host, error) {
+	data, err := s.Backend.Get(machineKey(name, "config.json"))
+	if err == ErrKeyNotFound {
+		return nil, mcnerror.ErrHostDoesNotExist{
+			Name: name,
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = rebaseConfigPaths(data, remoteStorePath, s.cache.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	machineDir := filepath.Join(s.cache.GetMachinesDir(), name)
+	if err := s.pullFiles(machineKey(name, ""), machineDir, remoteMachineFiles); err != nil {
+		return nil, err
+	}
+
+	if err := s.pullFiles("certs", filepath.Join(s.cache.Path, "certs"), remoteCertFiles); err != nil {
+		return nil, err
+	}
+
+	if err := s.cache.saveToFile(data, filepath.Join(machineDir, "config.json")); err != nil {
+		return nil, err
+	}
+
+	return s.cache.Load(name)
+}
+
+func (s *RemoteStore) Save(h *host.Host) error {
+	lock, err := s.LockMachine(h.Name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := s.cache.Save(h); err != nil {
+		return err
+	}
+
+	// The cache has the config as saved, without the credentials.
+	machineDir := filepath.Join(s.cache.GetMachinesDir(), h.Name)
+
+	data, err := ioutil.ReadFile(filepath.Join(machineDir, "config.json"))
+	if err != nil {
+		return err
+	}
+
+	data, err = rebaseConfigPaths(data, s.cache.Path, remoteStorePath)
+	if err != nil {
+		return err
+	}
+
+	if err := s.pushFiles(machineKey(h.Name, ""), machineDir, remoteMachineFiles); err != nil {
+		return err
+	}
+
+	if err := s.pushFiles("certs", filepath.Join(s.cache.Path, "certs"), remoteCertFiles); err != nil {
+		return err
+	}
+
+	// The config goes last, a machine only shows up once its files are
+	// all in the backend.
+	return s.Backend.Put(machineKey(h.Name, "config.json"), data)
+}
+
+func (s *RemoteStore) Touch(name string) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := s.cache.Touch(name); err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.cache.GetMachinesDir(), name, "config.json"))
+	if err != nil {
+		return err
+	}
+
+	data, err = rebaseConfigPaths(data, s.cache.Path, remoteStorePath)
+	if err != nil {
+		return err
+	}
+
+	return s.Backend.Put(machineKey(name, "config.json"), data)
+}
+
+// ConfigStamp returns a hash of the config of a machine in the backend,
+// which has no modification times.
+func (s *RemoteStore) ConfigStamp(name string) (string, error) {
+	data, err := s.Backend.Get(machineKey(name, "config.json"))
+	if err == ErrKeyNotFound {
+		return "", mcnerror.ErrHostDoesNotExist{
+			Name: name,
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+func (s *RemoteStore) Remove(name string) error {
+	lock, err := s.LockMachine(name)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	if err := s.Backend.Delete(machineKey(name, "")); err != nil {
+		return err
+	}
+
+	return s.cache.Remove(name)
+}
+
+func (s *RemoteStore) Export(name string, w io.Writer, includeCerts bool) error {
+	if _, err := s.Load(name); err != nil {
+		return err
+	}
+
+	return s.cache.Export(name, w, includeCerts)
+}
+
+func (s *RemoteStore) Import(r io.Reader, force, newCerts bool) (string, error) {
+	name, err := s.cache.Import(r, force, newCerts)
+	if err != nil {
+		return "", err
+	}
+
+	h, err := s.cache.Load(name)
+	if err != nil {
+		return "", err
+	}
+
+	return name, s.Save(h)
+}
+
+func machineKey(name, file string) string {
+	return path.Join("machines", name, file)
+}
+
+// pullFiles writes the files found in the backend below prefix into dir,
+// leaving unchanged files alone.
+func (s *RemoteStore) pullFiles(prefix, dir string, files []string) error {
+	for _, file := range files {
+		data, err := s.Backend.Get(path.Join(prefix, file))
+		if err == ErrKeyNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		localPath := filepath.Join(dir, file)
+		if current, err := ioutil.ReadFile(localPath); err == nil && bytes.Equal(current, data) {
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+
+		if err := s.cache.saveToFile(data, localPath); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pushFiles sends the files of dir to the backend below prefix.
+func (s *RemoteStore) pushFiles(prefix, dir string, files []string) error {
+	for _, file := range files {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.Backend.Put(path.Join(prefix, file), data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package persist
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTestRemoteStore(t *testing.T, backend Backend) (*RemoteStore, func()) {
+	cache := getTestStore()
+
+	store, err := NewRemoteStore(backend, &cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store, func() { os.RemoveAll(cache.Path) }
+}
+
+func getTestBoltBackend(t *testing.T) (*BoltBackend, func()) {
+	dir, err := ioutil.TempDir("", "machine-bolt-")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewBoltBackend(filepath.Join(dir, "machines.db")), func() { os.RemoveAll(dir) }
+}
+
+func testRemoteStore(t *testing.T, backend Backend) {
+	writer, cleanupWriter := getTestRemoteStore(t, backend)
+	defer cleanupWriter()
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machineDir := filepath.Join(writer.GetMachinesDir(), h.Name)
+	h.HostOptions.AuthOptions.StorePath = machineDir
+	h.HostOptions.AuthOptions.ServerCertPath = filepath.Join(machineDir, "server.pem")
+
+	if err := os.MkdirAll(machineDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(machineDir, "id_rsa"), []byte("key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, writer.Save(h))
+
+	config, err := backend.Get(machineKey(h.Name, "config.json"))
+	assert.NoError(t, err)
+	assert.False(t, strings.Contains(string(config), writer.cache.Path), "the backend shouldn't know about local paths")
+
+	// Another client, with its own cache, sees the machine and its files.
+	reader, cleanupReader := getTestRemoteStore(t, backend)
+	defer cleanupReader()
+
+	exists, err := reader.Exists(h.Name)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+
+	names, err := reader.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{h.Name}, names)
+
+	loaded, err := reader.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	readerMachineDir := filepath.Join(reader.GetMachinesDir(), h.Name)
+	assert.Equal(t, readerMachineDir, loaded.HostOptions.AuthOptions.StorePath)
+	assert.Equal(t, filepath.Join(readerMachineDir, "server.pem"), loaded.HostOptions.AuthOptions.ServerCertPath)
+
+	key, err := ioutil.ReadFile(filepath.Join(readerMachineDir, "id_rsa"))
+	assert.NoError(t, err)
+	assert.Equal(t, "key", string(key))
+
+	assert.NoError(t, reader.Remove(h.Name))
+
+	_, err = writer.Load(h.Name)
+	assert.Equal(t, mcnerror.ErrHostDoesNotExist{Name: h.Name}, err)
+
+	names, err = writer.List()
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
+
+func TestRemoteStoreWithBolt(t *testing.T) {
+	defer cleanup()
+
+	backend, cleanupBackend := getTestBoltBackend(t)
+	defer cleanupBackend()
+
+	testRemoteStore(t, backend)
+}
+
+func TestRemoteStoreWithHTTP(t *testing.T) {
+	defer cleanup()
+
+	bolt, cleanupBackend := getTestBoltBackend(t)
+	defer cleanupBackend()
+
+	server := httptest.NewServer(&BackendHandler{
+		Backend:  bolt,
+		Username: "team",
+		Password: "secret",
+	})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := NewHTTPBackend(u)
+	_, err = backend.List("")
+	assert.Error(t, err, "the server should require credentials")
+
+	u.User = url.UserPassword("team", "secret")
+	testRemoteStore(t, NewHTTPBackend(u))
+}
+
+func TestRemoteStoreLocksBoltBackend(t *testing.T) {
+	defer cleanup()
+
+	backend, cleanupBackend := getTestBoltBackend(t)
+	defer cleanupBackend()
+
+	store, cleanupStore := getTestRemoteStore(t, backend)
+	defer cleanupStore()
+
+	lockPath := filepath.Join(backend.Path+".locks", "machines", "test.lock")
+	if err := os.MkdirAll(filepath.Dir(lockPath), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// A client on another host holds the lock of the machine.
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if locked, err := tryLockFile(f, false); err != nil || !locked {
+		t.Fatalf("Expected to lock a fresh lock file, got %v", err)
+	}
+	f.WriteString(`{"Pid":1234,"Command":"create"}`)
+
+	_, err = store.LockMachine("test")
+	assert.Equal(t, ErrLocked{Name: "test", Pid: 1234, Command: "create"}, err)
+
+	// The local lock isn't kept either.
+	local, err := os.OpenFile(store.cache.getMachineLockPath("test"), os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked, err := tryLockFile(local, false)
+	assert.NoError(t, err)
+	assert.True(t, locked)
+	unlockFile(local)
+	local.Close()
+
+	assert.NoError(t, unlockFile(f))
+
+	lock, err := store.LockMachine("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, lock.Unlock())
+}
+
+func TestHTTPBackendLocks(t *testing.T) {
+	bolt, cleanupBackend := getTestBoltBackend(t)
+	defer cleanupBackend()
+
+	server := httptest.NewServer(&BackendHandler{
+		Backend: bolt,
+	})
+	defer server.Close()
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client1 := NewHTTPBackend(u)
+	client2 := NewHTTPBackend(u)
+
+	unlock, err := client1.LockKey("machines/test", false, "create", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client2.LockKey("machines/test", false, "start", 0)
+	assert.Equal(t, ErrLocked{Pid: os.Getpid(), Command: "create"}, err)
+
+	// Shared locks are held together, exclusive ones wait for them.
+	unlockShared1, err := client1.LockKey("store", true, "create", 0)
+	assert.NoError(t, err)
+	unlockShared2, err := client2.LockKey("store", true, "start", 0)
+	assert.NoError(t, err)
+
+	_, err = client2.LockKey("store", false, "store fsck", 0)
+	assert.Error(t, err)
+
+	assert.NoError(t, unlock())
+	assert.NoError(t, unlockShared1())
+	assert.NoError(t, unlockShared2())
+
+	unlock, err = client2.LockKey("machines/test", false, "start", 0)
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestBackendHandlerLeaseExpires(t *testing.T) {
+	handler := &BackendHandler{}
+
+	_, ok := handler.acquireLease("machines/test", httpLockRequest{Token: "killed", TTL: time.Millisecond})
+	assert.True(t, ok)
+
+	holder, ok := handler.acquireLease("machines/test", httpLockRequest{Token: "other", TTL: time.Minute})
+	assert.False(t, ok)
+	assert.Equal(t, LockInfo{}, holder)
+
+	time.Sleep(10 * time.Millisecond)
+
+	_, ok = handler.acquireLease("machines/test", httpLockRequest{Token: "other", TTL: time.Minute})
+	assert.True(t, ok)
+}
+
+func TestNewStore(t *testing.T) {
+	store, err := NewStore("/tmp/machine", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.FromSlash("/tmp/machine/machines"), store.(LocalStore).GetMachinesDir())
+
+	store, err = NewStore("file:///tmp/machine", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.FromSlash("/tmp/machine/machines"), store.(LocalStore).GetMachinesDir())
+
+	_, err = NewStore("ftp://example.com/machine", Options{})
+	assert.EqualError(t, err, `Unsupported storage URL scheme "ftp"`)
+}
@@ -0,0 +1,190 @@
+package persist
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/mcnerror"
+)
+
+// Renamer is implemented by stores which can rename a machine.
+type Renamer interface {
+	// Rename moves a machine to a new name, along with the paths of its
+	// config which point into its directory
+	Rename(oldName, newName string) error
+}
+
+func (s Filestore) Rename(oldName, newName string) error {
+	if !host.ValidateHostName(newName) {
+		return mcnerror.ErrInvalidHostname
+	}
+
+	unlock, err := s.lockMachines(oldName, newName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if exists, err := s.Exists(oldName); err != nil {
+		return err
+	} else if !exists {
+		return mcnerror.ErrHostDoesNotExist{
+			Name: oldName,
+		}
+	}
+
+	if exists, err := s.Exists(newName); err != nil {
+		return err
+	} else if exists {
+		return mcnerror.ErrHostAlreadyExists{
+			Name: newName,
+		}
+	}
+
+	oldDir := filepath.Join(s.GetMachinesDir(), oldName)
+	newDir := filepath.Join(s.GetMachinesDir(), newName)
+
+	helper, err := s.credentialHelperOf(oldName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.moveSecrets(helper, oldName, newName); err != nil {
+		return fmt.Errorf("Error moving secrets: %s", err)
+	}
+
+	if err := os.Rename(oldDir, newDir); err != nil {
+		s.moveSecrets(helper, newName, oldName)
+		return err
+	}
+
+	for i, file := range s.machineConfigFiles(newName) {
+		data, err := ioutil.ReadFile(file)
+		if err == nil {
+			data, err = renameConfig(data, newName, oldDir, newDir)
+		}
+		if err == nil {
+			err = s.saveToFile(data, file)
+		}
+
+		if err == nil {
+			continue
+		}
+
+		// Revisions and backups which can't be read are left as they
+		// are, the machine can't be renamed without its config though.
+		if i > 0 {
+			log.Debugf("Unable to rename %s: %s", file, err)
+			continue
+		}
+
+		if err := os.Rename(newDir, oldDir); err != nil {
+			log.Warnf("Unable to move %s back to %s: %s", newDir, oldDir, err)
+		} else {
+			s.moveSecrets(helper, newName, oldName)
+		}
+		return fmt.Errorf("Error renaming config: %s", err)
+	}
+
+	removeLockFile(s.getMachineLockPath(oldName))
+	return nil
+}
+
+// lockMachines takes the locks of two machines, always in the same order.
+func (s Filestore) lockMachines(name1, name2 string) (func(), error) {
+	if name2 < name1 {
+		name1, name2 = name2, name1
+	}
+
+	lock1, err := s.LockMachine(name1)
+	if err != nil {
+		return nil, err
+	}
+
+	lock2, err := s.LockMachine(name2)
+	if err != nil {
+		lock1.Unlock()
+		return nil, err
+	}
+
+	return func() {
+		lock2.Unlock()
+		lock1.Unlock()
+	}, nil
+}
+
+// renameConfig sets the name of a machine in its config and moves the paths
+// of its config from its old directory to its new one.
+func renameConfig(data []byte, name, oldDir, newDir string) ([]byte, error) {
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	rebaseStrings(config, func(s string) string {
+		if p, ok := rebasePath(s, oldDir, newDir); ok {
+			return p
+		}
+		return s
+	})
+
+	config["Name"] = name
+	if driver, ok := config["Driver"].(map[string]interface{}); ok {
+		if _, ok := driver["MachineName"]; ok {
+			driver["MachineName"] = name
+		}
+	}
+
+	return json.MarshalIndent(config, "", "    ")
+}
+
+func (s *RemoteStore) Rename(oldName, newName string) error {
+	unlock, err := s.cache.lockMachines(oldName, newName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if exists, err := s.Exists(newName); err != nil {
+		return err
+	} else if exists {
+		return mcnerror.ErrHostAlreadyExists{
+			Name: newName,
+		}
+	}
+
+	// Bring the machine up to date in the cache, rename it there and push
+	// it back under its new name.
+	if _, err := s.Load(oldName); err != nil {
+		return err
+	}
+
+	if err := s.cache.Rename(oldName, newName); err != nil {
+		return err
+	}
+
+	h, err := s.cache.Load(newName)
+	if err != nil {
+		return err
+	}
+
+	if err := s.Save(h); err != nil {
+		return err
+	}
+
+	// The history is only kept in the backend.
+	history, err := s.Backend.Get(machineKey(oldName, historyFile))
+	if err == nil {
+		err = s.Backend.Put(machineKey(newName, historyFile), history)
+	}
+	if err != nil && err != ErrKeyNotFound {
+		return err
+	}
+
+	return s.Backend.Delete(machineKey(oldName, ""))
+}
@@ -0,0 +1,57 @@
+package persist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/docker/machine/libmachine/mcnerror"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreRename(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	defer os.RemoveAll(store.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldDir := filepath.Join(store.GetMachinesDir(), h.Name)
+	h.HostOptions.AuthOptions.StorePath = oldDir
+	h.HostOptions.AuthOptions.ServerCertPath = filepath.Join(oldDir, "server.pem")
+
+	assert.NoError(t, store.Save(h))
+
+	other, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Name = "other"
+	assert.NoError(t, store.Save(other))
+
+	assert.Equal(t, mcnerror.ErrHostAlreadyExists{Name: "other"}, store.Rename(h.Name, "other"))
+	assert.Equal(t, mcnerror.ErrInvalidHostname, store.Rename(h.Name, "-invalid"))
+	assert.Equal(t, mcnerror.ErrHostDoesNotExist{Name: "missing"}, store.Rename("missing", "renamed"))
+
+	assert.NoError(t, store.Rename(h.Name, "renamed"))
+
+	exists, err := store.Exists(h.Name)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	renamed, err := store.Load("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newDir := filepath.Join(store.GetMachinesDir(), "renamed")
+	assert.Equal(t, "renamed", renamed.Name)
+	assert.Equal(t, "renamed", renamed.Driver.GetMachineName())
+	assert.Equal(t, newDir, renamed.HostOptions.AuthOptions.StorePath)
+	assert.Equal(t, filepath.Join(newDir, "server.pem"), renamed.HostOptions.AuthOptions.ServerCertPath)
+}
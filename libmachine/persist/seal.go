@@ -0,0 +1,154 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	sealedStringPrefix = "sealed:"
+	sealedPEMType      = "MACHINE SEALED DATA"
+	sealKeySize        = 32
+)
+
+var (
+	ErrUnsealFailed = errors.New("Unable to decrypt secret, the store passphrase is wrong or the data was tampered with")
+
+	sealedPEMHeader = []byte("-----BEGIN " + sealedPEMType + "-----")
+)
+
+// Sealer encrypts and authenticates the secrets of an encrypted store with
+// AES-256-GCM. Sealed strings are prefixed with "sealed:" and sealed files
+// are PEM encoded, so both can be told apart from plaintext.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer creates a sealer from a 32 bytes key.
+func NewSealer(key []byte) (*Sealer, error) {
+	if len(key) != sealKeySize {
+		return nil, fmt.Errorf("Invalid store key size %d, expected %d", len(key), sealKeySize)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sealer{
+		aead: aead,
+	}, nil
+}
+
+// DeriveKey derives a store key from a passphrase, or from the content of
+// a key file, with scrypt.
+func DeriveKey(passphrase, salt []byte, n, r, p int) ([]byte, error) {
+	return scrypt.Key(passphrase, salt, n, r, p, sealKeySize)
+}
+
+func (s *Sealer) Seal(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return s.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (s *Sealer) Open(sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, ErrUnsealFailed
+	}
+
+	nonceSize := s.aead.NonceSize()
+	plaintext, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrUnsealFailed
+	}
+
+	return plaintext, nil
+}
+
+// SealString seals a config value, sealed values are returned as is.
+func (s *Sealer) SealString(value string) (string, error) {
+	if isSealedString(value) {
+		return value, nil
+	}
+
+	sealed, err := s.Seal([]byte(value))
+	if err != nil {
+		return "", err
+	}
+
+	return sealedStringPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// OpenString opens a config value, plaintext values are returned as is.
+func (s *Sealer) OpenString(value string) (string, error) {
+	if !isSealedString(value) {
+		return value, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, sealedStringPrefix))
+	if err != nil {
+		return "", ErrUnsealFailed
+	}
+
+	plaintext, err := s.Open(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// SealFile seals the content of a file such as a private key.
+func (s *Sealer) SealFile(content []byte) ([]byte, error) {
+	sealed, err := s.Seal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  sealedPEMType,
+		Bytes: sealed,
+	}), nil
+}
+
+// OpenFile opens the content of a sealed file, plaintext content is
+// returned as is.
+func (s *Sealer) OpenFile(content []byte) ([]byte, error) {
+	if !isSealedFile(content) {
+		return content, nil
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != sealedPEMType {
+		return nil, ErrUnsealFailed
+	}
+
+	return s.Open(block.Bytes)
+}
+
+func isSealedString(value string) bool {
+	return strings.HasPrefix(value, sealedStringPrefix)
+}
+
+func isSealedFile(content []byte) bool {
+	return bytes.HasPrefix(content, sealedPEMHeader)
+}
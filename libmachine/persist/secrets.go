@@ -0,0 +1,420 @@
+package persist
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+const (
+	secretsFile = "secrets.json"
+
+	credentialHelperPrefix   = "docker-credential-"
+	credentialHelperUsername = "docker-machine"
+)
+
+// machineSecrets is kept in the secrets file of a machine.
+type machineSecrets struct {
+	// Helper is the credential helper holding the secrets, they are in
+	// Values otherwise.
+	Helper string            `json:",omitempty"`
+	Values map[string]string `json:",omitempty"`
+}
+
+// CredentialHelper keeps secrets with a docker-credential-<Name> program,
+// such as the helpers the Docker CLI keeps registry credentials with.
+type CredentialHelper struct {
+	Name string
+}
+
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func (h CredentialHelper) run(action string, input []byte) ([]byte, error) {
+	cmd := exec.Command(credentialHelperPrefix+h.Name, action)
+	cmd.Stdin = bytes.NewReader(input)
+
+	output, err := cmd.Output()
+	if err != nil {
+		// Helpers report their errors on stdout.
+		return nil, fmt.Errorf("Error running %s%s %s: %s %s", credentialHelperPrefix, h.Name, action, err, strings.TrimSpace(string(output)))
+	}
+
+	return output, nil
+}
+
+func (h CredentialHelper) Store(serverURL, secret string) error {
+	input, err := json.Marshal(helperCredentials{
+		ServerURL: serverURL,
+		Username:  credentialHelperUsername,
+		Secret:    secret,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = h.run("store", input)
+	return err
+}
+
+func (h CredentialHelper) Get(serverURL string) (string, error) {
+	output, err := h.run("get", []byte(serverURL))
+	if err != nil {
+		return "", err
+	}
+
+	var credentials helperCredentials
+	if err := json.Unmarshal(output, &credentials); err != nil {
+		return "", fmt.Errorf("Invalid output from %s%s: %s", credentialHelperPrefix, h.Name, err)
+	}
+
+	return credentials.Secret, nil
+}
+
+func (h CredentialHelper) Erase(serverURL string) error {
+	_, err := h.run("erase", []byte(serverURL))
+	return err
+}
+
+func (s Filestore) getSecretsPath(name string) string {
+	return filepath.Join(s.GetMachinesDir(), name, secretsFile)
+}
+
+func (s Filestore) hasSecrets(name string) bool {
+	_, err := os.Stat(s.getSecretsPath(name))
+	return err == nil
+}
+
+// credentialURL identifies the secrets of a machine in a credential
+// helper. Machines of different stores can share a name.
+func (s Filestore) credentialURL(name string) string {
+	hash := sha1.Sum([]byte(s.Path))
+	return fmt.Sprintf("docker-machine://%x/%s", hash[:6], name)
+}
+
+func (s Filestore) readSecrets(name string) (*machineSecrets, error) {
+	data, err := ioutil.ReadFile(s.getSecretsPath(name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := &machineSecrets{}
+	if err := json.Unmarshal(data, secrets); err != nil {
+		return nil, fmt.Errorf("Invalid secrets file: %s", err)
+	}
+
+	return secrets, nil
+}
+
+// loadSecrets returns the secrets of a machine, fetched from its credential
+// helper if it has one.
+func (s Filestore) loadSecrets(name string, sealer *Sealer) (map[string]string, error) {
+	secrets, err := s.readSecrets(name)
+	if err != nil || secrets == nil {
+		return nil, err
+	}
+
+	values := map[string]string{}
+
+	if secrets.Helper != "" {
+		secret, err := CredentialHelper{secrets.Helper}.Get(s.credentialURL(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal([]byte(secret), &values); err != nil {
+			return nil, fmt.Errorf("Invalid secrets in credential helper %q: %s", secrets.Helper, err)
+		}
+
+		return values, nil
+	}
+
+	for field, value := range secrets.Values {
+		if sealer != nil {
+			if value, err = sealer.OpenString(value); err != nil {
+				return nil, err
+			}
+		}
+		values[field] = value
+	}
+
+	return values, nil
+}
+
+// mergeSecrets puts the secrets of a machine back into its config.
+func (s Filestore) mergeSecrets(name string, data []byte) ([]byte, error) {
+	if !s.hasSecrets(name) {
+		return data, nil
+	}
+
+	sealer, err := s.sealer()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := s.loadSecrets(name, sealer)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := decodeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for field, value := range values {
+		setConfigString(config, value, secretFieldPath(field)...)
+	}
+
+	return json.MarshalIndent(config, "", "    ")
+}
+
+// extractSecrets moves the credentials of a machine config out to the
+// secrets of the machine: the fields listed in the config as secret, and
+// the ones which were secret before.
+func (s Filestore) extractSecrets(name string, config map[string]interface{}, sealer *Sealer) error {
+	existing, err := s.readSecrets(name)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]bool{}
+	for _, field := range configSecretFields(config) {
+		fields[field] = true
+	}
+	if existing != nil {
+		for field := range existing.Values {
+			fields[field] = true
+		}
+	}
+
+	values := map[string]string{}
+	for field := range fields {
+		path := secretFieldPath(field)
+
+		value, ok := configString(config, path...)
+		if !ok || value == "" {
+			continue
+		}
+
+		values[field] = value
+		deleteConfigField(config, path...)
+	}
+
+	if len(values) == 0 {
+		return nil
+	}
+
+	secrets := &machineSecrets{
+		Helper: s.CredentialHelper,
+	}
+	if existing != nil {
+		secrets.Helper = existing.Helper
+	}
+
+	if secrets.Helper != "" {
+		secret, err := json.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		if err := (CredentialHelper{secrets.Helper}).Store(s.credentialURL(name), string(secret)); err != nil {
+			return err
+		}
+	} else {
+		if sealer != nil {
+			for field, value := range values {
+				if values[field], err = sealer.SealString(value); err != nil {
+					return err
+				}
+			}
+		}
+
+		secrets.Values = values
+	}
+
+	data, err := json.MarshalIndent(secrets, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return s.saveToFile(data, s.getSecretsPath(name))
+}
+
+// scrubSecrets removes the credentials of a machine from its config
+// revisions and migration backup, saved before they were moved out to its
+// secrets.
+func (s Filestore) scrubSecrets(name string, secretFields []string) error {
+	fields := append([]string{}, secretFields...)
+
+	existing, err := s.readSecrets(name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		for field := range existing.Values {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	// The first file is the config itself.
+	for _, file := range s.machineConfigFiles(name)[1:] {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		config, err := decodeConfig(data)
+		if err != nil {
+			// Broken configs are for fsck to deal with.
+			continue
+		}
+
+		changed := false
+		for _, field := range fields {
+			path := secretFieldPath(field)
+			if _, ok := configString(config, path...); ok {
+				deleteConfigField(config, path...)
+				changed = true
+			}
+		}
+
+		if !changed {
+			continue
+		}
+
+		if data, err = json.MarshalIndent(config, "", "    "); err != nil {
+			return err
+		}
+
+		if err := s.saveToFile(data, file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// eraseSecrets removes the secrets of a machine from its credential helper.
+// Failing to is not worth keeping the machine around.
+func (s Filestore) eraseSecrets(name string) {
+	secrets, err := s.readSecrets(name)
+	if err != nil || secrets == nil || secrets.Helper == "" {
+		return
+	}
+
+	if err := (CredentialHelper{secrets.Helper}).Erase(s.credentialURL(name)); err != nil {
+		log.Warnf("Unable to remove the secrets of %s from credential helper %q: %s", name, secrets.Helper, err)
+	}
+}
+
+// credentialHelperOf returns the credential helper the secrets of a machine
+// are kept in, if any.
+func (s Filestore) credentialHelperOf(name string) (string, error) {
+	secrets, err := s.readSecrets(name)
+	if err != nil || secrets == nil {
+		return "", err
+	}
+	return secrets.Helper, nil
+}
+
+// moveSecrets moves the secrets of a renamed machine to its new name in
+// its credential helper. The secrets file moves along with the machine
+// directory.
+func (s Filestore) moveSecrets(helperName, oldName, newName string) error {
+	if helperName == "" {
+		return nil
+	}
+
+	helper := CredentialHelper{helperName}
+
+	secret, err := helper.Get(s.credentialURL(oldName))
+	if err != nil {
+		return err
+	}
+
+	if err := helper.Store(s.credentialURL(newName), secret); err != nil {
+		return err
+	}
+
+	if err := helper.Erase(s.credentialURL(oldName)); err != nil {
+		log.Warnf("Unable to remove the secrets of %s from credential helper %q: %s", oldName, helperName, err)
+	}
+
+	return nil
+}
+
+// transformSecretsFile applies transform to the secrets kept in the
+// secrets file of a machine, credential helpers are left alone.
+func (s Filestore) transformSecretsFile(name string, transform func(string) (string, error)) error {
+	secrets, err := s.readSecrets(name)
+	if err != nil || secrets == nil || len(secrets.Values) == 0 {
+		return err
+	}
+
+	for field, value := range secrets.Values {
+		if secrets.Values[field], err = transform(value); err != nil {
+			return fmt.Errorf("Error with secret %s: %s", field, err)
+		}
+	}
+
+	data, err := json.MarshalIndent(secrets, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return s.saveToFile(data, s.getSecretsPath(name))
+}
+
+// configSecretFields returns the driver fields a machine config lists as
+// secret, the fields of the secret flags of its driver.
+func configSecretFields(config map[string]interface{}) []string {
+	fields := []string{}
+
+	list, _ := config["SecretFields"].([]interface{})
+	for _, field := range list {
+		if f, ok := field.(string); ok && f != "" {
+			fields = append(fields, f)
+		}
+	}
+
+	return fields
+}
+
+// secretFieldPath returns the path of a secret driver field in a machine
+// config.
+func secretFieldPath(field string) []string {
+	return append([]string{"Driver"}, strings.Split(field, ".")...)
+}
+
+func deleteConfigField(config map[string]interface{}, fields ...string) {
+	object := config
+
+	for _, field := range fields[:len(fields)-1] {
+		next, ok := object[field].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object = next
+	}
+
+	delete(object, fields[len(fields)-1])
+}
@@ -0,0 +1,102 @@
+package persist
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/drivers/none"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/hosttest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretsAreKeptOutOfConfig(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	defer os.RemoveAll(store.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.SecretFields = []string{"AccessToken", "Client.ApiKey"}
+	h.Driver = &host.RawDataDriver{
+		Driver: none.NewDriver(h.Name, store.Path),
+		Data:   []byte(`{"MachineName": "test-host", "AccessToken": "t0ps3cret", "Client": {"User": "user", "ApiKey": "k3y"}}`),
+	}
+
+	assert.NoError(t, store.Save(h))
+
+	machineDir := filepath.Join(store.GetMachinesDir(), h.Name)
+	config := readTestFile(t, filepath.Join(machineDir, "config.json"))
+	assert.NotContains(t, config, "t0ps3cret")
+	assert.NotContains(t, config, "k3y")
+	assert.Contains(t, config, `"User": "user"`)
+
+	secrets := readTestFile(t, filepath.Join(machineDir, secretsFile))
+	assert.Contains(t, secrets, "t0ps3cret")
+	assert.Contains(t, secrets, "k3y")
+
+	loaded, err := store.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Contains(t, string(loaded.RawDriver), "t0ps3cret")
+	assert.Contains(t, string(loaded.RawDriver), "k3y")
+
+	// Saving the loaded machine keeps the secrets out of its config.
+	assert.NoError(t, store.Save(loaded))
+	assert.NotContains(t, readTestFile(t, filepath.Join(machineDir, "config.json")), "t0ps3cret")
+
+	assert.NoError(t, store.Remove(h.Name))
+	_, err = os.Stat(filepath.Join(machineDir, secretsFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSecretsAreScrubbedFromRevisions(t *testing.T) {
+	defer cleanup()
+
+	store := getTestStore()
+	store.Revisions = 2
+	defer os.RemoveAll(store.Path)
+
+	h, err := hosttest.GetDefaultTestHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A machine saved before its driver had secret flags.
+	h.Driver = &host.RawDataDriver{
+		Driver: none.NewDriver(h.Name, store.Path),
+		Data:   []byte(`{"MachineName": "test-host", "AccessToken": "t0ps3cret"}`),
+	}
+
+	assert.NoError(t, store.Save(h))
+	assert.NoError(t, store.Save(h))
+
+	machineDir := filepath.Join(store.GetMachinesDir(), h.Name)
+	backupPath := filepath.Join(machineDir, "config.json.bak")
+	assert.NoError(t, ioutil.WriteFile(backupPath, []byte(readTestFile(t, filepath.Join(machineDir, "config.json"))), 0600))
+
+	h.SecretFields = []string{"AccessToken"}
+	assert.NoError(t, store.Save(h))
+
+	revisions := store.GetRevisions(h.Name)
+	assert.Len(t, revisions, 2)
+	for _, file := range append(revisions, backupPath) {
+		config := readTestFile(t, file)
+		assert.NotContains(t, config, "t0ps3cret")
+		assert.Contains(t, config, `"MachineName": "test-host"`)
+	}
+
+	loaded, err := store.Load(h.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(loaded.RawDriver), "t0ps3cret")
+}
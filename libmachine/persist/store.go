@@ -21,6 +21,22 @@ type Store interface {
 	Save(host *host.Host) error
 }
 
+// Toucher is implemented by stores which can record the use of a machine
+// without saving its whole config.
+type Toucher interface {
+	// Touch sets when a machine was last used to now. Unlike Save, it
+	// keeps no config revision.
+	Touch(name string) error
+}
+
+// Stamper is implemented by stores which can tell whether the config of a
+// machine changed without loading it.
+type Stamper interface {
+	// ConfigStamp returns a value which changes whenever the config of a
+	// machine is written.
+	ConfigStamp(name string) (string, error)
+}
+
 func LoadHosts(s Store, hostNames []string) ([]*host.Host, map[string]error) {
 	loadedHosts := []*host.Host{}
 	errors := map[string]error{}
@@ -0,0 +1,122 @@
+package persist
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/mcnutils"
+)
+
+var (
+	storeFactories = map[string]StoreFactory{
+		"file":  newFileStoreFromURL,
+		"bolt":  newBoltStoreFromURL,
+		"http":  newHTTPStoreFromURL,
+		"https": newHTTPStoreFromURL,
+	}
+
+	windowsDrivePath = regexp.MustCompile(`^/[a-zA-Z]:`)
+)
+
+// StoreFactory creates the store a storage URL points to. cache is a file
+// store in a local directory dedicated to that URL, which remote stores use
+// to keep the files drivers and the Docker client need on local disk.
+type StoreFactory func(u *url.URL, cache *Filestore) (Store, error)
+
+// Options configures the stores created by NewStore.
+type Options struct {
+	LockTimeout time.Duration
+	LockCommand string
+
+	// Passphrase unlocks encrypted stores, see Encryption.
+	Passphrase func() ([]byte, error)
+
+	// CredentialHelper keeps the driver credentials of new machines, see
+	// Filestore.
+	CredentialHelper string
+}
+
+// RegisterStoreFactory makes NewStore use factory for storage URLs with the
+// given scheme.
+func RegisterStoreFactory(scheme string, factory StoreFactory) {
+	storeFactories[scheme] = factory
+}
+
+// NewStore creates the store a storage path points to. Plain paths and
+// file:// URLs are file stores, other URL schemes select remote backends,
+// e.g. bolt:///path/to/machines.db or https://machines.example.com/team.
+func NewStore(storagePath string, options Options) (Store, error) {
+	if !strings.Contains(storagePath, "://") {
+		return newFilestoreWithOptions(storagePath, options), nil
+	}
+
+	u, err := url.Parse(storagePath)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid storage URL %q: %s", storagePath, err)
+	}
+
+	factory, ok := storeFactories[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported storage URL scheme %q", u.Scheme)
+	}
+
+	cachePath := storagePath
+	if u.Scheme != "file" {
+		cachePath = remoteCacheDir(u)
+	}
+
+	return factory(u, newFilestoreWithOptions(cachePath, options))
+}
+
+func newFilestoreWithOptions(path string, options Options) *Filestore {
+	certsDir := filepath.Join(path, "certs")
+
+	s := NewFilestore(path, certsDir, certsDir)
+	s.LockTimeout = options.LockTimeout
+	s.LockCommand = options.LockCommand
+	s.Encryption.Passphrase = options.Passphrase
+	s.CredentialHelper = options.CredentialHelper
+
+	return s
+}
+
+// remoteCacheDir returns the local directory used for the files of a remote
+// store. Credentials are left out so that they don't change the location.
+func remoteCacheDir(u *url.URL) string {
+	withoutUser := *u
+	withoutUser.User = nil
+
+	hash := sha1.Sum([]byte(withoutUser.String()))
+
+	return filepath.Join(mcnutils.GetHomeDir(), ".docker", "machine", "stores", fmt.Sprintf("%s-%x", u.Scheme, hash[:6]))
+}
+
+func urlPath(u *url.URL) string {
+	path := u.Host + u.Path
+	if windowsDrivePath.MatchString(path) {
+		path = path[1:]
+	}
+
+	return filepath.FromSlash(path)
+}
+
+func newFileStoreFromURL(u *url.URL, cache *Filestore) (Store, error) {
+	cache.Path = urlPath(u)
+	cache.CaCertPath = filepath.Join(cache.Path, "certs")
+	cache.CaPrivateKeyPath = cache.CaCertPath
+
+	return cache, nil
+}
+
+func newBoltStoreFromURL(u *url.URL, cache *Filestore) (Store, error) {
+	return NewRemoteStore(NewBoltBackend(urlPath(u)), cache)
+}
+
+func newHTTPStoreFromURL(u *url.URL, cache *Filestore) (Store, error) {
+	return NewRemoteStore(NewHTTPBackend(u), cache)
+}
@@ -72,7 +72,7 @@ func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
 		return err
 	}
 
-	if err := mcnutils.WaitFor(drivers.MachineInState(provisioner.Driver, state.Stopped)); err != nil {
+	if err := mcnutils.WaitForContext(drivers.Context(provisioner.Driver), drivers.MachineInState(provisioner.Driver, state.Stopped)); err != nil {
 		return err
 	}
 
@@ -92,7 +92,7 @@ func (provisioner *Boot2DockerProvisioner) upgradeIso() error {
 		return err
 	}
 
-	return mcnutils.WaitFor(drivers.MachineInState(provisioner.Driver, state.Running))
+	return mcnutils.WaitForContext(drivers.Context(provisioner.Driver), drivers.MachineInState(provisioner.Driver, state.Running))
 }
 
 func (provisioner *Boot2DockerProvisioner) Package(name string, action pkgaction.PackageAction) error {
@@ -132,6 +132,10 @@ func (provisioner *Boot2DockerProvisioner) GetSwarmOptions() swarm.Options {
 	return provisioner.SwarmOptions
 }
 
+func (provisioner *Boot2DockerProvisioner) GetEngineOptions() engine.Options {
+	return provisioner.EngineOptions
+}
+
 func (provisioner *Boot2DockerProvisioner) GenerateDockerOptions(dockerPort int) (*DockerOptions, error) {
 	var (
 		engineCfg bytes.Buffer
@@ -148,13 +152,16 @@ EXTRA_ARGS='
 {{ end }}{{ range .EngineOptions.ArbitraryFlags }}--{{.}}
 {{ end }}
 '
-CACERT={{.AuthOptions.CaCertRemotePath}}
+{{ if .EngineOptions.NoTLS }}DOCKER_HOST='-H unix:///var/run/docker.sock'
+DOCKER_STORAGE={{.EngineOptions.StorageDriver}}
+DOCKER_TLS=no
+{{ else }}CACERT={{.AuthOptions.CaCertRemotePath}}
 DOCKER_HOST='-H tcp://0.0.0.0:{{.DockerPort}}'
 DOCKER_STORAGE={{.EngineOptions.StorageDriver}}
 DOCKER_TLS=auto
 SERVERKEY={{.AuthOptions.ServerKeyRemotePath}}
 SERVERCERT={{.AuthOptions.ServerCertRemotePath}}
-
+{{ end }}
 {{range .EngineOptions.Env}}export \"{{ printf "%q" . }}\"
 {{end}}
 `
@@ -241,7 +248,12 @@ func (provisioner *Boot2DockerProvisioner) Provision(swarmOptions swarm.Options,
 
 	// b2d hosts need to wait for the daemon to be up
 	// before continuing with provisioning
-	if err = WaitForDocker(provisioner, engine.DefaultPort); err != nil {
+	if engineOptions.NoTLS {
+		err = WaitForDockerSocket(provisioner)
+	} else {
+		err = WaitForDocker(provisioner, engine.DefaultPort)
+	}
+	if err != nil {
 		return err
 	}
 
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcndockerclient"
@@ -53,6 +54,7 @@ func configureSwarm(p Provisioner, swarmOptions swarm.Options, authOptions auth.
 	dockerHost := &mcndockerclient.RemoteDocker{
 		HostURL:    fmt.Sprintf("tcp://%s:%d", ip, enginePort),
 		AuthOption: &authOptions,
+		JumpHosts:  drivers.SSHAuth(p.GetDriver()).JumpHosts,
 	}
 	advertiseInfo := fmt.Sprintf("%s:%d", ip, enginePort)
 
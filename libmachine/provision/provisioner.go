@@ -1,6 +1,7 @@
 package provision
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/docker/machine/libmachine/auth"
@@ -53,6 +54,9 @@ type Provisioner interface {
 	// Get the swarm options associated with this host.
 	GetSwarmOptions() swarm.Options
 
+	// Get the engine options the daemon is configured with.
+	GetEngineOptions() engine.Options
+
 	// Run a package action e.g. install
 	Package(name string, action pkgaction.PackageAction) error
 
@@ -100,6 +104,41 @@ func DetectProvisioner(d drivers.Driver) (Provisioner, error) {
 	return detector.DetectProvisioner(d)
 }
 
+// DetectProvisionerContext detects the provisioner of a machine with a
+// context. Once it's done, the SSH commands the provisioner runs and its
+// waits fail.
+func DetectProvisionerContext(ctx context.Context, d drivers.Driver) (Provisioner, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	provisioner, err := DetectProvisioner(drivers.WithContext(ctx, d))
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return provisioner, nil
+}
+
+// ProvisionContext provisions a machine with a provisioner detected with a
+// context. Once the context is done, the provisioner fails fast and is
+// waited for, so that nothing is left changing the machine or its files
+// once its creation is rolled back.
+func ProvisionContext(ctx context.Context, p Provisioner, swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	err := p.Provision(swarmOptions, authOptions, engineOptions)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
 func (detector StandardDetector) DetectProvisioner(d drivers.Driver) (Provisioner, error) {
 	log.Info("Waiting for SSH to be available...")
 	if err := drivers.WaitForSSH(d); err != nil {
@@ -0,0 +1,52 @@
+package provision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/drivers/fakedriver"
+	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/drivers"
+	"github.com/docker/machine/libmachine/engine"
+	"github.com/docker/machine/libmachine/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+// slowProvisioner keeps provisioning a bit after its context is done.
+type slowProvisioner struct {
+	FakeProvisioner
+	ctx  context.Context
+	done bool
+}
+
+func (p *slowProvisioner) Provision(swarmOptions swarm.Options, authOptions auth.Options, engineOptions engine.Options) error {
+	<-p.ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	p.done = true
+	return nil
+}
+
+func TestProvisionContextWaitsForProvisioner(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &slowProvisioner{ctx: ctx}
+
+	go cancel()
+	err := ProvisionContext(ctx, p, swarm.Options{}, auth.Options{}, engine.Options{})
+
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, p.done)
+}
+
+func TestWaitForDockerStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := NewDebianProvisioner(drivers.WithContext(ctx, &fakedriver.Driver{}))
+
+	start := time.Now()
+	err := WaitForDocker(p, 2376)
+
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 3*time.Second)
+}
@@ -1,6 +1,7 @@
 package provision
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -13,6 +14,7 @@ import (
 
 	"github.com/docker/machine/libmachine/auth"
 	"github.com/docker/machine/libmachine/cert"
+	"github.com/docker/machine/libmachine/drivers"
 	"github.com/docker/machine/libmachine/engine"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/mcnutils"
@@ -56,11 +58,85 @@ func setRemoteAuthOptions(p Provisioner) auth.Options {
 	return authOptions
 }
 
+// ConfigureAuth configures the daemon, with TLS on its TCP port unless it's
+// only to listen on its unix socket.
 func ConfigureAuth(p Provisioner) error {
-	var (
-		err error
-	)
+	noTLS := p.GetEngineOptions().NoTLS
+
+	if !noTLS {
+		if err := generateServerCert(p); err != nil {
+			return err
+		}
+	}
+
+	if err := p.Service("docker", serviceaction.Stop); err != nil {
+		return err
+	}
+
+	if _, err := p.SSHCommand(`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
+		return err
+	}
+
+	if !noTLS {
+		if err := uploadCerts(p); err != nil {
+			return err
+		}
+	}
+
+	dockerURL, err := p.GetDriver().GetURL()
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(dockerURL)
+	if err != nil {
+		return err
+	}
+	dockerPort := engine.DefaultPort
+	parts := strings.Split(u.Host, ":")
+	if len(parts) == 2 {
+		dPort, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return err
+		}
+		dockerPort = dPort
+	}
+
+	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Setting Docker configuration on the remote daemon...")
+
+	if _, err = p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s && printf %%s \"%s\" | sudo tee %s", path.Dir(dkrcfg.EngineOptionsPath), dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
+		return err
+	}
+
+	if err := p.Service("docker", serviceaction.Start); err != nil {
+		return err
+	}
+
+	if noTLS {
+		err = WaitForDockerSocket(p)
+	} else {
+		err = WaitForDocker(p, dockerPort)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Docker clients connecting over SSH, as set up by env --ssh, use the
+	// unix socket of the daemon as the SSH user.
+	if _, err := p.SSHCommand(DockerGroupCommand); err != nil {
+		return fmt.Errorf("Error adding the SSH user to the docker group: %s", err)
+	}
+
+	return nil
+}
 
+// generateServerCert copies the client certs to the machine directory and
+// generates the server cert of the machine.
+func generateServerCert(p Provisioner) error {
 	driver := p.GetDriver()
 	machineName := driver.GetMachineName()
 	authOptions := p.GetAuthOptions()
@@ -114,13 +190,12 @@ func ConfigureAuth(p Provisioner) error {
 		return fmt.Errorf("error generating server cert: %s", err)
 	}
 
-	if err := p.Service("docker", serviceaction.Stop); err != nil {
-		return err
-	}
+	return nil
+}
 
-	if _, err := p.SSHCommand(`if [ ! -z "$(ip link show docker0)" ]; then sudo ip link delete docker0; fi`); err != nil {
-		return err
-	}
+// uploadCerts copies the CA and the server cert of the machine to it.
+func uploadCerts(p Provisioner) error {
+	authOptions := p.GetAuthOptions()
 
 	// upload certs and configure TLS auth
 	caCert, err := ioutil.ReadFile(authOptions.CaCertPath)
@@ -156,40 +231,7 @@ func ConfigureAuth(p Provisioner) error {
 		return err
 	}
 
-	dockerURL, err := driver.GetURL()
-	if err != nil {
-		return err
-	}
-	u, err := url.Parse(dockerURL)
-	if err != nil {
-		return err
-	}
-	dockerPort := engine.DefaultPort
-	parts := strings.Split(u.Host, ":")
-	if len(parts) == 2 {
-		dPort, err := strconv.Atoi(parts[1])
-		if err != nil {
-			return err
-		}
-		dockerPort = dPort
-	}
-
-	dkrcfg, err := p.GenerateDockerOptions(dockerPort)
-	if err != nil {
-		return err
-	}
-
-	log.Info("Setting Docker configuration on the remote daemon...")
-
-	if _, err = p.SSHCommand(fmt.Sprintf("sudo mkdir -p %s && printf %%s \"%s\" | sudo tee %s", path.Dir(dkrcfg.EngineOptionsPath), dkrcfg.EngineOptions, dkrcfg.EngineOptionsPath)); err != nil {
-		return err
-	}
-
-	if err := p.Service("docker", serviceaction.Start); err != nil {
-		return err
-	}
-
-	return WaitForDocker(p, dockerPort)
+	return nil
 }
 
 func matchNetstatOut(reDaemonListening, netstatOut string) bool {
@@ -266,7 +308,33 @@ func checkDaemonUp(p Provisioner, dockerPort int) func() bool {
 }
 
 func WaitForDocker(p Provisioner, dockerPort int) error {
-	if err := mcnutils.WaitForSpecific(checkDaemonUp(p, dockerPort), 10, 3*time.Second); err != nil {
+	if err := mcnutils.WaitForSpecificContext(drivers.Context(p.GetDriver()), checkDaemonUp(p, dockerPort), 10, 3*time.Second); err != nil {
+		return NewErrDaemonAvailable(err)
+	}
+
+	return nil
+}
+
+// DockerGroupCommand adds the SSH user to the docker group, for the Docker
+// clients connecting over SSH to be allowed on the unix socket. It's run
+// once, when the daemon is configured.
+const DockerGroupCommand = "id -nG | grep -qw docker || sudo usermod -aG docker $(id -un)"
+
+// checkSocketUp tells whether the daemon answers on its unix socket.
+func checkSocketUp(p Provisioner) func() bool {
+	return func() bool {
+		if _, err := p.SSHCommand("sudo docker version"); err != nil {
+			log.Debugf("Error running SSH command: %s", err)
+			return false
+		}
+
+		return true
+	}
+}
+
+// WaitForDockerSocket waits for a daemon which doesn't listen on a TCP port.
+func WaitForDockerSocket(p Provisioner) error {
+	if err := mcnutils.WaitForSpecificContext(drivers.Context(p.GetDriver()), checkSocketUp(p), 10, 3*time.Second); err != nil {
 		return NewErrDaemonAvailable(err)
 	}
 
@@ -300,8 +368,13 @@ func waitForLockAptGetUpdate(ssh SSHCommander) error {
 }
 
 func waitForLock(ssh SSHCommander, cmd string) error {
+	ctx := context.Background()
+	if p, ok := ssh.(Provisioner); ok {
+		ctx = drivers.Context(p.GetDriver())
+	}
+
 	var sshErr error
-	err := mcnutils.WaitFor(func() bool {
+	err := mcnutils.WaitForContext(ctx, func() bool {
 		_, sshErr = ssh.SSHCommand(cmd)
 		if sshErr != nil {
 			if strings.Contains(sshErr.Error(), "Could not get lock") {
@@ -282,3 +282,36 @@ func TestDockerClientVersion(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateDockerOptionsNoTLS(t *testing.T) {
+	authOptions := auth.Options{
+		CaCertRemotePath:     "/test/ca-cert",
+		ServerKeyRemotePath:  "/test/server-key",
+		ServerCertRemotePath: "/test/server-cert",
+	}
+	engineOptions := engine.Options{NoTLS: true}
+
+	provisioners := []Provisioner{
+		&Boot2DockerProvisioner{
+			Driver:        &fakedriver.Driver{},
+			AuthOptions:   authOptions,
+			EngineOptions: engineOptions,
+		},
+		&fakeProvisioner{GenericProvisioner{
+			Driver:        &fakedriver.Driver{},
+			AuthOptions:   authOptions,
+			EngineOptions: engineOptions,
+		}},
+	}
+
+	for _, p := range provisioners {
+		dockerCfg, err := p.GenerateDockerOptions(engine.DefaultPort)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assert.Contains(t, dockerCfg.EngineOptions, "-H unix:///var/run/docker.sock")
+		assert.NotContains(t, dockerCfg.EngineOptions, "tcp://")
+		assert.NotContains(t, dockerCfg.EngineOptions, authOptions.ServerKeyRemotePath)
+	}
+}
@@ -0,0 +1,295 @@
+// Package sftp serves local files over SFTP with github.com/pkg/sftp,
+// confined to a directory, for the commands run on machines to reach them.
+package sftp
+
+import (
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+// Serve serves the files under root to an SFTP client over rwc, until the
+// client is gone. Paths are relative to the root, even absolute ones, and
+// symbolic links aren't followed out of it.
+func Serve(rwc io.ReadWriteCloser, root string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+
+	h := &rootHandlers{root: root}
+	server := sftp.NewRequestServer(rwc, sftp.Handlers{
+		FileGet:  h,
+		FilePut:  h,
+		FileCmd:  h,
+		FileList: h,
+	})
+	defer server.Close()
+
+	if err := server.Serve(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// rootHandlers handles the requests on the files under root.
+type rootHandlers struct {
+	root string
+}
+
+// localPath returns where a file is under the root, with the symbolic
+// links leading to it resolved. The last one is kept unless follow is set,
+// for requests on links themselves. Paths which lead out of the root are
+// refused.
+func (h *rootHandlers) localPath(name string, follow bool) (string, error) {
+	local := filepath.Join(h.root, filepath.FromSlash(path.Clean("/"+name)))
+	if local == h.root {
+		return local, nil
+	}
+
+	if follow {
+		resolved, err := filepath.EvalSymlinks(local)
+		if err == nil {
+			return resolved, h.checkUnderRoot(name, resolved)
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+
+		// A dangling link would be followed out of the root when the
+		// file is created.
+		if fi, err := os.Lstat(local); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return "", outsideRoot(name)
+		}
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(local))
+	if err != nil {
+		return "", err
+	}
+
+	resolved := filepath.Join(dir, filepath.Base(local))
+	return resolved, h.checkUnderRoot(name, resolved)
+}
+
+func (h *rootHandlers) checkUnderRoot(name, resolved string) error {
+	rel, err := filepath.Rel(h.root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return outsideRoot(name)
+	}
+	return nil
+}
+
+func outsideRoot(name string) error {
+	return &os.PathError{Op: "resolve", Path: name, Err: sftp.ErrSSHFxPermissionDenied}
+}
+
+// checkSymlink refuses the targets of symbolic links which lead out of the
+// root. They're kept relative to the link, absolute ones are refused.
+func checkSymlink(target, link string) error {
+	if path.IsAbs(target) || filepath.IsAbs(target) {
+		return outsideRoot(target)
+	}
+
+	dir := path.Dir(strings.TrimPrefix(path.Clean("/"+link), "/"))
+	if resolved := path.Join(dir, filepath.ToSlash(target)); resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return outsideRoot(target)
+	}
+	return nil
+}
+
+func (h *rootHandlers) Fileread(r *sftp.Request) (io.ReaderAt, error) {
+	local, err := h.localPath(r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(local)
+}
+
+func (h *rootHandlers) Filewrite(r *sftp.Request) (io.WriterAt, error) {
+	return h.OpenFile(r)
+}
+
+// OpenFile opens files for both reading and writing. Writes carry their
+// offset, appending is left to clients, as os.File can't write at an offset
+// in append mode.
+func (h *rootHandlers) OpenFile(r *sftp.Request) (sftp.WriterAtReaderAt, error) {
+	pflags := r.Pflags()
+
+	flag := os.O_WRONLY
+	if pflags.Read {
+		flag = os.O_RDWR
+	}
+	if pflags.Creat {
+		flag |= os.O_CREATE
+	}
+	if pflags.Trunc {
+		flag |= os.O_TRUNC
+	}
+	if pflags.Excl {
+		flag |= os.O_EXCL
+	}
+
+	local, err := h.localPath(r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+	return os.OpenFile(local, flag, 0644)
+}
+
+func (h *rootHandlers) Filecmd(r *sftp.Request) error {
+	switch r.Method {
+	case "Setstat":
+		local, err := h.localPath(r.Filepath, true)
+		if err != nil {
+			return err
+		}
+		return setstat(local, r)
+	case "Rename":
+		return h.rename(r.Filepath, r.Target)
+	case "Rmdir", "Remove":
+		local, err := h.localPath(r.Filepath, false)
+		if err != nil {
+			return err
+		}
+		return os.Remove(local)
+	case "Mkdir":
+		local, err := h.localPath(r.Filepath, false)
+		if err != nil {
+			return err
+		}
+		return os.Mkdir(local, 0755)
+	case "Symlink":
+		// The request has the target as its path and the link as its
+		// target.
+		if err := checkSymlink(r.Filepath, r.Target); err != nil {
+			return err
+		}
+		local, err := h.localPath(r.Target, false)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(r.Filepath, local)
+	}
+
+	return sftp.ErrSSHFxOpUnsupported
+}
+
+// PosixRename renames files as Rename does, replacing the target.
+func (h *rootHandlers) PosixRename(r *sftp.Request) error {
+	return h.rename(r.Filepath, r.Target)
+}
+
+// rename renames files and links themselves, not what links lead to.
+func (h *rootHandlers) rename(oldname, newname string) error {
+	oldLocal, err := h.localPath(oldname, false)
+	if err != nil {
+		return err
+	}
+	newLocal, err := h.localPath(newname, false)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldLocal, newLocal)
+}
+
+// setstat changes the attributes of a file, but not its owner: files are
+// served as the user running the server.
+func setstat(name string, r *sftp.Request) error {
+	flags, attrs := r.AttrFlags(), r.Attributes()
+	if flags.UidGid {
+		return &os.PathError{Op: "chown", Path: name, Err: sftp.ErrSSHFxPermissionDenied}
+	}
+	if flags.Size {
+		if err := os.Truncate(name, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := os.Chmod(name, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		if err := os.Chtimes(name, time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *rootHandlers) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
+	local, err := h.localPath(r.Filepath, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Method == "Stat" {
+		fi, err := os.Stat(local)
+		if err != nil {
+			return nil, err
+		}
+		return listerAt{fi}, nil
+	}
+
+	f, err := os.Open(local)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	entries, err := f.Readdir(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return listerAt(entries), nil
+}
+
+func (h *rootHandlers) Lstat(r *sftp.Request) (sftp.ListerAt, error) {
+	local, err := h.localPath(r.Filepath, false)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := os.Lstat(local)
+	if err != nil {
+		return nil, err
+	}
+	return listerAt{fi}, nil
+}
+
+func (h *rootHandlers) Readlink(name string) (string, error) {
+	local, err := h.localPath(name, false)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(local)
+}
+
+// listerAt lists files.
+type listerAt []os.FileInfo
+
+func (l listerAt) ListAt(entries []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+
+	n := copy(entries, l[offset:])
+	if n < len(entries) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,223 @@
+package sftp
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestClient returns a client of a server serving a new temporary
+// directory.
+func newTestClient(t *testing.T) (*sftp.Client, string, func()) {
+	root, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+
+	clientConn, serverConn := net.Pipe()
+
+	done := make(chan error)
+	go func() {
+		done <- Serve(serverConn, root)
+	}()
+
+	client, err := sftp.NewClientPipe(clientConn, clientConn)
+	assert.NoError(t, err)
+
+	return client, root, func() {
+		client.Close()
+		assert.NoError(t, <-done)
+		os.RemoveAll(root)
+	}
+}
+
+func TestWriteAndReadFile(t *testing.T) {
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	f, err := client.Create("/file")
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	local, err := ioutil.ReadFile(filepath.Join(root, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(local))
+
+	f, err = client.Open("file")
+	assert.NoError(t, err)
+	read, err := ioutil.ReadAll(f)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(read))
+	assert.NoError(t, f.Close())
+}
+
+func TestTruncateAndWriteAt(t *testing.T) {
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), []byte("hello world"), 0644))
+
+	f, err := client.OpenFile("/file", os.O_RDWR)
+	assert.NoError(t, err)
+	_, err = f.WriteAt([]byte("J"), 0)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Truncate(5))
+
+	fi, err := f.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), fi.Size())
+	assert.NoError(t, f.Close())
+
+	local, err := ioutil.ReadFile(filepath.Join(root, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "Jello", string(local))
+}
+
+func TestStatAndAttributes(t *testing.T) {
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "file"), []byte("hello"), 0600))
+
+	mtime := time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, client.Chmod("/file", 0640))
+	assert.NoError(t, client.Chtimes("/file", mtime, mtime))
+
+	fi, err := client.Stat("/file")
+	assert.NoError(t, err)
+	assert.Equal(t, "file", fi.Name())
+	assert.Equal(t, int64(5), fi.Size())
+	assert.Equal(t, os.FileMode(0640), fi.Mode())
+	assert.True(t, fi.ModTime().Equal(mtime))
+	assert.False(t, fi.IsDir())
+
+	_, err = client.Stat("/missing")
+	assert.True(t, os.IsNotExist(err), "%v", err)
+}
+
+func TestDirectories(t *testing.T) {
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	assert.NoError(t, client.MkdirAll("/a/b"))
+	assert.NoError(t, client.MkdirAll("/a/b"))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(root, "a", "file"), []byte("hello"), 0644))
+
+	fi, err := client.Stat("/a/b")
+	assert.NoError(t, err)
+	assert.True(t, fi.IsDir())
+
+	entries, err := client.ReadDir("/a")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "b", entries[0].Name())
+	assert.True(t, entries[0].IsDir())
+	assert.Equal(t, "file", entries[1].Name())
+	assert.Equal(t, int64(5), entries[1].Size())
+
+	assert.NoError(t, client.Rename("/a/file", "/a/b/renamed"))
+	assert.NoError(t, client.Remove("/a/b/renamed"))
+	assert.NoError(t, client.Remove("/a/b"))
+
+	entries, err = client.ReadDir("/a")
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPathsStayUnderRoot(t *testing.T) {
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	f, err := client.Create("/../../escaped")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	_, err = os.Stat(filepath.Join(root, "escaped"))
+	assert.NoError(t, err)
+
+	realPath, err := client.RealPath("a/../..")
+	assert.NoError(t, err)
+	assert.Equal(t, "/", realPath)
+}
+
+func TestSymlinksStayUnderRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on windows")
+	}
+
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	outside, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outside)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0600))
+
+	assert.NoError(t, os.Symlink(outside, filepath.Join(root, "out")))
+	assert.NoError(t, os.Symlink(filepath.Join(outside, "missing"), filepath.Join(root, "dangling")))
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "in"), 0755))
+	assert.NoError(t, os.Symlink("in", filepath.Join(root, "link")))
+
+	_, err = client.Open("/out/secret")
+	assert.True(t, os.IsPermission(err), "%v", err)
+	_, err = client.Stat("/out")
+	assert.True(t, os.IsPermission(err), "%v", err)
+	_, err = client.Create("/dangling")
+	assert.True(t, os.IsPermission(err), "%v", err)
+	assert.True(t, os.IsPermission(client.Rename("/out/secret", "/stolen")))
+	assert.True(t, os.IsPermission(client.Chmod("/out/secret", 0777)))
+	_, err = os.Stat(filepath.Join(outside, "missing"))
+	assert.True(t, os.IsNotExist(err))
+
+	fi, err := client.Lstat("/out")
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, fi.Mode()&os.ModeType)
+
+	f, err := client.Create("/link/file")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	_, err = os.Stat(filepath.Join(root, "in", "file"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Remove("/out"))
+	_, err = os.Stat(filepath.Join(outside, "secret"))
+	assert.NoError(t, err)
+}
+
+func TestSymlinkTargetsStayUnderRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links need privileges on windows")
+	}
+
+	client, root, cleanup := newTestClient(t)
+	defer cleanup()
+
+	assert.True(t, os.IsPermission(client.Symlink("/etc", "/etc")))
+	assert.True(t, os.IsPermission(client.Symlink("../..", "/a/up")))
+	assert.NoError(t, client.Mkdir("/a"))
+	assert.NoError(t, client.Symlink("..", "/a/up"))
+
+	target, err := os.Readlink(filepath.Join(root, "a", "up"))
+	assert.NoError(t, err)
+	assert.Equal(t, "..", target)
+}
+
+func TestSetstatRefusesOwners(t *testing.T) {
+	client, _, cleanup := newTestClient(t)
+	defer cleanup()
+
+	f, err := client.Create("/file")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	err = client.Chown("/file", 0, 0)
+
+	assert.True(t, os.IsPermission(err), "%v", err)
+}
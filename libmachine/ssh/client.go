@@ -10,6 +10,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/docker/docker/pkg/term"
 	"github.com/docker/machine/libmachine/log"
@@ -36,15 +37,18 @@ type Client interface {
 }
 
 type ExternalClient struct {
-	BaseArgs   []string
-	BinaryPath string
-	cmd        *exec.Cmd
+	BaseArgs    []string
+	BinaryPath  string
+	cmd         *exec.Cmd
+	controlPath string
 }
 
 type NativeClient struct {
 	Config      ssh.ClientConfig
 	Hostname    string
 	Port        int
+	JumpHosts   []JumpHost
+	poolKey     string
 	openSession *ssh.Session
 	openClient  *ssh.Client
 }
@@ -52,6 +56,13 @@ type NativeClient struct {
 type Auth struct {
 	Passwords []string
 	Keys      []string
+	// JumpHosts are the SSH servers the host is reached through, in order.
+	JumpHosts []JumpHost
+	// HostKey is the key the host must present, in the authorized_keys
+	// format. Any key is accepted if it's empty.
+	HostKey string
+	// KnownHostsFile is where the external client pins HostKey.
+	KnownHostsFile string
 }
 
 type ClientType string
@@ -93,6 +104,12 @@ func SetDefaultClient(clientType ClientType) {
 	}
 }
 
+// DefaultClient returns the type of client used when the ssh binary is
+// found.
+func DefaultClient() ClientType {
+	return defaultClientType
+}
+
 func NewClient(user string, host string, port int, auth *Auth) (Client, error) {
 	sshBinaryPath, err := exec.LookPath("ssh")
 	if err != nil {
@@ -122,9 +139,11 @@ func NewNativeClient(user, host string, port int, auth *Auth) (Client, error) {
 	}
 
 	return &NativeClient{
-		Config:   config,
-		Hostname: host,
-		Port:     port,
+		Config:    config,
+		Hostname:  host,
+		Port:      port,
+		JumpHosts: auth.JumpHosts,
+		poolKey:   fmt.Sprintf("%s@%s:%d %+v", user, host, port, *auth),
 	}, nil
 }
 
@@ -151,32 +170,61 @@ func NewNativeConfig(user string, auth *Auth) (ssh.ClientConfig, error) {
 		authMethods = append(authMethods, ssh.Password(p))
 	}
 
+	hostKeyCallback, err := hostKeyCallback(auth.HostKey)
+	if err != nil {
+		return ssh.ClientConfig{}, err
+	}
+
 	return ssh.ClientConfig{
 		User:            user,
 		Auth:            authMethods,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyCallback,
 	}, nil
 }
 
-func (client *NativeClient) dialSuccess() bool {
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
-	if err != nil {
-		log.Debugf("Error dialing TCP: %s", err)
-		return false
-	}
-	closeConn(conn)
-	return true
+func (client *NativeClient) dial() (*ssh.Client, error) {
+	return dial(net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config, client.JumpHosts)
+}
+
+// connect dials the host until it succeeds. A host key mismatch isn't
+// retried.
+func (client *NativeClient) connect() (*ssh.Client, error) {
+	var conn *ssh.Client
+
+	err := mcnutils.WaitForSpecificOrError(func() (bool, error) {
+		c, err := client.dial()
+		if err != nil {
+			if _, ok := err.(ErrHostKeyMismatch); ok {
+				return false, err
+			}
+			log.Debugf("Error dialing TCP: %s", err)
+			return false, nil
+		}
+		conn = c
+		return true, nil
+	}, 60, 3*time.Second)
+
+	return conn, err
 }
 
+// session opens a session on the pooled connection to the host if there's
+// one, otherwise on a new connection, which is pooled if pooling is on.
 func (client *NativeClient) session(command string) (*ssh.Client, *ssh.Session, error) {
-	if err := mcnutils.WaitFor(client.dialSuccess); err != nil {
-		return nil, nil, fmt.Errorf("Error attempting SSH client dial: %s", err)
+	if conn := connections.get(client.poolKey); conn != nil {
+		session, err := conn.NewSession()
+		if err == nil {
+			return conn, session, nil
+		}
+
+		log.Debugf("Lost the pooled SSH connection to %s: %s", client.Hostname, err)
+		connections.drop(client.poolKey, conn)
 	}
 
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
+	conn, err := client.connect()
 	if err != nil {
-		return nil, nil, fmt.Errorf("Mysterious error dialing TCP for SSH (we already succeeded at least once) : %s", err)
+		return nil, nil, fmt.Errorf("Error attempting SSH client dial: %s", err)
 	}
+	connections.put(client.poolKey, conn)
 	session, err := conn.NewSession()
 
 	return conn, session, err
@@ -187,7 +235,7 @@ func (client *NativeClient) Output(command string) (string, error) {
 	if err != nil {
 		return "", nil
 	}
-	defer closeConn(conn)
+	defer connections.done(client.poolKey, conn)
 	defer session.Close()
 
 	output, err := session.CombinedOutput(command)
@@ -200,7 +248,7 @@ func (client *NativeClient) OutputWithPty(command string) (string, error) {
 	if err != nil {
 		return "", nil
 	}
-	defer closeConn(conn)
+	defer connections.done(client.poolKey, conn)
 	defer session.Close()
 
 	fd := int(os.Stdout.Fd())
@@ -258,10 +306,7 @@ func (client *NativeClient) Wait() error {
 
 	_ = client.openSession.Close()
 
-	err = client.openClient.Close()
-	if err != nil {
-		return err
-	}
+	connections.done(client.poolKey, client.openClient)
 
 	client.openSession = nil
 	client.openClient = nil
@@ -272,7 +317,7 @@ func (client *NativeClient) Shell(args ...string) error {
 	var (
 		termWidth, termHeight int
 	)
-	conn, err := ssh.Dial("tcp", net.JoinHostPort(client.Hostname, strconv.Itoa(client.Port)), &client.Config)
+	conn, err := client.dial()
 	if err != nil {
 		return err
 	}
@@ -373,7 +418,26 @@ func NewExternalClient(sshBinaryPath, user, host string, port int, auth *Auth) (
 	// Set which port to use for SSH.
 	args = append(args, "-p", fmt.Sprintf("%d", port))
 
+	// Check the host key if it's pinned.
+	if auth.HostKey != "" && auth.KnownHostsFile != "" {
+		if err := WriteKnownHosts(auth.KnownHostsFile, host, port, auth.HostKey, auth.JumpHosts); err != nil {
+			return nil, fmt.Errorf("Error writing the known hosts file: %s", err)
+		}
+		args = CheckHostKeys(args, auth.KnownHostsFile)
+	}
+
+	// Go through the jump hosts, if any. Their keys are pinned along with
+	// the one of the host.
+	knownHostsFile := ""
+	if auth.HostKey != "" {
+		knownHostsFile = auth.KnownHostsFile
+	}
+	if proxyCommand := ProxyCommand(auth.JumpHosts, net.JoinHostPort(host, strconv.Itoa(port)), knownHostsFile); proxyCommand != "" {
+		args = append(args, "-o", "ProxyCommand="+proxyCommand)
+	}
+
 	client.BaseArgs = args
+	client.controlPath = connections.controlPath(args)
 
 	return client, nil
 }
@@ -382,15 +446,55 @@ func getSSHCmd(binaryPath string, args ...string) *exec.Cmd {
 	return exec.Command(binaryPath, args...)
 }
 
+// args returns the arguments of ssh to run a command on the host, through
+// the master connection to it if connections are pooled. The first command
+// starts the master connection, which stays in the background once it's
+// done.
+func (client *ExternalClient) args(command ...string) []string {
+	if client.controlPath == "" {
+		return append(append([]string{}, client.BaseArgs...), command...)
+	}
+
+	connections.master(client.controlPath, client)
+	return append(client.controlArgs("-o", "ControlMaster=auto", "-o", "ControlPersist="+controlPersist), command...)
+}
+
+// controlArgs returns the arguments of the client with multiplexing on,
+// ssh keeping the first value of an option.
+func (client *ExternalClient) controlArgs(extra ...string) []string {
+	args := []string{}
+	for i := 0; i < len(client.BaseArgs); i++ {
+		if client.BaseArgs[i] == "-o" && i+1 < len(client.BaseArgs) {
+			switch client.BaseArgs[i+1] {
+			case "ControlMaster=no", "ControlPath=none":
+				i++
+				continue
+			}
+		}
+		args = append(args, client.BaseArgs[i])
+	}
+
+	args = append(args, "-o", "ControlPath="+client.controlPath)
+	return append(args, extra...)
+}
+
+func (client *ExternalClient) stopMaster() {
+	args := client.controlArgs("-O", "exit")
+
+	if output, err := getSSHCmd(client.BinaryPath, args...).CombinedOutput(); err != nil {
+		log.Debugf("Error stopping the SSH master connection: %s: %s", err, output)
+	}
+}
+
 func (client *ExternalClient) Output(command string) (string, error) {
-	args := append(client.BaseArgs, command)
+	args := client.args(command)
 	cmd := getSSHCmd(client.BinaryPath, args...)
 	output, err := cmd.CombinedOutput()
 	return string(output), err
 }
 
 func (client *ExternalClient) Shell(args ...string) error {
-	args = append(client.BaseArgs, args...)
+	args = client.args(args...)
 	cmd := getSSHCmd(client.BinaryPath, args...)
 
 	log.Debug(cmd)
@@ -403,7 +507,7 @@ func (client *ExternalClient) Shell(args ...string) error {
 }
 
 func (client *ExternalClient) Start(command string) (io.ReadCloser, io.ReadCloser, error) {
-	args := append(client.BaseArgs, command)
+	args := client.args(command)
 	cmd := getSSHCmd(client.BinaryPath, args...)
 
 	log.Debug(cmd)
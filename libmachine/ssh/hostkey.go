@@ -0,0 +1,137 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	errHostKeyScanned = errors.New("host key scanned")
+)
+
+// ErrHostKeyMismatch is returned when a host presents another key than the
+// one pinned for it.
+type ErrHostKeyMismatch struct {
+	Address  string
+	Expected string
+	Actual   string
+}
+
+func (e ErrHostKeyMismatch) Error() string {
+	return fmt.Sprintf("The SSH host key of %s has changed, it was %s and is now %s. Someone could be intercepting the connection, or the machine was rebuilt, in which case run 'docker-machine ssh-keyscan --update' on it", e.Address, e.Expected, e.Actual)
+}
+
+// Fingerprint returns the SHA256 fingerprint of a host key in the
+// authorized_keys format, as ssh shows it.
+func Fingerprint(hostKey string) (string, error) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return "", fmt.Errorf("Error parsing the host key: %s", err)
+	}
+
+	return ssh.FingerprintSHA256(key), nil
+}
+
+// hostKeyCallback accepts any host key if none is pinned, otherwise only the
+// pinned one.
+func hostKeyCallback(hostKey string) (ssh.HostKeyCallback, error) {
+	if hostKey == "" {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(hostKey))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing the pinned host key: %s", err)
+	}
+
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if bytes.Equal(key.Marshal(), pinned.Marshal()) {
+			return nil
+		}
+
+		return ErrHostKeyMismatch{
+			Address:  hostname,
+			Expected: ssh.FingerprintSHA256(pinned),
+			Actual:   ssh.FingerprintSHA256(key),
+		}
+	}, nil
+}
+
+// ScanHostKey returns the key a host presents, in the authorized_keys
+// format. No authentication is attempted.
+func ScanHostKey(host string, port int, jumpHosts []JumpHost) (string, error) {
+	var hostKey ssh.PublicKey
+
+	config := &ssh.ClientConfig{
+		User: "docker-machine",
+		HostKeyCallback: func(_ string, _ net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errHostKeyScanned
+		},
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	client, err := dial(address, config, jumpHosts)
+	if client != nil {
+		closeConn(client)
+	}
+	if hostKey == nil {
+		return "", fmt.Errorf("Error getting the SSH host key of %s: %s", address, err)
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey))), nil
+}
+
+// knownHostsPattern returns how ssh names a host in known_hosts files.
+func knownHostsPattern(host string, port int) string {
+	if port == defaultSSHPort {
+		return host
+	}
+	return fmt.Sprintf("[%s]:%d", host, port)
+}
+
+// WriteKnownHosts writes a known_hosts file pinning the key of a host and
+// the ones of the jump hosts it's reached through, for the ssh binary to
+// check them.
+func WriteKnownHosts(path, host string, port int, hostKey string, jumpHosts []JumpHost) error {
+	lines := fmt.Sprintf("%s %s\n", knownHostsPattern(host, port), hostKey)
+	for _, jumpHost := range jumpHosts {
+		if jumpHost.HostKey != "" {
+			lines += fmt.Sprintf("%s %s\n", knownHostsPattern(jumpHost.Hostname, jumpHost.port()), jumpHost.HostKey)
+		}
+	}
+
+	return ioutil.WriteFile(path, []byte(lines), 0600)
+}
+
+// CheckHostKeys turns the options of the ssh binary which disable host key
+// checking into ones which check host keys against the known_hosts files.
+// The warnings of ssh are kept for a mismatch to be explained.
+func CheckHostKeys(args []string, knownHostsFiles ...string) []string {
+	quoted := []string{}
+	for _, file := range knownHostsFiles {
+		quoted = append(quoted, fmt.Sprintf("%q", file))
+	}
+
+	checked := []string{}
+	for _, arg := range args {
+		switch arg {
+		case "StrictHostKeyChecking=no":
+			arg = "StrictHostKeyChecking=yes"
+		case "UserKnownHostsFile=/dev/null":
+			arg = "UserKnownHostsFile=" + strings.Join(quoted, " ")
+		case "LogLevel=quiet":
+			arg = "LogLevel=error"
+		}
+		checked = append(checked, arg)
+	}
+
+	return checked
+}
@@ -0,0 +1,92 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestScanHostKey(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	host, port := server.Host()
+	hostKey, err := ScanHostKey(host, port, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(server.HostKey.PublicKey()))), hostKey)
+}
+
+func TestNativeClientChecksPinnedHostKey(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	host, port := server.Host()
+	hostKey, err := ScanHostKey(host, port, nil)
+	assert.NoError(t, err)
+
+	client, err := NewNativeClient("docker", host, port, &Auth{HostKey: hostKey})
+	assert.NoError(t, err)
+	conn, err := client.(*NativeClient).connect()
+	assert.NoError(t, err)
+	closeConn(conn)
+
+	otherKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"
+	client, err = NewNativeClient("docker", host, port, &Auth{HostKey: otherKey})
+	assert.NoError(t, err)
+	_, err = client.(*NativeClient).connect()
+	assert.Equal(t, ErrHostKeyMismatch{
+		Address:  server.Addr,
+		Expected: "SHA256:WanU0av6hrg2s3u4NvTgZIzMVAy1AT6TSRxQUjIa68Y",
+		Actual:   ssh.FingerprintSHA256(server.HostKey.PublicKey()),
+	}, err)
+}
+
+func TestWriteKnownHosts(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	hostKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"
+	path := filepath.Join(tmpDir, "known_hosts")
+
+	assert.NoError(t, WriteKnownHosts(path, "10.0.0.5", 22, hostKey, nil))
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "10.0.0.5 "+hostKey+"\n", string(content))
+
+	assert.NoError(t, WriteKnownHosts(path, "localhost", 2222, hostKey, nil))
+	content, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "[localhost]:2222 "+hostKey+"\n", string(content))
+
+	jumpHosts := []JumpHost{
+		{Hostname: "outer", User: "admin", HostKey: hostKey},
+		{Hostname: "inner", Port: 2222, User: "docker"},
+	}
+	assert.NoError(t, WriteKnownHosts(path, "10.0.0.5", 22, hostKey, jumpHosts))
+	content, _ = ioutil.ReadFile(path)
+	assert.Equal(t, "10.0.0.5 "+hostKey+"\nouter "+hostKey+"\n", string(content))
+}
+
+func TestCheckHostKeys(t *testing.T) {
+	args := []string{
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=quiet",
+		"-p", "22",
+	}
+
+	assert.Equal(t, []string{
+		"-o", "StrictHostKeyChecking=yes",
+		"-o", `UserKnownHostsFile="/machines/a/known_hosts" "/machines/b/known_hosts"`,
+		"-o", "LogLevel=error",
+		"-p", "22",
+	}, CheckHostKeys(args, "/machines/a/known_hosts", "/machines/b/known_hosts"))
+}
@@ -0,0 +1,260 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultSSHPort = 22
+)
+
+// JumpHost is an SSH server a host is reached through, as with ssh -J.
+type JumpHost struct {
+	Hostname string
+	Port     int `json:",omitempty"`
+	User     string
+	KeyPath  string `json:",omitempty"`
+
+	// HostKey is the key the jump host presented on first contact, in the
+	// authorized_keys format. Jump hosts pinned before it existed have
+	// none, their host key isn't checked.
+	HostKey string `json:",omitempty"`
+}
+
+// ParseJumpHost parses a jump host in the form user@host[:port].
+func ParseJumpHost(value string) (JumpHost, error) {
+	parts := strings.SplitN(value, "@", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return JumpHost{}, fmt.Errorf("Invalid jump host %q, expected user@host[:port]", value)
+	}
+
+	jumpHost := JumpHost{
+		User:     parts[0],
+		Hostname: parts[1],
+	}
+
+	if host, port, err := net.SplitHostPort(parts[1]); err == nil {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return JumpHost{}, fmt.Errorf("Invalid port in jump host %q", value)
+		}
+		jumpHost.Hostname = host
+		jumpHost.Port = int(p)
+	}
+
+	return jumpHost, nil
+}
+
+func (j JumpHost) port() int {
+	if j.Port == 0 {
+		return defaultSSHPort
+	}
+	return j.Port
+}
+
+func (j JumpHost) address() string {
+	return net.JoinHostPort(j.Hostname, strconv.Itoa(j.port()))
+}
+
+func (j JumpHost) String() string {
+	return fmt.Sprintf("%s@%s", j.User, j.address())
+}
+
+func (j JumpHost) config() (*ssh.ClientConfig, error) {
+	auth := &Auth{HostKey: j.HostKey}
+	if j.KeyPath != "" {
+		auth.Keys = []string{j.KeyPath}
+	}
+
+	config, err := NewNativeConfig(j.User, auth)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting the SSH config of the jump host %s: %s", j, err)
+	}
+
+	return &config, nil
+}
+
+// dial opens an SSH connection to address, through the jump hosts in order.
+// The connections to the jump hosts are closed along with it.
+func dial(address string, config *ssh.ClientConfig, jumpHosts []JumpHost) (*ssh.Client, error) {
+	hops := []*ssh.Client{}
+	closeHops := func() {
+		for i := len(hops) - 1; i >= 0; i-- {
+			closeConn(hops[i])
+		}
+	}
+
+	dialHop := func(address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+		if len(hops) == 0 {
+			return ssh.Dial("tcp", address, config)
+		}
+
+		conn, err := hops[len(hops)-1].Dial("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+
+		c, channels, requests, err := ssh.NewClientConn(conn, address, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		return ssh.NewClient(c, channels, requests), nil
+	}
+
+	for _, jumpHost := range jumpHosts {
+		jumpConfig, err := jumpHost.config()
+		if err != nil {
+			closeHops()
+			return nil, err
+		}
+
+		hop, err := dialHop(jumpHost.address(), jumpConfig)
+		if err != nil {
+			closeHops()
+			return nil, fmt.Errorf("Error connecting to the jump host %s: %s", jumpHost, err)
+		}
+		hops = append(hops, hop)
+	}
+
+	// A host key mismatch is returned as is, the SSH handshake only keeps
+	// its message.
+	var hostKeyErr error
+	checked := *config
+	checked.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyErr = config.HostKeyCallback(hostname, remote, key)
+		return hostKeyErr
+	}
+
+	client, err := dialHop(address, &checked)
+	if err != nil {
+		closeHops()
+		if hostKeyErr != nil {
+			return nil, hostKeyErr
+		}
+		return nil, err
+	}
+
+	if len(hops) > 0 {
+		go func() {
+			client.Wait()
+			closeHops()
+		}()
+	}
+
+	return client, nil
+}
+
+// jumpConn is a connection opened from a jump host, which closes the SSH
+// connection it goes through when it's closed.
+type jumpConn struct {
+	net.Conn
+	client *ssh.Client
+}
+
+func (c *jumpConn) Close() error {
+	err := c.Conn.Close()
+	closeConn(c.client)
+	return err
+}
+
+// DialThrough opens a connection to address, as seen from the last of the
+// jump hosts, or directly if there are none.
+func DialThrough(jumpHosts []JumpHost, network, address string) (net.Conn, error) {
+	if len(jumpHosts) == 0 {
+		return net.Dial(network, address)
+	}
+
+	last := jumpHosts[len(jumpHosts)-1]
+	config, err := last.config()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := dial(last.address(), config, jumpHosts[:len(jumpHosts)-1])
+	if err != nil {
+		return nil, fmt.Errorf("Error connecting to the jump host %s: %s", last, err)
+	}
+
+	conn, err := client.Dial(network, address)
+	if err != nil {
+		closeConn(client)
+		return nil, fmt.Errorf("Error connecting to %s from the jump host %s: %s", address, last, err)
+	}
+
+	return &jumpConn{Conn: conn, client: client}, nil
+}
+
+// PinJumpHostKeys returns the jump hosts with the keys they present pinned,
+// each one scanned through the ones before it. Keys which are already
+// pinned are kept.
+func PinJumpHostKeys(jumpHosts []JumpHost) ([]JumpHost, error) {
+	pinned := append([]JumpHost{}, jumpHosts...)
+
+	for i := range pinned {
+		if pinned[i].HostKey != "" {
+			continue
+		}
+
+		hostKey, err := ScanHostKey(pinned[i].Hostname, pinned[i].port(), pinned[:i])
+		if err != nil {
+			return nil, err
+		}
+		pinned[i].HostKey = hostKey
+	}
+
+	return pinned, nil
+}
+
+// ProxyCommand returns the ProxyCommand option which makes the ssh binary,
+// and the tools running it such as scp, rsync and sshfs, reach address
+// through the jump hosts. The address can use the %h and %p tokens of ssh.
+// Each jump host is reached with the ProxyCommand of the ones before it.
+// The pinned keys of the jump hosts are checked against knownHostsFile, as
+// written by WriteKnownHosts.
+func ProxyCommand(jumpHosts []JumpHost, address, knownHostsFile string) string {
+	if len(jumpHosts) == 0 {
+		return ""
+	}
+
+	last := jumpHosts[len(jumpHosts)-1]
+	args := []string{"ssh",
+		"-o", "StrictHostKeyChecking=no",
+		"-o", "UserKnownHostsFile=/dev/null",
+		"-o", "LogLevel=quiet",
+		"-p", strconv.Itoa(last.port()),
+	}
+
+	if last.HostKey != "" && knownHostsFile != "" {
+		args = []string{"ssh",
+			"-o", "StrictHostKeyChecking=yes",
+			"-o", ShellQuote("UserKnownHostsFile=" + knownHostsFile),
+			"-o", "LogLevel=error",
+			"-p", strconv.Itoa(last.port()),
+		}
+	}
+
+	if last.KeyPath != "" {
+		args = append(args, "-o", "IdentitiesOnly=yes", "-i", ShellQuote(last.KeyPath))
+	}
+
+	if previous := ProxyCommand(jumpHosts[:len(jumpHosts)-1], last.address(), knownHostsFile); previous != "" {
+		args = append(args, "-o", ShellQuote("ProxyCommand="+previous))
+	}
+
+	args = append(args, "-W", ShellQuote(address), ShellQuote(last.User+"@"+last.Hostname))
+
+	return strings.Join(args, " ")
+}
+
+// ShellQuote quotes a word for a POSIX shell, such as the one ssh runs
+// commands and its ProxyCommand with.
+func ShellQuote(word string) string {
+	return "'" + strings.Replace(word, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,166 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func jumpHostOf(server *sshtest.Server) JumpHost {
+	host, port := server.Host()
+	return JumpHost{Hostname: host, Port: port, User: "admin"}
+}
+
+func TestParseJumpHost(t *testing.T) {
+	jumpHost, err := ParseJumpHost("admin@bastion")
+	assert.NoError(t, err)
+	assert.Equal(t, JumpHost{Hostname: "bastion", User: "admin"}, jumpHost)
+	assert.Equal(t, "admin@bastion:22", jumpHost.String())
+
+	jumpHost, err = ParseJumpHost("admin@[fe80::1]:2222")
+	assert.NoError(t, err)
+	assert.Equal(t, JumpHost{Hostname: "fe80::1", Port: 2222, User: "admin"}, jumpHost)
+
+	_, err = ParseJumpHost("bastion")
+	assert.EqualError(t, err, `Invalid jump host "bastion", expected user@host[:port]`)
+
+	_, err = ParseJumpHost("admin@bastion:ssh")
+	assert.EqualError(t, err, `Invalid port in jump host "admin@bastion:ssh"`)
+}
+
+func TestProxyCommand(t *testing.T) {
+	jumpHosts := []JumpHost{
+		{Hostname: "outer", User: "admin", KeyPath: "/keys/it's"},
+		{Hostname: "inner", Port: 2222, User: "docker"},
+	}
+
+	assert.Empty(t, ProxyCommand(nil, "10.0.0.5:22", ""))
+	assert.Equal(t,
+		`ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=quiet -p 2222 `+
+			`-o 'ProxyCommand=ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=quiet -p 22 -o IdentitiesOnly=yes -i '\''/keys/it'\''\'\'''\''s'\'' -W '\''inner:2222'\'' '\''admin@outer'\''' `+
+			`-W '10.0.0.5:22' 'docker@inner'`,
+		ProxyCommand(jumpHosts, "10.0.0.5:22", "/machines/a/known_hosts"))
+}
+
+func TestProxyCommandChecksPinnedKeys(t *testing.T) {
+	jumpHosts := []JumpHost{
+		{Hostname: "bastion", User: "admin", HostKey: "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"},
+	}
+
+	assert.Equal(t,
+		`ssh -o StrictHostKeyChecking=yes -o 'UserKnownHostsFile=/machines/a/known_hosts' -o LogLevel=error -p 22 -W '10.0.0.5:22' 'admin@bastion'`,
+		ProxyCommand(jumpHosts, "10.0.0.5:22", "/machines/a/known_hosts"))
+	assert.Equal(t,
+		`ssh -o StrictHostKeyChecking=no -o UserKnownHostsFile=/dev/null -o LogLevel=quiet -p 22 -W '10.0.0.5:22' 'admin@bastion'`,
+		ProxyCommand(jumpHosts, "10.0.0.5:22", ""))
+}
+
+func TestPinJumpHostKeys(t *testing.T) {
+	outer, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer outer.Close()
+
+	inner, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer inner.Close()
+
+	jumpHosts, err := PinJumpHostKeys([]JumpHost{jumpHostOf(outer), jumpHostOf(inner)})
+
+	assert.NoError(t, err)
+	assert.Equal(t, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(outer.HostKey.PublicKey()))), jumpHosts[0].HostKey)
+	assert.Equal(t, strings.TrimSpace(string(ssh.MarshalAuthorizedKey(inner.HostKey.PublicKey()))), jumpHosts[1].HostKey)
+	assert.Equal(t, 1, inner.Connections())
+}
+
+func TestDialThroughChecksPinnedKeys(t *testing.T) {
+	jump, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer jump.Close()
+
+	echo := echoServer(t, "tcp", "127.0.0.1:0")
+	defer echo.Close()
+
+	jumpHost := jumpHostOf(jump)
+	jumpHost.HostKey = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIKjaj3mWSS6QZPTKyahLksu0H902F0MXNK3ICx92OSNe"
+
+	_, err = DialThrough([]JumpHost{jumpHost}, "tcp", echo.Addr().String())
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "The SSH host key of "+jump.Addr+" has changed")
+}
+
+func TestDialThrough(t *testing.T) {
+	outer, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer outer.Close()
+
+	inner, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer inner.Close()
+
+	echo := echoServer(t, "tcp", "127.0.0.1:0")
+	defer echo.Close()
+
+	conn, err := DialThrough([]JumpHost{jumpHostOf(outer), jumpHostOf(inner)}, "tcp", echo.Addr().String())
+	assert.NoError(t, err)
+
+	_, err = conn.Write([]byte("hello"))
+	assert.NoError(t, err)
+	closeWrite(conn.(*jumpConn).Conn)
+
+	reply, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(reply))
+	conn.Close()
+
+	assert.Equal(t, 1, outer.Connections())
+	assert.Equal(t, 1, inner.Connections())
+}
+
+func TestTunnelThroughJumpHost(t *testing.T) {
+	jump, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer jump.Close()
+
+	target, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer target.Close()
+
+	echo := echoServer(t, "tcp", "127.0.0.1:0")
+	defer echo.Close()
+
+	host, port := target.Host()
+	tunnel, err := NewTunnel("docker", host, port, &Auth{JumpHosts: []JumpHost{jumpHostOf(jump)}}, "tcp", echo.Addr().String())
+	assert.NoError(t, err)
+
+	client, err := tunnel.connect()
+	assert.NoError(t, err)
+	defer tunnel.Close()
+
+	conn, err := client.Dial("tcp", echo.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, 1, jump.Connections())
+	assert.Equal(t, 1, target.Connections())
+}
+
+func TestDialJumpHostUnreachable(t *testing.T) {
+	target, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer target.Close()
+
+	unreachable := JumpHost{Hostname: "127.0.0.1", Port: 1, User: "admin"}
+	config, err := NewNativeConfig("docker", &Auth{})
+	assert.NoError(t, err)
+
+	_, err = dial(target.Addr, &config, []JumpHost{unreachable})
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Error connecting to the jump host admin@127.0.0.1:1")
+	assert.Equal(t, 0, target.Connections())
+}
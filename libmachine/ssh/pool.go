@@ -0,0 +1,171 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// controlPersist is how long an idle master connection of the external
+	// client outlives the operation, should it not be stopped.
+	controlPersist = "60s"
+)
+
+// connectionPool keeps the SSH connections to hosts open while an operation
+// runs, for the many commands it runs on them to share one connection per
+// host: a multiplexed connection for the native client, a master connection
+// for the external client.
+type connectionPool struct {
+	mutex sync.Mutex
+	users int
+
+	clients map[string]*ssh.Client
+
+	controlDir string
+	masters    map[string]*ExternalClient
+}
+
+var connections = &connectionPool{}
+
+// PoolConnections shares the SSH connections to each host until the returned
+// function is called. Calls can be nested, connections are closed once the
+// outermost operation is done.
+func PoolConnections() func() {
+	connections.mutex.Lock()
+	defer connections.mutex.Unlock()
+
+	if connections.users == 0 {
+		connections.clients = map[string]*ssh.Client{}
+		connections.masters = map[string]*ExternalClient{}
+	}
+	connections.users++
+
+	var once sync.Once
+	return func() {
+		once.Do(connections.release)
+	}
+}
+
+func (p *connectionPool) release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.users--
+	if p.users > 0 {
+		return
+	}
+
+	for _, client := range p.clients {
+		closeConn(client)
+	}
+	p.clients = nil
+
+	for _, master := range p.masters {
+		master.stopMaster()
+	}
+	p.masters = nil
+
+	if p.controlDir != "" {
+		os.RemoveAll(p.controlDir)
+		p.controlDir = ""
+	}
+}
+
+// get returns the pooled connection for key, if there's one.
+func (p *connectionPool) get(key string) *ssh.Client {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.users == 0 || key == "" {
+		return nil
+	}
+	return p.clients[key]
+}
+
+// put pools a connection for key, unless pooling is off or another one
+// was pooled in the meantime.
+func (p *connectionPool) put(key string, client *ssh.Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.users == 0 || key == "" {
+		return
+	}
+	if _, ok := p.clients[key]; !ok {
+		p.clients[key] = client
+	}
+}
+
+// drop closes a pooled connection which was lost.
+func (p *connectionPool) drop(key string, client *ssh.Client) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.clients[key] == client {
+		delete(p.clients, key)
+	}
+	closeConn(client)
+}
+
+// done closes a connection once it's not needed anymore, unless it's
+// pooled.
+func (p *connectionPool) done(key string, client *ssh.Client) {
+	p.mutex.Lock()
+	pooled := p.users > 0 && key != "" && p.clients[key] == client
+	p.mutex.Unlock()
+
+	if !pooled {
+		closeConn(client)
+	}
+}
+
+// controlPath returns the socket of the master connection for the arguments
+// of an external client, none if pooling is off or not supported.
+func (p *connectionPool) controlPath(args []string) string {
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.users == 0 {
+		return ""
+	}
+
+	if p.controlDir == "" {
+		dir, err := ioutil.TempDir("", "machine-ssh-")
+		if err != nil {
+			log.Debugf("Error creating the directory of the SSH control sockets: %s", err)
+			return ""
+		}
+		p.controlDir = dir
+	}
+
+	// Socket paths are short, the name only has to tell hosts apart.
+	hash := sha256.Sum256([]byte(strings.Join(args, "\x00")))
+	return filepath.Join(p.controlDir, fmt.Sprintf("%x", hash[:8]))
+}
+
+// master registers the client of a master connection, for it to be stopped
+// once the operation is done.
+func (p *connectionPool) master(controlPath string, client *ExternalClient) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.masters == nil {
+		return
+	}
+	if _, ok := p.masters[controlPath]; !ok {
+		p.masters[controlPath] = client
+	}
+}
@@ -0,0 +1,172 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNativeClientWithoutPool(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	host, port := server.Host()
+	client, err := NewNativeClient("docker", host, port, &Auth{})
+	assert.NoError(t, err)
+
+	output, err := client.Output("uname")
+	assert.NoError(t, err)
+	assert.Equal(t, "uname", output)
+
+	_, err = client.Output("hostname")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, server.Connections())
+}
+
+func TestNativeClientSharesPooledConnection(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	closeConnections := PoolConnections()
+	defer closeConnections()
+
+	host, port := server.Host()
+	for _, command := range []string{"uname", "hostname", "date"} {
+		client, err := NewNativeClient("docker", host, port, &Auth{})
+		assert.NoError(t, err)
+
+		output, err := client.Output(command)
+		assert.NoError(t, err)
+		assert.Equal(t, command, output)
+	}
+
+	assert.Equal(t, 1, server.Connections())
+}
+
+func TestNativeClientReconnectsWhenPooledConnectionIsLost(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	closeConnections := PoolConnections()
+	defer closeConnections()
+
+	host, port := server.Host()
+	client, err := NewNativeClient("docker", host, port, &Auth{})
+	assert.NoError(t, err)
+
+	_, err = client.Output("uname")
+	assert.NoError(t, err)
+
+	server.DropConnections()
+
+	output, err := client.Output("hostname")
+	assert.NoError(t, err)
+	assert.Equal(t, "hostname", output)
+	assert.Equal(t, 2, server.Connections())
+}
+
+func TestPoolConnectionsNested(t *testing.T) {
+	outer := PoolConnections()
+	inner := PoolConnections()
+
+	inner()
+	inner()
+	assert.NotNil(t, connections.clients)
+
+	outer()
+	assert.Nil(t, connections.clients)
+}
+
+// fakeSSH returns an ssh binary which logs its arguments, one call per line.
+func fakeSSH(t *testing.T, dir string) (string, string) {
+	logFile := filepath.Join(dir, "calls")
+	binary := filepath.Join(dir, "ssh")
+	script := "#!/bin/sh\necho \"$@\" >> " + logFile + "\n"
+
+	assert.NoError(t, ioutil.WriteFile(binary, []byte(script), 0700))
+	return binary, logFile
+}
+
+func TestExternalClientSharesMasterConnection(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no master connections on windows")
+	}
+
+	dir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	binary, logFile := fakeSSH(t, dir)
+
+	closeConnections := PoolConnections()
+
+	for _, command := range []string{"uname", "hostname"} {
+		client, err := NewExternalClient(binary, "docker", "10.0.0.5", 22, &Auth{})
+		assert.NoError(t, err)
+
+		_, err = client.Output(command)
+		assert.NoError(t, err)
+	}
+
+	controlPath := connections.controlPath(append(baseSSHArgs, "docker@10.0.0.5", "-p", "22"))
+	closeConnections()
+
+	calls, err := ioutil.ReadFile(logFile)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(calls)), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasSuffix(lines[0], "-o ControlPath="+controlPath+" -o ControlMaster=auto -o ControlPersist=60s uname"))
+	assert.True(t, strings.HasSuffix(lines[1], "-o ControlPath="+controlPath+" -o ControlMaster=auto -o ControlPersist=60s hostname"))
+	assert.True(t, strings.HasSuffix(lines[2], "-o ControlPath="+controlPath+" -O exit"))
+	for _, line := range lines {
+		assert.NotContains(t, line, "ControlMaster=no")
+		assert.NotContains(t, line, "ControlPath=none")
+	}
+
+	_, err = os.Stat(filepath.Dir(controlPath))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestExternalClientMultiplexesWithSSH(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no master connections on windows")
+	}
+
+	binary, err := exec.LookPath("ssh")
+	if err != nil {
+		t.Skip("no ssh binary")
+	}
+
+	defer PoolConnections()()
+
+	client, err := NewExternalClient(binary, "docker", "10.0.0.5", 22, &Auth{})
+	assert.NoError(t, err)
+
+	// ssh -G prints the configuration ssh would use without connecting.
+	output, err := exec.Command(binary, append([]string{"-G"}, client.args("uname")...)...).Output()
+	assert.NoError(t, err)
+
+	config := string(output)
+	assert.Contains(t, config, "\ncontrolmaster auto\n")
+	assert.Contains(t, config, "\ncontrolpath "+client.controlPath+"\n")
+	assert.Contains(t, config, "\ncontrolpersist 60\n")
+}
+
+func TestExternalClientWithoutPool(t *testing.T) {
+	client, err := NewExternalClient("ssh", "docker", "10.0.0.5", 22, &Auth{})
+	assert.NoError(t, err)
+
+	assert.Equal(t, append(client.BaseArgs, "uname"), client.args("uname"))
+}
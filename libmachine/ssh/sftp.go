@@ -0,0 +1,149 @@
+package ssh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	sftpserver "github.com/docker/machine/libmachine/sftp"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpStopTimeout is how long a command served over SFTP has to exit once
+// it's stopped.
+const sftpStopTimeout = 10 * time.Second
+
+// sftpSession is the SSH session an SFTP client runs over. The client
+// closes it through its standard input.
+type sftpSession struct {
+	io.WriteCloser
+
+	client  *NativeClient
+	conn    *ssh.Client
+	session *ssh.Session
+}
+
+func (s *sftpSession) Close() error {
+	if s.WriteCloser != nil {
+		s.WriteCloser.Close()
+	}
+	err := s.session.Close()
+	connections.done(s.client.poolKey, s.conn)
+	return err
+}
+
+// sftpChannel is the standard input and output of a command served over
+// SFTP.
+type sftpChannel struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// NewSFTPClient returns an SFTP client of the host. It runs over the native
+// client, so that no external binary is needed.
+func NewSFTPClient(user, host string, port int, auth *Auth) (*sftp.Client, error) {
+	client, err := NewNativeClient(user, host, port, auth)
+	if err != nil {
+		return nil, err
+	}
+	nativeClient := client.(*NativeClient)
+
+	conn, session, err := nativeClient.session("sftp")
+	if err != nil {
+		return nil, err
+	}
+	s := &sftpSession{client: nativeClient, conn: conn, session: session}
+
+	if s.WriteCloser, err = session.StdinPipe(); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Error starting the SFTP subsystem on %s: %s", host, err)
+	}
+
+	sftpClient, err := sftp.NewClientPipe(stdout, s)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("Error starting the SFTP session on %s: %s", host, err)
+	}
+
+	return sftpClient, nil
+}
+
+// ServeSFTP serves the local files under root to a command run on the host
+// which speaks SFTP over its standard input and output, such as sshfs in
+// slave mode. It returns once the command exits, which it's asked to by
+// closing stop.
+func ServeSFTP(user, host string, port int, auth *Auth, command, root string, stop <-chan struct{}) error {
+	client, err := NewNativeClient(user, host, port, auth)
+	if err != nil {
+		return err
+	}
+	nativeClient := client.(*NativeClient)
+
+	conn, session, err := nativeClient.session(command)
+	if err != nil {
+		return err
+	}
+	defer connections.done(nativeClient.poolKey, conn)
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	stderr := &bytes.Buffer{}
+	session.Stderr = stderr
+
+	if err := session.Start(command); err != nil {
+		return err
+	}
+
+	go func() {
+		if err := sftpserver.Serve(sftpChannel{stdout, stdin}, root); err != nil {
+			log.Debugf("Error serving %s over SFTP: %s", root, err)
+		}
+	}()
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- session.Wait()
+	}()
+
+	select {
+	case err = <-exited:
+	case <-stop:
+		// The command exits once its SFTP connection is closed, it's
+		// killed along with the session if it doesn't.
+		stdin.Close()
+		select {
+		case err = <-exited:
+		case <-time.After(sftpStopTimeout):
+			return fmt.Errorf("Error stopping %q on %s: it didn't exit", command, host)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("Error running %q on %s: %s: %s", command, host, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
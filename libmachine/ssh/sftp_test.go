@@ -0,0 +1,141 @@
+package ssh
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func TestSFTPClient(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	host, port := server.Host()
+	client, err := NewSFTPClient("docker", host, port, &Auth{})
+	assert.NoError(t, err)
+
+	f, err := client.Create(filepath.ToSlash(filepath.Join(dir, "file")))
+	assert.NoError(t, err)
+	_, err = f.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+	assert.NoError(t, client.Close())
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(content))
+}
+
+func TestSFTPClientSharesPooledConnection(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	closeConnections := PoolConnections()
+	defer closeConnections()
+
+	host, port := server.Host()
+	for i := 0; i < 2; i++ {
+		client, err := NewSFTPClient("docker", host, port, &Auth{})
+		assert.NoError(t, err)
+
+		_, err = client.Stat("/")
+		assert.NoError(t, err)
+		assert.NoError(t, client.Close())
+	}
+
+	assert.Equal(t, 1, server.Connections())
+}
+
+func TestServeSFTP(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte("hello"), 0644))
+
+	var command, content string
+	server.Run = func(c string, stdin io.Reader, stdout io.Writer) int {
+		command = c
+
+		client, err := sftp.NewClientPipe(stdin, nopWriteCloser{stdout})
+		if err != nil {
+			return 1
+		}
+
+		f, err := client.Open("/file")
+		if err != nil {
+			return 1
+		}
+		defer f.Close()
+
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return 1
+		}
+		content = string(b)
+		return 0
+	}
+
+	host, port := server.Host()
+	err = ServeSFTP("docker", host, port, &Auth{}, "sshfs -o slave :/ /mnt", dir, nil)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "sshfs -o slave :/ /mnt", command)
+	assert.Equal(t, "hello", content)
+}
+
+func TestServeSFTPStopped(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	server.Run = func(c string, stdin io.Reader, stdout io.Writer) int {
+		io.Copy(ioutil.Discard, stdin)
+		return 0
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+
+	host, port := server.Host()
+	assert.NoError(t, ServeSFTP("docker", host, port, &Auth{}, "sshfs", "/", stop))
+}
+
+func TestServeSFTPCommandFails(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	server.Run = func(c string, stdin io.Reader, stdout io.Writer) int {
+		return 1
+	}
+
+	host, port := server.Host()
+	err = ServeSFTP("docker", host, port, &Auth{}, "sshfs", "/", nil)
+
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `Error running "sshfs" on 127.0.0.1: Process exited with status 1`)
+}
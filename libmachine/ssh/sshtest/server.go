@@ -0,0 +1,263 @@
+package sshtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/docker/machine/libmachine/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server is an SSH server listening on localhost which accepts any client
+// and forwards the connections they open to TCP addresses and unix sockets.
+// The sftp subsystem serves the local files.
+type Server struct {
+	Addr    string
+	HostKey ssh.Signer
+
+	// Run runs the commands of sessions and returns their exit status.
+	// Commands print themselves and succeed if it's nil.
+	Run func(command string, stdin io.Reader, stdout io.Writer) int
+
+	// HangRequests leaves the global requests of clients, such as
+	// keepalives, unanswered, as a stalled connection would.
+	HangRequests bool
+
+	config   *ssh.ServerConfig
+	listener net.Listener
+
+	mutex       sync.Mutex
+	conns       []net.Conn
+	connections int
+}
+
+type directTCPIPMsg struct {
+	Host       string
+	Port       uint32
+	OriginHost string
+	OriginPort uint32
+}
+
+type directStreamLocalMsg struct {
+	SocketPath string
+	Reserved0  string
+	Reserved1  uint32
+}
+
+// NewServer starts a server, which is stopped with Close.
+func NewServer() (*Server, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Addr:     listener.Addr().String(),
+		HostKey:  signer,
+		config:   config,
+		listener: listener,
+	}
+	go s.serve()
+
+	return s, nil
+}
+
+// Host returns the host and the port the server listens on.
+func (s *Server) Host() (string, int) {
+	host, port, _ := net.SplitHostPort(s.Addr)
+	p, _ := strconv.Atoi(port)
+	return host, p
+}
+
+// Connections returns the number of SSH connections the server accepted.
+func (s *Server) Connections() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.connections
+}
+
+// DropConnections closes the open SSH connections, as a network failure
+// would.
+func (s *Server) DropConnections() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+// Close stops the server and closes its connections.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.DropConnections()
+	return err
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mutex.Lock()
+		s.conns = append(s.conns, conn)
+		s.connections++
+		s.mutex.Unlock()
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	_, channels, requests, err := ssh.NewServerConn(conn, s.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	if s.HangRequests {
+		go func() {
+			for range requests {
+			}
+		}()
+	} else {
+		go ssh.DiscardRequests(requests)
+	}
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() == "session" {
+			go s.session(newChannel)
+			continue
+		}
+
+		network, address, err := target(newChannel)
+		if err != nil {
+			newChannel.Reject(ssh.UnknownChannelType, err.Error())
+			continue
+		}
+
+		go forward(newChannel, network, address)
+	}
+}
+
+func target(newChannel ssh.NewChannel) (string, string, error) {
+	switch newChannel.ChannelType() {
+	case "direct-tcpip":
+		msg := directTCPIPMsg{}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+			return "", "", err
+		}
+		return "tcp", net.JoinHostPort(msg.Host, strconv.Itoa(int(msg.Port))), nil
+	case "direct-streamlocal@openssh.com":
+		msg := directStreamLocalMsg{}
+		if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+			return "", "", err
+		}
+		return "unix", msg.SocketPath, nil
+	}
+
+	return "", "", fmt.Errorf("unsupported channel type %s", newChannel.ChannelType())
+}
+
+func (s *Server) session(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for req := range requests {
+		if req.Type == "subsystem" {
+			msg := struct{ Name string }{}
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil || msg.Name != "sftp" {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+
+			go ssh.DiscardRequests(requests)
+			sftp.Serve(channel, "/")
+			return
+		}
+
+		if req.Type != "exec" {
+			req.Reply(false, nil)
+			continue
+		}
+
+		msg := struct{ Command string }{}
+		if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, nil)
+
+		go ssh.DiscardRequests(requests)
+
+		status := 0
+		if s.Run != nil {
+			status = s.Run(msg.Command, channel, channel)
+		} else {
+			io.WriteString(channel, msg.Command)
+		}
+
+		channel.CloseWrite()
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+		return
+	}
+}
+
+func forward(newChannel ssh.NewChannel, network, address string) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(channel, conn)
+		channel.CloseWrite()
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(conn, channel)
+		if c, ok := conn.(interface {
+			CloseWrite() error
+		}); ok {
+			c.CloseWrite()
+		}
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
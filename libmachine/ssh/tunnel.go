@@ -0,0 +1,259 @@
+package ssh
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	defaultTunnelKeepAlive = 15 * time.Second
+)
+
+var (
+	errTunnelClosed = errors.New("The tunnel is closed")
+)
+
+// Tunnel forwards the connections accepted on a local listener to an address
+// on a remote host, a TCP address or a unix socket, through an SSH
+// connection which is opened again whenever it's lost.
+type Tunnel struct {
+	// KeepAlive is how often the SSH connection is checked, and reopened
+	// if it was lost.
+	KeepAlive time.Duration
+
+	config        ssh.ClientConfig
+	address       string
+	remoteNetwork string
+	remoteAddress string
+	jumpHosts     []JumpHost
+
+	mutex  sync.Mutex
+	client *ssh.Client
+	closed bool
+}
+
+// NewTunnel returns a tunnel to remoteAddress on remoteNetwork, "tcp" or
+// "unix", as seen from host.
+func NewTunnel(user, host string, port int, auth *Auth, remoteNetwork, remoteAddress string) (*Tunnel, error) {
+	if remoteNetwork != "tcp" && remoteNetwork != "unix" {
+		return nil, fmt.Errorf("Unsupported network %q to tunnel to", remoteNetwork)
+	}
+
+	config, err := NewNativeConfig(user, auth)
+	if err != nil {
+		return nil, fmt.Errorf("Error getting config for native Go SSH: %s", err)
+	}
+
+	return &Tunnel{
+		KeepAlive:     defaultTunnelKeepAlive,
+		config:        config,
+		address:       net.JoinHostPort(host, strconv.Itoa(port)),
+		remoteNetwork: remoteNetwork,
+		remoteAddress: remoteAddress,
+		jumpHosts:     auth.JumpHosts,
+	}, nil
+}
+
+// connect returns the SSH connection of the tunnel, opening it if needed.
+func (t *Tunnel) connect() (*ssh.Client, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.closed {
+		return nil, errTunnelClosed
+	}
+
+	if t.client != nil {
+		return t.client, nil
+	}
+
+	client, err := dial(t.address, &t.config, t.jumpHosts)
+	if err != nil {
+		return nil, fmt.Errorf("Error dialing SSH to %s: %s", t.address, err)
+	}
+
+	log.Debugf("Opened the SSH connection to %s", t.address)
+	t.client = client
+
+	return client, nil
+}
+
+// reset closes a lost SSH connection, for the next connect to open a new
+// one. It's a no-op if the connection was already replaced.
+func (t *Tunnel) reset(client *ssh.Client) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.client == client {
+		closeConn(client)
+		t.client = nil
+	}
+}
+
+// dialRemote opens a connection to the remote address. A failure to do so
+// on an existing SSH connection is retried once on a new one, the existing
+// one may have been lost without having been noticed yet.
+func (t *Tunnel) dialRemote() (net.Conn, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := t.connect()
+		if err != nil {
+			return nil, err
+		}
+
+		conn, err := client.Dial(t.remoteNetwork, t.remoteAddress)
+		if err == nil {
+			return conn, nil
+		}
+
+		if attempt > 0 {
+			return nil, fmt.Errorf("Error connecting to %s through the tunnel: %s", t.remoteAddress, err)
+		}
+		t.reset(client)
+	}
+}
+
+// keepAlive checks the SSH connection every KeepAlive, and reopens it
+// once it's lost or doesn't reply within KeepAlive.
+func (t *Tunnel) keepAlive(stop <-chan struct{}) {
+	ticker := time.NewTicker(t.KeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		t.mutex.Lock()
+		client := t.client
+		t.mutex.Unlock()
+
+		if client != nil {
+			if alive(client, t.KeepAlive) {
+				continue
+			}
+
+			log.Infof("Lost the SSH connection to %s, reconnecting...", t.address)
+			t.reset(client)
+		}
+
+		if _, err := t.connect(); err == errTunnelClosed {
+			return
+		} else if err != nil {
+			log.Debugf("%s", err)
+		}
+	}
+}
+
+// alive tells whether an SSH connection replies to a keepalive request in
+// time. A connection which stalled doesn't fail the request, the request
+// is left to fail once the connection is reset.
+func alive(client *ssh.Client, timeout time.Duration) bool {
+	replied := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+		replied <- err
+	}()
+
+	select {
+	case err := <-replied:
+		return err == nil
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// forward copies a local connection to a new remote one and back, until
+// both sides are done.
+func (t *Tunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.dialRemote()
+	if err != nil {
+		log.Warnf("Error forwarding a connection: %s", err)
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		closeWrite(remote)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		closeWrite(local)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface {
+		CloseWrite() error
+	}); ok {
+		c.CloseWrite()
+	}
+}
+
+// Serve forwards the connections accepted on listener until stop is
+// closed. The listener and the tunnel are closed once it returns.
+func (t *Tunnel) Serve(listener net.Listener, stop <-chan struct{}) error {
+	defer t.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stop:
+		case <-done:
+		}
+		listener.Close()
+	}()
+
+	go t.keepAlive(done)
+
+	// The SSH connection is opened early for errors to show up at once,
+	// not only on the first connection.
+	if _, err := t.connect(); err != nil {
+		log.Warnf("%s, retrying on the first connection", err)
+	}
+
+	for {
+		local, err := listener.Accept()
+		if err != nil {
+			select {
+			case <-stop:
+				return nil
+			default:
+				return err
+			}
+		}
+
+		go t.forward(local)
+	}
+}
+
+// Close closes the SSH connection of the tunnel, for good.
+func (t *Tunnel) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.closed = true
+	if t.client != nil {
+		closeConn(t.client)
+		t.client = nil
+	}
+}
@@ -0,0 +1,173 @@
+package ssh
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/machine/libmachine/ssh/sshtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func echoServer(t *testing.T, network, address string) net.Listener {
+	listener, err := net.Listen(network, address)
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return listener
+}
+
+func roundTrip(t *testing.T, network, address, message string) string {
+	conn, err := net.Dial(network, address)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(message))
+	assert.NoError(t, err)
+	closeWrite(conn)
+
+	reply, err := ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+
+	return string(reply)
+}
+
+func serveTunnel(t *testing.T, server *sshtest.Server, remoteNetwork, remoteAddress string, listener net.Listener) (stop chan struct{}, done chan error) {
+	host, port := server.Host()
+	tunnel, err := NewTunnel("docker", host, port, &Auth{}, remoteNetwork, remoteAddress)
+	assert.NoError(t, err)
+
+	stop = make(chan struct{})
+	done = make(chan error)
+	go func() {
+		done <- tunnel.Serve(listener, stop)
+	}()
+
+	return stop, done
+}
+
+func TestTunnelTCP(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	echo := echoServer(t, "tcp", "127.0.0.1:0")
+	defer echo.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	stop, done := serveTunnel(t, server, "tcp", echo.Addr().String(), listener)
+
+	assert.Equal(t, "hello", roundTrip(t, "tcp", listener.Addr().String(), "hello"))
+	assert.Equal(t, "again", roundTrip(t, "tcp", listener.Addr().String(), "again"))
+	assert.Equal(t, 1, server.Connections())
+
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestTunnelUnixSocket(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "machine-test-")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	remoteSocket := filepath.Join(tmpDir, "remote.sock")
+	echo := echoServer(t, "unix", remoteSocket)
+	defer echo.Close()
+
+	localSocket := filepath.Join(tmpDir, "docker.sock")
+	listener, err := net.Listen("unix", localSocket)
+	assert.NoError(t, err)
+
+	stop, done := serveTunnel(t, server, "unix", remoteSocket, listener)
+
+	assert.Equal(t, "hello", roundTrip(t, "unix", localSocket, "hello"))
+
+	close(stop)
+	assert.NoError(t, <-done)
+
+	// The socket is removed with the listener.
+	_, err = os.Stat(localSocket)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestTunnelReconnects(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+
+	echo := echoServer(t, "tcp", "127.0.0.1:0")
+	defer echo.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	stop, done := serveTunnel(t, server, "tcp", echo.Addr().String(), listener)
+
+	assert.Equal(t, "hello", roundTrip(t, "tcp", listener.Addr().String(), "hello"))
+
+	server.DropConnections()
+
+	assert.Equal(t, "again", roundTrip(t, "tcp", listener.Addr().String(), "again"))
+	assert.Equal(t, 2, server.Connections())
+
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestTunnelReconnectsStalledConnections(t *testing.T) {
+	server, err := sshtest.NewServer()
+	assert.NoError(t, err)
+	defer server.Close()
+	server.HangRequests = true
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	host, port := server.Host()
+	tunnel, err := NewTunnel("docker", host, port, &Auth{}, "tcp", "127.0.0.1:1")
+	assert.NoError(t, err)
+	tunnel.KeepAlive = 10 * time.Millisecond
+
+	stop := make(chan struct{})
+	done := make(chan error)
+	go func() {
+		done <- tunnel.Serve(listener, stop)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Connections() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.True(t, server.Connections() >= 2, "Expected the stalled connection to be reopened")
+
+	close(stop)
+	assert.NoError(t, <-done)
+}
+
+func TestNewTunnelUnsupportedNetwork(t *testing.T) {
+	_, err := NewTunnel("docker", "localhost", 22, &Auth{}, "udp", "localhost:53")
+
+	assert.EqualError(t, err, `Unsupported network "udp" to tunnel to`)
+}
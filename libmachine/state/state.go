@@ -1,5 +1,10 @@
 package state
 
+import (
+	"fmt"
+	"strings"
+)
+
 // State represents the state of a host
 type State int
 
@@ -34,3 +39,13 @@ func (s State) String() string {
 	}
 	return ""
 }
+
+// Parse returns the state of a name, such as "running".
+func Parse(name string) (State, error) {
+	for i, s := range states {
+		if s != "" && strings.EqualFold(s, name) {
+			return State(i), nil
+		}
+	}
+	return None, fmt.Errorf("Unknown state %q", name)
+}
@@ -15,3 +15,15 @@ func TestDaemonCreate(t *testing.T) {
 		t.Fatal("Error state should be 'Error'")
 	}
 }
+
+func TestParse(t *testing.T) {
+	if s, err := Parse("running"); err != nil || s != Running {
+		t.Fatalf("Expected Running, got %s, %v", s, err)
+	}
+	if _, err := Parse(""); err == nil {
+		t.Fatal("Expected an error for an empty state")
+	}
+	if _, err := Parse("Flying"); err == nil {
+		t.Fatal("Expected an error for an unknown state")
+	}
+}